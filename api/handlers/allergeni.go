@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strings"
+)
+
+// profiliAllergeni restituisce allergeni e diete delle pietanze con una ricetta attiva,
+// dalla cache o ricavati dalle ricette
+func profiliAllergeni(ctx context.Context, repo *repository.RicettaRepository) (map[int]*models.ProfiloAllergeni, error) {
+	profili, found, err := repo.Cache.GetProfiliAllergeni(ctx)
+	if err != nil {
+		log.Printf("Errore nell'accesso alla cache: %v", err)
+	} else if found {
+		return profili, nil
+	}
+
+	profili, err = repo.ProfiliAllergeni(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := repo.Cache.SetProfiliAllergeni(ctx, profili); err != nil {
+		log.Printf("Errore nell'aggiornamento della cache: %v", err)
+	}
+	return profili, nil
+}
+
+// applicaAllergeni completa le pietanze con allergeni e diete della ricetta attiva
+// Le pietanze senza ricetta restano senza, perché i loro allergeni non sono noti
+func applicaAllergeni(pietanze []models.Pietanza, profili map[int]*models.ProfiloAllergeni) {
+	for i := range pietanze {
+		pietanze[i].ProfiloAllergeni = profili[pietanze[i].ID]
+	}
+}
+
+// filtroAllergeni riporta gli allergeni da escludere (?senza=glutine,lattosio) e la dieta richiesta (?dieta=vegana)
+type filtroAllergeni struct {
+	Senza []string
+	Dieta string
+}
+
+// leggiFiltroAllergeni legge e valida i parametri senza e dieta della richiesta
+func leggiFiltroAllergeni(r *http.Request) (filtroAllergeni, error) {
+	var filtro filtroAllergeni
+	if s := r.URL.Query().Get("senza"); s != "" {
+		for _, a := range strings.Split(s, ",") {
+			a = strings.ToLower(strings.TrimSpace(a))
+			if !models.AllergeneValido(a) {
+				return filtro, fmt.Errorf("allergene non valido: %q", a)
+			}
+			filtro.Senza = append(filtro.Senza, a)
+		}
+	}
+	if d := r.URL.Query().Get("dieta"); d != "" {
+		filtro.Dieta = strings.ToLower(strings.TrimSpace(d))
+		if !models.DietaValida(filtro.Dieta) {
+			return filtro, fmt.Errorf("dieta non valida: %q (vegetariana, vegana, senza_glutine)", d)
+		}
+	}
+	return filtro, nil
+}
+
+// attivo indica se la richiesta filtra per allergeni o dieta
+func (f filtroAllergeni) attivo() bool {
+	return len(f.Senza) > 0 || f.Dieta != ""
+}
+
+// filtra tiene le pietanze prive degli allergeni indicati e compatibili con la dieta;
+// quelle senza ricetta sono escluse perché non se ne conoscono gli allergeni
+func (f filtroAllergeni) filtra(pietanze []models.Pietanza) []models.Pietanza {
+	filtrate := []models.Pietanza{}
+	for _, p := range pietanze {
+		if p.ProfiloAllergeni == nil {
+			continue
+		}
+		if f.Dieta != "" && !p.Compatibile(f.Dieta) {
+			continue
+		}
+		esclusa := false
+		for _, a := range f.Senza {
+			esclusa = esclusa || p.Contiene(a)
+		}
+		if !esclusa {
+			filtrate = append(filtrate, p)
+		}
+	}
+	return filtrate
+}
+
+// applicaAllergeniMenu completa le pietanze del menu fisso con allergeni e diete e ne riassume quelli del menu
+func applicaAllergeniMenu(menu *models.MenuFissoCompleto, profili map[int]*models.ProfiloAllergeni) {
+	applicaAllergeni(menu.Pietanze, profili)
+	pietanze := make([]*models.ProfiloAllergeni, len(menu.Pietanze))
+	for i, p := range menu.Pietanze {
+		pietanze[i] = p.ProfiloAllergeni
+	}
+	menu.ProfiloAllergeni = models.ProfiloComune(pietanze)
+}
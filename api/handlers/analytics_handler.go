@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+	"time"
+)
+
+// Periodo predefinito delle analisi (ultimi 30 giorni, oggi compreso) e numero predefinito di pietanze in classifica
+const (
+	giorniAnalisiPredefiniti = 30
+	limiteTopPredefinito     = 10
+)
+
+type AnalyticsHandler struct {
+	Repo  *repository.AnalyticsRepository
+	Cache *cache.AnalyticsCache
+}
+
+func NewAnalyticsHandler(repo *repository.AnalyticsRepository, cache *cache.AnalyticsCache) *AnalyticsHandler {
+	return &AnalyticsHandler{Repo: repo, Cache: cache}
+}
+
+// GetTopPietanze restituisce le pietanze più vendute per quantità e per ricavo
+// Parametri: dal, al, id_ristorante e limite (predefinito 10)
+func (h *AnalyticsHandler) GetTopPietanze(w http.ResponseWriter, r *http.Request) {
+	filtro, parametri, err := filtroAnalisi(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limite := limiteTopPredefinito
+	if s := r.URL.Query().Get("limite"); s != "" {
+		limite, err = strconv.Atoi(s)
+		if err != nil || limite <= 0 {
+			http.Error(w, "Limite non valido", http.StatusBadRequest)
+			return
+		}
+	}
+	parametri.Set("limite", strconv.Itoa(limite))
+
+	h.rispondi(w, r, "pietanze", parametri, func(ctx context.Context) (any, error) {
+		return h.Repo.TopPietanze(ctx, filtro, limite)
+	})
+}
+
+// GetVenditeOrarie restituisce le vendite per ora del giorno e per giorno della settimana
+func (h *AnalyticsHandler) GetVenditeOrarie(w http.ResponseWriter, r *http.Request) {
+	filtro, parametri, err := filtroAnalisi(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.rispondi(w, r, "vendite-orarie", parametri, func(ctx context.Context) (any, error) {
+		return h.Repo.MappaVendite(ctx, filtro)
+	})
+}
+
+// GetMenuFissi restituisce l'adesione ai menu fissi nel periodo
+func (h *AnalyticsHandler) GetMenuFissi(w http.ResponseWriter, r *http.Request) {
+	filtro, parametri, err := filtroAnalisi(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.rispondi(w, r, "menu-fissi", parametri, func(ctx context.Context) (any, error) {
+		return h.Repo.AdesioneMenuFissi(ctx, filtro)
+	})
+}
+
+// GetCoperti restituisce i coperti medi per capienza del tavolo
+func (h *AnalyticsHandler) GetCoperti(w http.ResponseWriter, r *http.Request) {
+	filtro, parametri, err := filtroAnalisi(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.rispondi(w, r, "coperti", parametri, func(ctx context.Context) (any, error) {
+		return h.Repo.CopertiPerTavolo(ctx, filtro)
+	})
+}
+
+// GetAndamento confronta il periodo con il periodo precedente di pari durata
+func (h *AnalyticsHandler) GetAndamento(w http.ResponseWriter, r *http.Request) {
+	filtro, parametri, err := filtroAnalisi(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	h.rispondi(w, r, "andamento", parametri, func(ctx context.Context) (any, error) {
+		return h.Repo.Andamento(ctx, filtro)
+	})
+}
+
+// rispondi restituisce il risultato dell'analisi dalla cache oppure lo calcola e lo salva in cache
+func (h *AnalyticsHandler) rispondi(w http.ResponseWriter, r *http.Request, analisi string, parametri url.Values, calcola func(ctx context.Context) (any, error)) {
+	ctx := r.Context()
+	chiave := cache.ChiaveAnalytics(analisi, parametri)
+
+	data, err := h.Cache.Get(ctx, chiave)
+	if err == nil && data != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+		return
+	}
+
+	risultato, err := calcola(ctx)
+	if err != nil {
+		if errors.Is(err, repository.ErrRistoranteInesistente) {
+			http.Error(w, "Ristorante non trovato", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel calcolo dell'analisi", http.StatusInternalServerError)
+		log.Printf("Errore nel calcolo dell'analisi %s: %v", analisi, err)
+		return
+	}
+	h.Cache.Set(ctx, chiave, risultato)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(risultato)
+}
+
+// filtroAnalisi legge dalla richiesta il periodo (dal, al in formato AAAA-MM-GG, predefiniti gli ultimi 30 giorni)
+// e il ristorante (id_ristorante, facoltativo); restituisce anche i parametri normalizzati per la chiave di cache
+func filtroAnalisi(r *http.Request) (models.FiltroAnalisi, url.Values, error) {
+	query := r.URL.Query()
+	filtro := models.FiltroAnalisi{Dal: query.Get("dal"), Al: query.Get("al")}
+
+	if filtro.Al == "" {
+		filtro.Al = time.Now().Format("2006-01-02")
+	}
+	al, err := time.Parse("2006-01-02", filtro.Al)
+	if err != nil {
+		return filtro, nil, errors.New("Data di fine non valida (formato AAAA-MM-GG)")
+	}
+	if filtro.Dal == "" {
+		filtro.Dal = al.AddDate(0, 0, -(giorniAnalisiPredefiniti - 1)).Format("2006-01-02")
+	}
+	dal, err := time.Parse("2006-01-02", filtro.Dal)
+	if err != nil {
+		return filtro, nil, errors.New("Data di inizio non valida (formato AAAA-MM-GG)")
+	}
+	if dal.After(al) {
+		return filtro, nil, errors.New("La data di inizio non può essere successiva alla data di fine")
+	}
+
+	if s := query.Get("id_ristorante"); s != "" {
+		filtro.IDRistorante, err = strconv.Atoi(s)
+		if err != nil || filtro.IDRistorante <= 0 {
+			return filtro, nil, errors.New("ID ristorante non valido")
+		}
+	}
+
+	parametri := url.Values{}
+	parametri.Set("dal", filtro.Dal)
+	parametri.Set("al", filtro.Al)
+	parametri.Set("id_ristorante", strconv.Itoa(filtro.IDRistorante))
+	return filtro, parametri, nil
+}
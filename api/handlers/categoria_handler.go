@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CategoriaHandler gestisce le categorie delle pietanze e il menu raggruppato per categoria
+type CategoriaHandler struct {
+	Repo          *repository.CategoriaRepository
+	Cache         *cache.CategoriaCache
+	PietanzaCache *cache.PietanzaCache
+	RicettaRepo   *repository.RicettaRepository
+}
+
+func NewCategoriaHandler(repo *repository.CategoriaRepository, cache *cache.CategoriaCache, pietanzaCache *cache.PietanzaCache, ricettaRepo *repository.RicettaRepository) *CategoriaHandler {
+	return &CategoriaHandler{
+		Repo:          repo,
+		Cache:         cache,
+		PietanzaCache: pietanzaCache,
+		RicettaRepo:   ricettaRepo,
+	}
+}
+
+// GetCategorie restituisce tutte le categorie nell'ordine del menu
+func (h *CategoriaHandler) GetCategorie(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	cached, found, err := h.Cache.GetAll(ctx)
+	if err != nil {
+		log.Printf("Errore nell'accesso alla cache: %v", err)
+	} else if found {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(cached)
+		return
+	}
+
+	categorie, err := h.Repo.GetAll(ctx)
+	if err != nil {
+		http.Error(w, "Errore nel recupero delle categorie", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero delle categorie: %v", err)
+		return
+	}
+
+	if err := h.Cache.SetAll(ctx, categorie); err != nil {
+		log.Printf("Errore nell'aggiornamento della cache: %v", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categorie)
+}
+
+// GetCategoria restituisce una categoria
+func (h *CategoriaHandler) GetCategoria(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	categoria, err := h.Repo.GetByID(r.Context(), id)
+	if err != nil {
+		scriviErroreCategoria(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categoria)
+}
+
+// CreateCategoria crea una categoria; senza aliquota IVA vale quella predefinita
+func (h *CategoriaHandler) CreateCategoria(w http.ResponseWriter, r *http.Request) {
+	categoria, ok := leggiCategoria(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.Repo.Create(r.Context(), categoria); err != nil {
+		scriviErroreCategoria(w, err)
+		return
+	}
+	h.invalidaCache(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(categoria)
+}
+
+// UpdateCategoria aggiorna nome, aliquota IVA e posizione di una categoria
+func (h *CategoriaHandler) UpdateCategoria(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	categoria, ok := leggiCategoria(w, r)
+	if !ok {
+		return
+	}
+	categoria.ID = id
+
+	if err := h.Repo.Update(r.Context(), categoria); err != nil {
+		scriviErroreCategoria(w, err)
+		return
+	}
+	h.invalidaCache(r)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categoria)
+}
+
+// DeleteCategoria elimina una categoria senza pietanze né sconti
+func (h *CategoriaHandler) DeleteCategoria(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Delete(r.Context(), id); err != nil {
+		scriviErroreCategoria(w, err)
+		return
+	}
+	h.invalidaCache(r)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RiordinaCategorie stabilisce l'ordine delle categorie nel menu
+func (h *CategoriaHandler) RiordinaCategorie(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Categorie []int `json:"categorie"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Riordina(r.Context(), req.Categorie); err != nil {
+		scriviErroreCategoria(w, err)
+		return
+	}
+	h.invalidaCache(r)
+
+	categorie, err := h.Repo.GetAll(r.Context())
+	if err != nil {
+		http.Error(w, "Errore nel recupero delle categorie", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero delle categorie: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categorie)
+}
+
+// GetMenu restituisce le pietanze disponibili raggruppate per categoria, nell'ordine del menu.
+// Solo quelle del menu del ristorante della richiesta e con i suoi prezzi.
+// Ogni pietanza riporta allergeni e diete ricavati dalla ricetta
+func (h *CategoriaHandler) GetMenu(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idRistorante := ristoranteRichiesta(r)
+
+	menu, found, err := h.PietanzaCache.GetMenu(ctx, idRistorante)
+	if err != nil {
+		log.Printf("Errore nell'accesso alla cache: %v", err)
+	}
+
+	if !found {
+		menu, err = h.Repo.Menu(ctx, idRistorante)
+		if err != nil {
+			http.Error(w, "Errore nel recupero del menu", http.StatusInternalServerError)
+			log.Printf("Errore nel recupero del menu: %v", err)
+			return
+		}
+
+		if err := h.PietanzaCache.SetMenu(ctx, idRistorante, menu); err != nil {
+			log.Printf("Errore nell'aggiornamento della cache: %v", err)
+		}
+	}
+
+	profili, err := profiliAllergeni(ctx, h.RicettaRepo)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli allergeni", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli allergeni: %v", err)
+		return
+	}
+	for _, sezione := range menu {
+		applicaAllergeni(sezione.Pietanze, profili)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(menu)
+}
+
+// leggiCategoria decodifica e valida il corpo della richiesta di creazione o modifica di una categoria
+func leggiCategoria(w http.ResponseWriter, r *http.Request) (*models.CategoriaPietanza, bool) {
+	var req struct {
+		Nome        string              `json:"nome"`
+		AliquotaIVA *models.Percentuale `json:"aliquota_iva"`
+		Posizione   int                 `json:"posizione"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return nil, false
+	}
+
+	categoria := &models.CategoriaPietanza{Nome: req.Nome, AliquotaIVA: models.AliquotaIVAPredefinita, Posizione: req.Posizione}
+	if req.AliquotaIVA != nil {
+		if !models.AliquotaIVAValida(*req.AliquotaIVA) {
+			http.Error(w, "Aliquota IVA non valida (tra 0 e 100)", http.StatusBadRequest)
+			return nil, false
+		}
+		categoria.AliquotaIVA = *req.AliquotaIVA
+	}
+	return categoria, true
+}
+
+// invalidaCache rimuove dalla cache le categorie e il menu che le usa
+func (h *CategoriaHandler) invalidaCache(r *http.Request) {
+	if err := h.Cache.InvalidateAll(r.Context()); err != nil {
+		log.Printf("Errore nell'invalidazione della cache: %v", err)
+	}
+	if err := h.PietanzaCache.InvalidateAll(r.Context()); err != nil {
+		log.Printf("Errore nell'invalidazione della cache: %v", err)
+	}
+}
+
+// scriviErroreCategoria traduce gli errori sulle categorie nella risposta HTTP corrispondente
+func scriviErroreCategoria(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrCategoriaInesistente):
+		http.Error(w, "Categoria non trovata", http.StatusNotFound)
+	case errors.Is(err, repository.ErrNomeCategoria), errors.Is(err, repository.ErrOrdineCategorieErrato):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrCategoriaDuplicata), errors.Is(err, repository.ErrCategoriaConPietanze):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Errore nella gestione della categoria", http.StatusInternalServerError)
+		log.Printf("Errore nella gestione della categoria: %v", err)
+	}
+}
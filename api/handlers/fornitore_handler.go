@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type FornitoreHandler struct {
+	Repo *repository.FornitoreRepository
+}
+
+func NewFornitoreHandler(repo *repository.FornitoreRepository) *FornitoreHandler {
+	return &FornitoreHandler{Repo: repo}
+}
+
+// GetFornitori restituisce tutti i fornitori
+func (h *FornitoreHandler) GetFornitori(w http.ResponseWriter, r *http.Request) {
+	fornitori, err := h.Repo.GetAll(r.Context())
+	if err != nil {
+		http.Error(w, "Errore nel recupero dei fornitori", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero dei fornitori: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fornitori)
+}
+
+// GetFornitore restituisce un fornitore con il listino degli ingredienti
+func (h *FornitoreHandler) GetFornitore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	fornitore, err := h.Repo.GetByID(r.Context(), id)
+	if err != nil {
+		scriviErroreFornitore(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fornitore)
+}
+
+// CreateFornitore crea un nuovo fornitore
+func (h *FornitoreHandler) CreateFornitore(w http.ResponseWriter, r *http.Request) {
+	var fornitore models.Fornitore
+	if err := json.NewDecoder(r.Body).Decode(&fornitore); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Create(r.Context(), &fornitore); err != nil {
+		scriviErroreFornitore(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(fornitore)
+}
+
+// UpdateFornitore aggiorna i dati anagrafici di un fornitore
+func (h *FornitoreHandler) UpdateFornitore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var fornitore models.Fornitore
+	if err := json.NewDecoder(r.Body).Decode(&fornitore); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+	fornitore.ID = id
+	fornitore.Ingredienti = nil
+
+	if err := h.Repo.Update(r.Context(), &fornitore); err != nil {
+		scriviErroreFornitore(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(fornitore)
+}
+
+// DeleteFornitore elimina un fornitore senza ordini di acquisto
+func (h *FornitoreHandler) DeleteFornitore(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Delete(r.Context(), id); err != nil {
+		scriviErroreFornitore(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ImpostaIngrediente aggiunge un ingrediente al listino del fornitore o ne aggiorna prezzo, giorni di consegna e ordine minimo
+func (h *FornitoreHandler) ImpostaIngrediente(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+	idIngrediente, err := strconv.Atoi(chi.URLParam(r, "id_ingrediente"))
+	if err != nil {
+		http.Error(w, "ID ingrediente non valido", http.StatusBadRequest)
+		return
+	}
+
+	var condizioni models.FornitoreIngrediente
+	if err := json.NewDecoder(r.Body).Decode(&condizioni); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+	condizioni.IDFornitore = id
+	condizioni.IDIngrediente = idIngrediente
+
+	if err := h.Repo.ImpostaIngrediente(r.Context(), &condizioni); err != nil {
+		scriviErroreFornitore(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(condizioni)
+}
+
+// RimuoviIngrediente toglie un ingrediente dal listino del fornitore
+func (h *FornitoreHandler) RimuoviIngrediente(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+	idIngrediente, err := strconv.Atoi(chi.URLParam(r, "id_ingrediente"))
+	if err != nil {
+		http.Error(w, "ID ingrediente non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.RimuoviIngrediente(r.Context(), id, idIngrediente); err != nil {
+		scriviErroreFornitore(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scriviErroreFornitore traduce gli errori sui fornitori nella risposta HTTP corrispondente
+func scriviErroreFornitore(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrFornitoreInesistente):
+		http.Error(w, "Fornitore non trovato", http.StatusNotFound)
+	case errors.Is(err, repository.ErrIngredienteInesistente):
+		http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+	case errors.Is(err, repository.ErrIngredienteNonFornito):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrNomeFornitore), errors.Is(err, repository.ErrCondizioniNonValide):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrFornitoreDuplicato), errors.Is(err, repository.ErrFornitoreConOrdini):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Errore nella gestione del fornitore", http.StatusInternalServerError)
+		log.Printf("Errore nella gestione del fornitore: %v", err)
+	}
+}
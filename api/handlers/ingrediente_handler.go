@@ -2,26 +2,36 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"ristorante-api/cache"
 	"ristorante-api/models"
 	"ristorante-api/repository"
+	"ristorante-api/unita"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
 
+// Giorni predefiniti entro cui un lotto è considerato in scadenza
+const giorniScadenzaPredefiniti = 3
+
 // IngredienteHandler gestisce le richieste relative agli ingredienti
 type IngredienteHandler struct {
-	repo  *repository.IngredienteRepository
-	cache *cache.IngredienteCache
+	repo          *repository.IngredienteRepository
+	cache         *cache.IngredienteCache
+	ricettaCache  *cache.RicettaCache
+	pietanzaCache *cache.PietanzaCache
 }
 
 // NewIngredienteHandler crea un nuovo handler per gli ingredienti
-func NewIngredienteHandler(repo *repository.IngredienteRepository, cache *cache.IngredienteCache) *IngredienteHandler {
+func NewIngredienteHandler(repo *repository.IngredienteRepository, cache *cache.IngredienteCache, ricettaCache *cache.RicettaCache, pietanzaCache *cache.PietanzaCache) *IngredienteHandler {
 	return &IngredienteHandler{
-		repo:  repo,
-		cache: cache,
+		repo:          repo,
+		cache:         cache,
+		ricettaCache:  ricettaCache,
+		pietanzaCache: pietanzaCache,
 	}
 }
 
@@ -113,10 +123,16 @@ func (h *IngredienteHandler) CreateIngrediente(w http.ResponseWriter, r *http.Re
 	}
 
 	// Crea l'ingrediente nel database
-	if err := h.repo.Create(ctx, &ingrediente); err != nil {
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	if err := h.repo.Create(ctxRaccolta, &ingrediente); err != nil {
+		if erroreDatiIngrediente(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Errore nella creazione dell'ingrediente", http.StatusInternalServerError)
 		return
 	}
+	repository.InvalidaCachePietanze(ctx, h.pietanzaCache, *cambiate)
 
 	// Invalida la cache degli ingredienti
 	if err := h.cache.InvalidateAll(ctx); err != nil {
@@ -128,6 +144,13 @@ func (h *IngredienteHandler) CreateIngrediente(w http.ResponseWriter, r *http.Re
 	json.NewEncoder(w).Encode(ingrediente)
 }
 
+// erroreDatiIngrediente indica gli errori dovuti a dati dell'ingrediente non validi (costo, unità di misura, peso per pezzo, allergeni)
+func erroreDatiIngrediente(err error) bool {
+	return errors.Is(err, repository.ErrCostoNonValido) || errors.Is(err, repository.ErrPesoPezzoNonValido) ||
+		errors.Is(err, repository.ErrAllergeneNonValido) ||
+		errors.Is(err, unita.ErrUnitaSconosciuta) || errors.Is(err, unita.ErrUnitaIncompatibili)
+}
+
 // UpdateIngrediente aggiorna un ingrediente esistente
 func (h *IngredienteHandler) UpdateIngrediente(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -147,10 +170,24 @@ func (h *IngredienteHandler) UpdateIngrediente(w http.ResponseWriter, r *http.Re
 	ingrediente.ID = id
 
 	// Aggiorna l'ingrediente nel database
-	if err := h.repo.Update(ctx, &ingrediente); err != nil {
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	if err := h.repo.Update(ctxRaccolta, &ingrediente); err != nil {
+		if errors.Is(err, repository.ErrIngredienteInesistente) {
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+			return
+		}
+		if errors.Is(err, repository.ErrUnitaInUso) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if erroreDatiIngrediente(err) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 		http.Error(w, "Errore nell'aggiornamento dell'ingrediente", http.StatusInternalServerError)
 		return
 	}
+	repository.InvalidaCachePietanze(ctx, h.pietanzaCache, *cambiate)
 
 	// Invalida la cache degli ingredienti
 	if err := h.cache.InvalidateByID(ctx, id); err != nil {
@@ -165,6 +202,11 @@ func (h *IngredienteHandler) UpdateIngrediente(w http.ResponseWriter, r *http.Re
 		http.Error(w, "Errore nell'invalidazione della cache degli ingredienti da riordinare", http.StatusInternalServerError)
 		return
 	}
+	// Allergeni e diete delle pietanze dipendono dagli ingredienti delle ricette
+	if err := h.ricettaCache.InvalidateProfiliAllergeni(ctx); err != nil {
+		http.Error(w, "Errore nell'invalidazione della cache degli allergeni", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(ingrediente)
@@ -199,6 +241,11 @@ func (h *IngredienteHandler) DeleteIngrediente(w http.ResponseWriter, r *http.Re
 		http.Error(w, "Errore nell'invalidazione della cache degli ingredienti da riordinare", http.StatusInternalServerError)
 		return
 	}
+	// Allergeni e diete delle pietanze dipendono dagli ingredienti delle ricette
+	if err := h.ricettaCache.InvalidateProfiliAllergeni(ctx); err != nil {
+		http.Error(w, "Errore nell'invalidazione della cache degli allergeni", http.StatusInternalServerError)
+		return
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
@@ -256,10 +303,19 @@ func (h *IngredienteHandler) PrenotaIngrediente(w http.ResponseWriter, r *http.R
 	}
 
 	// Prenota l'ingrediente nel database
-	if err := h.repo.Prenota(ctx, id, richiesta.Quantita); err != nil {
-		http.Error(w, "Errore nella prenotazione dell'ingrediente", http.StatusInternalServerError)
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	if err := h.repo.Prenota(ctxRaccolta, id, richiesta.Quantita); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrIngredienteInesistente):
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrQuantitaMovimentoNonValida), errors.Is(err, repository.ErrIngredientiInsufficienti):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Errore nella prenotazione dell'ingrediente", http.StatusInternalServerError)
+		}
 		return
 	}
+	repository.InvalidaCachePietanze(ctx, h.pietanzaCache, *cambiate)
 
 	// Invalida la cache degli ingredienti e degli ingredienti da riordinare
 	if err := h.cache.InvalidateAll(ctx); err != nil {
@@ -280,7 +336,7 @@ func (h *IngredienteHandler) PrenotaIngrediente(w http.ResponseWriter, r *http.R
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// Rifornisci un ingrediente con una certa quantità
+// Rifornisci un ingrediente con una certa quantità; codice_lotto e data_scadenza sono facoltativi
 func (h *IngredienteHandler) RifornisciIngrediente(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	idStr := chi.URLParam(r, "id")
@@ -292,17 +348,27 @@ func (h *IngredienteHandler) RifornisciIngrediente(w http.ResponseWriter, r *htt
 
 	var richiesta struct {
 		Quantita float64 `json:"quantita"`
+		models.DatiLotto
 	}
 	if err := json.NewDecoder(r.Body).Decode(&richiesta); err != nil {
 		http.Error(w, "Errore nella decodifica del corpo della richiesta", http.StatusBadRequest)
 		return
 	}
 
-	// Rifornisci l'ingrediente nel database
-	if err := h.repo.Rifornisci(ctx, id, richiesta.Quantita); err != nil {
-		http.Error(w, "Errore nel rifornimento dell'ingrediente", http.StatusInternalServerError)
+	// Rifornisci l'ingrediente nel database, in un nuovo lotto
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	if _, err := h.repo.Rifornisci(ctxRaccolta, id, richiesta.Quantita, richiesta.DatiLotto); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrIngredienteInesistente):
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrQuantitaMovimentoNonValida), errors.Is(err, repository.ErrDataScadenzaNonValida):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Errore nel rifornimento dell'ingrediente", http.StatusInternalServerError)
+		}
 		return
 	}
+	repository.InvalidaCachePietanze(ctx, h.pietanzaCache, *cambiate)
 
 	// Invalida la cache degli ingredienti e degli ingredienti da riordinare
 	if err := h.cache.InvalidateAll(ctx); err != nil {
@@ -322,3 +388,232 @@ func (h *IngredienteHandler) RifornisciIngrediente(w http.ResponseWriter, r *htt
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// GetStoricoCosti restituisce lo storico dei costi unitari di un ingrediente, dal più recente
+func (h *IngredienteHandler) GetStoricoCosti(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	storico, err := h.repo.StoricoCosti(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrIngredienteInesistente) {
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel recupero dello storico dei costi", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(storico)
+}
+
+// RegistraSpreco scala dal magazzino una quantità buttata con la relativa causale
+func (h *IngredienteHandler) RegistraSpreco(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var richiesta struct {
+		Quantita float64 `json:"quantita"`
+		Causale  string  `json:"causale"`
+		Note     string  `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&richiesta); err != nil {
+		http.Error(w, "Errore nella decodifica del corpo della richiesta", http.StatusBadRequest)
+		return
+	}
+
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	spreco, err := h.repo.RegistraSpreco(ctxRaccolta, id, richiesta.Quantita, richiesta.Causale, richiesta.Note)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrIngredienteInesistente):
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrQuantitaMovimentoNonValida), errors.Is(err, repository.ErrCausaleSprecoNonValida),
+			errors.Is(err, repository.ErrIngredientiInsufficienti):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Errore nella registrazione dello spreco", http.StatusInternalServerError)
+		}
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.pietanzaCache, *cambiate)
+
+	// Invalida la cache dell'ingrediente specifico e di tutti gli ingredienti, anche quelli da riordinare
+	repository.InvalidaCacheIngredienti(ctx, h.cache, map[int]float64{id: richiesta.Quantita})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(spreco)
+}
+
+// GetLotti restituisce i lotti con residuo di un ingrediente, nell'ordine in cui vengono consumati
+func (h *IngredienteHandler) GetLotti(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	lotti, err := h.repo.Lotti(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrIngredienteInesistente) {
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel recupero dei lotti", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lotti)
+}
+
+// GetLottiInScadenza restituisce i lotti che scadono entro ?giorni= (predefinito 3), compresi quelli scaduti
+func (h *IngredienteHandler) GetLottiInScadenza(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	giorni := giorniScadenzaPredefiniti
+	if s := r.URL.Query().Get("giorni"); s != "" {
+		var err error
+		giorni, err = strconv.Atoi(s)
+		if err != nil || giorni < 0 {
+			http.Error(w, "Numero di giorni non valido", http.StatusBadRequest)
+			return
+		}
+	}
+
+	lotti, err := h.repo.LottiInScadenza(ctx, giorni)
+	if err != nil {
+		http.Error(w, "Errore nel recupero dei lotti in scadenza", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lotti)
+}
+
+// SmaltisciLottiScaduti registra come spreco il residuo di tutti i lotti scaduti
+func (h *IngredienteHandler) SmaltisciLottiScaduti(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	sprechi, err := h.repo.SmaltisciLottiScaduti(ctxRaccolta)
+	if err != nil {
+		http.Error(w, "Errore nello smaltimento dei lotti scaduti", http.StatusInternalServerError)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.pietanzaCache, *cambiate)
+
+	smaltiti := make(map[int]float64)
+	for _, s := range sprechi {
+		smaltiti[s.IDIngrediente] += s.Quantita
+	}
+	repository.InvalidaCacheIngredienti(ctx, h.cache, smaltiti)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sprechi)
+}
+
+// GetMovimenti restituisce i movimenti di magazzino di un ingrediente, dal più recente
+// Parametri facoltativi: dal, al (formato AAAA-MM-GG) e tipo (carico, scarico, storno, rettifica, spreco)
+func (h *IngredienteHandler) GetMovimenti(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	query := r.URL.Query()
+	filtro := models.FiltroMovimenti{Dal: query.Get("dal"), Al: query.Get("al"), Tipo: query.Get("tipo")}
+	if filtro.Dal != "" {
+		if _, err := time.Parse("2006-01-02", filtro.Dal); err != nil {
+			http.Error(w, "Data di inizio non valida (formato AAAA-MM-GG)", http.StatusBadRequest)
+			return
+		}
+	}
+	if filtro.Al != "" {
+		if _, err := time.Parse("2006-01-02", filtro.Al); err != nil {
+			http.Error(w, "Data di fine non valida (formato AAAA-MM-GG)", http.StatusBadRequest)
+			return
+		}
+	}
+	if filtro.Tipo != "" && !models.TipoMovimentoValido(filtro.Tipo) {
+		http.Error(w, "Tipo di movimento non valido", http.StatusBadRequest)
+		return
+	}
+
+	movimenti, err := h.repo.Movimenti(ctx, id, filtro)
+	if err != nil {
+		if errors.Is(err, repository.ErrIngredienteInesistente) {
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel recupero dei movimenti di magazzino", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movimenti)
+}
+
+// AggiornaCosto imposta il costo unitario di un ingrediente, registrandolo nello storico
+func (h *IngredienteHandler) AggiornaCosto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var richiesta struct {
+		CostoUnitario *models.CostoUnitario `json:"costo_unitario"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&richiesta); err != nil || richiesta.CostoUnitario == nil {
+		http.Error(w, "Errore nella decodifica del corpo della richiesta", http.StatusBadRequest)
+		return
+	}
+
+	storico, err := h.repo.AggiornaCosto(ctx, id, *richiesta.CostoUnitario)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrIngredienteInesistente):
+			http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrCostoNonValido):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, "Errore nell'aggiornamento del costo dell'ingrediente", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	// Invalida la cache dell'ingrediente specifico e di tutti gli ingredienti, anche quelli da riordinare
+	if err := h.cache.InvalidateByID(ctx, id); err != nil {
+		http.Error(w, "Errore nell'invalidazione della cache", http.StatusInternalServerError)
+		return
+	}
+	if err := h.cache.InvalidateAll(ctx); err != nil {
+		http.Error(w, "Errore nell'invalidazione della cache", http.StatusInternalServerError)
+		return
+	}
+	if err := h.cache.InvalidateDaRiordinare(ctx); err != nil {
+		http.Error(w, "Errore nell'invalidazione della cache degli ingredienti da riordinare", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(storico)
+}
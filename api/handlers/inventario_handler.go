@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// InventarioHandler gestisce i conteggi fisici del magazzino
+type InventarioHandler struct {
+	Repo             *repository.InventarioRepository
+	IngredienteCache *cache.IngredienteCache
+	PietanzaCache    *cache.PietanzaCache
+}
+
+func NewInventarioHandler(repo *repository.InventarioRepository, ingredienteCache *cache.IngredienteCache, pietanzaCache *cache.PietanzaCache) *InventarioHandler {
+	return &InventarioHandler{Repo: repo, IngredienteCache: ingredienteCache, PietanzaCache: pietanzaCache}
+}
+
+// GetInventari restituisce gli inventari, dal più recente, con i totali delle differenze
+func (h *InventarioHandler) GetInventari(w http.ResponseWriter, r *http.Request) {
+	inventari, err := h.Repo.GetAll(r.Context())
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli inventari", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli inventari: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventari)
+}
+
+// GetInventario restituisce un inventario con il report delle differenze
+func (h *InventarioHandler) GetInventario(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	inventario, err := h.Repo.GetByID(r.Context(), id)
+	if err != nil {
+		scriviErroreInventario(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventario)
+}
+
+// CreateInventario registra le quantità contate come bozza, oppure le conferma subito con "conferma": true
+func (h *InventarioHandler) CreateInventario(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Note     string                        `json:"note"`
+		Righe    []models.ConteggioIngrediente `json:"righe"`
+		Conferma bool                          `json:"conferma"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	inventario, err := h.Repo.Create(ctx, body.Note, body.Righe, body.Conferma, h.IngredienteCache)
+	if err != nil {
+		scriviErroreInventario(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(inventario)
+}
+
+// AggiornaInventario aggiunge o corregge quantità contate in una bozza di inventario
+func (h *InventarioHandler) AggiornaInventario(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Note  *string                       `json:"note"`
+		Righe []models.ConteggioIngrediente `json:"righe"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	inventario, err := h.Repo.AggiornaConteggi(r.Context(), id, body.Note, body.Righe)
+	if err != nil {
+		scriviErroreInventario(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventario)
+}
+
+// ConfermaInventario rettifica le scorte in base alla bozza di inventario
+func (h *InventarioHandler) ConfermaInventario(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	inventario, err := h.Repo.Conferma(ctx, id, h.IngredienteCache)
+	if err != nil {
+		scriviErroreInventario(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(inventario)
+}
+
+// DeleteInventario elimina una bozza di inventario
+func (h *InventarioHandler) DeleteInventario(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Delete(r.Context(), id); err != nil {
+		scriviErroreInventario(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scriviErroreInventario traduce gli errori dell'inventario nella risposta HTTP corrispondente
+func scriviErroreInventario(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrInventarioInesistente):
+		http.Error(w, "Inventario non trovato", http.StatusNotFound)
+	case errors.Is(err, repository.ErrInventarioConfermato):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrInventarioVuoto), errors.Is(err, repository.ErrQuantitaContata),
+		errors.Is(err, repository.ErrIngredienteInesistente):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Errore nella gestione dell'inventario", http.StatusInternalServerError)
+		log.Printf("Errore nella gestione dell'inventario: %v", err)
+	}
+}
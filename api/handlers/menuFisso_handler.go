@@ -14,15 +14,17 @@ import (
 
 // MenuFissoHandler gestisce le richieste relative ai menu fissi
 type MenuFissoHandler struct {
-	repo  *repository.MenuFissoRepository
-	cache *cache.MenuFissoCache
+	repo        *repository.MenuFissoRepository
+	cache       *cache.MenuFissoCache
+	ricettaRepo *repository.RicettaRepository
 }
 
 // NewMenuFissoHandler crea un nuovo handler per i menu fissi
-func NewMenuFissoHandler(repo *repository.MenuFissoRepository, cache *cache.MenuFissoCache) *MenuFissoHandler {
+func NewMenuFissoHandler(repo *repository.MenuFissoRepository, cache *cache.MenuFissoCache, ricettaRepo *repository.RicettaRepository) *MenuFissoHandler {
 	return &MenuFissoHandler{
-		repo:  repo,
-		cache: cache,
+		repo:        repo,
+		cache:       cache,
+		ricettaRepo: ricettaRepo,
 	}
 }
 
@@ -258,26 +260,33 @@ func (h *MenuFissoHandler) GetComposizione(w http.ResponseWriter, r *http.Reques
 		log.Printf("Errore nell'accesso alla cache: %v", err)
 		// Continua con il database in caso di errore della cache
 	} else if found {
-		// Usa i dati dalla cache
 		log.Printf("Servendo la composizione del menu fisso ID %d dalla cache Redis", id)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(pietanze)
-		return
 	}
 
-	// Cache miss o errore, recupera dal database
-	pietanze, err = h.repo.GetComposizione(ctx, id)
-	if err != nil {
-		http.Error(w, "Errore nel recupero della composizione del menu fisso", http.StatusInternalServerError)
-		log.Printf("Errore nel recupero della composizione del menu fisso: %v", err)
-		return
+	if !found {
+		// Cache miss o errore, recupera dal database
+		pietanze, err = h.repo.GetComposizione(ctx, id)
+		if err != nil {
+			http.Error(w, "Errore nel recupero della composizione del menu fisso", http.StatusInternalServerError)
+			log.Printf("Errore nel recupero della composizione del menu fisso: %v", err)
+			return
+		}
+
+		// Salva in cache per le future richieste
+		if err := h.cache.SetComposizione(ctx, id, pietanze); err != nil {
+			log.Printf("Errore nell'aggiornamento della cache: %v", err)
+			// Continua comunque
+		}
 	}
 
-	// Salva in cache per le future richieste
-	if err := h.cache.SetComposizione(ctx, id, pietanze); err != nil {
-		log.Printf("Errore nell'aggiornamento della cache: %v", err)
-		// Continua comunque
+	// Allergeni e diete delle pietanze, ricavati dalle ricette
+	profili, err := profiliAllergeni(ctx, h.ricettaRepo)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli allergeni", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli allergeni: %v", err)
+		return
 	}
+	applicaAllergeni(pietanze, profili)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(pietanze)
@@ -393,26 +402,33 @@ func (h *MenuFissoHandler) GetMenuFissoCompleto(w http.ResponseWriter, r *http.R
 		log.Printf("Errore nell'accesso alla cache: %v", err)
 		// Continua con il database in caso di errore della cache
 	} else if found {
-		// Usa i dati dalla cache
 		log.Printf("Servendo il menu fisso completo ID %d dalla cache Redis", id)
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(menuCompleto)
-		return
 	}
 
-	// Cache miss o errore, recupera dal database
-	menuCompleto, err = h.repo.GetMenuFissoCompleto(ctx, id)
-	if err != nil {
-		http.Error(w, "Menu fisso non trovato", http.StatusNotFound)
-		log.Printf("Errore nel recupero del menu fisso completo: %v", err)
-		return
+	if !found {
+		// Cache miss o errore, recupera dal database
+		menuCompleto, err = h.repo.GetMenuFissoCompleto(ctx, id)
+		if err != nil {
+			http.Error(w, "Menu fisso non trovato", http.StatusNotFound)
+			log.Printf("Errore nel recupero del menu fisso completo: %v", err)
+			return
+		}
+
+		// Salva in cache per le future richieste
+		if err := h.cache.SetMenuFissoCompleto(ctx, id, menuCompleto); err != nil {
+			log.Printf("Errore nell'aggiornamento della cache: %v", err)
+			// Continua comunque
+		}
 	}
 
-	// Salva in cache per le future richieste
-	if err := h.cache.SetMenuFissoCompleto(ctx, id, menuCompleto); err != nil {
-		log.Printf("Errore nell'aggiornamento della cache: %v", err)
-		// Continua comunque
+	// Allergeni e diete delle pietanze e del menu, ricavati dalle ricette
+	profili, err := profiliAllergeni(ctx, h.ricettaRepo)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli allergeni", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli allergeni: %v", err)
+		return
 	}
+	applicaAllergeniMenu(menuCompleto, profili)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(menuCompleto)
@@ -449,6 +465,17 @@ func (h *MenuFissoHandler) GetAllMenuFissiCompleti(w http.ResponseWriter, r *htt
 		// Continua comunque
 	}
 
+	// Allergeni e diete delle pietanze e dei menu, ricavati dalle ricette
+	profili, err := profiliAllergeni(ctx, h.ricettaRepo)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli allergeni", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli allergeni: %v", err)
+		return
+	}
+	for i := range menuCompleti {
+		applicaAllergeniMenu(&menuCompleti[i], profili)
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(menuCompleti)
 }
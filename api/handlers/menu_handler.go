@@ -0,0 +1,122 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// MenuHandler gestisce il menu di ciascun ristorante
+type MenuHandler struct {
+	Repo          *repository.MenuRepository
+	PietanzaCache *cache.PietanzaCache
+}
+
+func NewMenuHandler(repo *repository.MenuRepository, pietanzaCache *cache.PietanzaCache) *MenuHandler {
+	return &MenuHandler{Repo: repo, PietanzaCache: pietanzaCache}
+}
+
+// GetMenuRistorante restituisce le pietanze del menu del ristorante con il prezzo applicato
+func (h *MenuHandler) GetMenuRistorante(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	voci, err := h.Repo.GetByRistorante(r.Context(), id)
+	if err != nil {
+		scriviErroreMenu(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(voci)
+}
+
+// ImpostaPietanzaMenu aggiunge una pietanza al menu del ristorante o ne aggiorna il prezzo
+// Senza corpo, o con prezzo nullo, la pietanza è venduta al prezzo di listino
+func (h *MenuHandler) ImpostaPietanzaMenu(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+	idPietanza, err := strconv.Atoi(chi.URLParam(r, "id_pietanza"))
+	if err != nil {
+		http.Error(w, "ID pietanza non valido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Prezzo *models.Importo `json:"prezzo"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	voce := models.Menu{ID_Ristorante: id, ID_Pietanza: idPietanza, Prezzo: body.Prezzo}
+	if err := h.Repo.Imposta(r.Context(), &voce); err != nil {
+		scriviErroreMenu(w, err)
+		return
+	}
+	h.invalidaMenu(r, id)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(voce)
+}
+
+// RimuoviPietanzaMenu toglie una pietanza dal menu del ristorante
+func (h *MenuHandler) RimuoviPietanzaMenu(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+	idPietanza, err := strconv.Atoi(chi.URLParam(r, "id_pietanza"))
+	if err != nil {
+		http.Error(w, "ID pietanza non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Rimuovi(r.Context(), id, idPietanza); err != nil {
+		scriviErroreMenu(w, err)
+		return
+	}
+	h.invalidaMenu(r, id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// invalidaMenu rimuove dalla cache il menu per categoria del ristorante
+func (h *MenuHandler) invalidaMenu(r *http.Request, idRistorante int) {
+	if err := h.PietanzaCache.InvalidateMenu(r.Context(), idRistorante); err != nil {
+		log.Printf("Errore nell'invalidazione della cache del menu: %v", err)
+	}
+}
+
+// scriviErroreMenu traduce gli errori sul menu dei ristoranti nella risposta HTTP corrispondente
+func scriviErroreMenu(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrRistoranteInesistente):
+		http.Error(w, "Ristorante non trovato", http.StatusNotFound)
+	case errors.Is(err, repository.ErrPietanzaInesistente):
+		http.Error(w, "Pietanza non trovata", http.StatusNotFound)
+	case errors.Is(err, repository.ErrPietanzaNonInMenu):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrPrezzoNonValido):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Errore nella gestione del menu", http.StatusInternalServerError)
+		log.Printf("Errore nella gestione del menu: %v", err)
+	}
+}
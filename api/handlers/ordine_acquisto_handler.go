@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type OrdineAcquistoHandler struct {
+	Repo             *repository.OrdineAcquistoRepository
+	IngredienteCache *cache.IngredienteCache
+	PietanzaCache    *cache.PietanzaCache
+}
+
+func NewOrdineAcquistoHandler(repo *repository.OrdineAcquistoRepository, ingredienteCache *cache.IngredienteCache, pietanzaCache *cache.PietanzaCache) *OrdineAcquistoHandler {
+	return &OrdineAcquistoHandler{Repo: repo, IngredienteCache: ingredienteCache, PietanzaCache: pietanzaCache}
+}
+
+// GetOrdiniAcquisto restituisce gli ordini di acquisto, filtrabili per stato e id_fornitore
+func (h *OrdineAcquistoHandler) GetOrdiniAcquisto(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	stato := query.Get("stato")
+	if stato != "" && !models.StatoAcquistoValido(stato) {
+		http.Error(w, "Stato non valido", http.StatusBadRequest)
+		return
+	}
+	idFornitore := 0
+	if s := query.Get("id_fornitore"); s != "" {
+		var err error
+		idFornitore, err = strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "ID fornitore non valido", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ordini, err := h.Repo.GetAll(r.Context(), stato, idFornitore)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli ordini di acquisto", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli ordini di acquisto: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ordini)
+}
+
+// GetOrdineAcquisto restituisce un ordine di acquisto con le righe
+func (h *OrdineAcquistoHandler) GetOrdineAcquisto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	ordine, err := h.Repo.GetByID(r.Context(), id)
+	if err != nil {
+		scriviErroreAcquisto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ordine)
+}
+
+// GeneraOrdiniAcquisto crea le bozze degli ordini ai fornitori per gli ingredienti da riordinare
+func (h *OrdineAcquistoHandler) GeneraOrdiniAcquisto(w http.ResponseWriter, r *http.Request) {
+	risultato, err := h.Repo.GeneraDaRiordino(r.Context())
+	if err != nil {
+		scriviErroreAcquisto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(risultato)
+}
+
+// ModificaRigaAcquisto cambia la quantità di una riga di una bozza; con quantità zero la riga viene eliminata
+func (h *OrdineAcquistoHandler) ModificaRigaAcquisto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+	idRiga, err := strconv.Atoi(chi.URLParam(r, "id_riga"))
+	if err != nil {
+		http.Error(w, "ID riga non valido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Quantita float64 `json:"quantita"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	ordine, err := h.Repo.ModificaRiga(r.Context(), id, idRiga, body.Quantita)
+	if err != nil {
+		scriviErroreAcquisto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ordine)
+}
+
+// InviaOrdineAcquisto segna la bozza come inviata al fornitore
+func (h *OrdineAcquistoHandler) InviaOrdineAcquisto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	ordine, err := h.Repo.Invia(r.Context(), id)
+	if err != nil {
+		scriviErroreAcquisto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ordine)
+}
+
+// RiceviOrdineAcquisto carica in magazzino la merce ricevuta, un lotto per riga; senza corpo viene ricevuto tutto il residuo
+func (h *OrdineAcquistoHandler) RiceviOrdineAcquisto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Righe []models.RicezioneRiga `json:"righe"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	ordine, err := h.Repo.Ricevi(ctx, id, body.Righe, h.IngredienteCache)
+	if err != nil {
+		scriviErroreAcquisto(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ordine)
+}
+
+// DeleteOrdineAcquisto elimina una bozza di ordine di acquisto
+func (h *OrdineAcquistoHandler) DeleteOrdineAcquisto(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Delete(r.Context(), id); err != nil {
+		scriviErroreAcquisto(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scriviErroreAcquisto traduce gli errori sugli ordini di acquisto nella risposta HTTP corrispondente
+func scriviErroreAcquisto(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrOrdineAcquistoInesistente):
+		http.Error(w, "Ordine di acquisto non trovato", http.StatusNotFound)
+	case errors.Is(err, repository.ErrRigaAcquistoInesistente):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrStatoOrdineAcquisto), errors.Is(err, repository.ErrOrdineAcquistoVuoto):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, repository.ErrQuantitaMovimentoNonValida), errors.Is(err, repository.ErrDataScadenzaNonValida):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, "Errore nella gestione dell'ordine di acquisto", http.StatusInternalServerError)
+		log.Printf("Errore nella gestione dell'ordine di acquisto: %v", err)
+	}
+}
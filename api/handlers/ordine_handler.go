@@ -2,36 +2,46 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"ristorante-api/cache"
 	"ristorante-api/models"
 	"ristorante-api/repository"
+	"ristorante-api/stampa"
 	"strconv"
 
 	"github.com/go-chi/chi/v5"
 )
 
 type OrdineHandler struct {
-	Repo  *repository.OrdineRepository
-	Cache *cache.OrdineCache
+	Repo             *repository.OrdineRepository
+	Cache            *cache.OrdineCache
+	TavoloRepo       *repository.TavoloRepository
+	TavoloCache      *cache.TavoloCache
+	RistoranteRepo   *repository.RistoranteRepository
+	IngredienteCache *cache.IngredienteCache
+	PietanzaCache    *cache.PietanzaCache
 }
 
-func NewOrdineHandler(repo *repository.OrdineRepository, cache *cache.OrdineCache) *OrdineHandler {
-	return &OrdineHandler{Repo: repo, Cache: cache}
+func NewOrdineHandler(repo *repository.OrdineRepository, cache *cache.OrdineCache, tavoloRepo *repository.TavoloRepository, tavoloCache *cache.TavoloCache, ristoranteRepo *repository.RistoranteRepository, ingredienteCache *cache.IngredienteCache, pietanzaCache *cache.PietanzaCache) *OrdineHandler {
+	return &OrdineHandler{Repo: repo, Cache: cache, TavoloRepo: tavoloRepo, TavoloCache: tavoloCache, RistoranteRepo: ristoranteRepo, IngredienteCache: ingredienteCache, PietanzaCache: pietanzaCache}
 }
 
+// GetOrdini restituisce gli ordini aperti del ristorante della richiesta
 func (h *OrdineHandler) GetOrdini(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	ordini, err := h.Cache.GetAll(ctx)
+	idRistorante := ristoranteRichiesta(r)
+	ordini, err := h.Cache.GetAll(ctx, idRistorante)
 	if err != nil || ordini == nil {
-		ordini, err = h.Repo.GetAll(ctx)
+		ordini, err = h.Repo.GetAll(ctx, idRistorante)
 		if err != nil {
 			http.Error(w, "Errore nel recupero degli ordini", http.StatusInternalServerError)
 			log.Printf("Errore nel recupero: %v", err)
 			return
 		}
-		h.Cache.SetAll(ctx, ordini)
+		h.Cache.SetAll(ctx, idRistorante, ordini)
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ordini)
@@ -85,16 +95,27 @@ func (h *OrdineHandler) CreateOrdine(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "JSON non valido", http.StatusBadRequest)
 		return
 	}
+	if !ristoranteCorpo(r, &ordine.IDRistorante) {
+		http.Error(w, "IDRistorante diverso dal ristorante della richiesta", http.StatusBadRequest)
+		return
+	}
 	if ordine.IDTavolo <= 0 || ordine.NumPersone <= 0 || ordine.IDRistorante <= 0 {
 		http.Error(w, "Tutti i campi obbligatori devono essere validi", http.StatusBadRequest)
 		return
 	}
-	if err := h.Repo.Create(ctx, &ordine); err != nil {
-		http.Error(w, "Errore nella creazione dell'ordine", http.StatusInternalServerError)
-		log.Printf("Errore creazione ordine: %v", err)
+	if err := h.Repo.Create(ctx, &ordine, attoreRichiesta(r, "")); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrTavoloInesistente):
+			http.Error(w, "Tavolo non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrTavoloAltroRistorante):
+			http.Error(w, "Il tavolo non appartiene al ristorante dell'ordine", http.StatusBadRequest)
+		default:
+			http.Error(w, "Errore nella creazione dell'ordine", http.StatusInternalServerError)
+			log.Printf("Errore creazione ordine: %v", err)
+		}
 		return
 	}
-	h.Cache.Invalidate(ctx)
+	h.Cache.Invalidate(ctx, ordine.IDRistorante)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(ordine)
@@ -109,23 +130,103 @@ func (h *OrdineHandler) UpdateStatoOrdine(w http.ResponseWriter, r *http.Request
 		return
 	}
 	var body struct {
-		Stato string `json:"stato"`
+		Stato  string `json:"stato"`
+		Attore string `json:"attore"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
 		return
 	}
-	ordine, err := h.Repo.UpdateStato(ctx, id, body.Stato)
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	ordine, err := h.Repo.UpdateStato(ctxRaccolta, id, body.Stato, attoreRichiesta(r, body.Attore), h.IngredienteCache)
 	if err != nil {
-		http.Error(w, "Errore nell'aggiornamento stato ordine", http.StatusInternalServerError)
-		log.Printf("Errore aggiornamento stato: %v", err)
+		var transizioneErr *models.ErrTransizioneStato
+		switch {
+		case errors.Is(err, repository.ErrStatoOrdineNonValido):
+			http.Error(w, "Stato non valido", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrOrdineInesistente):
+			http.Error(w, "Ordine non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrPagamentoRichiesto):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.As(err, &transizioneErr):
+			http.Error(w, transizioneErr.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Errore nell'aggiornamento stato ordine", http.StatusInternalServerError)
+			log.Printf("Errore aggiornamento stato: %v", err)
+		}
 		return
 	}
-	h.Cache.Invalidate(ctx)
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+	h.Cache.Invalidate(ctx, ristoranteRisorsa(r))
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ordine)
 }
 
+// GetTransizioni restituisce gli stati successivi consentiti per un ordine
+func (h *OrdineHandler) GetTransizioni(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	ordine, err := h.Repo.GetByID(ctx, id)
+	if err != nil {
+		http.Error(w, "Ordine non trovato", http.StatusNotFound)
+		log.Printf("Errore nel recupero ordine: %v", err)
+		return
+	}
+
+	risposta := struct {
+		IDOrdine    int      `json:"id_ordine"`
+		Stato       string   `json:"stato"`
+		Transizioni []string `json:"transizioni"`
+	}{
+		IDOrdine:    ordine.ID,
+		Stato:       ordine.Stato,
+		Transizioni: models.TransizioniConsentite(ordine.Stato),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(risposta)
+}
+
+// GetStorico restituisce la cronologia degli stati di un ordine con le durate delle fasi
+func (h *OrdineHandler) GetStorico(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	storico, err := h.Repo.GetStorico(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrdineInesistente) {
+			http.Error(w, "Ordine non trovato", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel recupero dello storico dell'ordine", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero dello storico ordine: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(storico)
+}
+
+// attoreRichiesta restituisce chi ha eseguito l'operazione: il valore esplicito
+// nel corpo della richiesta oppure, in sua assenza, l'header X-Attore
+func attoreRichiesta(r *http.Request, attore string) string {
+	if attore != "" {
+		return attore
+	}
+	return r.Header.Get("X-Attore")
+}
+
 func (h *OrdineHandler) DeleteOrdine(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	idStr := chi.URLParam(r, "id")
@@ -134,12 +235,18 @@ func (h *OrdineHandler) DeleteOrdine(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "ID non valido", http.StatusBadRequest)
 		return
 	}
-	if err := h.Repo.Delete(ctx, id); err != nil {
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	if err := h.Repo.Delete(ctxRaccolta, id, h.IngredienteCache); err != nil {
+		if errors.Is(err, repository.ErrOrdineInesistente) {
+			http.Error(w, "Ordine non trovato", http.StatusNotFound)
+			return
+		}
 		http.Error(w, "Errore nella cancellazione dell'ordine", http.StatusInternalServerError)
 		log.Printf("Errore cancellazione ordine: %v", err)
 		return
 	}
-	h.Cache.Invalidate(ctx)
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+	h.Cache.Invalidate(ctx, ristoranteRisorsa(r))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -153,6 +260,38 @@ func (h *OrdineHandler) CalcolaScontrino(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Formato della risposta: JSON (predefinito), testo, PDF o ESC/POS
+	formato, err := stampa.FormatoRichiesto(r.URL.Query().Get("format"), r.Header.Get("Accept"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Con ?split=equal&parti=N restituisce lo scontrino diviso in parti uguali (senza registrarlo)
+	if split := r.URL.Query().Get("split"); split != "" {
+		if split != models.DivisioneEqua {
+			http.Error(w, "Modalità di divisione non valida", http.StatusBadRequest)
+			return
+		}
+		if formato != stampa.FormatoJSON {
+			http.Error(w, "La stampa è disponibile solo per lo scontrino non diviso", http.StatusBadRequest)
+			return
+		}
+		parti, err := strconv.Atoi(r.URL.Query().Get("parti"))
+		if err != nil {
+			http.Error(w, "Numero di parti non valido", http.StatusBadRequest)
+			return
+		}
+		scontrinoDiviso, err := h.Repo.DividiScontrinoEquo(ctx, idTavolo, parti, false)
+		if err != nil {
+			h.scriviErroreDivisione(w, err)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scontrinoDiviso)
+		return
+	}
+
 	// Calcola lo scontrino
 	scontrino, err := h.Repo.CalcolaScontrino(ctx, idTavolo)
 	if err != nil {
@@ -170,22 +309,212 @@ func (h *OrdineHandler) CalcolaScontrino(w http.ResponseWriter, r *http.Request)
 
 	// Invalida la cache degli ordini
 	if h.Cache != nil {
-		h.Cache.Invalidate(ctx)
+		h.Cache.Invalidate(ctx, ristoranteRisorsa(r))
+	}
+
+	if formato != stampa.FormatoJSON {
+		h.stampaScontrino(w, r, formato, scontrino)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(scontrino)
 }
 
-// GetAllOrdiniCompleti recupera tutti gli ordini con i dettagli completi (pietanze e menu)
+// stampaScontrino scrive lo scontrino nel formato stampabile richiesto,
+// con l'intestazione del ristorante e le voci dell'ordine
+func (h *OrdineHandler) stampaScontrino(w http.ResponseWriter, r *http.Request, formato string, scontrino *models.Scontrino) {
+	ctx := r.Context()
+
+	ordineCompleto, err := h.Repo.GetOrdineCompleto(ctx, scontrino.IDOrdine)
+	if err != nil {
+		http.Error(w, "Errore nel recupero delle voci dell'ordine", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero dell'ordine completo %d: %v", scontrino.IDOrdine, err)
+		return
+	}
+
+	ristorante, err := h.RistoranteRepo.GetByID(ctx, ordineCompleto.Ordine.IDRistorante)
+	if err != nil {
+		http.Error(w, "Errore nel recupero del ristorante", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero del ristorante %d: %v", ordineCompleto.Ordine.IDRistorante, err)
+		return
+	}
+
+	documento, err := stampa.Genera(formato, stampa.DatiScontrino{
+		NomeRistorante: ristorante.Nome,
+		Scontrino:      *scontrino,
+		Ordine:         *ordineCompleto,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", stampa.ContentType(formato))
+	if formato == stampa.FormatoPDF {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"scontrino-%d.pdf\"", scontrino.IDOrdine))
+	}
+	w.Write(documento)
+}
+
+// DividiScontrino divide e registra il conto dell'ordine consegnato di un tavolo
+// Con ?split=equal&parti=N divide in parti uguali, altrimenti il corpo della richiesta
+// assegna righe e menu fissi a parti nominative. Ogni parte può essere pagata separatamente
+func (h *OrdineHandler) DividiScontrino(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idTavoloStr := chi.URLParam(r, "id_tavolo")
+	idTavolo, err := strconv.Atoi(idTavoloStr)
+	if err != nil {
+		http.Error(w, "ID tavolo non valido", http.StatusBadRequest)
+		return
+	}
+
+	var scontrinoDiviso *models.ScontrinoDiviso
+	switch r.URL.Query().Get("split") {
+	case models.DivisioneEqua:
+		parti, err := strconv.Atoi(r.URL.Query().Get("parti"))
+		if err != nil {
+			http.Error(w, "Numero di parti non valido", http.StatusBadRequest)
+			return
+		}
+		scontrinoDiviso, err = h.Repo.DividiScontrinoEquo(ctx, idTavolo, parti, true)
+		if err != nil {
+			h.scriviErroreDivisione(w, err)
+			return
+		}
+	case "", models.DivisionePerVoce:
+		var body struct {
+			Parti []models.RichiestaParte `json:"parti"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+			return
+		}
+		scontrinoDiviso, err = h.Repo.DividiScontrinoPerVoce(ctx, idTavolo, body.Parti)
+		if err != nil {
+			h.scriviErroreDivisione(w, err)
+			return
+		}
+	default:
+		http.Error(w, "Modalità di divisione non valida", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(scontrinoDiviso)
+}
+
+// scriviErroreDivisione traduce gli errori della divisione del conto nelle risposte HTTP
+func (h *OrdineHandler) scriviErroreDivisione(w http.ResponseWriter, err error) {
+	var ordineErr *models.ErrOrdineNonTrovato
+	switch {
+	case errors.As(err, &ordineErr):
+		http.Error(w, ordineErr.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrDivisioneNonValida):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrSottocontoPagato):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Errore nella divisione dello scontrino", http.StatusInternalServerError)
+		log.Printf("Errore nella divisione dello scontrino: %v", err)
+	}
+}
+
+// GetSottoconti restituisce le parti del conto diviso di un ordine con lo stato di pagamento
+func (h *OrdineHandler) GetSottoconti(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	sottoconti, err := h.Repo.GetSottoconti(ctx, id)
+	if err != nil {
+		http.Error(w, "Errore nel recupero dei sottoconti", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero dei sottoconti: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sottoconti)
+}
+
+// RegistraPagamento registra il pagamento di un ordine consegnato,
+// chiude l'ordine e libera il tavolo
+func (h *OrdineHandler) RegistraPagamento(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		IDSottoconto *int           `json:"id_sottoconto"`
+		Importo      models.Importo `json:"importo"`
+		Metodo       string         `json:"metodo"`
+		Mancia       models.Importo `json:"mancia"`
+		Attore       string         `json:"attore"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	pagamento := models.Pagamento{
+		IDSottoconto: body.IDSottoconto,
+		Importo:      body.Importo,
+		Metodo:       body.Metodo,
+		Mancia:       body.Mancia,
+	}
+	esito, err := h.Repo.RegistraPagamento(ctx, id, &pagamento, attoreRichiesta(r, body.Attore), h.TavoloRepo)
+	if err != nil {
+		var transizioneErr *models.ErrTransizioneStato
+		switch {
+		case errors.Is(err, repository.ErrOrdineInesistente):
+			http.Error(w, "Ordine non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrMetodoPagamentoNonValido):
+			http.Error(w, "Metodo di pagamento non valido (contanti, carta, buono)", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrImportoNonValido):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, repository.ErrImportoInsufficiente):
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		case errors.Is(err, repository.ErrSottocontoInesistente):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, repository.ErrContoDiviso), errors.Is(err, repository.ErrSottocontoPagato):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.As(err, &transizioneErr):
+			http.Error(w, transizioneErr.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Errore nella registrazione del pagamento", http.StatusInternalServerError)
+			log.Printf("Errore nella registrazione del pagamento: %v", err)
+		}
+		return
+	}
+
+	// Invalida la cache degli ordini e dei tavoli
+	h.Cache.Invalidate(ctx, ristoranteRisorsa(r))
+	_ = h.TavoloCache.InvalidateTavoli(ctx, ristoranteRisorsa(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(esito)
+}
+
+// GetAllOrdiniCompleti recupera gli ordini aperti del ristorante della richiesta con i dettagli completi (pietanze e menu)
 func (h *OrdineHandler) GetAllOrdiniCompleti(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	idRistorante := ristoranteRichiesta(r)
 
 	// Tenta di recuperare dalla cache
-	ordiniCompleti, err := h.Cache.GetAllOrdiniCompleti(ctx)
+	ordiniCompleti, err := h.Cache.GetAllOrdiniCompleti(ctx, idRistorante)
 	if err != nil || ordiniCompleti == nil {
 		// Cache miss o errore, recupera dal database
-		ordiniCompleti, err = h.Repo.GetAllOrdiniCompleti(ctx)
+		ordiniCompleti, err = h.Repo.GetAllOrdiniCompleti(ctx, idRistorante)
 		if err != nil {
 			http.Error(w, "Errore nel recupero degli ordini completi", http.StatusInternalServerError)
 			log.Printf("Errore nel recupero degli ordini completi: %v", err)
@@ -193,7 +522,7 @@ func (h *OrdineHandler) GetAllOrdiniCompleti(w http.ResponseWriter, r *http.Requ
 		}
 
 		// Salva in cache per le future richieste
-		if err := h.Cache.SetAllOrdiniCompleti(ctx, ordiniCompleti); err != nil {
+		if err := h.Cache.SetAllOrdiniCompleti(ctx, idRistorante, ordiniCompleti); err != nil {
 			log.Printf("Errore nell'aggiornamento della cache per ordini completi: %v", err)
 			// Continua comunque
 		}
@@ -202,3 +531,171 @@ func (h *OrdineHandler) GetAllOrdiniCompleti(w http.ResponseWriter, r *http.Requ
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ordiniCompleti)
 }
+
+// ApplicaSconto applica a un ordine uno sconto indicato per ID o per codice promozionale
+// e restituisce lo scontrino ricalcolato
+func (h *OrdineHandler) ApplicaSconto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		IDSconto int    `json:"id_sconto"`
+		Codice   string `json:"codice"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+	if body.IDSconto <= 0 && body.Codice == "" {
+		http.Error(w, "Indicare id_sconto o codice", http.StatusBadRequest)
+		return
+	}
+
+	scontrino, err := h.Repo.ApplicaSconto(ctx, id, body.IDSconto, body.Codice)
+	if err != nil {
+		scriviErroreSconto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(scontrino)
+}
+
+// RimuoviSconto toglie uno sconto da un ordine e restituisce lo scontrino ricalcolato
+func (h *OrdineHandler) RimuoviSconto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+	idSconto, err := strconv.Atoi(chi.URLParam(r, "id_sconto"))
+	if err != nil {
+		http.Error(w, "ID sconto non valido", http.StatusBadRequest)
+		return
+	}
+
+	scontrino, err := h.Repo.RimuoviSconto(ctx, id, idSconto)
+	if err != nil {
+		scriviErroreSconto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scontrino)
+}
+
+// RimuoviRiga elimina una riga dell'ordine (o l'intero menu fisso di cui fa parte)
+// restituendo gli ingredienti al magazzino; restituisce l'ordine con il costo aggiornato
+func (h *OrdineHandler) RimuoviRiga(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, idDettaglio, ok := parametriRiga(w, r)
+	if !ok {
+		return
+	}
+
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	ordine, err := h.Repo.RimuoviRiga(ctxRaccolta, id, idDettaglio, h.IngredienteCache)
+	if err != nil {
+		scriviErroreRiga(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+	h.Cache.Invalidate(ctx, ristoranteRisorsa(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ordine)
+}
+
+// ModificaRiga cambia la quantità di una riga dell'ordine (per un menu fisso, il numero di menu)
+// aggiornando le scorte di ingredienti; restituisce l'ordine con il costo aggiornato
+func (h *OrdineHandler) ModificaRiga(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, idDettaglio, ok := parametriRiga(w, r)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Quantita int `json:"quantita"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	ordine, err := h.Repo.ModificaQuantitaRiga(ctxRaccolta, id, idDettaglio, body.Quantita, h.IngredienteCache)
+	if err != nil {
+		scriviErroreRiga(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+	h.Cache.Invalidate(ctx, ristoranteRisorsa(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ordine)
+}
+
+// parametriRiga legge l'ID dell'ordine e della riga dal percorso
+func parametriRiga(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	idDettaglio, err := strconv.Atoi(chi.URLParam(r, "id_dettaglio"))
+	if err != nil {
+		http.Error(w, "ID riga non valido", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return id, idDettaglio, true
+}
+
+// scriviErroreRiga traduce gli errori di modifica delle righe nella risposta HTTP corrispondente
+func scriviErroreRiga(w http.ResponseWriter, err error) {
+	var mancantiErr *repository.ErrIngredientiMancanti
+	switch {
+	case errors.Is(err, repository.ErrOrdineInesistente), errors.Is(err, repository.ErrRigaInesistente):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrQuantitaNonValida):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.As(err, &mancantiErr):
+		http.Error(w, mancantiErr.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrOrdineChiuso), errors.Is(err, repository.ErrRigaNonModificabile),
+		errors.Is(err, repository.ErrSottocontoPagato):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Errore nella modifica della riga dell'ordine", http.StatusInternalServerError)
+		log.Printf("Errore nella modifica della riga dell'ordine: %v", err)
+	}
+}
+
+// GetLottiOrdine restituisce i lotti di ingredienti usati per preparare l'ordine (tracciabilità)
+func (h *OrdineHandler) GetLottiOrdine(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	lotti, err := h.Repo.LottiUtilizzati(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrdineInesistente) {
+			http.Error(w, "Ordine non trovato", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel recupero dei lotti dell'ordine", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero dei lotti dell'ordine: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lotti)
+}
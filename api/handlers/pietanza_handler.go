@@ -1,14 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
 	"log"
 	"net/http"
 	"ristorante-api/cache"
 	"ristorante-api/models"
 	"ristorante-api/repository"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 )
@@ -39,28 +41,75 @@ func NewPietanzaHandler(
 	}
 }
 
-// GetPietanze restituisce tutte le pietanze disponibili
+// GetPietanze restituisce tutte le pietanze disponibili, con allergeni e diete ricavati dalla ricetta
+// Con ?con_porzioni=true riporta anche le porzioni preparabili con le scorte attuali, sempre lette dal database.
+// Con ?senza=glutine,lattosio esclude le pietanze con quegli allergeni e con ?dieta=vegana tiene solo quelle
+// compatibili: in entrambi i casi sono escluse le pietanze senza ricetta, di cui non si conoscono gli allergeni
 func (h *PietanzaHandler) GetPietanze(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
+	filtro, err := leggiFiltroAllergeni(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	conPorzioni := false
+	if s := r.URL.Query().Get("con_porzioni"); s != "" {
+		conPorzioni, err = strconv.ParseBool(s)
+		if err != nil {
+			http.Error(w, "Parametro con_porzioni non valido", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var pietanze []models.Pietanza
+	if conPorzioni {
+		pietanze, err = h.repo.GetAllConPorzioni(ctx)
+		if err != nil {
+			http.Error(w, "Errore nel calcolo delle porzioni disponibili", http.StatusInternalServerError)
+			log.Printf("Errore nel calcolo delle porzioni disponibili: %v", err)
+			return
+		}
+	} else {
+		pietanze, err = h.pietanze(ctx)
+		if err != nil {
+			http.Error(w, "Errore nel recupero delle pietanze", http.StatusInternalServerError)
+			log.Printf("Errore nel recupero delle pietanze: %v", err)
+			return
+		}
+	}
+
+	profili, err := profiliAllergeni(ctx, h.ricettaRepo)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli allergeni", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli allergeni: %v", err)
+		return
+	}
+	applicaAllergeni(pietanze, profili)
+	if filtro.attivo() {
+		pietanze = filtro.filtra(pietanze)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pietanze)
+}
+
+// pietanze restituisce tutte le pietanze, dalla cache o dal database
+func (h *PietanzaHandler) pietanze(ctx context.Context) ([]models.Pietanza, error) {
 	// Tenta di recuperare le pietanze dalla cache
 	cached, found, err := h.cache.GetAll(ctx)
 	if err != nil {
 		log.Printf("Errore nell'accesso alla cache: %v", err)
 		// Continua con il database in caso di errore della cache
 	} else if found {
-		// Usa i dati dalla cache
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(cached)
-		return
+		return cached, nil
 	}
 
 	// Cache miss o errore, recupera dal database
 	pietanze, err := h.repo.GetAll(ctx)
 	if err != nil {
-		http.Error(w, "Errore nel recupero delle pietanze", http.StatusInternalServerError)
-		log.Printf("Errore nel recupero delle pietanze: %v", err)
-		return
+		return nil, err
 	}
 
 	// Salva i risultati in cache per le future richieste
@@ -68,9 +117,7 @@ func (h *PietanzaHandler) GetPietanze(w http.ResponseWriter, r *http.Request) {
 		log.Printf("Errore nell'aggiornamento della cache: %v", err)
 		// Continua comunque
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(pietanze)
+	return pietanze, nil
 }
 
 // GetPietanza restituisce una singola pietanza per ID
@@ -88,26 +135,32 @@ func (h *PietanzaHandler) GetPietanza(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		log.Printf("Errore nell'accesso alla cache: %v", err)
 		// Continua con il database in caso di errore della cache
-	} else if found {
-		// Usa i dati dalla cache
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(pietanza)
-		return
 	}
 
-	// Cache miss o errore, recupera dal database
-	pietanza, err = h.repo.GetByID(ctx, id)
-	if err != nil {
-		http.Error(w, "Pietanza non trovata", http.StatusNotFound)
-		log.Printf("Errore nel recupero della pietanza: %v", err)
-		return
+	if !found {
+		// Cache miss o errore, recupera dal database
+		pietanza, err = h.repo.GetByID(ctx, id)
+		if err != nil {
+			http.Error(w, "Pietanza non trovata", http.StatusNotFound)
+			log.Printf("Errore nel recupero della pietanza: %v", err)
+			return
+		}
+
+		// Salva in cache per le future richieste
+		if err := h.cache.SetByID(ctx, id, pietanza); err != nil {
+			log.Printf("Errore nell'aggiornamento della cache: %v", err)
+			// Continua comunque
+		}
 	}
 
-	// Salva in cache per le future richieste
-	if err := h.cache.SetByID(ctx, id, pietanza); err != nil {
-		log.Printf("Errore nell'aggiornamento della cache: %v", err)
-		// Continua comunque
+	// Allergeni e diete ricavati dalla ricetta attiva
+	profili, err := profiliAllergeni(ctx, h.ricettaRepo)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli allergeni", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli allergeni: %v", err)
+		return
 	}
+	pietanza.ProfiloAllergeni = profili[pietanza.ID]
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(pietanza)
@@ -130,6 +183,10 @@ func (h *PietanzaHandler) CreatePietanza(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Nome e prezzo sono campi obbligatori", http.StatusBadRequest)
 		return
 	}
+	if p.AliquotaIVA != nil && !models.AliquotaIVAValida(*p.AliquotaIVA) {
+		http.Error(w, "Aliquota IVA non valida (tra 0 e 100)", http.StatusBadRequest)
+		return
+	}
 
 	// Inserimento nel database
 	err := h.repo.Create(ctx, &p)
@@ -173,6 +230,10 @@ func (h *PietanzaHandler) UpdatePietanza(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Nome e prezzo sono campi obbligatori", http.StatusBadRequest)
 		return
 	}
+	if p.AliquotaIVA != nil && !models.AliquotaIVAValida(*p.AliquotaIVA) {
+		http.Error(w, "Aliquota IVA non valida (tra 0 e 100)", http.StatusBadRequest)
+		return
+	}
 
 	// Verifica che la pietanza esista
 	exists, err := h.repo.Exists(ctx, id)
@@ -276,19 +337,24 @@ func (h *PietanzaHandler) AddPietanzaToOrdine(w http.ResponseWriter, r *http.Req
 	}
 
 	// Aggiungi la pietanza all'ordine
-	err = h.repo.AddPietanzaToOrdine(ctx, idOrdine, requestBody.IDPietanza, requestBody.Quantita, h.ricettaRepo, h.ingredienteCache)
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	err = h.repo.AddPietanzaToOrdine(ctxRaccolta, idOrdine, requestBody.IDPietanza, requestBody.Quantita, h.ricettaRepo, h.ingredienteCache)
 	if err != nil {
-		switch err {
-		case repository.ErrPietanzaNonDisponibile:
+		var mancantiErr *repository.ErrIngredientiMancanti
+		switch {
+		case errors.Is(err, repository.ErrPietanzaNonDisponibile):
 			http.Error(w, "La pietanza non è disponibile", http.StatusBadRequest)
-		case repository.ErrIngredientiInsufficienti:
-			http.Error(w, "Ingredienti insufficienti per preparare la pietanza", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrPietanzaNonInMenu):
+			http.Error(w, "La pietanza non è nel menu del ristorante dell'ordine", http.StatusBadRequest)
+		case errors.As(err, &mancantiErr):
+			http.Error(w, mancantiErr.Error(), http.StatusBadRequest)
 		default:
 			http.Error(w, "Errore nell'aggiunta della pietanza all'ordine", http.StatusInternalServerError)
 			log.Printf("Errore nell'aggiunta della pietanza all'ordine: %v", err)
 		}
 		return
 	}
+	repository.InvalidaCachePietanze(ctx, h.cache, *cambiate)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Pietanza aggiunta all'ordine con successo"})
@@ -330,26 +396,87 @@ func (h *PietanzaHandler) AddMenuFissoToOrdine(w http.ResponseWriter, r *http.Re
 	}
 
 	// Aggiungi il menu all'ordine
-	err = h.repo.AddMenuFissoToOrdine(ctx, idOrdine, requestBody.IDMenu, h.ricettaRepo, h.menuRepo, h.ingredienteCache)
+	ctxRaccolta, cambiate := repository.RaccogliPietanzeCambiate(ctx)
+	err = h.repo.AddMenuFissoToOrdine(ctxRaccolta, idOrdine, requestBody.IDMenu, h.ricettaRepo, h.menuRepo, h.ingredienteCache)
 	if err != nil {
-		switch err {
-		case repository.ErrMenuNonDisponibile:
+		var mancantiErr *repository.ErrIngredientiMancanti
+		switch {
+		case errors.Is(err, repository.ErrMenuNonDisponibile):
 			http.Error(w, "Il menu fisso non è disponibile: una o più pietanze non sono disponibili o mancano ingredienti", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrPietanzaNonInMenu):
+			http.Error(w, "Il menu fisso contiene pietanze che non sono nel menu del ristorante dell'ordine", http.StatusBadRequest)
+		case errors.As(err, &mancantiErr):
+			http.Error(w, "Il menu fisso non è disponibile: "+mancantiErr.Error(), http.StatusBadRequest)
 		default:
 			http.Error(w, "Errore nell'aggiunta del menu fisso all'ordine", http.StatusInternalServerError)
 			log.Printf("Errore nell'aggiunta del menu fisso all'ordine: %v", err)
 		}
 		return
 	}
+	repository.InvalidaCachePietanze(ctx, h.cache, *cambiate)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{
 		"message":   "Menu fisso aggiunto all'ordine con successo",
 		"nome_menu": menuFisso.Nome,
-		"prezzo":    fmt.Sprintf("%.2f", menuFisso.Prezzo),
+		"prezzo":    menuFisso.Prezzo.String(),
 	})
 }
 
+// GetEventiDisponibilita restituisce i cambi automatici di disponibilità delle pietanze dovuti alle scorte,
+// dal più recente, filtrabili per periodo (dal, al)
+func (h *PietanzaHandler) GetEventiDisponibilita(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	dal, al := query.Get("dal"), query.Get("al")
+	if dal != "" {
+		if _, err := time.Parse("2006-01-02", dal); err != nil {
+			http.Error(w, "Data di inizio non valida (formato AAAA-MM-GG)", http.StatusBadRequest)
+			return
+		}
+	}
+	if al != "" {
+		if _, err := time.Parse("2006-01-02", al); err != nil {
+			http.Error(w, "Data di fine non valida (formato AAAA-MM-GG)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	eventi, err := h.repo.EventiDisponibilita(r.Context(), dal, al)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli eventi di disponibilità", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli eventi di disponibilità: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(eventi)
+}
+
+// GetCosto restituisce il food cost di una porzione della pietanza, calcolato dalla ricetta,
+// con il margine lordo sul prezzo al netto dell'IVA
+func (h *PietanzaHandler) GetCosto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	costo, err := h.repo.Costo(ctx, id)
+	if err != nil {
+		if errors.Is(err, repository.ErrPietanzaInesistente) {
+			http.Error(w, "Pietanza non trovata", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel calcolo del costo della pietanza", http.StatusInternalServerError)
+		log.Printf("Errore nel calcolo del costo della pietanza: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(costo)
+}
+
 // GetRicettaByPietanzaID restituisce la ricetta completa con ingredienti di una pietanza
 func (h *PietanzaHandler) GetRicettaByPietanzaID(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -401,3 +528,65 @@ func (h *PietanzaHandler) GetRicettaByPietanzaID(w http.ResponseWriter, r *http.
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(ricettaCompleta)
 }
+
+// ImpostaIngredienteRicetta aggiunge un ingrediente alla ricetta della pietanza o ne aggiorna la quantità;
+// la quantità può essere espressa in un'unità diversa da quella del magazzino (es. grammi per un ingrediente a kg)
+func (h *PietanzaHandler) ImpostaIngredienteRicetta(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID pietanza non valido", http.StatusBadRequest)
+		return
+	}
+	idIngrediente, err := strconv.Atoi(chi.URLParam(r, "id_ingrediente"))
+	if err != nil {
+		http.Error(w, "ID ingrediente non valido", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Quantita    float64 `json:"quantita"`
+		UnitaMisura string  `json:"unita_misura"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	riga := &models.RicettaIngrediente{
+		IDIngrediente: idIngrediente,
+		Quantita:      body.Quantita,
+		UnitaMisura:   body.UnitaMisura,
+	}
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	if err := h.ricettaRepo.ImpostaIngrediente(ctx, id, riga); err != nil {
+		scriviErroreRicetta(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.cache, *cambiate)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(riga)
+}
+
+// RimuoviIngredienteRicetta toglie un ingrediente dalla ricetta della pietanza
+func (h *PietanzaHandler) RimuoviIngredienteRicetta(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID pietanza non valido", http.StatusBadRequest)
+		return
+	}
+	idIngrediente, err := strconv.Atoi(chi.URLParam(r, "id_ingrediente"))
+	if err != nil {
+		http.Error(w, "ID ingrediente non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	if err := h.ricettaRepo.RimuoviIngrediente(ctx, id, idIngrediente); err != nil {
+		scriviErroreRicetta(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.cache, *cambiate)
+
+	w.WriteHeader(http.StatusNoContent)
+}
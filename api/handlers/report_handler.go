@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type ReportHandler struct {
+	Repo          *repository.ReportRepository
+	PietanzaRepo  *repository.PietanzaRepository
+	MargineMinimo float64
+}
+
+func NewReportHandler(repo *repository.ReportRepository, pietanzaRepo *repository.PietanzaRepository, margineMinimo float64) *ReportHandler {
+	return &ReportHandler{Repo: repo, PietanzaRepo: pietanzaRepo, MargineMinimo: margineMinimo}
+}
+
+// GetChiusura restituisce la chiusura giornaliera di un ristorante
+// Parametri: data (AAAA-MM-GG, predefinita oggi) e id_ristorante (obbligatorio)
+// Con ?format=csv o Accept: text/csv il report viene esportato in CSV
+func (h *ReportHandler) GetChiusura(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	data := query.Get("data")
+	if data == "" {
+		data = time.Now().Format("2006-01-02")
+	}
+	if _, err := time.Parse("2006-01-02", data); err != nil {
+		http.Error(w, "Data non valida (formato AAAA-MM-GG)", http.StatusBadRequest)
+		return
+	}
+
+	idRistorante, err := strconv.Atoi(query.Get("id_ristorante"))
+	if err != nil {
+		http.Error(w, "ID ristorante non valido", http.StatusBadRequest)
+		return
+	}
+
+	formato := strings.ToLower(query.Get("format"))
+	if formato == "" && strings.Contains(r.Header.Get("Accept"), "text/csv") {
+		formato = "csv"
+	}
+	if formato != "" && formato != "json" && formato != "csv" {
+		http.Error(w, "Formato non supportato (json, csv)", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Repo.Chiusura(ctx, data, idRistorante)
+	if err != nil {
+		if errors.Is(err, repository.ErrRistoranteInesistente) {
+			http.Error(w, "Ristorante non trovato", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Errore nel calcolo della chiusura giornaliera", http.StatusInternalServerError)
+		log.Printf("Errore nel calcolo della chiusura giornaliera: %v", err)
+		return
+	}
+
+	if formato == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"chiusura-%d-%s.csv\"", idRistorante, data))
+		if err := scriviChiusuraCSV(w, report); err != nil {
+			log.Printf("Errore nella scrittura del CSV della chiusura: %v", err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GetMargini restituisce food cost e margine di tutte le pietanze, dal margine più basso,
+// segnalando quelle sotto il margine minimo (configurato con MARGINE_MINIMO o indicato con ?margine_minimo=)
+func (h *ReportHandler) GetMargini(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	margineMinimo := h.MargineMinimo
+	if s := r.URL.Query().Get("margine_minimo"); s != "" {
+		var err error
+		margineMinimo, err = strconv.ParseFloat(s, 64)
+		if err != nil || margineMinimo < 0 || margineMinimo > 100 {
+			http.Error(w, "Margine minimo non valido (percentuale tra 0 e 100)", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := h.PietanzaRepo.ReportMargini(ctx, margineMinimo)
+	if err != nil {
+		http.Error(w, "Errore nel calcolo dei margini", http.StatusInternalServerError)
+		log.Printf("Errore nel calcolo dei margini: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// scriviChiusuraCSV esporta la chiusura giornaliera in CSV con le colonne sezione, voce, quantita, importo
+func scriviChiusuraCSV(w io.Writer, report *models.ReportChiusura) error {
+	c := csv.NewWriter(w)
+	righe := [][]string{
+		{"sezione", "voce", "quantita", "importo"},
+		{"riepilogo", "data", "", report.Data},
+		{"riepilogo", "ordini", strconv.Itoa(report.NumOrdini), ""},
+		{"riepilogo", "coperti", strconv.Itoa(report.NumCoperti), report.IncassoCoperto.String()},
+		{"riepilogo", "alla_carta", "", report.ImportoAllaCarta.String()},
+		{"riepilogo", "menu_fissi", strconv.Itoa(report.NumMenuFissi), report.ImportoMenuFissi.String()},
+		{"riepilogo", "sconti", "", (-report.ImportoSconti).String()},
+		{"riepilogo", "servizio", "", report.ImportoServizio.String()},
+		{"riepilogo", "incasso_totale", strconv.Itoa(report.NumOrdini), report.IncassoTotale.String()},
+		{"riepilogo", "scontrino_medio", "", report.ScontrinoMedio.String()},
+		{"riepilogo", "mance", "", report.Mance.String()},
+	}
+	for _, categoria := range report.PerCategoria {
+		righe = append(righe, []string{"categoria", categoria.Categoria, strconv.Itoa(categoria.Quantita), categoria.Importo.String()})
+	}
+	for _, metodo := range report.PerMetodo {
+		righe = append(righe, []string{"metodo", metodo.Metodo, strconv.Itoa(metodo.NumPagamenti), metodo.Importo.String()})
+	}
+	for _, iva := range report.IVA {
+		aliquota := iva.Aliquota.String() + "%"
+		righe = append(righe,
+			[]string{"iva", aliquota + " imponibile", "", iva.Imponibile.String()},
+			[]string{"iva", aliquota + " imposta", "", iva.Imposta.String()},
+			[]string{"iva", aliquota + " totale", "", iva.Totale.String()},
+		)
+	}
+
+	if err := c.WriteAll(righe); err != nil {
+		return err
+	}
+	return c.Error()
+}
+
+// GetSprechi restituisce il valore degli sprechi per ingrediente e per causale
+// Parametri: dal, al (formato AAAA-MM-GG, predefiniti gli ultimi 30 giorni)
+func (h *ReportHandler) GetSprechi(w http.ResponseWriter, r *http.Request) {
+	filtro, _, err := filtroAnalisi(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Repo.Sprechi(r.Context(), filtro.Dal, filtro.Al)
+	if err != nil {
+		http.Error(w, "Errore nel calcolo del report degli sprechi", http.StatusInternalServerError)
+		log.Printf("Errore nel calcolo del report degli sprechi: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"ristorante-api/unita"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type RicettaHandler struct {
+	Repo          *repository.RicettaRepository
+	PietanzaCache *cache.PietanzaCache
+}
+
+func NewRicettaHandler(repo *repository.RicettaRepository, pietanzaCache *cache.PietanzaCache) *RicettaHandler {
+	return &RicettaHandler{Repo: repo, PietanzaCache: pietanzaCache}
+}
+
+// GetRicette restituisce la versione attiva delle ricette di tutte le pietanze
+func (h *RicettaHandler) GetRicette(w http.ResponseWriter, r *http.Request) {
+	ricette, err := h.Repo.GetAll(r.Context())
+	if err != nil {
+		http.Error(w, "Errore nel recupero delle ricette", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero delle ricette: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ricette)
+}
+
+// GetRicetta restituisce una versione della ricetta con i suoi ingredienti
+func (h *RicettaHandler) GetRicetta(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	ricetta, err := h.Repo.GetByID(r.Context(), id)
+	if err != nil {
+		scriviErroreRicetta(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ricetta)
+}
+
+// GetVersioniRicetta restituisce tutte le versioni della ricetta della stessa pietanza
+func (h *RicettaHandler) GetVersioniRicetta(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	versioni, err := h.Repo.Versioni(r.Context(), id)
+	if err != nil {
+		scriviErroreRicetta(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versioni)
+}
+
+// CreateRicetta crea la ricetta di una pietanza con i suoi ingredienti
+func (h *RicettaHandler) CreateRicetta(w http.ResponseWriter, r *http.Request) {
+	var ricetta models.RicettaConIngredienti
+	if err := json.NewDecoder(r.Body).Decode(&ricetta); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	if err := h.Repo.Create(ctx, &ricetta); err != nil {
+		scriviErroreRicetta(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ricetta)
+}
+
+// UpdateRicetta modifica la ricetta attiva e i suoi ingredienti; se la ricetta
+// è già stata usata da qualche ordine la risposta contiene la nuova versione
+func (h *RicettaHandler) UpdateRicetta(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	var ricetta models.RicettaConIngredienti
+	if err := json.NewDecoder(r.Body).Decode(&ricetta); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	if err := h.Repo.Update(ctx, id, &ricetta); err != nil {
+		scriviErroreRicetta(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ricetta)
+}
+
+// DeleteRicetta elimina la ricetta di una pietanza
+func (h *RicettaHandler) DeleteRicetta(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	ctx, cambiate := repository.RaccogliPietanzeCambiate(r.Context())
+	if err := h.Repo.Delete(ctx, id); err != nil {
+		scriviErroreRicetta(w, err)
+		return
+	}
+	repository.InvalidaCachePietanze(ctx, h.PietanzaCache, *cambiate)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scriviErroreRicetta traduce gli errori sulle ricette nella risposta HTTP corrispondente
+func scriviErroreRicetta(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrRicettaInesistente), errors.Is(err, repository.ErrIngredienteNonInRicetta):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrPietanzaInesistente):
+		http.Error(w, "Pietanza non trovata", http.StatusNotFound)
+	case errors.Is(err, repository.ErrIngredienteInesistente):
+		http.Error(w, "Ingrediente non trovato", http.StatusNotFound)
+	case errors.Is(err, repository.ErrNomeRicetta), errors.Is(err, repository.ErrQuantitaRicettaNonValida),
+		errors.Is(err, repository.ErrIngredienteRipetuto), errors.Is(err, unita.ErrUnitaSconosciuta),
+		errors.Is(err, unita.ErrUnitaIncompatibili):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrRicettaEsistente), errors.Is(err, repository.ErrRicettaNonAttiva):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Errore nella gestione della ricetta", http.StatusInternalServerError)
+		log.Printf("Errore nella gestione della ricetta: %v", err)
+	}
+}
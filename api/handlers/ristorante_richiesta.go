@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"ristorante-api/repository"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type chiaveContesto string
+
+const (
+	chiaveRistorante        chiaveContesto = "id_ristorante"
+	chiaveRistoranteRisorsa chiaveContesto = "id_ristorante_risorsa"
+)
+
+// RistoranteRichiesta ricava il ristorante a cui si riferisce la richiesta dall'header X-Ristorante
+// o dal parametro id_ristorante e verifica che esista. Senza nessuno dei due vale il ristorante
+// predefinito; se anche questo manca (0) la richiesta è rifiutata
+func RistoranteRichiesta(repo *repository.RistoranteRepository, predefinito int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			valore := r.Header.Get("X-Ristorante")
+			if valore == "" {
+				valore = r.URL.Query().Get("id_ristorante")
+			}
+			if valore == "" {
+				if predefinito == 0 {
+					http.Error(w, "Ristorante obbligatorio: indicarlo con l'header X-Ristorante o il parametro id_ristorante", http.StatusBadRequest)
+					return
+				}
+				valore = strconv.Itoa(predefinito)
+			}
+
+			id, err := strconv.Atoi(valore)
+			if err != nil || id <= 0 {
+				http.Error(w, "ID ristorante non valido", http.StatusBadRequest)
+				return
+			}
+			esiste, err := repo.Exists(r.Context(), id)
+			if err != nil {
+				http.Error(w, "Errore verifica ristorante", http.StatusInternalServerError)
+				log.Printf("Errore verifica ristorante %d: %v", id, err)
+				return
+			}
+			if !esiste {
+				http.Error(w, "Ristorante non trovato", http.StatusNotFound)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chiaveRistorante, id)))
+		})
+	}
+}
+
+// ristoranteRichiesta restituisce il ristorante della richiesta, 0 sulle rotte senza RistoranteRichiesta
+func ristoranteRichiesta(r *http.Request) int {
+	id, _ := r.Context().Value(chiaveRistorante).(int)
+	return id
+}
+
+// AppartieneAlRistorante verifica che la risorsa indicata dal parametro di percorso param esista e,
+// se la richiesta è riferita a un ristorante, che appartenga a quel ristorante: altrimenti risponde
+// 404 con il messaggio nonTrovato. ristoranteDi restituisce il ristorante della risorsa, che resta
+// disponibile agli handler con ristoranteRisorsa
+func AppartieneAlRistorante(param string, ristoranteDi func(context.Context, int) (int, error), nonTrovato string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := strconv.Atoi(chi.URLParam(r, param))
+			if err != nil {
+				// L'handler risponde con l'errore sull'ID
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			idRistorante, err := ristoranteDi(r.Context(), id)
+			if err != nil {
+				if errors.Is(err, repository.ErrOrdineInesistente) || errors.Is(err, repository.ErrTavoloInesistente) {
+					http.Error(w, nonTrovato, http.StatusNotFound)
+					return
+				}
+				http.Error(w, "Errore verifica ristorante", http.StatusInternalServerError)
+				log.Printf("Errore verifica ristorante di %s %d: %v", param, id, err)
+				return
+			}
+			if scope := ristoranteRichiesta(r); scope != 0 && scope != idRistorante {
+				http.Error(w, nonTrovato, http.StatusNotFound)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chiaveRistoranteRisorsa, idRistorante)))
+		})
+	}
+}
+
+// ristoranteRisorsa restituisce il ristorante della risorsa verificata da AppartieneAlRistorante
+func ristoranteRisorsa(r *http.Request) int {
+	id, _ := r.Context().Value(chiaveRistoranteRisorsa).(int)
+	return id
+}
+
+// ristoranteCorpo completa l'id_ristorante del corpo della richiesta con quello della richiesta
+// e segnala se i due non coincidono
+func ristoranteCorpo(r *http.Request, idRistorante *int) bool {
+	scope := ristoranteRichiesta(r)
+	if scope == 0 {
+		return true
+	}
+	if *idRistorante == 0 {
+		*idRistorante = scope
+	}
+	return *idRistorante == scope
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"ristorante-api/models"
+	"ristorante-api/repository"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type ScontoHandler struct {
+	Repo *repository.ScontoRepository
+}
+
+func NewScontoHandler(repo *repository.ScontoRepository) *ScontoHandler {
+	return &ScontoHandler{Repo: repo}
+}
+
+// GetSconti restituisce tutti gli sconti e i codici promozionali
+func (h *ScontoHandler) GetSconti(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sconti, err := h.Repo.GetAll(ctx)
+	if err != nil {
+		http.Error(w, "Errore nel recupero degli sconti", http.StatusInternalServerError)
+		log.Printf("Errore nel recupero degli sconti: %v", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sconti)
+}
+
+// GetSconto restituisce uno sconto per ID
+func (h *ScontoHandler) GetSconto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	sconto, err := h.Repo.GetByID(ctx, id)
+	if err != nil {
+		scriviErroreSconto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sconto)
+}
+
+// CreateSconto crea un nuovo sconto o codice promozionale
+func (h *ScontoHandler) CreateSconto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	sconto := models.Sconto{Attivo: true}
+
+	if err := json.NewDecoder(r.Body).Decode(&sconto); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Create(ctx, &sconto); err != nil {
+		scriviErroreSconto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sconto)
+}
+
+// UpdateSconto aggiorna la definizione di uno sconto
+func (h *ScontoHandler) UpdateSconto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	sconto := models.Sconto{Attivo: true}
+	if err := json.NewDecoder(r.Body).Decode(&sconto); err != nil {
+		http.Error(w, "Formato JSON non valido", http.StatusBadRequest)
+		return
+	}
+
+	sconto.ID = id
+	if err := h.Repo.Update(ctx, &sconto); err != nil {
+		scriviErroreSconto(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(sconto)
+}
+
+// DeleteSconto elimina uno sconto mai applicato
+func (h *ScontoHandler) DeleteSconto(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	idStr := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "ID non valido", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Repo.Delete(ctx, id); err != nil {
+		scriviErroreSconto(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// scriviErroreSconto traduce gli errori sugli sconti nel codice HTTP corrispondente
+func scriviErroreSconto(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repository.ErrScontoInesistente), errors.Is(err, repository.ErrOrdineInesistente):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repository.ErrScontoNonValido):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, repository.ErrScontoNonApplicabile), errors.Is(err, repository.ErrScontoEsaurito):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, repository.ErrCodiceScontoDuplicato),
+		errors.Is(err, repository.ErrScontoInUso),
+		errors.Is(err, repository.ErrScontoUsatoImmutabile),
+		errors.Is(err, repository.ErrScontoGiaApplicato),
+		errors.Is(err, repository.ErrScontoNonApplicato),
+		errors.Is(err, repository.ErrOrdineChiuso),
+		errors.Is(err, repository.ErrSottocontoPagato):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, "Errore nella gestione dello sconto", http.StatusInternalServerError)
+		log.Printf("Errore nella gestione dello sconto: %v", err)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"ristorante-api/cache"
@@ -26,17 +27,18 @@ func NewTavoloHandler(repo *repository.TavoloRepository, cache *cache.TavoloCach
 
 func (h *TavoloHandler) GetTavoli(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	tavoli, err := h.Cache.GetTavoli(ctx)
+	idRistorante := ristoranteRichiesta(r)
+	tavoli, err := h.Cache.GetTavoli(ctx, idRistorante)
 	if err != nil {
 		log.Printf("Errore cache GetTavoli: %v", err)
 	}
 	if tavoli == nil {
-		tavoli, err = h.Repo.GetAll(ctx)
+		tavoli, err = h.Repo.GetAll(ctx, idRistorante)
 		if err != nil {
 			http.Error(w, "Errore recupero tavoli", http.StatusInternalServerError)
 			return
 		}
-		_ = h.Cache.SetTavoli(ctx, tavoli)
+		_ = h.Cache.SetTavoli(ctx, idRistorante, tavoli)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -68,6 +70,10 @@ func (h *TavoloHandler) CreateTavolo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "JSON non valido", http.StatusBadRequest)
 		return
 	}
+	if !ristoranteCorpo(r, &t.IDRistorante) {
+		http.Error(w, "IDRistorante diverso dal ristorante della richiesta", http.StatusBadRequest)
+		return
+	}
 	if t.MaxPosti <= 0 || t.IDRistorante <= 0 {
 		http.Error(w, "MaxPosti e IDRistorante obbligatori", http.StatusBadRequest)
 		return
@@ -79,7 +85,7 @@ func (h *TavoloHandler) CreateTavolo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Errore creazione tavolo", http.StatusInternalServerError)
 		return
 	}
-	_ = h.Cache.InvalidateTavoli(ctx)
+	_ = h.Cache.InvalidateTavoli(ctx, t.IDRistorante)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(t)
@@ -98,15 +104,30 @@ func (h *TavoloHandler) UpdateTavolo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "JSON non valido", http.StatusBadRequest)
 		return
 	}
+	// Il tavolo appartiene già al ristorante della richiesta: un id_ristorante diverso lo passa a un altro ristorante
+	if t.IDRistorante == 0 {
+		t.IDRistorante = ristoranteRisorsa(r)
+	}
 	if t.MaxPosti <= 0 || t.IDRistorante <= 0 {
 		http.Error(w, "MaxPosti e IDRistorante obbligatori", http.StatusBadRequest)
 		return
 	}
 	if err := h.Repo.Update(ctx, id, t); err != nil {
-		http.Error(w, "Errore aggiornamento", http.StatusInternalServerError)
+		switch {
+		case errors.Is(err, repository.ErrTavoloInesistente):
+			http.Error(w, "Tavolo non trovato", http.StatusNotFound)
+		case errors.Is(err, repository.ErrRistoranteInesistente):
+			http.Error(w, "Ristorante di destinazione non trovato", http.StatusBadRequest)
+		case errors.Is(err, repository.ErrTavoloConOrdiniAperti):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			http.Error(w, "Errore aggiornamento", http.StatusInternalServerError)
+		}
 		return
 	}
-	_ = h.Cache.InvalidateTavoli(ctx)
+	// Il tavolo può essere passato a un altro ristorante: invalida entrambi
+	_ = h.Cache.InvalidateTavoli(ctx, ristoranteRisorsa(r))
+	_ = h.Cache.InvalidateTavoli(ctx, t.IDRistorante)
 	t.ID = id
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(t)
@@ -124,7 +145,7 @@ func (h *TavoloHandler) DeleteTavolo(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Errore eliminazione", http.StatusInternalServerError)
 		return
 	}
-	_ = h.Cache.InvalidateTavoli(ctx)
+	_ = h.Cache.InvalidateTavoli(ctx, ristoranteRisorsa(r))
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -152,47 +173,47 @@ func (h *TavoloHandler) CambiaStatoTavolo(w http.ResponseWriter, r *http.Request
 		http.Error(w, "Errore aggiornamento stato", http.StatusInternalServerError)
 		return
 	}
-	_ = h.Cache.InvalidateTavoli(ctx)
-	_ = h.Cache.InvalidateTavoliLiberi(ctx)
-	_ = h.Cache.InvalidateTavoliOccupati(ctx)
+	_ = h.Cache.InvalidateTavoli(ctx, t.IDRistorante)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(t)
 }
 
-// GetTavoliLiberi restituisce i tavoli liberi per un ristorante specifico
+// GetTavoliLiberi restituisce i tavoli liberi del ristorante della richiesta
 func (h *TavoloHandler) GetTavoliLiberi(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
-	tavoli, err := h.Cache.GetTavoliLiberi(ctx)
+	idRistorante := ristoranteRichiesta(r)
+	tavoli, err := h.Cache.GetTavoliLiberi(ctx, idRistorante)
 	if err != nil {
 		log.Printf("Errore cache GetTavoliLiberi: %v", err)
 	}
 	if tavoli == nil {
-		tavoli, err = h.Repo.GetTavoliLiberi(ctx, 1) // Supponiamo ID ristorante 1
+		tavoli, err = h.Repo.GetTavoliLiberi(ctx, idRistorante)
 		if err != nil {
 			http.Error(w, "Errore recupero tavoli liberi", http.StatusInternalServerError)
 			return
 		}
-		_ = h.Cache.SetTavoliLiberi(ctx, tavoli)
+		_ = h.Cache.SetTavoliLiberi(ctx, idRistorante, tavoli)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(tavoli)
 }
 
-// GetTavoliOccupati restituisce i tavoli occupati per un ristorante specifico
+// GetTavoliOccupati restituisce i tavoli occupati del ristorante della richiesta
 func (h *TavoloHandler) GetTavoliOccupati(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	idRistorante := ristoranteRichiesta(r)
 
 	// Prima cerca nella cache
-	tavoli, err := h.Cache.GetTavoliOccupati(ctx)
+	tavoli, err := h.Cache.GetTavoliOccupati(ctx, idRistorante)
 	if err != nil {
 		log.Printf("Errore cache GetTavoliOccupati: %v", err)
 	}
 
 	// Se non è in cache, recupera dal database
 	if tavoli == nil {
-		tavoli, err = h.Repo.GetTavoliOccupati(ctx, 1) // Supponiamo ID ristorante 1
+		tavoli, err = h.Repo.GetTavoliOccupati(ctx, idRistorante)
 		if err != nil {
 			http.Error(w, "Errore recupero tavoli occupati", http.StatusInternalServerError)
 			log.Printf("Errore recupero tavoli occupati: %v", err)
@@ -200,7 +221,7 @@ func (h *TavoloHandler) GetTavoliOccupati(w http.ResponseWriter, r *http.Request
 		}
 
 		// Salva in cache
-		if err := h.Cache.SetTavoliOccupati(ctx, tavoli); err != nil {
+		if err := h.Cache.SetTavoliOccupati(ctx, idRistorante, tavoli); err != nil {
 			log.Printf("Errore salvataggio tavoli occupati in cache: %v", err)
 		}
 	}
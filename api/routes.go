@@ -3,6 +3,7 @@ package api
 import (
 	"ristorante-api/api/handlers"
 	"ristorante-api/cache"
+	"ristorante-api/config"
 	"ristorante-api/database"
 	"ristorante-api/repository"
 
@@ -10,7 +11,7 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 )
 
-func SetupRoutes(db *database.DB) *chi.Mux {
+func SetupRoutes(db *database.DB, cfg *config.Config) *chi.Mux {
 	r := chi.NewRouter()
 
 	// Middleware
@@ -32,31 +33,71 @@ func SetupRoutes(db *database.DB) *chi.Mux {
 	tavoloCache := cache.NewTavoloCache(db.Redis.Client)
 	tavoloHandler := handlers.NewTavoloHandler(tavoloRepo, tavoloCache)
 
-	// Ordini
-	ordineRepo := repository.NewOrdineRepository(db.Pool)
-	ordineCache := cache.NewOrdineCache(db.Redis.Client)
-	ordineHandler := handlers.NewOrdineHandler(ordineRepo, ordineCache)
-
 	// Cache
 	ingredienteCache := cache.NewIngredienteCache(db.Redis.Client)
 	pietanzaCache := cache.NewPietanzaCache(db.Redis.Client)
 	ricettaCache := cache.NewRicettaCache(db.Redis.Client)
 	menuFissoCache := cache.NewMenuFissoCache(db.Redis.Client)
 
+	// Ordini
+	ordineRepo := repository.NewOrdineRepository(db.Pool)
+	ordineCache := cache.NewOrdineCache(db.Redis.Client)
+	ordineHandler := handlers.NewOrdineHandler(ordineRepo, ordineCache, tavoloRepo, tavoloCache, ristoranteRepo, ingredienteCache, pietanzaCache)
+
 	// Pietanze
 	pietanzaRepo := repository.NewPietanzaRepository(db.Pool)
 	ricettaRepo := repository.NewRicettaRepository(db.Pool, ricettaCache)
+	ricettaHandler := handlers.NewRicettaHandler(ricettaRepo, pietanzaCache)
+
+	// Menu dei ristoranti
+	menuRepo := repository.NewMenuRepository(db.Pool)
+	menuHandler := handlers.NewMenuHandler(menuRepo, pietanzaCache)
+
+	// Categorie e menu per categoria
+	categoriaRepo := repository.NewCategoriaRepository(db.Pool)
+	categoriaCache := cache.NewCategoriaCache(db.Redis.Client)
+	categoriaHandler := handlers.NewCategoriaHandler(categoriaRepo, categoriaCache, pietanzaCache, ricettaRepo)
 
 	// Menu Fissi
 	menuFissoRepo := repository.NewMenuFissoRepository(db.Pool)
-	menuFissoHandler := handlers.NewMenuFissoHandler(menuFissoRepo, menuFissoCache)
+	menuFissoHandler := handlers.NewMenuFissoHandler(menuFissoRepo, menuFissoCache, ricettaRepo)
 
 	// Pietanza Handler
 	pietanzaHandler := handlers.NewPietanzaHandler(pietanzaRepo, pietanzaCache, ricettaRepo, menuFissoRepo, ingredienteCache)
 
 	// Ingredienti
 	ingredienteRepo := repository.NewIngredienteRepository(db.Pool)
-	ingredienteHandler := handlers.NewIngredienteHandler(ingredienteRepo, ingredienteCache)
+	ingredienteHandler := handlers.NewIngredienteHandler(ingredienteRepo, ingredienteCache, ricettaCache, pietanzaCache)
+
+	// Fornitori e ordini di acquisto
+	fornitoreRepo := repository.NewFornitoreRepository(db.Pool)
+	fornitoreHandler := handlers.NewFornitoreHandler(fornitoreRepo)
+	ordineAcquistoRepo := repository.NewOrdineAcquistoRepository(db.Pool)
+	ordineAcquistoHandler := handlers.NewOrdineAcquistoHandler(ordineAcquistoRepo, ingredienteCache, pietanzaCache)
+
+	// Inventario
+	inventarioRepo := repository.NewInventarioRepository(db.Pool)
+	inventarioHandler := handlers.NewInventarioHandler(inventarioRepo, ingredienteCache, pietanzaCache)
+
+	// Sconti
+	scontoRepo := repository.NewScontoRepository(db.Pool)
+	scontoHandler := handlers.NewScontoHandler(scontoRepo)
+
+	// Report
+	reportRepo := repository.NewReportRepository(db.Pool)
+	reportHandler := handlers.NewReportHandler(reportRepo, pietanzaRepo, cfg.MargineMinimo)
+
+	// Analytics
+	analyticsRepo := repository.NewAnalyticsRepository(db.Pool)
+	analyticsCache := cache.NewAnalyticsCache(db.Redis.Client)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsRepo, analyticsCache)
+
+	// Ristorante della richiesta (header X-Ristorante, parametro id_ristorante o ristorante predefinito)
+	// e verifica che tavoli e ordini indicati nel percorso gli appartengano
+	ristoranteRichiesta := handlers.RistoranteRichiesta(ristoranteRepo, cfg.RistorantePredefinito)
+	tavoloDelRistorante := handlers.AppartieneAlRistorante("id", tavoloRepo.IDRistorante, "Tavolo non trovato")
+	ordineDelRistorante := handlers.AppartieneAlRistorante("id", ordineRepo.IDRistorante, "Ordine non trovato")
+
 	// Monitoring Routes
 	r.Route("/monitoring", func(r chi.Router) {
 		r.Get("/redis", monitoringHandler.GetRedisStatus)
@@ -71,39 +112,88 @@ func SetupRoutes(db *database.DB) *chi.Mux {
 			r.Get("/{id}", ristoranteHandler.GetRistorante)
 			r.Put("/{id}", ristoranteHandler.UpdateRistorante)
 			r.Delete("/{id}", ristoranteHandler.DeleteRistorante)
+			r.Get("/{id}/menu", menuHandler.GetMenuRistorante)
+			r.Put("/{id}/menu/{id_pietanza}", menuHandler.ImpostaPietanzaMenu)
+			r.Delete("/{id}/menu/{id_pietanza}", menuHandler.RimuoviPietanzaMenu)
 		})
 
 		r.Route("/tavoli", func(r chi.Router) {
+			r.Use(ristoranteRichiesta)
 			r.Get("/", tavoloHandler.GetTavoli)
-			r.Get("/{id}", tavoloHandler.GetTavolo)
 			r.Post("/", tavoloHandler.CreateTavolo)
-			r.Put("/{id}", tavoloHandler.UpdateTavolo)
-			r.Delete("/{id}", tavoloHandler.DeleteTavolo)
-			r.Patch("/{id}/stato", tavoloHandler.CambiaStatoTavolo)
 			r.Get("/liberi", tavoloHandler.GetTavoliLiberi)
 			r.Get("/occupati", tavoloHandler.GetTavoliOccupati)
+			r.With(tavoloDelRistorante).Route("/{id}", func(r chi.Router) {
+				r.Get("/", tavoloHandler.GetTavolo)
+				r.Put("/", tavoloHandler.UpdateTavolo)
+				r.Delete("/", tavoloHandler.DeleteTavolo)
+				r.Patch("/stato", tavoloHandler.CambiaStatoTavolo)
+			})
 		})
 
 		r.Route("/ordini", func(r chi.Router) {
+			r.Use(ristoranteRichiesta)
 			r.Get("/", ordineHandler.GetOrdini)
 			r.Get("/completi", ordineHandler.GetAllOrdiniCompleti)
-			r.Get("/{id}", ordineHandler.GetOrdine)
-			r.Get("/{id}/completo", ordineHandler.GetOrdineCompleto)
 			r.Post("/", ordineHandler.CreateOrdine)
-			r.Patch("/{id}", ordineHandler.UpdateStatoOrdine)
-			r.Delete("/{id}", ordineHandler.DeleteOrdine)
-			r.Get("/tavolo/{id_tavolo}/scontrino", ordineHandler.CalcolaScontrino)
+			r.With(ordineDelRistorante).Route("/{id}", func(r chi.Router) {
+				r.Get("/", ordineHandler.GetOrdine)
+				r.Get("/completo", ordineHandler.GetOrdineCompleto)
+				r.Patch("/", ordineHandler.UpdateStatoOrdine)
+				r.Get("/transizioni", ordineHandler.GetTransizioni)
+				r.Get("/storico", ordineHandler.GetStorico)
+				r.Post("/pagamento", ordineHandler.RegistraPagamento)
+				r.Get("/sottoconti", ordineHandler.GetSottoconti)
+				r.Post("/sconti", ordineHandler.ApplicaSconto)
+				r.Delete("/sconti/{id_sconto}", ordineHandler.RimuoviSconto)
+				r.Patch("/righe/{id_dettaglio}", ordineHandler.ModificaRiga)
+				r.Delete("/righe/{id_dettaglio}", ordineHandler.RimuoviRiga)
+				r.Get("/lotti", ordineHandler.GetLottiOrdine)
+				r.Delete("/", ordineHandler.DeleteOrdine)
+			})
+			r.With(handlers.AppartieneAlRistorante("id_tavolo", tavoloRepo.IDRistorante, "Tavolo non trovato")).
+				Route("/tavolo/{id_tavolo}", func(r chi.Router) {
+					r.Get("/scontrino", ordineHandler.CalcolaScontrino)
+					r.Post("/scontrino", ordineHandler.DividiScontrino)
+				})
 		})
 
 		r.Route("/pietanze", func(r chi.Router) {
 			r.Get("/", pietanzaHandler.GetPietanze)
+			r.Get("/eventi-disponibilita", pietanzaHandler.GetEventiDisponibilita)
 			r.Get("/{id}", pietanzaHandler.GetPietanza)
 			r.Get("/{id}/ricetta", pietanzaHandler.GetRicettaByPietanzaID)
+			r.Put("/{id}/ricetta/ingredienti/{id_ingrediente}", pietanzaHandler.ImpostaIngredienteRicetta)
+			r.Delete("/{id}/ricetta/ingredienti/{id_ingrediente}", pietanzaHandler.RimuoviIngredienteRicetta)
+			r.Get("/{id}/costo", pietanzaHandler.GetCosto)
 			r.Post("/", pietanzaHandler.CreatePietanza)
 			r.Put("/{id}", pietanzaHandler.UpdatePietanza)
 			r.Delete("/{id}", pietanzaHandler.DeletePietanza)
-			r.Post("/ordine/{id_ordine}", pietanzaHandler.AddPietanzaToOrdine)
-			r.Post("/menu-fisso/ordine/{id_ordine}", pietanzaHandler.AddMenuFissoToOrdine)
+			r.Group(func(r chi.Router) {
+				r.Use(ristoranteRichiesta, handlers.AppartieneAlRistorante("id_ordine", ordineRepo.IDRistorante, "Ordine non trovato"))
+				r.Post("/ordine/{id_ordine}", pietanzaHandler.AddPietanzaToOrdine)
+				r.Post("/menu-fisso/ordine/{id_ordine}", pietanzaHandler.AddMenuFissoToOrdine)
+			})
+		})
+
+		r.Route("/categorie", func(r chi.Router) {
+			r.Get("/", categoriaHandler.GetCategorie)
+			r.Post("/", categoriaHandler.CreateCategoria)
+			r.Put("/ordine", categoriaHandler.RiordinaCategorie)
+			r.Get("/{id}", categoriaHandler.GetCategoria)
+			r.Put("/{id}", categoriaHandler.UpdateCategoria)
+			r.Delete("/{id}", categoriaHandler.DeleteCategoria)
+		})
+
+		r.With(ristoranteRichiesta).Get("/menu", categoriaHandler.GetMenu)
+
+		r.Route("/ricette", func(r chi.Router) {
+			r.Get("/", ricettaHandler.GetRicette)
+			r.Post("/", ricettaHandler.CreateRicetta)
+			r.Get("/{id}", ricettaHandler.GetRicetta)
+			r.Put("/{id}", ricettaHandler.UpdateRicetta)
+			r.Delete("/{id}", ricettaHandler.DeleteRicetta)
+			r.Get("/{id}/versioni", ricettaHandler.GetVersioniRicetta)
 		})
 
 		r.Route("/menu-fissi", func(r chi.Router) {
@@ -126,7 +216,65 @@ func SetupRoutes(db *database.DB) *chi.Mux {
 			r.Put("/{id}", ingredienteHandler.UpdateIngrediente)
 			r.Delete("/{id}", ingredienteHandler.DeleteIngrediente)
 			r.Get("/da-riordinare", ingredienteHandler.GetIngredientiDaRiordinare)
+			r.Get("/lotti-in-scadenza", ingredienteHandler.GetLottiInScadenza)
+			r.Post("/lotti-scaduti/smaltisci", ingredienteHandler.SmaltisciLottiScaduti)
 			r.Post("/{id}/rifornisci", ingredienteHandler.RifornisciIngrediente)
+			r.Get("/{id}/movimenti", ingredienteHandler.GetMovimenti)
+			r.Get("/{id}/lotti", ingredienteHandler.GetLotti)
+			r.Post("/{id}/spreco", ingredienteHandler.RegistraSpreco)
+			r.Get("/{id}/costi", ingredienteHandler.GetStoricoCosti)
+			r.Put("/{id}/costo", ingredienteHandler.AggiornaCosto)
+		})
+
+		r.Route("/inventario", func(r chi.Router) {
+			r.Get("/", inventarioHandler.GetInventari)
+			r.Post("/", inventarioHandler.CreateInventario)
+			r.Get("/{id}", inventarioHandler.GetInventario)
+			r.Put("/{id}", inventarioHandler.AggiornaInventario)
+			r.Delete("/{id}", inventarioHandler.DeleteInventario)
+			r.Post("/{id}/conferma", inventarioHandler.ConfermaInventario)
+		})
+
+		r.Route("/fornitori", func(r chi.Router) {
+			r.Get("/", fornitoreHandler.GetFornitori)
+			r.Post("/", fornitoreHandler.CreateFornitore)
+			r.Get("/{id}", fornitoreHandler.GetFornitore)
+			r.Put("/{id}", fornitoreHandler.UpdateFornitore)
+			r.Delete("/{id}", fornitoreHandler.DeleteFornitore)
+			r.Put("/{id}/ingredienti/{id_ingrediente}", fornitoreHandler.ImpostaIngrediente)
+			r.Delete("/{id}/ingredienti/{id_ingrediente}", fornitoreHandler.RimuoviIngrediente)
+		})
+
+		r.Route("/ordini-acquisto", func(r chi.Router) {
+			r.Get("/", ordineAcquistoHandler.GetOrdiniAcquisto)
+			r.Post("/genera", ordineAcquistoHandler.GeneraOrdiniAcquisto)
+			r.Get("/{id}", ordineAcquistoHandler.GetOrdineAcquisto)
+			r.Delete("/{id}", ordineAcquistoHandler.DeleteOrdineAcquisto)
+			r.Patch("/{id}/righe/{id_riga}", ordineAcquistoHandler.ModificaRigaAcquisto)
+			r.Post("/{id}/invia", ordineAcquistoHandler.InviaOrdineAcquisto)
+			r.Post("/{id}/ricevi", ordineAcquistoHandler.RiceviOrdineAcquisto)
+		})
+
+		r.Route("/sconti", func(r chi.Router) {
+			r.Get("/", scontoHandler.GetSconti)
+			r.Get("/{id}", scontoHandler.GetSconto)
+			r.Post("/", scontoHandler.CreateSconto)
+			r.Put("/{id}", scontoHandler.UpdateSconto)
+			r.Delete("/{id}", scontoHandler.DeleteSconto)
+		})
+
+		r.Route("/report", func(r chi.Router) {
+			r.Get("/chiusura", reportHandler.GetChiusura)
+			r.Get("/margini", reportHandler.GetMargini)
+			r.Get("/sprechi", reportHandler.GetSprechi)
+		})
+
+		r.Route("/analytics", func(r chi.Router) {
+			r.Get("/pietanze", analyticsHandler.GetTopPietanze)
+			r.Get("/vendite-orarie", analyticsHandler.GetVenditeOrarie)
+			r.Get("/menu-fissi", analyticsHandler.GetMenuFissi)
+			r.Get("/coperti", analyticsHandler.GetCoperti)
+			r.Get("/andamento", analyticsHandler.GetAndamento)
 		})
 
 	})
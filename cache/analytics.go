@@ -0,0 +1,49 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Le analisi riguardano ordini già pagati: non vengono invalidate, ma scadono
+// dopo analyticsTTL così da includere gli ordini pagati nel frattempo
+const analyticsTTL = 10 * time.Minute
+
+type AnalyticsCache struct {
+	redis *redis.Client
+}
+
+func NewAnalyticsCache(client *redis.Client) *AnalyticsCache {
+	return &AnalyticsCache{redis: client}
+}
+
+// ChiaveAnalytics costruisce la chiave di cache di un'analisi a partire dai parametri della richiesta
+// I parametri sono ordinati per nome, così richieste equivalenti condividono la stessa chiave
+func ChiaveAnalytics(analisi string, parametri url.Values) string {
+	return "analytics:" + analisi + ":" + parametri.Encode()
+}
+
+// Get restituisce il risultato JSON di un'analisi dalla cache
+func (c *AnalyticsCache) Get(ctx context.Context, chiave string) ([]byte, error) {
+	data, err := c.redis.Get(ctx, chiave).Bytes()
+	if err == redis.Nil {
+		return nil, nil // cache miss
+	}
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Set salva in cache il risultato di un'analisi
+func (c *AnalyticsCache) Set(ctx context.Context, chiave string, risultato any) error {
+	data, err := json.Marshal(risultato)
+	if err != nil {
+		return err
+	}
+	return c.redis.Set(ctx, chiave, data, analyticsTTL).Err()
+}
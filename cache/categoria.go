@@ -0,0 +1,46 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"ristorante-api/models"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type CategoriaCache struct {
+	redis *redis.Client
+}
+
+func NewCategoriaCache(rdb *redis.Client) *CategoriaCache {
+	return &CategoriaCache{redis: rdb}
+}
+
+// GetAll recupera tutte le categorie dalla cache
+func (c *CategoriaCache) GetAll(ctx context.Context) ([]models.CategoriaPietanza, bool, error) {
+	val, err := c.redis.Get(ctx, "categorie:all").Result()
+	if err == redis.Nil {
+		return nil, false, nil // cache miss
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var categorie []models.CategoriaPietanza
+	err = json.Unmarshal([]byte(val), &categorie)
+	return categorie, true, err
+}
+
+// SetAll salva tutte le categorie nella cache
+func (c *CategoriaCache) SetAll(ctx context.Context, categorie []models.CategoriaPietanza) error {
+	data, err := json.Marshal(categorie)
+	if err != nil {
+		return err
+	}
+	return c.redis.Set(ctx, "categorie:all", data, 30*time.Minute).Err()
+}
+
+// InvalidateAll rimuove tutte le categorie dalla cache
+func (c *CategoriaCache) InvalidateAll(ctx context.Context) error {
+	return c.redis.Del(ctx, "categorie:all").Err()
+}
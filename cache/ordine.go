@@ -17,8 +17,15 @@ func NewOrdineCache(rdb *redis.Client) *OrdineCache {
 	return &OrdineCache{redis: rdb}
 }
 
-func (c *OrdineCache) GetAll(ctx context.Context) ([]models.Ordine, error) {
-	key := "ordini:all"
+// Elenchi di ordini aperti salvati in cache per ogni ristorante
+const (
+	ordiniKey         = "ordini:all"
+	ordiniCompletiKey = "ordini:completi:all"
+)
+
+// GetAll recupera dalla cache gli ordini aperti del ristorante (0 per tutti i ristoranti)
+func (c *OrdineCache) GetAll(ctx context.Context, idRistorante int) ([]models.Ordine, error) {
+	key := chiaveRistorante(idRistorante, ordiniKey)
 	val, err := c.redis.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return nil, nil // cache miss
@@ -30,23 +37,28 @@ func (c *OrdineCache) GetAll(ctx context.Context) ([]models.Ordine, error) {
 	return ordini, err
 }
 
-func (c *OrdineCache) SetAll(ctx context.Context, ordini []models.Ordine) error {
+// SetAll salva nella cache gli ordini aperti del ristorante
+func (c *OrdineCache) SetAll(ctx context.Context, idRistorante int, ordini []models.Ordine) error {
 	data, err := json.Marshal(ordini)
 	if err != nil {
 		return err
 	}
-	return c.redis.Set(ctx, "ordini:all", data, 5*time.Minute).Err()
+	return c.redis.Set(ctx, chiaveRistorante(idRistorante, ordiniKey), data, 5*time.Minute).Err()
 }
 
-func (c *OrdineCache) Invalidate(ctx context.Context) error {
+// Invalidate cancella gli ordini in cache del ristorante e quelli di tutti i ristoranti, che li includono
+func (c *OrdineCache) Invalidate(ctx context.Context, idRistorante int) error {
 	// Invalida sia la cache degli ordini normali sia quella degli ordini completi
-	_, err := c.redis.Del(ctx, "ordini:all", "ordini:completi:all").Result()
+	_, err := c.redis.Del(ctx,
+		chiaveRistorante(idRistorante, ordiniKey), chiaveRistorante(idRistorante, ordiniCompletiKey),
+		chiaveRistorante(0, ordiniKey), chiaveRistorante(0, ordiniCompletiKey),
+	).Result()
 	return err
 }
 
-// GetAllOrdiniCompleti recupera tutti gli ordini completi dalla cache
-func (c *OrdineCache) GetAllOrdiniCompleti(ctx context.Context) ([]*models.OrdineCompleto, error) {
-	key := "ordini:completi:all"
+// GetAllOrdiniCompleti recupera dalla cache gli ordini completi del ristorante (0 per tutti i ristoranti)
+func (c *OrdineCache) GetAllOrdiniCompleti(ctx context.Context, idRistorante int) ([]*models.OrdineCompleto, error) {
+	key := chiaveRistorante(idRistorante, ordiniCompletiKey)
 	val, err := c.redis.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return nil, nil // cache miss
@@ -59,11 +71,11 @@ func (c *OrdineCache) GetAllOrdiniCompleti(ctx context.Context) ([]*models.Ordin
 	return ordiniCompleti, err
 }
 
-// SetAllOrdiniCompleti salva tutti gli ordini completi nella cache
-func (c *OrdineCache) SetAllOrdiniCompleti(ctx context.Context, ordiniCompleti []*models.OrdineCompleto) error {
+// SetAllOrdiniCompleti salva nella cache gli ordini completi del ristorante
+func (c *OrdineCache) SetAllOrdiniCompleti(ctx context.Context, idRistorante int, ordiniCompleti []*models.OrdineCompleto) error {
 	data, err := json.Marshal(ordiniCompleti)
 	if err != nil {
 		return err
 	}
-	return c.redis.Set(ctx, "ordini:completi:all", data, 5*time.Minute).Err()
+	return c.redis.Set(ctx, chiaveRistorante(idRistorante, ordiniCompletiKey), data, 5*time.Minute).Err()
 }
@@ -42,9 +42,18 @@ func (c *PietanzaCache) SetAll(ctx context.Context, pietanze []models.Pietanza)
 	return c.redis.Set(ctx, "pietanze:all", data, 10*time.Minute).Err()
 }
 
-// InvalidateAll rimuove tutte le pietanze dalla cache
+// InvalidateAll rimuove tutte le pietanze dalla cache, insieme ai menu per categoria di ogni ristorante che le contengono
 func (c *PietanzaCache) InvalidateAll(ctx context.Context) error {
-	return c.redis.Del(ctx, "pietanze:all").Err()
+	if err := c.redis.Del(ctx, "pietanze:all").Err(); err != nil {
+		return err
+	}
+	iter := c.redis.Scan(ctx, 0, "ristorante:*:"+menuKey, 100).Iterator()
+	for iter.Next(ctx) {
+		if err := c.redis.Del(ctx, iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
 }
 
 // GetByID recupera una pietanza specifica dalla cache in base all'ID
@@ -75,3 +84,33 @@ func (c *PietanzaCache) SetByID(ctx context.Context, id int, pietanza *models.Pi
 func (c *PietanzaCache) InvalidateByID(ctx context.Context, id int) error {
 	return c.redis.Del(ctx, fmt.Sprintf("pietanza:%d", id)).Err()
 }
+
+const menuKey = "menu:categorie"
+
+// GetMenu recupera dalla cache il menu del ristorante (0 per il listino) con le pietanze raggruppate per categoria
+func (c *PietanzaCache) GetMenu(ctx context.Context, idRistorante int) ([]models.CategoriaMenu, bool, error) {
+	val, err := c.redis.Get(ctx, chiaveRistorante(idRistorante, menuKey)).Result()
+	if err == redis.Nil {
+		return nil, false, nil // cache miss
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var menu []models.CategoriaMenu
+	err = json.Unmarshal([]byte(val), &menu)
+	return menu, true, err
+}
+
+// SetMenu salva nella cache il menu del ristorante con le pietanze raggruppate per categoria
+func (c *PietanzaCache) SetMenu(ctx context.Context, idRistorante int, menu []models.CategoriaMenu) error {
+	data, err := json.Marshal(menu)
+	if err != nil {
+		return err
+	}
+	return c.redis.Set(ctx, chiaveRistorante(idRistorante, menuKey), data, 10*time.Minute).Err()
+}
+
+// InvalidateMenu rimuove dalla cache il menu per categoria del ristorante
+func (c *PietanzaCache) InvalidateMenu(ctx context.Context, idRistorante int) error {
+	return c.redis.Del(ctx, chiaveRistorante(idRistorante, menuKey)).Err()
+}
@@ -114,3 +114,34 @@ func (c *RicettaCache) InvalidateRicettaCompletaByPietanzaID(ctx context.Context
 	key := fmt.Sprintf("ricetta:completa:pietanza:%d", idPietanza)
 	return c.redis.Del(ctx, key).Err()
 }
+
+// GetProfiliAllergeni recupera dalla cache allergeni e diete delle pietanze con una ricetta attiva
+func (c *RicettaCache) GetProfiliAllergeni(ctx context.Context) (map[int]*models.ProfiloAllergeni, bool, error) {
+	val, err := c.redis.Get(ctx, "ricette:allergeni").Result()
+	if err == redis.Nil {
+		return nil, false, nil // cache miss
+	} else if err != nil {
+		return nil, false, err
+	}
+
+	var profili map[int]*models.ProfiloAllergeni
+	if err := json.Unmarshal([]byte(val), &profili); err != nil {
+		return nil, false, err
+	}
+	return profili, true, nil
+}
+
+// SetProfiliAllergeni salva nella cache allergeni e diete delle pietanze con una ricetta attiva
+func (c *RicettaCache) SetProfiliAllergeni(ctx context.Context, profili map[int]*models.ProfiloAllergeni) error {
+	data, err := json.Marshal(profili)
+	if err != nil {
+		return err
+	}
+	return c.redis.Set(ctx, "ricette:allergeni", data, 30*time.Minute).Err()
+}
+
+// InvalidateProfiliAllergeni rimuove dalla cache allergeni e diete delle pietanze,
+// da ricalcolare quando cambiano le ricette o gli ingredienti
+func (c *RicettaCache) InvalidateProfiliAllergeni(ctx context.Context) error {
+	return c.redis.Del(ctx, "ricette:allergeni").Err()
+}
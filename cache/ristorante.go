@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"ristorante-api/models"
 	"time"
 
@@ -45,3 +46,12 @@ func (c *RistoranteCache) SetAll(ctx context.Context, ristoranti []models.Ristor
 func (c *RistoranteCache) DeleteAll(ctx context.Context) error {
 	return c.Client.Del(ctx, "ristoranti:all").Err()
 }
+
+// chiaveRistorante restituisce la chiave dei dati del ristorante indicato,
+// oppure di tutti i ristoranti ("tutti") se idRistorante è 0
+func chiaveRistorante(idRistorante int, dato string) string {
+	if idRistorante == 0 {
+		return "ristorante:tutti:" + dato
+	}
+	return fmt.Sprintf("ristorante:%d:%s", idRistorante, dato)
+}
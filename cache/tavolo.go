@@ -19,75 +19,54 @@ func NewTavoloCache(client *redis.Client) *TavoloCache {
 	}
 }
 
-const tavoliKey = "ristorante:1:tavoli:all"
-
-// GetTavoli restituisce tutti i tavoli dalla cache
-func (c *TavoloCache) GetTavoli(ctx context.Context) ([]models.Tavolo, error) {
-	data, err := c.redis.Get(ctx, tavoliKey).Result()
-	if err == redis.Nil {
-		return nil, nil // cache miss
-	}
-	if err != nil {
-		return nil, err
-	}
+// Elenchi di tavoli salvati in cache per ogni ristorante
+const (
+	tavoliKey         = "tavoli:all"
+	tavoliLiberiKey   = "tavoli:liberi"
+	tavoliOccupatiKey = "tavoli:occupati"
+)
 
-	var tavoli []models.Tavolo
-	if err := json.Unmarshal([]byte(data), &tavoli); err != nil {
-		return nil, err
-	}
-	return tavoli, nil
+// GetTavoli restituisce dalla cache i tavoli del ristorante (0 per tutti i ristoranti)
+func (c *TavoloCache) GetTavoli(ctx context.Context, idRistorante int) ([]models.Tavolo, error) {
+	return c.get(ctx, chiaveRistorante(idRistorante, tavoliKey))
 }
 
-// SetTavoli salva tutti i tavoli in cache
-func (c *TavoloCache) SetTavoli(ctx context.Context, tavoli []models.Tavolo) error {
-	data, err := json.Marshal(tavoli)
-	if err != nil {
-		return err
-	}
-
-	return c.redis.Set(ctx, tavoliKey, data, 5*time.Minute).Err()
+// SetTavoli salva in cache i tavoli del ristorante
+func (c *TavoloCache) SetTavoli(ctx context.Context, idRistorante int, tavoli []models.Tavolo) error {
+	return c.set(ctx, chiaveRistorante(idRistorante, tavoliKey), tavoli)
 }
 
-// InvalidateTavoli cancella la cache dei tavoli
-func (c *TavoloCache) InvalidateTavoli(ctx context.Context) error {
-	return c.redis.Del(ctx, tavoliKey).Err()
+// GetTavoliLiberi restituisce dalla cache i tavoli liberi del ristorante
+func (c *TavoloCache) GetTavoliLiberi(ctx context.Context, idRistorante int) ([]models.Tavolo, error) {
+	return c.get(ctx, chiaveRistorante(idRistorante, tavoliLiberiKey))
 }
 
-// get tavoli liberi
-func (c *TavoloCache) GetTavoliLiberi(ctx context.Context) ([]models.Tavolo, error) {
-	data, err := c.redis.Get(ctx, "ristorante:1:tavoli:liberi").Result()
-	if err == redis.Nil {
-		return nil, nil // cache miss
-	}
-	if err != nil {
-		return nil, err
-	}
-
-	var tavoli []models.Tavolo
-	if err := json.Unmarshal([]byte(data), &tavoli); err != nil {
-		return nil, err
-	}
-	return tavoli, nil
+// SetTavoliLiberi salva in cache i tavoli liberi del ristorante
+func (c *TavoloCache) SetTavoliLiberi(ctx context.Context, idRistorante int, tavoli []models.Tavolo) error {
+	return c.set(ctx, chiaveRistorante(idRistorante, tavoliLiberiKey), tavoli)
 }
 
-// SetTavoliLiberi salva i tavoli liberi in cache
-func (c *TavoloCache) SetTavoliLiberi(ctx context.Context, tavoli []models.Tavolo) error {
-	data, err := json.Marshal(tavoli)
-	if err != nil {
-		return err
-	}
+// GetTavoliOccupati restituisce dalla cache i tavoli occupati del ristorante
+func (c *TavoloCache) GetTavoliOccupati(ctx context.Context, idRistorante int) ([]models.Tavolo, error) {
+	return c.get(ctx, chiaveRistorante(idRistorante, tavoliOccupatiKey))
+}
 
-	return c.redis.Set(ctx, "ristorante:1:tavoli:liberi", data, 5*time.Minute).Err()
+// SetTavoliOccupati salva in cache i tavoli occupati del ristorante
+func (c *TavoloCache) SetTavoliOccupati(ctx context.Context, idRistorante int, tavoli []models.Tavolo) error {
+	return c.set(ctx, chiaveRistorante(idRistorante, tavoliOccupatiKey), tavoli)
 }
 
-// InvalidateTavoliLiberi cancella la cache dei tavoli liberi
-func (c *TavoloCache) InvalidateTavoliLiberi(ctx context.Context) error {
-	return c.redis.Del(ctx, "ristorante:1:tavoli:liberi").Err()
+// InvalidateTavoli cancella gli elenchi di tavoli del ristorante e quelli di tutti i ristoranti, che li includono
+func (c *TavoloCache) InvalidateTavoli(ctx context.Context, idRistorante int) error {
+	var keys []string
+	for _, key := range []string{tavoliKey, tavoliLiberiKey, tavoliOccupatiKey} {
+		keys = append(keys, chiaveRistorante(idRistorante, key), chiaveRistorante(0, key))
+	}
+	return c.redis.Del(ctx, keys...).Err()
 }
 
-// GetTavoliOccupati recupera i tavoli occupati dalla cache
-func (c *TavoloCache) GetTavoliOccupati(ctx context.Context) ([]models.Tavolo, error) {
-	data, err := c.redis.Get(ctx, "ristorante:1:tavoli:occupati").Result()
+func (c *TavoloCache) get(ctx context.Context, key string) ([]models.Tavolo, error) {
+	data, err := c.redis.Get(ctx, key).Result()
 	if err == redis.Nil {
 		return nil, nil // cache miss
 	}
@@ -102,17 +81,11 @@ func (c *TavoloCache) GetTavoliOccupati(ctx context.Context) ([]models.Tavolo, e
 	return tavoli, nil
 }
 
-// SetTavoliOccupati salva i tavoli occupati in cache
-func (c *TavoloCache) SetTavoliOccupati(ctx context.Context, tavoli []models.Tavolo) error {
+func (c *TavoloCache) set(ctx context.Context, key string, tavoli []models.Tavolo) error {
 	data, err := json.Marshal(tavoli)
 	if err != nil {
 		return err
 	}
 
-	return c.redis.Set(ctx, "ristorante:1:tavoli:occupati", data, 5*time.Minute).Err()
-}
-
-// InvalidateTavoliOccupati cancella la cache dei tavoli occupati
-func (c *TavoloCache) InvalidateTavoliOccupati(ctx context.Context) error {
-	return c.redis.Del(ctx, "ristorante:1:tavoli:occupati").Err()
+	return c.redis.Set(ctx, key, data, 5*time.Minute).Err()
 }
@@ -17,6 +17,10 @@ type Config struct {
 	DBName     string
 	RedisHost  string
 	RedisPort  int
+	// MargineMinimo è il margine lordo percentuale sotto il quale una pietanza viene segnalata nel report dei margini
+	MargineMinimo float64
+	// RistorantePredefinito è il ristorante di tavoli, ordini e menu quando la richiesta non lo indica (0 = obbligatorio)
+	RistorantePredefinito int
 }
 
 // LoadConfig carica la configurazione da variabili d'ambiente o file .env
@@ -34,14 +38,29 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("invalid REDIS_PORT: %v", err)
 	}
 
+	margineMinimo, err := strconv.ParseFloat(getEnv("MARGINE_MINIMO", "65"), 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MARGINE_MINIMO: %v", err)
+	}
+
+	ristorantePredefinito, err := strconv.Atoi(getEnv("RISTORANTE_PREDEFINITO", "0"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid RISTORANTE_PREDEFINITO: %v", err)
+	}
+	if ristorantePredefinito < 0 {
+		return nil, fmt.Errorf("invalid RISTORANTE_PREDEFINITO: %d", ristorantePredefinito)
+	}
+
 	return &Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBPort:     dbPort,
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "postgres"),
-		DBName:     getEnv("DB_NAME", "ristorante"),
-		RedisHost:  getEnv("REDIS_HOST", "localhost"),
-		RedisPort:  redisPort,
+		DBHost:                getEnv("DB_HOST", "localhost"),
+		DBPort:                dbPort,
+		DBUser:                getEnv("DB_USER", "postgres"),
+		DBPassword:            getEnv("DB_PASSWORD", "postgres"),
+		DBName:                getEnv("DB_NAME", "ristorante"),
+		RedisHost:             getEnv("REDIS_HOST", "localhost"),
+		RedisPort:             redisPort,
+		MargineMinimo:         margineMinimo,
+		RistorantePredefinito: ristorantePredefinito,
 	}, nil
 }
 
@@ -100,6 +100,138 @@ INSERT INTO ingrediente (nome, quantita_disponibile, unita_misura, soglia_riordi
 ('Birra alla spina', 60.0, 'litri', 15.0),
 ('Amaro', 10.0, 'litri', 2.0);
 
+-- Costi d'acquisto degli ingredienti (per unità di misura) e relativo storico
+UPDATE ingrediente SET costo_unitario = costi.costo
+FROM (VALUES
+('Pomodoro', 2.20),
+('Farina', 0.90),
+('Sale', 0.50),
+('Olio d oliva', 9.50),
+('Aglio', 6.00),
+('Basilico', 1.20),
+('Mozzarella', 9.00),
+('Parmigiano', 22.00),
+('Pecorino', 18.00),
+('Guanciale', 16.00),
+('Pancetta', 12.00),
+('Uova', 0.30),
+('Pepe nero', 25.00),
+('Peperoncino', 15.00),
+('Funghi porcini', 35.00),
+('Riso Carnaroli', 4.50),
+('Pasta all uovo', 6.50),
+('Pasta di semola', 1.80),
+('Carne macinata', 11.00),
+('Sedano', 2.00),
+('Carote', 1.30),
+('Cipolla', 1.20),
+('Vino bianco', 5.50),
+('Vino rosso', 6.00),
+('Burro', 10.00),
+('Latte', 1.20),
+('Panna', 4.50),
+('Zucchero', 1.10),
+('Mascarpone', 8.50),
+('Caffe', 18.00),
+('Filetto di manzo', 38.00),
+('Bistecca', 26.00),
+('Branzino', 16.00),
+('Calamari', 14.00),
+('Gamberi', 22.00),
+('Melanzane', 2.00),
+('Zucchine', 2.20),
+('Patate', 1.00),
+('Insalata', 2.50),
+('Pomodorini', 3.50),
+('Rucola', 7.00),
+('Peperoni', 2.80),
+('Fagiolini', 3.50),
+('Cavolfiore', 2.20),
+('Broccoli', 2.50),
+('Carciofi', 5.00),
+('Frutta di stagione', 3.00),
+('Gelato', 9.00),
+('Cioccolato', 12.00),
+('Noci', 14.00),
+('Mandorle', 15.00),
+('Pistacchi', 35.00),
+('Vaniglia', 400.00),
+('Limoni', 2.50),
+('Arance', 1.80),
+('Cozze', 4.00),
+('Vongole', 12.00),
+('Sgombro', 9.00),
+('Tonno fresco', 28.00),
+('Salmone', 20.00),
+('Pollo', 7.50),
+('Coniglio', 11.00),
+('Stinco di maiale', 9.00),
+('Salsiccia', 9.50),
+('Rum', 18.00),
+('Friarielli', 5.00),
+('Olive', 8.00),
+('Pinoli', 60.00),
+('Frutta fresca', 3.00),
+('Acqua naturale', 0.30),
+('Acqua frizzante', 0.30),
+('Coca Cola', 1.50),
+('Prosecco', 7.00),
+('Limoncello', 14.00),
+('Grappa', 18.00),
+('Birra alla spina', 3.20),
+('Amaro', 16.00)
+) AS costi(nome, costo)
+WHERE ingrediente.nome = costi.nome;
+
+INSERT INTO storico_costo_ingrediente (id_ingrediente, costo_unitario)
+SELECT id_ingrediente, costo_unitario FROM ingrediente;
+
+-- Allergeni e diete compatibili degli ingredienti
+UPDATE ingrediente SET allergeni = '{}', vegetariano = true, vegano = true;
+
+UPDATE ingrediente SET vegano = false
+WHERE nome IN ('Mozzarella', 'Uova', 'Pasta all uovo', 'Burro', 'Latte', 'Panna', 'Mascarpone', 'Gelato', 'Cioccolato');
+
+-- Parmigiano e pecorino sono prodotti con caglio animale
+UPDATE ingrediente SET vegetariano = false, vegano = false
+WHERE nome IN ('Parmigiano', 'Pecorino', 'Guanciale', 'Pancetta', 'Carne macinata', 'Filetto di manzo', 'Bistecca',
+               'Branzino', 'Calamari', 'Gamberi', 'Cozze', 'Vongole', 'Sgombro', 'Tonno fresco', 'Salmone',
+               'Pollo', 'Coniglio', 'Stinco di maiale', 'Salsiccia');
+
+UPDATE ingrediente SET allergeni = a.allergeni
+FROM (VALUES
+('Farina', ARRAY['glutine']),
+('Mozzarella', ARRAY['lattosio']),
+('Parmigiano', ARRAY['lattosio']),
+('Pecorino', ARRAY['lattosio']),
+('Uova', ARRAY['uova']),
+('Pasta all uovo', ARRAY['glutine', 'uova']),
+('Pasta di semola', ARRAY['glutine']),
+('Sedano', ARRAY['sedano']),
+('Vino bianco', ARRAY['solfiti']),
+('Vino rosso', ARRAY['solfiti']),
+('Burro', ARRAY['lattosio']),
+('Latte', ARRAY['lattosio']),
+('Panna', ARRAY['lattosio']),
+('Mascarpone', ARRAY['lattosio']),
+('Branzino', ARRAY['pesce']),
+('Calamari', ARRAY['molluschi']),
+('Gamberi', ARRAY['crostacei']),
+('Gelato', ARRAY['uova', 'lattosio']),
+('Cioccolato', ARRAY['soia', 'lattosio']),
+('Noci', ARRAY['frutta_a_guscio']),
+('Mandorle', ARRAY['frutta_a_guscio']),
+('Pistacchi', ARRAY['frutta_a_guscio']),
+('Cozze', ARRAY['molluschi']),
+('Vongole', ARRAY['molluschi']),
+('Sgombro', ARRAY['pesce']),
+('Tonno fresco', ARRAY['pesce']),
+('Salmone', ARRAY['pesce']),
+('Prosecco', ARRAY['solfiti']),
+('Birra alla spina', ARRAY['glutine'])
+) AS a(nome, allergeni)
+WHERE ingrediente.nome = a.nome;
+
 -- Dati generati per la tabella categoria_pietanza
 INSERT INTO categoria_pietanza (nome) VALUES
 ('Antipasti'),
@@ -164,6 +296,10 @@ INSERT INTO pietanza (nome, prezzo, id_categoria, disponibile) VALUES
 ('Grappa', 3.33, 7, true),
 ('Prosecco', 2.33, 7, true);
 
+-- Le bevande alcoliche hanno aliquota IVA al 22%, le altre pietanze quella della categoria (10%)
+UPDATE pietanza SET aliquota_iva = 22.00
+WHERE nome IN ('Vino rosso', 'Vino bianco', 'Birra alla spina', 'Amaro', 'Limoncello', 'Grappa', 'Prosecco');
+
 -- Dati generati per la tabella ricetta
 INSERT INTO ricetta (nome, descrizione, id_pietanza, tempo_preparazione, istruzioni) VALUES
 ('Bruschetta pomodoro e basilico', 'Fette di pane casereccio tostate e condite con pomodoro fresco, basilico e olio d oliva', 1, 10, 'Tagliare il pane a fette, tostarlo, strofinare con aglio, condire con pomodoro fresco a cubetti, basilico, sale e olio extravergine d oliva.'),
@@ -476,3 +612,8 @@ INSERT INTO composizione_menu (id_menu, id_pietanza) VALUES
 (5, 39),
 (5, 40);
 
+
+-- Menu dei ristoranti: tutte le pietanze al prezzo di listino
+INSERT INTO menu (id_ristorante, id_pietanza)
+SELECT r.id_ristorante, p.id_pietanza
+FROM ristorante r CROSS JOIN pietanza p;
@@ -111,6 +111,42 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("failed to create ingrediente table: %v", err)
 	}
 
+	// Costo d'acquisto degli ingredienti (per unità di misura) e storico delle variazioni
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE ingrediente ADD COLUMN IF NOT EXISTS costo_unitario NUMERIC(12,5) NOT NULL DEFAULT 0;
+		CREATE TABLE IF NOT EXISTS storico_costo_ingrediente (
+		  id_storico SERIAL PRIMARY KEY,
+		  id_ingrediente INTEGER NOT NULL,
+		  costo_unitario NUMERIC(12,5) NOT NULL CHECK (costo_unitario >= 0),
+		  data_inizio TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  FOREIGN KEY (id_ingrediente) REFERENCES ingrediente (id_ingrediente) ON DELETE CASCADE
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create storico_costo_ingrediente table: %v", err)
+	}
+
+	// Peso di un pezzo (in grammi) per gli ingredienti a conteggio usati a peso nelle ricette
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE ingrediente ADD COLUMN IF NOT EXISTS peso_pezzo FLOAT NOT NULL DEFAULT 0 CHECK (peso_pezzo >= 0)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update ingrediente table: %v", err)
+	}
+
+	// Allergeni contenuti nell'ingrediente (tra i 14 del Regolamento UE 1169/2011) e diete compatibili
+	// NULL indica allergeni non ancora dichiarati, diverso da un elenco vuoto (nessun allergene)
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE ingrediente ADD COLUMN IF NOT EXISTS allergeni TEXT[];
+		ALTER TABLE ingrediente ALTER COLUMN allergeni DROP NOT NULL;
+		ALTER TABLE ingrediente ALTER COLUMN allergeni DROP DEFAULT;
+		ALTER TABLE ingrediente ADD COLUMN IF NOT EXISTS vegetariano BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE ingrediente ADD COLUMN IF NOT EXISTS vegano BOOLEAN NOT NULL DEFAULT false;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update ingrediente table: %v", err)
+	}
+
 	// Tabella Categoria Pietanza
 	_, err = db.Pool.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS categoria_pietanza (
@@ -137,6 +173,23 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("failed to create pietanza table: %v", err)
 	}
 
+	// Aliquote IVA: per categoria (predefinita 10%) e, facoltativa, per singola pietanza
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE categoria_pietanza ADD COLUMN IF NOT EXISTS aliquota_iva DECIMAL(5,2) NOT NULL DEFAULT 10.00;
+		ALTER TABLE pietanza ADD COLUMN IF NOT EXISTS aliquota_iva DECIMAL(5,2);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to add aliquota_iva columns: %v", err)
+	}
+
+	// Posizione delle categorie nel menu
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE categoria_pietanza ADD COLUMN IF NOT EXISTS posizione INTEGER NOT NULL DEFAULT 0
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update categoria_pietanza table: %v", err)
+	}
+
 	// Tabella Menu
 	_, err = db.Pool.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS menu (
@@ -151,6 +204,28 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("failed to create menu table: %v", err)
 	}
 
+	// Prezzo della pietanza nel menu del ristorante (NULL per il prezzo di listino). Nei database
+	// precedenti al menu per ristorante, ancora vuoto, ogni ristorante riceve tutte le pietanze:
+	// solo quando la colonna viene aggiunta, così un menu svuotato in seguito resta vuoto
+	_, err = db.Pool.Exec(context.Background(), `
+		DO $$
+		BEGIN
+			IF NOT EXISTS (
+				SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'menu' AND column_name = 'prezzo'
+			) THEN
+				ALTER TABLE menu ADD COLUMN prezzo DECIMAL(10,2) CHECK (prezzo > 0);
+				INSERT INTO menu (id_ristorante, id_pietanza)
+				SELECT r.id_ristorante, p.id_pietanza
+				FROM ristorante r CROSS JOIN pietanza p
+				WHERE NOT EXISTS (SELECT 1 FROM menu);
+			END IF;
+		END $$;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update menu table: %v", err)
+	}
+
 	// Tabella Ricetta
 	_, err = db.Pool.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS ricetta (
@@ -167,6 +242,22 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("failed to create ricetta table: %v", err)
 	}
 
+	// Versioni delle ricette: una sola versione attiva per pietanza; le precedenti restano per gli ordini che le hanno usate
+	// (nei database esistenti diventa attiva la prima ricetta di ogni pietanza)
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE ricetta ADD COLUMN IF NOT EXISTS versione INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE ricetta ADD COLUMN IF NOT EXISTS data_creazione TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+		ALTER TABLE ricetta ADD COLUMN IF NOT EXISTS attiva BOOLEAN;
+		UPDATE ricetta r
+		SET attiva = (r.id_ricetta = (SELECT MIN(id_ricetta) FROM ricetta WHERE id_pietanza = r.id_pietanza))
+		WHERE attiva IS NULL;
+		ALTER TABLE ricetta ALTER COLUMN attiva SET DEFAULT true;
+		ALTER TABLE ricetta ALTER COLUMN attiva SET NOT NULL;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update ricetta table: %v", err)
+	}
+
 	// Tabella Ricetta Ingrediente
 	_, err = db.Pool.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS ricetta_ingrediente (
@@ -182,6 +273,14 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("failed to create ricetta_ingrediente table: %v", err)
 	}
 
+	// Unità in cui è espressa la quantità della ricetta (NULL: la stessa unità dell'ingrediente in magazzino)
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE ricetta_ingrediente ADD COLUMN IF NOT EXISTS unita_misura VARCHAR(20)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update ricetta_ingrediente table: %v", err)
+	}
+
 	// Tabella Menu Fisso
 	_, err = db.Pool.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS menu_fisso (
@@ -216,7 +315,7 @@ func (db *DB) InitSchema() error {
 		  id_tavolo INTEGER NOT NULL,
 		  num_persone INTEGER NOT NULL,
 		  data_ordine TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		  stato VARCHAR(20) NOT NULL DEFAULT 'in_attesa' CHECK (stato IN ('in_attesa', 'confermato', 'in_preparazione', 'pronto', 'consegnato', 'pagato')),
+		  stato VARCHAR(20) NOT NULL DEFAULT 'in_attesa' CHECK (stato IN ('in_attesa', 'confermato', 'in_preparazione', 'pronto', 'consegnato', 'pagato', 'annullato')),
 		  id_ristorante INTEGER NOT NULL,
 		  costo_totale DECIMAL(10,2) NOT NULL DEFAULT 0.00,
 		  FOREIGN KEY (id_tavolo) REFERENCES tavolo (id_tavolo) ON DELETE CASCADE,
@@ -227,6 +326,16 @@ func (db *DB) InitSchema() error {
 		return fmt.Errorf("failed to create ordine table: %v", err)
 	}
 
+	// Vincolo sugli stati dell'ordine (include lo stato "annullato" anche per i database esistenti)
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE ordine DROP CONSTRAINT IF EXISTS ordine_stato_check;
+		ALTER TABLE ordine ADD CONSTRAINT ordine_stato_check
+		  CHECK (stato IN ('in_attesa', 'confermato', 'in_preparazione', 'pronto', 'consegnato', 'pagato', 'annullato'));
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update ordine stato constraint: %v", err)
+	}
+
 	// Tabella Dettaglio Ordine
 	_, err = db.Pool.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS dettaglio_ordine_pietanza (
@@ -237,20 +346,437 @@ func (db *DB) InitSchema() error {
 		  parte_di_menu BOOLEAN NOT NULL DEFAULT FALSE,
 		  id_menu INTEGER DEFAULT NULL,
 		  FOREIGN KEY (id_ordine) REFERENCES ordine (id_ordine) ON DELETE CASCADE,
-		  FOREIGN KEY (id_pietanza) REFERENCES pietanza (id_pietanza) ON DELETE CASCADE,
-		  UNIQUE (id_ordine, id_pietanza, parte_di_menu, id_menu)
+		  FOREIGN KEY (id_pietanza) REFERENCES pietanza (id_pietanza) ON DELETE CASCADE
 		)
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to create dettaglio_ordine_pietanza table: %v", err)
 	}
 
+	// Versione della ricetta usata per preparare la riga; le righe precedenti alle versioni
+	// vengono associate alla ricetta attiva, così le modifiche successive non ne cambiano costi e consumi
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE dettaglio_ordine_pietanza ADD COLUMN IF NOT EXISTS id_ricetta INTEGER
+		  REFERENCES ricetta (id_ricetta) ON DELETE SET NULL;
+		UPDATE dettaglio_ordine_pietanza d
+		SET id_ricetta = r.id_ricetta
+		FROM ricetta r
+		WHERE d.id_ricetta IS NULL AND r.id_pietanza = d.id_pietanza AND r.attiva;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update dettaglio_ordine_pietanza table: %v", err)
+	}
+
+	// Prezzo unitario della pietanza quando è stata ordinata (quello del menu del ristorante, se
+	// personalizzato, altrimenti il listino), così le variazioni successive non cambiano gli ordini già presi.
+	// Le righe precedenti prendono il prezzo attuale. Le righe alla carta si uniscono solo a parità di prezzo,
+	// mentre ogni pietanza di un menu fisso resta su una sola riga con la quantità dei menu ordinati
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE dettaglio_ordine_pietanza ADD COLUMN IF NOT EXISTS prezzo_unitario DECIMAL(10,2);
+		UPDATE dettaglio_ordine_pietanza d
+		SET prezzo_unitario = COALESCE((
+			SELECT m.prezzo FROM ordine o
+			JOIN menu m ON m.id_ristorante = o.id_ristorante
+			WHERE o.id_ordine = d.id_ordine AND m.id_pietanza = d.id_pietanza
+		), p.prezzo)
+		FROM pietanza p
+		WHERE d.prezzo_unitario IS NULL AND p.id_pietanza = d.id_pietanza;
+		ALTER TABLE dettaglio_ordine_pietanza ALTER COLUMN prezzo_unitario SET NOT NULL;
+		DO $$
+		DECLARE vincolo TEXT;
+		BEGIN
+			FOR vincolo IN
+				SELECT conname FROM pg_constraint
+				WHERE conrelid = 'dettaglio_ordine_pietanza'::regclass AND contype = 'u'
+			LOOP
+				EXECUTE format('ALTER TABLE dettaglio_ordine_pietanza DROP CONSTRAINT %I', vincolo);
+			END LOOP;
+		END $$;
+		DROP INDEX IF EXISTS idx_dettaglio_carta;
+		DROP INDEX IF EXISTS idx_dettaglio_menu;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_dettaglio_riga_carta
+		  ON dettaglio_ordine_pietanza (id_ordine, id_pietanza, id_menu, prezzo_unitario, id_ricetta) WHERE NOT parte_di_menu;
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_dettaglio_riga_menu
+		  ON dettaglio_ordine_pietanza (id_ordine, id_pietanza, id_menu, id_ricetta) WHERE parte_di_menu;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update dettaglio_ordine_pietanza table: %v", err)
+	}
+
+	// Tabella Storico Stato Ordine
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS storico_stato_ordine (
+		  id_storico SERIAL PRIMARY KEY,
+		  id_ordine INTEGER NOT NULL,
+		  stato_precedente VARCHAR(20),
+		  stato_nuovo VARCHAR(20) NOT NULL,
+		  data_cambio TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  attore VARCHAR(100),
+		  FOREIGN KEY (id_ordine) REFERENCES ordine (id_ordine) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create storico_stato_ordine table: %v", err)
+	}
+
+	// Tabella Movimento Magazzino (registro delle variazioni di quantità degli ingredienti)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS movimento_magazzino (
+		  id_movimento SERIAL PRIMARY KEY,
+		  id_ingrediente INTEGER NOT NULL,
+		  tipo VARCHAR(20) NOT NULL CHECK (tipo IN ('carico', 'scarico', 'storno', 'rettifica', 'spreco')),
+		  quantita FLOAT NOT NULL,
+		  quantita_prima FLOAT NOT NULL,
+		  quantita_dopo FLOAT NOT NULL,
+		  id_ordine INTEGER,
+		  note VARCHAR(255),
+		  data_movimento TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  FOREIGN KEY (id_ingrediente) REFERENCES ingrediente (id_ingrediente) ON DELETE CASCADE,
+		  FOREIGN KEY (id_ordine) REFERENCES ordine (id_ordine) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create movimento_magazzino table: %v", err)
+	}
+
+	// Tipo "storno" per gli ingredienti restituiti da righe eliminate o ordini annullati, che nei database
+	// esistenti erano scarichi dell'ordine con quantità positiva
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE movimento_magazzino DROP CONSTRAINT IF EXISTS movimento_magazzino_tipo_check;
+		ALTER TABLE movimento_magazzino ADD CONSTRAINT movimento_magazzino_tipo_check
+		  CHECK (tipo IN ('carico', 'scarico', 'storno', 'rettifica', 'spreco'));
+		UPDATE movimento_magazzino SET tipo = 'storno'
+		WHERE tipo = 'scarico' AND quantita > 0 AND id_ordine IS NOT NULL;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update movimento_magazzino tipo constraint: %v", err)
+	}
+
+	// Disponibilità automatica delle pietanze in base alle scorte e registro dei cambi
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE pietanza ADD COLUMN IF NOT EXISTS esaurita BOOLEAN NOT NULL DEFAULT false;
+		CREATE TABLE IF NOT EXISTS evento_disponibilita (
+		  id_evento SERIAL PRIMARY KEY,
+		  id_pietanza INTEGER NOT NULL,
+		  tipo VARCHAR(20) NOT NULL CHECK (tipo IN ('esaurita', 'ripristinata')),
+		  porzioni INTEGER NOT NULL,
+		  id_movimento INTEGER,
+		  data_evento TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  FOREIGN KEY (id_pietanza) REFERENCES pietanza (id_pietanza) ON DELETE CASCADE,
+		  FOREIGN KEY (id_movimento) REFERENCES movimento_magazzino (id_movimento) ON DELETE SET NULL
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create evento_disponibilita table: %v", err)
+	}
+
+	// Tabella Spreco (causale e valore dei movimenti di spreco)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS spreco (
+		  id_spreco SERIAL PRIMARY KEY,
+		  id_movimento INTEGER NOT NULL UNIQUE,
+		  causale VARCHAR(20) NOT NULL CHECK (causale IN ('scaduto', 'bruciato', 'caduto', 'reso_cliente')),
+		  costo_unitario NUMERIC(12,5) NOT NULL,
+		  FOREIGN KEY (id_movimento) REFERENCES movimento_magazzino (id_movimento) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create spreco table: %v", err)
+	}
+
+	// Tabella Lotto (partite di ingrediente con scadenza)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS lotto (
+		  id_lotto SERIAL PRIMARY KEY,
+		  id_ingrediente INTEGER NOT NULL,
+		  codice_lotto VARCHAR(50),
+		  quantita_iniziale FLOAT NOT NULL CHECK (quantita_iniziale > 0),
+		  quantita_residua FLOAT NOT NULL CHECK (quantita_residua >= 0),
+		  data_ricevimento TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  data_scadenza DATE,
+		  id_movimento INTEGER NOT NULL,
+		  FOREIGN KEY (id_ingrediente) REFERENCES ingrediente (id_ingrediente) ON DELETE CASCADE,
+		  FOREIGN KEY (id_movimento) REFERENCES movimento_magazzino (id_movimento) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create lotto table: %v", err)
+	}
+
+	// Tabella Consumo Lotto (quantità prelevate dai lotti per ogni movimento; negative se restituite)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS consumo_lotto (
+		  id_consumo SERIAL PRIMARY KEY,
+		  id_movimento INTEGER NOT NULL,
+		  id_lotto INTEGER NOT NULL,
+		  quantita FLOAT NOT NULL,
+		  FOREIGN KEY (id_movimento) REFERENCES movimento_magazzino (id_movimento) ON DELETE CASCADE,
+		  FOREIGN KEY (id_lotto) REFERENCES lotto (id_lotto) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create consumo_lotto table: %v", err)
+	}
+
+	// Tabella Inventario (conteggi fisici del magazzino)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS inventario (
+		  id_inventario SERIAL PRIMARY KEY,
+		  stato VARCHAR(20) NOT NULL DEFAULT 'bozza' CHECK (stato IN ('bozza', 'confermato')),
+		  note VARCHAR(255),
+		  data_creazione TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  data_conferma TIMESTAMP
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create inventario table: %v", err)
+	}
+
+	// Tabella Inventario Riga (quantità contate con la teorica al momento del conteggio; il costo è fissato alla conferma)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS inventario_riga (
+		  id_inventario INTEGER NOT NULL,
+		  id_ingrediente INTEGER NOT NULL,
+		  quantita_contata FLOAT NOT NULL CHECK (quantita_contata >= 0),
+		  quantita_teorica FLOAT,
+		  costo_unitario NUMERIC(12,5),
+		  PRIMARY KEY (id_inventario, id_ingrediente),
+		  FOREIGN KEY (id_inventario) REFERENCES inventario (id_inventario) ON DELETE CASCADE,
+		  FOREIGN KEY (id_ingrediente) REFERENCES ingrediente (id_ingrediente) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create inventario_riga table: %v", err)
+	}
+
+	// Costi unitari con cinque decimali, così i costi al grammo o al millilitro non si arrotondano a zero
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE ingrediente ALTER COLUMN costo_unitario TYPE NUMERIC(12,5);
+		ALTER TABLE storico_costo_ingrediente ALTER COLUMN costo_unitario TYPE NUMERIC(12,5);
+		ALTER TABLE spreco ALTER COLUMN costo_unitario TYPE NUMERIC(12,5);
+		ALTER TABLE inventario_riga ALTER COLUMN costo_unitario TYPE NUMERIC(12,5);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update costo_unitario columns: %v", err)
+	}
+
+	// Tabella Fornitore
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS fornitore (
+		  id_fornitore SERIAL PRIMARY KEY,
+		  nome VARCHAR(100) NOT NULL UNIQUE,
+		  email VARCHAR(100),
+		  telefono VARCHAR(30),
+		  note VARCHAR(255)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create fornitore table: %v", err)
+	}
+
+	// Tabella Fornitore Ingrediente (listino del fornitore)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS fornitore_ingrediente (
+		  id_fornitore INTEGER NOT NULL,
+		  id_ingrediente INTEGER NOT NULL,
+		  prezzo DECIMAL(10,2) NOT NULL CHECK (prezzo >= 0),
+		  giorni_consegna INTEGER NOT NULL DEFAULT 1 CHECK (giorni_consegna >= 0),
+		  ordine_minimo FLOAT NOT NULL DEFAULT 0 CHECK (ordine_minimo >= 0),
+		  PRIMARY KEY (id_fornitore, id_ingrediente),
+		  FOREIGN KEY (id_fornitore) REFERENCES fornitore (id_fornitore) ON DELETE CASCADE,
+		  FOREIGN KEY (id_ingrediente) REFERENCES ingrediente (id_ingrediente) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create fornitore_ingrediente table: %v", err)
+	}
+
+	// Tabella Ordine Acquisto (ordini ai fornitori)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS ordine_acquisto (
+		  id_ordine_acquisto SERIAL PRIMARY KEY,
+		  id_fornitore INTEGER NOT NULL,
+		  stato VARCHAR(25) NOT NULL DEFAULT 'bozza'
+		    CHECK (stato IN ('bozza', 'inviato', 'ricevuto_parzialmente', 'ricevuto')),
+		  note VARCHAR(255),
+		  data_creazione TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  data_invio TIMESTAMP,
+		  consegna_prevista DATE,
+		  data_ricezione TIMESTAMP,
+		  FOREIGN KEY (id_fornitore) REFERENCES fornitore (id_fornitore)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create ordine_acquisto table: %v", err)
+	}
+
+	// Tabella Ordine Acquisto Riga
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS ordine_acquisto_riga (
+		  id_riga SERIAL PRIMARY KEY,
+		  id_ordine_acquisto INTEGER NOT NULL,
+		  id_ingrediente INTEGER NOT NULL,
+		  quantita_ordinata FLOAT NOT NULL CHECK (quantita_ordinata > 0),
+		  quantita_ricevuta FLOAT NOT NULL DEFAULT 0,
+		  prezzo_unitario DECIMAL(10,2) NOT NULL,
+		  UNIQUE (id_ordine_acquisto, id_ingrediente),
+		  FOREIGN KEY (id_ordine_acquisto) REFERENCES ordine_acquisto (id_ordine_acquisto) ON DELETE CASCADE,
+		  FOREIGN KEY (id_ingrediente) REFERENCES ingrediente (id_ingrediente)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create ordine_acquisto_riga table: %v", err)
+	}
+
+	// Tabella Sottoconto (parti di un conto diviso)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS sottoconto (
+		  id_sottoconto SERIAL PRIMARY KEY,
+		  id_ordine INTEGER NOT NULL,
+		  nome VARCHAR(100) NOT NULL,
+		  num_persone INTEGER NOT NULL DEFAULT 0,
+		  subtotale DECIMAL(10,2) NOT NULL,
+		  importo_coperto DECIMAL(10,2) NOT NULL,
+		  totale DECIMAL(10,2) NOT NULL,
+		  pagato BOOLEAN NOT NULL DEFAULT FALSE,
+		  FOREIGN KEY (id_ordine) REFERENCES ordine (id_ordine) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create sottoconto table: %v", err)
+	}
+
+	// Tabella Sottoconto Riga (righe dell'ordine assegnate a una parte del conto)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS sottoconto_riga (
+		  id_sottoconto INTEGER NOT NULL,
+		  id_dettaglio INTEGER NOT NULL,
+		  PRIMARY KEY (id_sottoconto, id_dettaglio),
+		  FOREIGN KEY (id_sottoconto) REFERENCES sottoconto (id_sottoconto) ON DELETE CASCADE,
+		  FOREIGN KEY (id_dettaglio) REFERENCES dettaglio_ordine_pietanza (id_dettaglio) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create sottoconto_riga table: %v", err)
+	}
+
+	// Tabella Pagamento
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS pagamento (
+		  id_pagamento SERIAL PRIMARY KEY,
+		  id_ordine INTEGER NOT NULL,
+		  id_sottoconto INTEGER,
+		  importo DECIMAL(10,2) NOT NULL,
+		  metodo VARCHAR(10) NOT NULL CHECK (metodo IN ('contanti', 'carta', 'buono')),
+		  mancia DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+		  resto DECIMAL(10,2) NOT NULL DEFAULT 0.00,
+		  data_pagamento TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  FOREIGN KEY (id_ordine) REFERENCES ordine (id_ordine) ON DELETE CASCADE,
+		  FOREIGN KEY (id_sottoconto) REFERENCES sottoconto (id_sottoconto) ON DELETE SET NULL
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create pagamento table: %v", err)
+	}
+
+	// Tabelle Scontrino e Scontrino IVA: gli importi dello scontrino registrati quando l'ordine
+	// viene pagato, sommati dalla chiusura giornaliera
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS scontrino (
+		  id_ordine INTEGER PRIMARY KEY,
+		  data_emissione TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  costo_totale DECIMAL(10,2) NOT NULL,
+		  importo_alla_carta DECIMAL(10,2) NOT NULL,
+		  num_menu_fissi INTEGER NOT NULL,
+		  importo_menu_fissi DECIMAL(10,2) NOT NULL,
+		  importo_sconti DECIMAL(10,2) NOT NULL,
+		  importo_servizio DECIMAL(10,2) NOT NULL,
+		  num_coperti INTEGER NOT NULL,
+		  costo_coperto DECIMAL(10,2) NOT NULL,
+		  importo_coperto DECIMAL(10,2) NOT NULL,
+		  totale_complessivo DECIMAL(10,2) NOT NULL,
+		  totale_imponibile DECIMAL(10,2) NOT NULL,
+		  totale_imposta DECIMAL(10,2) NOT NULL,
+		  FOREIGN KEY (id_ordine) REFERENCES ordine (id_ordine) ON DELETE CASCADE
+		);
+		CREATE TABLE IF NOT EXISTS scontrino_iva (
+		  id_ordine INTEGER NOT NULL,
+		  aliquota DECIMAL(5,2) NOT NULL,
+		  imponibile DECIMAL(10,2) NOT NULL,
+		  imposta DECIMAL(10,2) NOT NULL,
+		  totale DECIMAL(10,2) NOT NULL,
+		  PRIMARY KEY (id_ordine, aliquota),
+		  FOREIGN KEY (id_ordine) REFERENCES scontrino (id_ordine) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create scontrino tables: %v", err)
+	}
+
+	// Colonna id_sottoconto per i database creati prima della divisione del conto
+	_, err = db.Pool.Exec(context.Background(), `
+		ALTER TABLE pagamento ADD COLUMN IF NOT EXISTS id_sottoconto INTEGER
+		  REFERENCES sottoconto (id_sottoconto) ON DELETE SET NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to update pagamento table: %v", err)
+	}
+
+	// Tabella Sconto (sconti, codici promozionali e servizio)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS sconto (
+		  id_sconto SERIAL PRIMARY KEY,
+		  nome VARCHAR(100) NOT NULL,
+		  codice VARCHAR(50) UNIQUE,
+		  tipo VARCHAR(20) NOT NULL CHECK (tipo IN ('percentuale', 'fisso', 'servizio')),
+		  valore DECIMAL(10,2) NOT NULL CHECK (valore > 0),
+		  id_categoria INTEGER,
+		  valido_dal TIMESTAMP,
+		  valido_al TIMESTAMP,
+		  utilizzi_massimi INTEGER,
+		  utilizzi INTEGER NOT NULL DEFAULT 0,
+		  attivo BOOLEAN NOT NULL DEFAULT TRUE,
+		  FOREIGN KEY (id_categoria) REFERENCES categoria_pietanza (id_categoria) ON DELETE CASCADE
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create sconto table: %v", err)
+	}
+
+	// Tabella Ordine Sconto (sconti applicati agli ordini)
+	_, err = db.Pool.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS ordine_sconto (
+		  id_ordine INTEGER NOT NULL,
+		  id_sconto INTEGER NOT NULL,
+		  data_applicazione TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		  PRIMARY KEY (id_ordine, id_sconto),
+		  FOREIGN KEY (id_ordine) REFERENCES ordine (id_ordine) ON DELETE CASCADE,
+		  FOREIGN KEY (id_sconto) REFERENCES sconto (id_sconto)
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create ordine_sconto table: %v", err)
+	}
+
 	// Indici per migliorare le performance
 	_, err = db.Pool.Exec(context.Background(), `
 		CREATE INDEX IF NOT EXISTS idx_ordine_tavolo ON ordine (id_tavolo);
 		CREATE INDEX IF NOT EXISTS idx_ordine_ristorante ON ordine (id_ristorante);
 		CREATE INDEX IF NOT EXISTS idx_ordine_stato ON ordine (stato);
 		CREATE INDEX IF NOT EXISTS idx_dettaglio_ordine ON dettaglio_ordine_pietanza (id_ordine);
+		CREATE INDEX IF NOT EXISTS idx_storico_stato_ordine ON storico_stato_ordine (id_ordine, data_cambio);
+		CREATE INDEX IF NOT EXISTS idx_pagamento_ordine ON pagamento (id_ordine);
+		CREATE INDEX IF NOT EXISTS idx_sottoconto_ordine ON sottoconto (id_ordine);
+		CREATE INDEX IF NOT EXISTS idx_movimento_ingrediente ON movimento_magazzino (id_ingrediente, data_movimento);
+		CREATE INDEX IF NOT EXISTS idx_movimento_ordine ON movimento_magazzino (id_ordine);
+		CREATE INDEX IF NOT EXISTS idx_lotto_ingrediente ON lotto (id_ingrediente, data_scadenza) WHERE quantita_residua > 0;
+		CREATE INDEX IF NOT EXISTS idx_consumo_lotto_movimento ON consumo_lotto (id_movimento);
+		CREATE INDEX IF NOT EXISTS idx_ordine_acquisto_fornitore ON ordine_acquisto (id_fornitore, stato);
+		CREATE INDEX IF NOT EXISTS idx_ricetta_ingrediente ON ricetta_ingrediente (id_ingrediente);
+		CREATE UNIQUE INDEX IF NOT EXISTS idx_ricetta_attiva ON ricetta (id_pietanza) WHERE attiva;
+		CREATE INDEX IF NOT EXISTS idx_dettaglio_ricetta ON dettaglio_ordine_pietanza (id_ricetta);
+		CREATE INDEX IF NOT EXISTS idx_evento_disponibilita_data ON evento_disponibilita (data_evento);
+		CREATE INDEX IF NOT EXISTS idx_pietanza_categoria ON pietanza (id_categoria);
 	`)
 	if err != nil {
 		return fmt.Errorf("failed to create indexes: %v", err)
@@ -33,7 +33,7 @@ func main() {
 	}
 
 	// Configurazione router
-	router := api.SetupRoutes(db)
+	router := api.SetupRoutes(db, cfg)
 
 	// Avvio server
 	addr := ":8080"
@@ -0,0 +1,91 @@
+package models
+
+import "slices"
+
+// I 14 allergeni da dichiarare secondo il Regolamento UE 1169/2011
+const (
+	AllergeneGlutine      = "glutine"
+	AllergeneCrostacei    = "crostacei"
+	AllergeneUova         = "uova"
+	AllergenePesce        = "pesce"
+	AllergeneArachidi     = "arachidi"
+	AllergeneSoia         = "soia"
+	AllergeneLattosio     = "lattosio"
+	AllergeneFruttaGuscio = "frutta_a_guscio"
+	AllergeneSedano       = "sedano"
+	AllergeneSenape       = "senape"
+	AllergeneSesamo       = "sesamo"
+	AllergeneSolfiti      = "solfiti"
+	AllergeneLupini       = "lupini"
+	AllergeneMolluschi    = "molluschi"
+)
+
+// Allergeni elenca gli allergeni ammessi, nell'ordine del regolamento
+var Allergeni = []string{
+	AllergeneGlutine, AllergeneCrostacei, AllergeneUova, AllergenePesce, AllergeneArachidi,
+	AllergeneSoia, AllergeneLattosio, AllergeneFruttaGuscio, AllergeneSedano, AllergeneSenape,
+	AllergeneSesamo, AllergeneSolfiti, AllergeneLupini, AllergeneMolluschi,
+}
+
+// Diete con cui una pietanza può essere compatibile
+const (
+	DietaVegetariana  = "vegetariana"
+	DietaVegana       = "vegana"
+	DietaSenzaGlutine = "senza_glutine"
+)
+
+// AllergeneValido indica se il nome è uno dei 14 allergeni
+func AllergeneValido(nome string) bool {
+	return slices.Contains(Allergeni, nome)
+}
+
+// DietaValida indica se il nome è una delle diete gestite
+func DietaValida(nome string) bool {
+	return nome == DietaVegetariana || nome == DietaVegana || nome == DietaSenzaGlutine
+}
+
+// ProfiloAllergeni riporta gli allergeni di una pietanza e le diete con cui è compatibile
+type ProfiloAllergeni struct {
+	Allergeni []string `json:"allergeni"`
+	Diete     []string `json:"diete"`
+}
+
+// Contiene indica se il profilo include l'allergene
+func (p *ProfiloAllergeni) Contiene(allergene string) bool {
+	return slices.Contains(p.Allergeni, allergene)
+}
+
+// Compatibile indica se il profilo è compatibile con la dieta
+func (p *ProfiloAllergeni) Compatibile(dieta string) bool {
+	return slices.Contains(p.Diete, dieta)
+}
+
+// ProfiloComune riassume i profili di più pietanze servite insieme: gli allergeni di almeno una
+// e le diete compatibili con tutte. È nil se manca il profilo di qualche pietanza
+func ProfiloComune(profili []*ProfiloAllergeni) *ProfiloAllergeni {
+	comune := &ProfiloAllergeni{Allergeni: []string{}, Diete: []string{DietaVegetariana, DietaVegana, DietaSenzaGlutine}}
+	for _, p := range profili {
+		if p == nil {
+			return nil
+		}
+		for _, a := range p.Allergeni {
+			if !comune.Contiene(a) {
+				comune.Allergeni = append(comune.Allergeni, a)
+			}
+		}
+		comune.Diete = slices.DeleteFunc(comune.Diete, func(d string) bool { return !p.Compatibile(d) })
+	}
+	comune.Allergeni = ordinaAllergeni(comune.Allergeni)
+	return comune
+}
+
+// ordinaAllergeni restituisce gli allergeni nell'ordine del regolamento
+func ordinaAllergeni(allergeni []string) []string {
+	ordinati := []string{}
+	for _, a := range Allergeni {
+		if slices.Contains(allergeni, a) {
+			ordinati = append(ordinati, a)
+		}
+	}
+	return ordinati
+}
@@ -0,0 +1,106 @@
+package models
+
+// FiltroAnalisi delimita i dati analizzati: ordini pagati con data ordine
+// compresa tra Dal e Al (inclusi, formato AAAA-MM-GG); IDRistorante 0 indica tutti i ristoranti
+type FiltroAnalisi struct {
+	Dal          string `json:"dal"`
+	Al           string `json:"al"`
+	IDRistorante int    `json:"id_ristorante,omitempty"`
+}
+
+// VenditaPietanza riporta le vendite di una pietanza nel periodo
+// Quantita comprende anche le porzioni servite nei menu fissi (QuantitaInMenu);
+// Ricavo considera solo le vendite alla carta, al prezzo del menu del ristorante
+type VenditaPietanza struct {
+	IDPietanza     int     `json:"id_pietanza"`
+	Nome           string  `json:"nome"`
+	Categoria      string  `json:"categoria"`
+	Quantita       int     `json:"quantita"`
+	QuantitaInMenu int     `json:"quantita_in_menu"`
+	Ricavo         Importo `json:"ricavo"`
+}
+
+// TopPietanze contiene le pietanze più vendute per quantità e per ricavo
+type TopPietanze struct {
+	Filtro      FiltroAnalisi     `json:"filtro"`
+	PerQuantita []VenditaPietanza `json:"per_quantita"`
+	PerRicavo   []VenditaPietanza `json:"per_ricavo"`
+}
+
+// CellaVendite riporta le vendite di una fascia: giorno della settimana (1 = lunedì, 7 = domenica) e/o ora del giorno
+type CellaVendite struct {
+	GiornoSettimana int     `json:"giorno_settimana,omitempty"`
+	Ora             *int    `json:"ora,omitempty"`
+	NumOrdini       int     `json:"num_ordini"`
+	NumCoperti      int     `json:"num_coperti"`
+	Ricavo          Importo `json:"ricavo"`
+}
+
+// MappaVendite raccoglie le vendite per ora del giorno, per giorno della settimana
+// e per entrambi (mappa di calore); sono riportate solo le fasce con almeno un ordine
+type MappaVendite struct {
+	Filtro    FiltroAnalisi  `json:"filtro"`
+	PerOra    []CellaVendite `json:"per_ora"`
+	PerGiorno []CellaVendite `json:"per_giorno"`
+	Celle     []CellaVendite `json:"celle"`
+}
+
+// UtilizzoMenuFisso riporta quante volte un menu fisso è stato ordinato nel periodo
+type UtilizzoMenuFisso struct {
+	IDMenu    int     `json:"id_menu"`
+	Nome      string  `json:"nome"`
+	NumMenu   int     `json:"num_menu"`
+	NumOrdini int     `json:"num_ordini"`
+	Ricavo    Importo `json:"ricavo"`
+}
+
+// AdesioneMenuFissi riassume la diffusione dei menu fissi sugli ordini del periodo
+type AdesioneMenuFissi struct {
+	Filtro        FiltroAnalisi       `json:"filtro"`
+	OrdiniTotali  int                 `json:"ordini_totali"`
+	OrdiniConMenu int                 `json:"ordini_con_menu"`
+	Percentuale   float64             `json:"percentuale"`
+	Menu          []UtilizzoMenuFisso `json:"menu"`
+}
+
+// CopertiPerTavolo riporta il numero medio di coperti per capienza del tavolo
+// Occupazione è il rapporto percentuale tra coperti medi e posti del tavolo
+type CopertiPerTavolo struct {
+	PostiTavolo  int     `json:"posti_tavolo"`
+	NumOrdini    int     `json:"num_ordini"`
+	MediaCoperti float64 `json:"media_coperti"`
+	Occupazione  float64 `json:"occupazione"`
+}
+
+// AnalisiCoperti raccoglie i coperti medi per capienza del tavolo
+type AnalisiCoperti struct {
+	Filtro FiltroAnalisi      `json:"filtro"`
+	Tavoli []CopertiPerTavolo `json:"tavoli"`
+}
+
+// IndicatoriPeriodo sono gli indicatori di vendita di un periodo
+type IndicatoriPeriodo struct {
+	Dal            string  `json:"dal"`
+	Al             string  `json:"al"`
+	NumOrdini      int     `json:"num_ordini"`
+	NumCoperti     int     `json:"num_coperti"`
+	Ricavo         Importo `json:"ricavo"`
+	ScontrinoMedio Importo `json:"scontrino_medio"`
+}
+
+// VariazioniPercentuali riporta la variazione percentuale di ogni indicatore rispetto al periodo precedente
+// Un valore nullo indica che nel periodo precedente l'indicatore era zero
+type VariazioniPercentuali struct {
+	NumOrdini      *float64 `json:"num_ordini"`
+	NumCoperti     *float64 `json:"num_coperti"`
+	Ricavo         *float64 `json:"ricavo"`
+	ScontrinoMedio *float64 `json:"scontrino_medio"`
+}
+
+// Andamento confronta gli indicatori del periodo con quelli del periodo precedente di pari durata
+type Andamento struct {
+	IDRistorante int                   `json:"id_ristorante,omitempty"`
+	Corrente     IndicatoriPeriodo     `json:"corrente"`
+	Precedente   IndicatoriPeriodo     `json:"precedente"`
+	Variazioni   VariazioniPercentuali `json:"variazioni"`
+}
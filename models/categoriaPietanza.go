@@ -1,7 +1,20 @@
 package models
 
 // CategoriaPietanza rappresenta la categoria di una pietanza
+// AliquotaIVA è l'aliquota delle pietanze della categoria (es. 10.00 per il 10%);
+// Posizione stabilisce l'ordine delle categorie nel menu (le più basse prima)
 type CategoriaPietanza struct {
-	ID   int    `json:"id"`
-	Nome string `json:"nome"`
-}
\ No newline at end of file
+	ID          int         `json:"id"`
+	Nome        string      `json:"nome"`
+	AliquotaIVA Percentuale `json:"aliquota_iva"`
+	Posizione   int         `json:"posizione"`
+}
+
+// CategoriaMenu è una sezione del menu con le pietanze della categoria
+// Le pietanze senza categoria sono raccolte in fondo, con IDCategoria nullo
+type CategoriaMenu struct {
+	IDCategoria *int       `json:"id_categoria"`
+	Nome        string     `json:"nome"`
+	Posizione   int        `json:"posizione"`
+	Pietanze    []Pietanza `json:"pietanze"`
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"math"
+	"time"
+)
+
+// StoricoCostoIngrediente registra un costo d'acquisto di un ingrediente e la data da cui è in vigore
+type StoricoCostoIngrediente struct {
+	ID            int           `json:"id"`
+	IDIngrediente int           `json:"id_ingrediente"`
+	CostoUnitario CostoUnitario `json:"costo_unitario"`
+	DataInizio    time.Time     `json:"data_inizio"`
+}
+
+// CostoIngrediente è il costo di un ingrediente per una porzione della pietanza
+type CostoIngrediente struct {
+	IDIngrediente int           `json:"id_ingrediente"`
+	Nome          string        `json:"nome"`
+	UnitaMisura   string        `json:"unita_misura"`
+	Quantita      float64       `json:"quantita"`
+	CostoUnitario CostoUnitario `json:"costo_unitario"`
+	Costo         Importo       `json:"costo"`
+}
+
+// CostoPietanza riporta il food cost di una porzione e il margine lordo sul prezzo al netto dell'IVA
+// CostoIncompleto indica che la pietanza non ha una ricetta o che qualche ingrediente non ha un costo;
+// NonCalcolabile che la quantità di qualche ingrediente non si converte nella sua unità di magazzino,
+// quindi food cost e margine non sono disponibili
+type CostoPietanza struct {
+	IDPietanza          int                `json:"id_pietanza"`
+	Nome                string             `json:"nome"`
+	Prezzo              Importo            `json:"prezzo"`
+	AliquotaIVA         Percentuale        `json:"aliquota_iva"`
+	PrezzoNetto         Importo            `json:"prezzo_netto"`
+	FoodCost            Importo            `json:"food_cost"`
+	Margine             Importo            `json:"margine"`
+	FoodCostPercentuale float64            `json:"food_cost_percentuale"`
+	MarginePercentuale  float64            `json:"margine_percentuale"`
+	CostoIncompleto     bool               `json:"costo_incompleto"`
+	NonCalcolabile      bool               `json:"non_calcolabile"`
+	SottoSoglia         bool               `json:"sotto_soglia"`
+	Ingredienti         []CostoIngrediente `json:"ingredienti,omitempty"`
+}
+
+// ReportMargini riporta il margine di tutte le pietanze, segnalando quelle sotto il margine minimo (in percentuale)
+type ReportMargini struct {
+	MargineMinimo  float64         `json:"margine_minimo"`
+	NumSottoSoglia int             `json:"num_sotto_soglia"`
+	Pietanze       []CostoPietanza `json:"pietanze"`
+}
+
+// CalcolaMargine completa il costo della pietanza a partire da prezzo, aliquota e costi degli ingredienti
+func (c *CostoPietanza) CalcolaMargine() {
+	c.FoodCost = 0
+	for _, ingrediente := range c.Ingredienti {
+		c.FoodCost += ingrediente.Costo
+		if ingrediente.CostoUnitario == 0 {
+			c.CostoIncompleto = true
+		}
+	}
+	if len(c.Ingredienti) == 0 {
+		c.CostoIncompleto = true
+	}
+
+	c.PrezzoNetto, _ = ScorporaIVA(c.Prezzo, c.AliquotaIVA)
+	c.FoodCostPercentuale, c.MarginePercentuale = 0, 0
+	if c.NonCalcolabile {
+		c.CostoIncompleto = true
+		c.FoodCost, c.Margine = 0, 0
+		return
+	}
+	c.Margine = c.PrezzoNetto - c.FoodCost
+	if c.PrezzoNetto > 0 {
+		c.FoodCostPercentuale = math.Round(float64(c.FoodCost)*1000/float64(c.PrezzoNetto)) / 10
+		c.MarginePercentuale = math.Round(float64(c.Margine)*1000/float64(c.PrezzoNetto)) / 10
+	}
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// CostoUnitario rappresenta il costo d'acquisto di un'unità di misura di un ingrediente,
+// espresso in centomillesimi di euro: i costi al grammo o al millilitro (es. 0,004 €/g)
+// restano esatti invece di arrotondarsi a zero come farebbero in centesimi.
+// Viene letto e scritto su PostgreSQL come NUMERIC(12,5) e serializzato in JSON
+// come numero con almeno due decimali (es. 12.50, 0.004)
+type CostoUnitario int64
+
+// decimaliCostoUnitario è il numero di decimali di euro di un costo unitario
+const decimaliCostoUnitario = 5
+
+// ParseCostoUnitario interpreta una stringa decimale (es. "0.004", "12.5")
+// Le cifre oltre il quinto decimale vengono arrotondate con le metà lontano dallo zero
+func ParseCostoUnitario(s string) (CostoUnitario, error) {
+	valore, err := parseDecimale(s, decimaliCostoUnitario)
+	if err != nil {
+		return 0, err
+	}
+	return CostoUnitario(valore), nil
+}
+
+// CostoUnitarioDaImporto converte un importo in centesimi (es. il prezzo di un fornitore) in costo unitario
+func CostoUnitarioDaImporto(i Importo) CostoUnitario {
+	return CostoUnitario(i.Centesimi() * 1000)
+}
+
+// CostoPerQuantita restituisce il costo di una quantità frazionaria (es. 0.15 kg) al costo unitario indicato,
+// arrotondato al centesimo con le metà lontano dallo zero
+func CostoPerQuantita(costoUnitario CostoUnitario, quantita float64) Importo {
+	return Importo(math.Round(float64(costoUnitario) * quantita / 1000))
+}
+
+// String restituisce il costo in euro con almeno due e al massimo cinque decimali (es. "12.50", "0.004")
+func (c CostoUnitario) String() string {
+	segno := ""
+	v := int64(c)
+	if v < 0 {
+		segno = "-"
+		v = -v
+	}
+	decimali := strings.TrimRight(fmt.Sprintf("%05d", v%100000), "0")
+	if len(decimali) < 2 {
+		decimali = (decimali + "00")[:2]
+	}
+	return fmt.Sprintf("%s%d.%s", segno, v/100000, decimali)
+}
+
+// MarshalJSON serializza il costo come numero JSON
+func (c CostoUnitario) MarshalJSON() ([]byte, error) {
+	return []byte(c.String()), nil
+}
+
+// UnmarshalJSON accetta un numero JSON o una stringa decimale, senza passare per float64
+func (c *CostoUnitario) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	v, err := ParseCostoUnitario(s)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFormatoImporto, string(data))
+	}
+	*c = v
+	return nil
+}
+
+// ScanNumeric permette a pgx di leggere una colonna NUMERIC direttamente in un CostoUnitario
+func (c *CostoUnitario) ScanNumeric(v pgtype.Numeric) error {
+	valore, err := scalaNumeric(v, decimaliCostoUnitario)
+	if err != nil {
+		return err
+	}
+	*c = CostoUnitario(valore)
+	return nil
+}
+
+// NumericValue permette a pgx di scrivere un CostoUnitario in una colonna NUMERIC senza perdita di precisione
+func (c CostoUnitario) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(c)), Exp: -decimaliCostoUnitario, Valid: true}, nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import (
+	"encoding/json"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParseCostoUnitario(t *testing.T) {
+	tests := []struct {
+		input  string
+		atteso CostoUnitario
+		testo  string
+	}{
+		{"0.004", 400, "0.004"},
+		{"12.5", 1250000, "12.50"},
+		{"3", 300000, "3.00"},
+		{"0.000015", 2, "0.00002"},
+		{"0.000014", 1, "0.00001"},
+		{"1.23456", 123456, "1.23456"},
+		{"-0.004", -400, "-0.004"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseCostoUnitario(tt.input)
+			if err != nil {
+				t.Fatalf("ParseCostoUnitario(%q) errore: %v", tt.input, err)
+			}
+			if got != tt.atteso {
+				t.Errorf("ParseCostoUnitario(%q) = %d, atteso %d", tt.input, got, tt.atteso)
+			}
+			if s := got.String(); s != tt.testo {
+				t.Errorf("CostoUnitario(%d).String() = %q, atteso %q", got, s, tt.testo)
+			}
+		})
+	}
+}
+
+func TestCostoPerQuantita(t *testing.T) {
+	tests := []struct {
+		name     string
+		costo    CostoUnitario
+		quantita float64
+		atteso   Importo
+	}{
+		{"grammi a costo inferiore al centesimo", 400, 250, 100}, // 250 g a 0,004 €/g
+		{"chilogrammi", 1250000, 0.15, 188},                      // 0,15 kg a 12,50 €/kg = 1,875
+		{"pochi grammi", 400, 1, 0},
+		{"quantità negativa", 400, -250, -100},
+		{"costo nullo", 0, 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CostoPerQuantita(tt.costo, tt.quantita); got != tt.atteso {
+				t.Errorf("CostoPerQuantita(%s, %g) = %d, atteso %d", tt.costo, tt.quantita, got, tt.atteso)
+			}
+		})
+	}
+
+	if got := CostoUnitarioDaImporto(1250); got != 1250000 {
+		t.Errorf("CostoUnitarioDaImporto(1250) = %d, atteso 1250000", got)
+	}
+}
+
+func TestCostoUnitarioJSONENumeric(t *testing.T) {
+	var c CostoUnitario
+	if err := json.Unmarshal([]byte(`0.004`), &c); err != nil || c != 400 {
+		t.Errorf("json.Unmarshal(0.004) = %d, %v; atteso 400, nil", c, err)
+	}
+	dati, err := json.Marshal(c)
+	if err != nil || string(dati) != "0.004" {
+		t.Errorf("json.Marshal = %s, %v; atteso 0.004", dati, err)
+	}
+
+	if err := c.ScanNumeric(pgtype.Numeric{Int: big.NewInt(4), Exp: -3, Valid: true}); err != nil || c != 400 {
+		t.Errorf("ScanNumeric(0.004) = %d, %v; atteso 400, nil", c, err)
+	}
+	valore, err := CostoUnitario(123456).NumericValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ScanNumeric(valore); err != nil || c != 123456 {
+		t.Errorf("ScanNumeric(NumericValue(1.23456)) = %d, %v; atteso 123456, nil", c, err)
+	}
+}
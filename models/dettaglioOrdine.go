@@ -1,6 +1,7 @@
 package models
 
 // DettaglioOrdine rappresenta una riga di un ordine, collegata a una pietanza
+// IDRicetta è la versione della ricetta usata per prepararla, da cui si calcolano gli ingredienti restituiti
 type DettaglioOrdine struct {
 	ID             int  `json:"id"`
 	IDOrdine       int  `json:"id_ordine"`
@@ -8,4 +9,5 @@ type DettaglioOrdine struct {
 	Quantita       int  `json:"quantita"`
 	ParteDiMenu    bool `json:"parte_di_menu"`
 	IDMenu         *int `json:"id_menu,omitempty"`
+	IDRicetta      *int `json:"id_ricetta,omitempty"`
 } 
\ No newline at end of file
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Tipi di evento sulla disponibilità automatica delle pietanze
+const (
+	EventoEsaurita     = "esaurita"
+	EventoRipristinata = "ripristinata"
+)
+
+// EventoDisponibilita registra un cambio automatico di disponibilità di una pietanza dovuto alle scorte:
+// esaurita quando le porzioni preparabili arrivano a zero, ripristinata quando tornano a bastare
+// per almeno una porzione. IDMovimento è il movimento di magazzino che ha causato il cambio
+type EventoDisponibilita struct {
+	ID          int       `json:"id"`
+	IDPietanza  int       `json:"id_pietanza"`
+	Nome        string    `json:"nome"`
+	Tipo        string    `json:"tipo"`
+	Porzioni    int       `json:"porzioni"`
+	IDMovimento *int      `json:"id_movimento,omitempty"`
+	DataEvento  time.Time `json:"data_evento"`
+}
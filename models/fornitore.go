@@ -0,0 +1,23 @@
+package models
+
+// Fornitore rappresenta un fornitore di ingredienti
+type Fornitore struct {
+	ID          int                    `json:"id"`
+	Nome        string                 `json:"nome"`
+	Email       string                 `json:"email,omitempty"`
+	Telefono    string                 `json:"telefono,omitempty"`
+	Note        string                 `json:"note,omitempty"`
+	Ingredienti []FornitoreIngrediente `json:"ingredienti,omitempty"`
+}
+
+// FornitoreIngrediente è la condizione di fornitura di un ingrediente: prezzo per unità di misura,
+// giorni di consegna e quantità minima ordinabile (nell'unità di misura dell'ingrediente)
+type FornitoreIngrediente struct {
+	IDFornitore    int     `json:"id_fornitore"`
+	IDIngrediente  int     `json:"id_ingrediente"`
+	Nome           string  `json:"nome,omitempty"`
+	UnitaMisura    string  `json:"unita_misura,omitempty"`
+	Prezzo         Importo `json:"prezzo"`
+	GiorniConsegna int     `json:"giorni_consegna"`
+	OrdineMinimo   float64 `json:"ordine_minimo"`
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Importo rappresenta una somma di denaro espressa in centesimi di euro
+// Le operazioni sono esatte (aritmetica intera); quando serve arrotondare
+// si arrotonda al centesimo più vicino, con le metà lontano dallo zero
+// (0,005 → 0,01). Viene letto e scritto su PostgreSQL come DECIMAL
+// e serializzato in JSON come numero con due decimali (es. 12.50)
+type Importo int64
+
+// ErrFormatoImporto è restituito quando un valore non può essere interpretato come importo
+var ErrFormatoImporto = errors.New("importo non valido")
+
+// ImportoDaCentesimi crea un importo a partire dal numero di centesimi
+func ImportoDaCentesimi(centesimi int64) Importo {
+	return Importo(centesimi)
+}
+
+// ParseImporto interpreta una stringa decimale (es. "12.5", "-3", "0.125")
+// Le cifre oltre il centesimo vengono arrotondate con le metà lontano dallo zero
+func ParseImporto(s string) (Importo, error) {
+	centesimi, err := parseDecimale(s, 2)
+	if err != nil {
+		return 0, err
+	}
+	return Importo(centesimi), nil
+}
+
+// parseDecimale interpreta una stringa decimale come intero con il numero di decimali indicato
+// (es. "12.5" con 2 decimali vale 1250), arrotondando le cifre in eccesso con le metà lontano dallo zero
+func parseDecimale(s string, cifre int) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrFormatoImporto
+	}
+
+	negativo := false
+	switch s[0] {
+	case '-':
+		negativo = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	interi, decimali, _ := strings.Cut(s, ".")
+	if interi == "" && decimali == "" {
+		return 0, ErrFormatoImporto
+	}
+	for _, c := range interi + decimali {
+		if c < '0' || c > '9' {
+			return 0, ErrFormatoImporto
+		}
+	}
+
+	// Porta i decimali a esattamente il numero di cifre richiesto, ricordando la prima cifra scartata
+	arrotonda := len(decimali) > cifre && decimali[cifre] >= '5'
+	decimali = (decimali + strings.Repeat("0", cifre))[:cifre]
+
+	valore, err := strconv.ParseInt(interi+decimali, 10, 64)
+	if err != nil {
+		return 0, ErrFormatoImporto
+	}
+	if arrotonda {
+		valore++
+	}
+	if negativo {
+		valore = -valore
+	}
+	return valore, nil
+}
+
+// Centesimi restituisce l'importo espresso in centesimi
+func (i Importo) Centesimi() int64 {
+	return int64(i)
+}
+
+// Per moltiplica l'importo per una quantità intera (es. prezzo per quantità)
+func (i Importo) Per(quantita int) Importo {
+	return i * Importo(quantita)
+}
+
+// Diviso divide l'importo per un numero intero positivo (es. per calcolare una media),
+// arrotondando al centesimo con le metà lontano dallo zero
+func (i Importo) Diviso(n int) Importo {
+	if n <= 0 {
+		return 0
+	}
+	quoziente, resto := int64(i)/int64(n), int64(i)%int64(n)
+	if resto < 0 {
+		resto = -resto
+	}
+	if resto*2 >= int64(n) {
+		if i < 0 {
+			quoziente--
+		} else {
+			quoziente++
+		}
+	}
+	return Importo(quoziente)
+}
+
+// Percentuale restituisce la percentuale indicata dell'importo (es. 10.00 per il 10%),
+// arrotondata al centesimo con le metà lontano dallo zero
+func (i Importo) Percentuale(percentuale Percentuale) Importo {
+	// centesimi * (percentuale in centesimi di punto) / 10000
+	prodotto := int64(i) * int64(percentuale)
+	quoziente, resto := prodotto/10000, prodotto%10000
+	if resto < 0 {
+		resto = -resto
+	}
+	if resto*2 >= 10000 {
+		if prodotto < 0 {
+			quoziente--
+		} else {
+			quoziente++
+		}
+	}
+	return Importo(quoziente)
+}
+
+// String restituisce l'importo in euro con due decimali (es. "12.50")
+func (i Importo) String() string {
+	segno := ""
+	c := int64(i)
+	if c < 0 {
+		segno = "-"
+		c = -c
+	}
+	return fmt.Sprintf("%s%d.%02d", segno, c/100, c%100)
+}
+
+// MarshalJSON serializza l'importo come numero JSON con due decimali
+func (i Importo) MarshalJSON() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// UnmarshalJSON accetta un numero JSON o una stringa decimale, senza passare per float64
+func (i *Importo) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	v, err := ParseImporto(s)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFormatoImporto, string(data))
+	}
+	*i = v
+	return nil
+}
+
+// ScanNumeric permette a pgx di leggere una colonna DECIMAL direttamente in un Importo
+func (i *Importo) ScanNumeric(v pgtype.Numeric) error {
+	centesimi, err := scalaNumeric(v, 2)
+	if err != nil {
+		return err
+	}
+	*i = Importo(centesimi)
+	return nil
+}
+
+// scalaNumeric converte un valore DECIMAL in un intero con il numero di decimali indicato,
+// arrotondando le cifre in eccesso con le metà lontano dallo zero
+func scalaNumeric(v pgtype.Numeric, cifre int64) (int64, error) {
+	if !v.Valid {
+		return 0, fmt.Errorf("%w: valore NULL", ErrFormatoImporto)
+	}
+	if v.NaN || v.InfinityModifier != pgtype.Finite {
+		return 0, fmt.Errorf("%w: valore non finito", ErrFormatoImporto)
+	}
+
+	// valore = Int * 10^Exp, mentre serve valore * 10^cifre
+	scalato := new(big.Int).Set(v.Int)
+	esponente := int64(v.Exp) + cifre
+	if esponente >= 0 {
+		scalato.Mul(scalato, new(big.Int).Exp(big.NewInt(10), big.NewInt(esponente), nil))
+	} else {
+		divisore := new(big.Int).Exp(big.NewInt(10), big.NewInt(-esponente), nil)
+		resto := new(big.Int)
+		scalato.QuoRem(scalato, divisore, resto)
+		// Arrotondamento con le metà lontano dallo zero
+		resto.Abs(resto).Mul(resto, big.NewInt(2))
+		if resto.Cmp(divisore) >= 0 {
+			if v.Int.Sign() < 0 {
+				scalato.Sub(scalato, big.NewInt(1))
+			} else {
+				scalato.Add(scalato, big.NewInt(1))
+			}
+		}
+	}
+
+	if !scalato.IsInt64() {
+		return 0, fmt.Errorf("%w: valore fuori intervallo", ErrFormatoImporto)
+	}
+	return scalato.Int64(), nil
+}
+
+// NumericValue permette a pgx di scrivere un Importo in una colonna DECIMAL senza perdita di precisione
+func (i Importo) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(i)), Exp: -2, Valid: true}, nil
+}
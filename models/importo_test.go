@@ -0,0 +1,208 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestParseImporto(t *testing.T) {
+	tests := []struct {
+		input  string
+		atteso Importo
+	}{
+		{"12.5", 1250},
+		{"12.50", 1250},
+		{"-3", -300},
+		{"+3", 300},
+		{"0", 0},
+		{".5", 50},
+		{"7.", 700},
+		{" 4.20 ", 420},
+		{"0.125", 13},
+		{"0.124", 12},
+		{"0.005", 1},
+		{"0.0049", 0},
+		{"-0.005", -1},
+		{"-0.125", -13},
+		{"1.999", 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseImporto(tt.input)
+			if err != nil {
+				t.Fatalf("ParseImporto(%q) errore: %v", tt.input, err)
+			}
+			if got != tt.atteso {
+				t.Errorf("ParseImporto(%q) = %d, atteso %d", tt.input, got, tt.atteso)
+			}
+		})
+	}
+
+	for _, input := range []string{"", " ", "-", ".", "abc", "1,50", "1.2.3", "1e3", "--1", "99999999999999999999"} {
+		t.Run("non valido "+input, func(t *testing.T) {
+			if _, err := ParseImporto(input); !errors.Is(err, ErrFormatoImporto) {
+				t.Errorf("ParseImporto(%q) errore = %v, atteso ErrFormatoImporto", input, err)
+			}
+		})
+	}
+}
+
+func TestImportoString(t *testing.T) {
+	tests := []struct {
+		importo Importo
+		atteso  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-5, "-0.05"},
+		{-1250, "-12.50"},
+		{100000, "1000.00"},
+	}
+	for _, tt := range tests {
+		if got := tt.importo.String(); got != tt.atteso {
+			t.Errorf("Importo(%d).String() = %q, atteso %q", tt.importo, got, tt.atteso)
+		}
+	}
+}
+
+func TestImportoDiviso(t *testing.T) {
+	tests := []struct {
+		importo Importo
+		n       int
+		atteso  Importo
+	}{
+		{1000, 3, 333},
+		{1000, 4, 250},
+		{1001, 2, 501},
+		{1003, 2, 502},
+		{-1001, 2, -501},
+		{2, 3, 1},
+		{1, 3, 0},
+		{1000, 0, 0},
+		{1000, -2, 0},
+	}
+	for _, tt := range tests {
+		if got := tt.importo.Diviso(tt.n); got != tt.atteso {
+			t.Errorf("Importo(%d).Diviso(%d) = %d, atteso %d", tt.importo, tt.n, got, tt.atteso)
+		}
+	}
+}
+
+func TestImportoPercentuale(t *testing.T) {
+	tests := []struct {
+		importo     Importo
+		percentuale Percentuale
+		atteso      Importo
+	}{
+		{1000, 1000, 100}, // 10% di 10,00
+		{1234, 1000, 123}, // 10% di 12,34 = 1,234
+		{1235, 1000, 124}, // 10% di 12,35 = 1,235
+		{999, 3333, 333},  // 33,33% di 9,99 = 3,329667
+		{-1235, 1000, -124},
+		{1000, 0, 0},
+		{1000, 10000, 1000},
+	}
+	for _, tt := range tests {
+		if got := tt.importo.Percentuale(tt.percentuale); got != tt.atteso {
+			t.Errorf("Importo(%d).Percentuale(%d) = %d, atteso %d", tt.importo, tt.percentuale, got, tt.atteso)
+		}
+	}
+}
+
+func TestImportoPer(t *testing.T) {
+	if got := Importo(1250).Per(3); got != 3750 {
+		t.Errorf("Importo(1250).Per(3) = %d, atteso 3750", got)
+	}
+	if got := Importo(1250).Per(0); got != 0 {
+		t.Errorf("Importo(1250).Per(0) = %d, atteso 0", got)
+	}
+}
+
+func TestImportoJSON(t *testing.T) {
+	dati, err := json.Marshal(struct {
+		Totale Importo `json:"totale"`
+	}{Totale: 1250})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(dati) != `{"totale":12.50}` {
+		t.Errorf("json.Marshal = %s, atteso {\"totale\":12.50}", dati)
+	}
+
+	tests := []struct {
+		input  string
+		atteso Importo
+	}{
+		{`12.5`, 1250},
+		{`"12.5"`, 1250},
+		{`0.1`, 10},
+		{`-7`, -700},
+	}
+	for _, tt := range tests {
+		var i Importo
+		if err := json.Unmarshal([]byte(tt.input), &i); err != nil {
+			t.Errorf("json.Unmarshal(%s) errore: %v", tt.input, err)
+			continue
+		}
+		if i != tt.atteso {
+			t.Errorf("json.Unmarshal(%s) = %d, atteso %d", tt.input, i, tt.atteso)
+		}
+	}
+
+	// null lascia invariato il valore
+	i := Importo(500)
+	if err := json.Unmarshal([]byte(`null`), &i); err != nil || i != 500 {
+		t.Errorf("json.Unmarshal(null) = %d, %v; atteso 500, nil", i, err)
+	}
+
+	if err := json.Unmarshal([]byte(`"abc"`), &i); !errors.Is(err, ErrFormatoImporto) {
+		t.Errorf("json.Unmarshal(\"abc\") errore = %v, atteso ErrFormatoImporto", err)
+	}
+}
+
+func TestImportoScanNumeric(t *testing.T) {
+	tests := []struct {
+		name   string
+		valore pgtype.Numeric
+		atteso Importo
+	}{
+		{"due decimali", pgtype.Numeric{Int: big.NewInt(1250), Exp: -2, Valid: true}, 1250},
+		{"intero", pgtype.Numeric{Int: big.NewInt(12), Exp: 0, Valid: true}, 1200},
+		{"esponente positivo", pgtype.Numeric{Int: big.NewInt(3), Exp: 2, Valid: true}, 30000},
+		{"tre decimali per eccesso", pgtype.Numeric{Int: big.NewInt(1235), Exp: -3, Valid: true}, 124},
+		{"tre decimali per difetto", pgtype.Numeric{Int: big.NewInt(1234), Exp: -3, Valid: true}, 123},
+		{"negativo", pgtype.Numeric{Int: big.NewInt(-1235), Exp: -3, Valid: true}, -124},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var i Importo
+			if err := i.ScanNumeric(tt.valore); err != nil {
+				t.Fatalf("ScanNumeric errore: %v", err)
+			}
+			if i != tt.atteso {
+				t.Errorf("ScanNumeric = %d, atteso %d", i, tt.atteso)
+			}
+		})
+	}
+
+	var i Importo
+	if err := i.ScanNumeric(pgtype.Numeric{}); !errors.Is(err, ErrFormatoImporto) {
+		t.Errorf("ScanNumeric(NULL) errore = %v, atteso ErrFormatoImporto", err)
+	}
+	if err := i.ScanNumeric(pgtype.Numeric{NaN: true, Valid: true}); !errors.Is(err, ErrFormatoImporto) {
+		t.Errorf("ScanNumeric(NaN) errore = %v, atteso ErrFormatoImporto", err)
+	}
+
+	valore, err := Importo(-1250).NumericValue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ScanNumeric(valore); err != nil || i != -1250 {
+		t.Errorf("ScanNumeric(NumericValue(-12.50)) = %d, %v; atteso -1250, nil", i, err)
+	}
+}
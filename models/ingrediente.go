@@ -2,10 +2,19 @@ package models
 
 
 // Ingrediente rappresenta un ingrediente in magazzino
+// CostoUnitario è il costo d'acquisto corrente per unità di misura (es. euro al kg)
+// PesoPezzo è il peso in grammi di un pezzo, per gli ingredienti a conteggio usati a peso nelle ricette
+// Allergeni sono quelli contenuti tra i 14 da dichiarare: nil se non ancora dichiarati, vuoto se non ne contiene;
+// Vegetariano e Vegano indicano le diete compatibili
 type Ingrediente struct {
 	ID                 int     `json:"id"`
 	Nome               string  `json:"nome"`
 	QuantitaDisponibile float64 `json:"quantita_disponibile"`
 	UnitaMisura        string  `json:"unita_misura"`
 	SogliaRiordino     float64 `json:"soglia_riordino"`
+	CostoUnitario      CostoUnitario `json:"costo_unitario"`
+	PesoPezzo          float64 `json:"peso_pezzo,omitempty"`
+	Allergeni          []string `json:"allergeni"`
+	Vegetariano        bool    `json:"vegetariano"`
+	Vegano             bool    `json:"vegano"`
 }
\ No newline at end of file
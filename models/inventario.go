@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Stati di un inventario: una bozza si può ancora modificare, un inventario confermato ha rettificato le scorte
+const (
+	InventarioBozza      = "bozza"
+	InventarioConfermato = "confermato"
+)
+
+// ConteggioIngrediente è la quantità di un ingrediente contata fisicamente in magazzino
+type ConteggioIngrediente struct {
+	IDIngrediente   int     `json:"id_ingrediente"`
+	QuantitaContata float64 `json:"quantita_contata"`
+}
+
+// RigaInventario confronta la quantità contata con quella registrata (teorica)
+// La quantità teorica è quella registrata al momento del conteggio; il costo di una bozza è quello attuale,
+// per un inventario confermato quello al momento della conferma
+type RigaInventario struct {
+	IDIngrediente    int           `json:"id_ingrediente"`
+	Nome             string        `json:"nome"`
+	UnitaMisura      string        `json:"unita_misura"`
+	QuantitaTeorica  float64       `json:"quantita_teorica"`
+	QuantitaContata  float64       `json:"quantita_contata"`
+	Differenza       float64       `json:"differenza"`
+	CostoUnitario    CostoUnitario `json:"costo_unitario"`
+	ValoreDifferenza Importo       `json:"valore_differenza"`
+}
+
+// Inventario rappresenta un conteggio fisico del magazzino con il report delle differenze,
+// valorizzate al costo unitario degli ingredienti: gli ammanchi sono le differenze negative
+type Inventario struct {
+	ID               int              `json:"id"`
+	Stato            string           `json:"stato"`
+	Note             string           `json:"note,omitempty"`
+	DataCreazione    time.Time        `json:"data_creazione"`
+	DataConferma     *time.Time       `json:"data_conferma,omitempty"`
+	NumRighe         int              `json:"num_righe"`
+	NumDifferenze    int              `json:"num_differenze"`
+	ValoreAmmanchi   Importo          `json:"valore_ammanchi"`
+	ValoreEccedenze  Importo          `json:"valore_eccedenze"`
+	ValoreDifferenze Importo          `json:"valore_differenze"`
+	Righe            []RigaInventario `json:"righe,omitempty"`
+}
+
+// CalcolaDifferenze completa le righe con differenza e valore e aggiorna i totali dell'inventario
+func (inv *Inventario) CalcolaDifferenze() {
+	inv.NumRighe = len(inv.Righe)
+	inv.NumDifferenze = 0
+	inv.ValoreAmmanchi, inv.ValoreEccedenze = 0, 0
+	for i := range inv.Righe {
+		riga := &inv.Righe[i]
+		riga.Differenza = riga.QuantitaContata - riga.QuantitaTeorica
+		riga.ValoreDifferenza = CostoPerQuantita(riga.CostoUnitario, riga.Differenza)
+		if riga.Differenza == 0 {
+			continue
+		}
+		inv.NumDifferenze++
+		if riga.ValoreDifferenza < 0 {
+			inv.ValoreAmmanchi -= riga.ValoreDifferenza
+		} else {
+			inv.ValoreEccedenze += riga.ValoreDifferenza
+		}
+	}
+	inv.ValoreDifferenze = inv.ValoreEccedenze - inv.ValoreAmmanchi
+}
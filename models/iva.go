@@ -0,0 +1,39 @@
+package models
+
+// AliquotaIVAPredefinita è l'aliquota applicata quando non ne è indicata una specifica
+// (somministrazione di alimenti, coperto e servizio): 10.00%
+const AliquotaIVAPredefinita = Percentuale(1000)
+
+// RiepilogoIVA riporta, per una singola aliquota, l'imponibile, l'imposta e il totale lordo
+type RiepilogoIVA struct {
+	Aliquota   Percentuale `json:"aliquota"`
+	Imponibile Importo     `json:"imponibile"`
+	Imposta    Importo     `json:"imposta"`
+	Totale     Importo     `json:"totale"`
+}
+
+// ScorporaIVA ricava imponibile e imposta da un importo lordo (IVA inclusa) all'aliquota indicata
+// L'imponibile è arrotondato al centesimo e l'imposta è la differenza, così la somma torna sempre al lordo
+func ScorporaIVA(lordo Importo, aliquota Percentuale) (imponibile Importo, imposta Importo) {
+	// imponibile = lordo * 100 / (100 + aliquota), con l'aliquota in centesimi di punto
+	numeratore := int64(lordo) * 10000
+	denominatore := 10000 + int64(aliquota)
+	quoziente, resto := numeratore/denominatore, numeratore%denominatore
+	if resto < 0 {
+		resto = -resto
+	}
+	if resto*2 >= denominatore {
+		if numeratore < 0 {
+			quoziente--
+		} else {
+			quoziente++
+		}
+	}
+	imponibile = Importo(quoziente)
+	return imponibile, lordo - imponibile
+}
+
+// AliquotaIVAValida verifica che l'aliquota sia compresa tra 0 e 100%
+func AliquotaIVAValida(aliquota Percentuale) bool {
+	return aliquota >= 0 && aliquota <= PercentualeMassima
+}
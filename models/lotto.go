@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// Lotto rappresenta una partita di ingrediente entrata in magazzino
+// La quantità disponibile dell'ingrediente comprende i residui dei lotti ed eventuali scorte senza lotto
+// (giacenze precedenti ai lotti o rettifiche in aumento)
+type Lotto struct {
+	ID               int        `json:"id"`
+	IDIngrediente    int        `json:"id_ingrediente"`
+	Nome             string     `json:"nome,omitempty"`
+	UnitaMisura      string     `json:"unita_misura,omitempty"`
+	CodiceLotto      string     `json:"codice_lotto,omitempty"`
+	QuantitaIniziale float64    `json:"quantita_iniziale"`
+	QuantitaResidua  float64    `json:"quantita_residua"`
+	DataRicevimento  time.Time  `json:"data_ricevimento"`
+	DataScadenza     *time.Time `json:"data_scadenza,omitempty"`
+}
+
+// DatiLotto sono codice e scadenza (AAAA-MM-GG) indicati al carico di un ingrediente; entrambi facoltativi
+type DatiLotto struct {
+	CodiceLotto  string `json:"codice_lotto"`
+	DataScadenza string `json:"data_scadenza"`
+}
+
+// LottoUtilizzato indica quanto di un lotto è stato usato per un ordine (al netto degli storni)
+type LottoUtilizzato struct {
+	IDIngrediente int        `json:"id_ingrediente"`
+	Nome          string     `json:"nome"`
+	UnitaMisura   string     `json:"unita_misura"`
+	IDLotto       int        `json:"id_lotto"`
+	CodiceLotto   string     `json:"codice_lotto,omitempty"`
+	DataScadenza  *time.Time `json:"data_scadenza,omitempty"`
+	Quantita      float64    `json:"quantita"`
+}
@@ -1,7 +1,18 @@
 package models
 
-// Menu rappresenta un menu di ristorante
+// Menu rappresenta una pietanza nel menu di un ristorante
+// Prezzo, se indicato, sostituisce nel ristorante il prezzo di listino della pietanza
 type Menu struct {
-	ID_Ristorante int `json:"id_ristorante"`
-	ID_Pietanza   int `json:"id_pietanza"`
+	ID_Ristorante int      `json:"id_ristorante"`
+	ID_Pietanza   int      `json:"id_pietanza"`
+	Prezzo        *Importo `json:"prezzo,omitempty"`
+}
+
+// VoceMenu è una pietanza del menu di un ristorante: Prezzo è quello applicato nel ristorante,
+// PrezzoListino quello della pietanza e Personalizzato indica se il ristorante ne ha uno proprio
+type VoceMenu struct {
+	Pietanza
+	IDRistorante   int     `json:"id_ristorante"`
+	PrezzoListino  Importo `json:"prezzo_listino"`
+	Personalizzato bool    `json:"prezzo_personalizzato"`
 }
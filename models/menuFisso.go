@@ -4,6 +4,6 @@ package models
 type MenuFisso struct {
 	ID          int     `json:"id"`
 	Nome        string  `json:"nome"`
-	Prezzo      float64 `json:"prezzo"`
+	Prezzo      Importo `json:"prezzo"`
 	Descrizione string  `json:"descrizione"`
 }
\ No newline at end of file
@@ -1,7 +1,9 @@
 package models
 
 // MenuFissoCompleto rappresenta un menu fisso con tutte le pietanze che lo compongono
+// Allergeni e diete riassumono quelli delle pietanze e mancano se qualcuna non ha una ricetta
 type MenuFissoCompleto struct {
 	Menu     MenuFisso  `json:"menu"`
 	Pietanze []Pietanza `json:"pietanze"`
+	*ProfiloAllergeni
 }
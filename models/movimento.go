@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// Tipi di movimento di magazzino
+const (
+	MovimentoCarico    = "carico"
+	MovimentoScarico   = "scarico"
+	MovimentoStorno    = "storno"
+	MovimentoRettifica = "rettifica"
+	MovimentoSpreco    = "spreco"
+)
+
+// TipoMovimentoValido verifica che la stringa sia un tipo di movimento conosciuto
+func TipoMovimentoValido(tipo string) bool {
+	switch tipo {
+	case MovimentoCarico, MovimentoScarico, MovimentoStorno, MovimentoRettifica, MovimentoSpreco:
+		return true
+	}
+	return false
+}
+
+// MovimentoMagazzino rappresenta una variazione della quantità disponibile di un ingrediente
+// Quantita è la variazione con segno (positiva per le entrate); gli scarichi per ordine
+// riportano l'ordine, e un ripristino di ingredienti non consumati è uno storno dell'ordine
+type MovimentoMagazzino struct {
+	ID            int       `json:"id"`
+	IDIngrediente int       `json:"id_ingrediente"`
+	Tipo          string    `json:"tipo"`
+	Quantita      float64   `json:"quantita"`
+	QuantitaPrima float64   `json:"quantita_prima"`
+	QuantitaDopo  float64   `json:"quantita_dopo"`
+	IDOrdine      *int      `json:"id_ordine,omitempty"`
+	Note          string    `json:"note,omitempty"`
+	DataMovimento time.Time `json:"data_movimento"`
+}
+
+// FiltroMovimenti seleziona i movimenti di un ingrediente per periodo (date AAAA-MM-GG, estremi inclusi) e tipo
+// I campi vuoti non filtrano
+type FiltroMovimenti struct {
+	Dal  string
+	Al   string
+	Tipo string
+}
@@ -13,7 +13,7 @@ type Ordine struct {
 	DataOrdine   time.Time `json:"data_ordine"`
 	Stato        string    `json:"stato"`
 	IDRistorante int       `json:"id_ristorante"`
-	CostoTotale  float64   `json:"costo_totale"`
+	CostoTotale  Importo   `json:"costo_totale"`
 }
 
 // ErrOrdineNonTrovato è un errore personalizzato restituito quando non viene trovato un ordine
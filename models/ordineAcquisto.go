@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// Stati di un ordine di acquisto
+const (
+	AcquistoBozza                = "bozza"
+	AcquistoInviato              = "inviato"
+	AcquistoRicevutoParzialmente = "ricevuto_parzialmente"
+	AcquistoRicevuto             = "ricevuto"
+)
+
+// StatoAcquistoValido verifica che la stringa sia uno stato dell'ordine di acquisto conosciuto
+func StatoAcquistoValido(stato string) bool {
+	switch stato {
+	case AcquistoBozza, AcquistoInviato, AcquistoRicevutoParzialmente, AcquistoRicevuto:
+		return true
+	}
+	return false
+}
+
+// RigaOrdineAcquisto è un ingrediente ordinato al fornitore, con la quantità già ricevuta
+type RigaOrdineAcquisto struct {
+	ID               int     `json:"id"`
+	IDIngrediente    int     `json:"id_ingrediente"`
+	Nome             string  `json:"nome"`
+	UnitaMisura      string  `json:"unita_misura"`
+	QuantitaOrdinata float64 `json:"quantita_ordinata"`
+	QuantitaRicevuta float64 `json:"quantita_ricevuta"`
+	PrezzoUnitario   Importo `json:"prezzo_unitario"`
+	Importo          Importo `json:"importo"`
+}
+
+// OrdineAcquisto rappresenta un ordine a un fornitore
+// ConsegnaPrevista è calcolata all'invio dai giorni di consegna più lunghi tra gli ingredienti ordinati
+type OrdineAcquisto struct {
+	ID               int                  `json:"id"`
+	IDFornitore      int                  `json:"id_fornitore"`
+	Fornitore        string               `json:"fornitore"`
+	Stato            string               `json:"stato"`
+	Note             string               `json:"note,omitempty"`
+	DataCreazione    time.Time            `json:"data_creazione"`
+	DataInvio        *time.Time           `json:"data_invio,omitempty"`
+	ConsegnaPrevista *time.Time           `json:"consegna_prevista,omitempty"`
+	DataRicezione    *time.Time           `json:"data_ricezione,omitempty"`
+	Totale           Importo              `json:"totale"`
+	Righe            []RigaOrdineAcquisto `json:"righe"`
+}
+
+// CalcolaTotale calcola l'importo di ogni riga (quantità ordinata per prezzo) e il totale dell'ordine
+func (o *OrdineAcquisto) CalcolaTotale() {
+	o.Totale = 0
+	for i := range o.Righe {
+		o.Righe[i].Importo = CostoPerQuantita(CostoUnitarioDaImporto(o.Righe[i].PrezzoUnitario), o.Righe[i].QuantitaOrdinata)
+		o.Totale += o.Righe[i].Importo
+	}
+}
+
+// RiordinoGenerato è il risultato della generazione degli ordini di acquisto dagli ingredienti da riordinare
+// SenzaFornitore elenca gli ingredienti sotto soglia che nessun fornitore tratta
+type RiordinoGenerato struct {
+	Ordini         []OrdineAcquisto `json:"ordini"`
+	SenzaFornitore []Ingrediente    `json:"senza_fornitore"`
+}
+
+// RicezioneRiga indica la quantità ricevuta per una riga dell'ordine di acquisto,
+// con codice e scadenza del lotto consegnato
+type RicezioneRiga struct {
+	IDRiga       int     `json:"id_riga"`
+	Quantita     float64 `json:"quantita"`
+	CodiceLotto  string  `json:"codice_lotto,omitempty"`
+	DataScadenza string  `json:"data_scadenza,omitempty"`
+}
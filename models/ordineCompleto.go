@@ -8,6 +8,7 @@ type DettaglioPietanza struct {
 	Quantita    int      `json:"quantita"`
 	ParteDiMenu bool     `json:"parte_di_menu"`
 	IDMenu      *int     `json:"id_menu,omitempty"`
+	IDRicetta   *int     `json:"id_ricetta,omitempty"`
 }
 
 // DettaglioMenuFisso contiene un menu fisso con le sue pietanze
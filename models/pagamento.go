@@ -0,0 +1,43 @@
+package models
+
+import "time"
+
+// Metodi di pagamento accettati
+const (
+	MetodoContanti = "contanti"
+	MetodoCarta    = "carta"
+	MetodoBuono    = "buono"
+)
+
+// Pagamento rappresenta il pagamento del conto di un ordine
+// Importo è quanto versato dal cliente, mancia compresa: per i contanti il resto è
+// l'importo meno il totale e la mancia, con la carta l'importo è esattamente il totale più la mancia
+type Pagamento struct {
+	ID            int       `json:"id"`
+	IDOrdine      int       `json:"id_ordine"`
+	IDSottoconto  *int      `json:"id_sottoconto,omitempty"`
+	Importo       Importo   `json:"importo"`
+	Metodo        string    `json:"metodo"`
+	Mancia        Importo   `json:"mancia"`
+	Resto         Importo   `json:"resto"`
+	DataPagamento time.Time `json:"data_pagamento"`
+}
+
+// EsitoPagamento riassume il risultato di un pagamento: il pagamento registrato,
+// lo scontrino su cui è stato validato e l'ordine (chiuso quando il conto è saldato)
+// Se il conto è diviso, Sottoconto indica la parte pagata
+type EsitoPagamento struct {
+	Pagamento  Pagamento   `json:"pagamento"`
+	Scontrino  Scontrino   `json:"scontrino"`
+	Sottoconto *Sottoconto `json:"sottoconto,omitempty"`
+	Ordine     Ordine      `json:"ordine"`
+}
+
+// MetodoPagamentoValido verifica che il metodo di pagamento sia tra quelli accettati
+func MetodoPagamentoValido(metodo string) bool {
+	switch metodo {
+	case MetodoContanti, MetodoCarta, MetodoBuono:
+		return true
+	}
+	return false
+}
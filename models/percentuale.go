@@ -0,0 +1,77 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Percentuale rappresenta una percentuale espressa in centesimi di punto (es. 1000 = 10.00%),
+// come le aliquote IVA e gli sconti in percentuale. Viene letta e scritta su PostgreSQL come DECIMAL
+// e serializzata in JSON come numero con due decimali (es. 22.00)
+type Percentuale int64
+
+// PercentualeMassima è il 100%
+const PercentualeMassima = Percentuale(10000)
+
+// ErrFormatoPercentuale è restituito quando un valore non può essere interpretato come percentuale
+var ErrFormatoPercentuale = errors.New("percentuale non valida")
+
+// ParsePercentuale interpreta una stringa decimale (es. "10", "22.5")
+// Le cifre oltre il centesimo di punto vengono arrotondate con le metà lontano dallo zero
+func ParsePercentuale(s string) (Percentuale, error) {
+	valore, err := parseDecimale(s, 2)
+	if err != nil {
+		return 0, ErrFormatoPercentuale
+	}
+	return Percentuale(valore), nil
+}
+
+// String restituisce la percentuale con due decimali, senza simbolo (es. "10.00")
+func (p Percentuale) String() string {
+	segno := ""
+	v := int64(p)
+	if v < 0 {
+		segno = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", segno, v/100, v%100)
+}
+
+// MarshalJSON serializza la percentuale come numero JSON con due decimali
+func (p Percentuale) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON accetta un numero JSON o una stringa decimale, senza passare per float64
+func (p *Percentuale) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	s = strings.Trim(s, `"`)
+	v, err := ParsePercentuale(s)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrFormatoPercentuale, string(data))
+	}
+	*p = v
+	return nil
+}
+
+// ScanNumeric permette a pgx di leggere una colonna DECIMAL direttamente in una Percentuale
+func (p *Percentuale) ScanNumeric(v pgtype.Numeric) error {
+	valore, err := scalaNumeric(v, 2)
+	if err != nil {
+		return err
+	}
+	*p = Percentuale(valore)
+	return nil
+}
+
+// NumericValue permette a pgx di scrivere una Percentuale in una colonna DECIMAL senza perdita di precisione
+func (p Percentuale) NumericValue() (pgtype.Numeric, error) {
+	return pgtype.Numeric{Int: big.NewInt(int64(p)), Exp: -2, Valid: true}, nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParsePercentuale(t *testing.T) {
+	tests := []struct {
+		input  string
+		atteso Percentuale
+		testo  string
+	}{
+		{"10", 1000, "10.00"},
+		{"22.5", 2250, "22.50"},
+		{"4.005", 401, "4.01"},
+		{"0", 0, "0.00"},
+		{"-5", -500, "-5.00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParsePercentuale(tt.input)
+			if err != nil {
+				t.Fatalf("ParsePercentuale(%q) errore: %v", tt.input, err)
+			}
+			if got != tt.atteso {
+				t.Errorf("ParsePercentuale(%q) = %d, atteso %d", tt.input, got, tt.atteso)
+			}
+			if s := got.String(); s != tt.testo {
+				t.Errorf("Percentuale(%d).String() = %q, atteso %q", got, s, tt.testo)
+			}
+		})
+	}
+
+	if _, err := ParsePercentuale("dieci"); err == nil {
+		t.Error("ParsePercentuale(\"dieci\") senza errore")
+	}
+}
+
+func TestPercentualeJSON(t *testing.T) {
+	var v struct {
+		Aliquota Percentuale `json:"aliquota"`
+	}
+	if err := json.Unmarshal([]byte(`{"aliquota": 22}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Aliquota != 2200 {
+		t.Errorf("aliquota = %d, attesa 2200", v.Aliquota)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != `{"aliquota":22.00}` {
+		t.Errorf("json = %s, atteso {\"aliquota\":22.00}", out)
+	}
+}
@@ -2,10 +2,18 @@ package models
 
 
 // Pietanza rappresenta un piatto nel menu
+// Il prezzo è IVA inclusa; AliquotaIVA, se indicata, sostituisce quella della categoria
+// Esaurita indica che la pietanza è stata resa non disponibile automaticamente per mancanza di scorte;
+// Porzioni è il numero di porzioni preparabili con le scorte attuali (assente se la ricetta non lo limita)
+// Allergeni e diete sono ricavati dalla ricetta attiva e mancano per le pietanze senza ricetta
 type Pietanza struct {
-	ID          int     `json:"id"`
-	Nome        string  `json:"nome"`
-	Prezzo      float64 `json:"prezzo"`
-	IDCategoria *int    `json:"id_categoria,omitempty"`
-	Disponibile bool    `json:"disponibile"`
+	ID          int          `json:"id"`
+	Nome        string       `json:"nome"`
+	Prezzo      Importo      `json:"prezzo"`
+	IDCategoria *int         `json:"id_categoria,omitempty"`
+	AliquotaIVA *Percentuale `json:"aliquota_iva,omitempty"`
+	Disponibile bool         `json:"disponibile"`
+	Esaurita    bool         `json:"esaurita"`
+	Porzioni    *int         `json:"porzioni,omitempty"`
+	*ProfiloAllergeni
 }
@@ -0,0 +1,42 @@
+package models
+
+// ReportChiusura riassume gli ordini pagati di un ristorante in una giornata (chiusura giornaliera)
+// Gli importi per categoria e per menu fisso sono lordi, prima di sconti e servizio;
+// IncassoTotale è la somma dei totali degli scontrini
+type ReportChiusura struct {
+	Data             string             `json:"data"`
+	IDRistorante     int                `json:"id_ristorante"`
+	NumOrdini        int                `json:"num_ordini"`
+	NumCoperti       int                `json:"num_coperti"`
+	IncassoCoperto   Importo            `json:"incasso_coperto"`
+	ImportoAllaCarta Importo            `json:"importo_alla_carta"`
+	NumMenuFissi     int                `json:"num_menu_fissi"`
+	ImportoMenuFissi Importo            `json:"importo_menu_fissi"`
+	ImportoSconti    Importo            `json:"importo_sconti"`
+	ImportoServizio  Importo            `json:"importo_servizio"`
+	IncassoTotale    Importo            `json:"incasso_totale"`
+	ScontrinoMedio   Importo            `json:"scontrino_medio"`
+	Mance            Importo            `json:"mance"`
+	PerCategoria     []IncassoCategoria `json:"per_categoria"`
+	PerMetodo        []IncassoMetodo    `json:"per_metodo"`
+	IVA              []RiepilogoIVA     `json:"iva"`
+}
+
+// IncassoCategoria riporta le pietanze alla carta vendute in una categoria
+type IncassoCategoria struct {
+	IDCategoria *int    `json:"id_categoria,omitempty"`
+	Categoria   string  `json:"categoria"`
+	Quantita    int     `json:"quantita"`
+	Importo     Importo `json:"importo"`
+}
+
+// IncassoMetodo riporta quanto incassato con un metodo di pagamento (al netto del resto)
+type IncassoMetodo struct {
+	Metodo       string  `json:"metodo"`
+	NumPagamenti int     `json:"num_pagamenti"`
+	Importo      Importo `json:"importo"`
+	Mance        Importo `json:"mance"`
+}
+
+// MetodoNonRegistrato indica gli ordini pagati senza un pagamento registrato
+const MetodoNonRegistrato = "non_registrato"
@@ -1,12 +1,25 @@
 package models
 
+import "time"
 
 // Ricetta rappresenta la ricetta di una pietanza
+// Ogni modifica di una ricetta già usata da qualche ordine crea una nuova versione: una sola è attiva
+// per pietanza, le precedenti restano per gli ordini che le hanno usate
 type Ricetta struct {
-	ID                int    `json:"id"`
-	Nome              string `json:"nome"`
-	Descrizione       string `json:"descrizione"`
-	IDPietanza        int    `json:"id_pietanza"`
-	TempoPreparazione int    `json:"tempo_preparazione"`
-	Istruzioni        string `json:"istruzioni"`
+	ID                int       `json:"id"`
+	Nome              string    `json:"nome"`
+	Descrizione       string    `json:"descrizione"`
+	IDPietanza        int       `json:"id_pietanza"`
+	TempoPreparazione int       `json:"tempo_preparazione"`
+	Istruzioni        string    `json:"istruzioni"`
+	Versione          int       `json:"versione"`
+	Attiva            bool      `json:"attiva"`
+	DataCreazione     time.Time `json:"data_creazione"`
+}
+
+// RicettaConIngredienti è una ricetta con le righe degli ingredienti,
+// usata per crearla o modificarla con un'unica richiesta
+type RicettaConIngredienti struct {
+	Ricetta
+	Ingredienti []RicettaIngrediente `json:"ingredienti"`
 }
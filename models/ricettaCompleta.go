@@ -1,9 +1,11 @@
 package models
 
-// IngredienteConQuantita rappresenta un ingrediente con la quantità richiesta nella ricetta
+// IngredienteConQuantita rappresenta un ingrediente con la quantità richiesta nella ricetta,
+// espressa nell'unità di misura della ricetta
 type IngredienteConQuantita struct {
 	Ingrediente Ingrediente `json:"ingrediente"`
 	Quantita    float64     `json:"quantita"`
+	UnitaMisura string      `json:"unita_misura"`
 }
 
 // RicettaCompleta rappresenta una ricetta completa con tutti i suoi ingredienti
@@ -11,3 +13,34 @@ type RicettaCompleta struct {
 	Ricetta     Ricetta                  `json:"ricetta"`
 	Ingredienti []IngredienteConQuantita `json:"ingredienti"`
 }
+
+// Profilo ricava dagli ingredienti della ricetta gli allergeni della pietanza e le diete con cui è compatibile:
+// vegetariana o vegana se lo sono tutti gli ingredienti, senza glutine se nessuno lo contiene.
+// È nil, cioè allergeni non noti, se la ricetta non ha ingredienti o qualcuno non ha gli allergeni dichiarati
+func (rc *RicettaCompleta) Profilo() *ProfiloAllergeni {
+	if len(rc.Ingredienti) == 0 {
+		return nil
+	}
+	var allergeni []string
+	vegetariana, vegana := true, true
+	for _, riga := range rc.Ingredienti {
+		if riga.Ingrediente.Allergeni == nil {
+			return nil
+		}
+		allergeni = append(allergeni, riga.Ingrediente.Allergeni...)
+		vegetariana = vegetariana && riga.Ingrediente.Vegetariano
+		vegana = vegana && riga.Ingrediente.Vegano
+	}
+
+	profilo := &ProfiloAllergeni{Allergeni: ordinaAllergeni(allergeni), Diete: []string{}}
+	if vegetariana {
+		profilo.Diete = append(profilo.Diete, DietaVegetariana)
+	}
+	if vegana {
+		profilo.Diete = append(profilo.Diete, DietaVegana)
+	}
+	if !profilo.Contiene(AllergeneGlutine) {
+		profilo.Diete = append(profilo.Diete, DietaSenzaGlutine)
+	}
+	return profilo
+}
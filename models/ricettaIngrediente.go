@@ -1,8 +1,12 @@
 package models
 
 // RicettaIngrediente rappresenta la relazione tra ricetta e ingrediente
+// La quantità è espressa in UnitaMisura, che può differire dall'unità dell'ingrediente in magazzino
+// purché convertibile (es. grammi per un ingrediente a kg)
 type RicettaIngrediente struct {
 	IDRicetta     int     `json:"id_ricetta"`
 	IDIngrediente int     `json:"id_ingrediente"`
+	Nome          string  `json:"nome,omitempty"`
 	Quantita      float64 `json:"quantita"`
-}
\ No newline at end of file
+	UnitaMisura   string  `json:"unita_misura"`
+}
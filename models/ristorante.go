@@ -5,5 +5,5 @@ type Ristorante struct {
 	ID           int     `json:"id"`
 	Nome         string  `json:"nome"`
 	NumeroTavoli int     `json:"numero_tavoli"`
-	CostoCoperto float64 `json:"costo_coperto"`
+	CostoCoperto Importo `json:"costo_coperto"`
 }
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Tipi di sconto
+const (
+	ScontoPercentuale = "percentuale"
+	ScontoFisso       = "fisso"
+	ScontoServizio    = "servizio"
+)
+
+// Sconto rappresenta uno sconto, un codice promozionale o una maggiorazione per il servizio
+// Per i tipi "percentuale" e "servizio" Valore è una percentuale (es. 10.00 = 10%),
+// per il tipo "fisso" è un importo in euro: si legge con Valore.Percentuale o Valore.Importo
+// Se IDCategoria è valorizzato lo sconto si applica solo alle pietanze alla carta di quella categoria
+type Sconto struct {
+	ID              int          `json:"id"`
+	Nome            string       `json:"nome"`
+	Codice          *string      `json:"codice,omitempty"`
+	Tipo            string       `json:"tipo"`
+	Valore          ValoreSconto `json:"valore"`
+	IDCategoria     *int         `json:"id_categoria,omitempty"`
+	ValidoDal       *time.Time   `json:"valido_dal,omitempty"`
+	ValidoAl        *time.Time   `json:"valido_al,omitempty"`
+	UtilizziMassimi *int         `json:"utilizzi_massimi,omitempty"`
+	Utilizzi        int          `json:"utilizzi"`
+	Attivo          bool         `json:"attivo"`
+}
+
+// ValoreSconto è il valore di uno sconto con due decimali, il cui significato dipende dal tipo di sconto
+// Viene letto e scritto su PostgreSQL come DECIMAL e serializzato in JSON come numero con due decimali
+type ValoreSconto int64
+
+// Percentuale restituisce il valore di uno sconto "percentuale" o "servizio"
+func (v ValoreSconto) Percentuale() Percentuale {
+	return Percentuale(v)
+}
+
+// Importo restituisce il valore in euro di uno sconto "fisso"
+func (v ValoreSconto) Importo() Importo {
+	return Importo(v)
+}
+
+// MarshalJSON serializza il valore come numero JSON con due decimali
+func (v ValoreSconto) MarshalJSON() ([]byte, error) {
+	return v.Importo().MarshalJSON()
+}
+
+// UnmarshalJSON accetta un numero JSON o una stringa decimale, senza passare per float64
+func (v *ValoreSconto) UnmarshalJSON(data []byte) error {
+	var i Importo
+	if err := i.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*v = ValoreSconto(i)
+	return nil
+}
+
+// ScanNumeric permette a pgx di leggere una colonna DECIMAL direttamente in un ValoreSconto
+func (v *ValoreSconto) ScanNumeric(n pgtype.Numeric) error {
+	valore, err := scalaNumeric(n, 2)
+	if err != nil {
+		return err
+	}
+	*v = ValoreSconto(valore)
+	return nil
+}
+
+// NumericValue permette a pgx di scrivere un ValoreSconto in una colonna DECIMAL senza perdita di precisione
+func (v ValoreSconto) NumericValue() (pgtype.Numeric, error) {
+	return v.Importo().NumericValue()
+}
+
+// VoceScontrino rappresenta una riga di sconto o di servizio riportata sullo scontrino
+// L'importo è negativo per gli sconti e positivo per il servizio
+// IDCategoria è valorizzato per gli sconti limitati a una categoria di pietanze
+type VoceScontrino struct {
+	IDSconto    int     `json:"id_sconto"`
+	Descrizione string  `json:"descrizione"`
+	Tipo        string  `json:"tipo"`
+	Codice      *string `json:"codice,omitempty"`
+	IDCategoria *int    `json:"id_categoria,omitempty"`
+	Importo     Importo `json:"importo"`
+}
+
+// TipoScontoValido verifica che il tipo di sconto sia tra quelli previsti
+func TipoScontoValido(tipo string) bool {
+	switch tipo {
+	case ScontoPercentuale, ScontoFisso, ScontoServizio:
+		return true
+	}
+	return false
+}
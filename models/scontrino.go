@@ -3,13 +3,26 @@ package models
 import "time"
 
 // Scontrino rappresenta i dettagli del conto finale di un ordine
+// Sconti e servizio sono riportati come voci separate e non si applicano al coperto
+// IVA riporta lo scorporo del totale complessivo per aliquota
 type Scontrino struct {
-	IDOrdine          int       `json:"id_ordine"`
-	IDTavolo          int       `json:"id_tavolo"`
-	DataOrdine        time.Time `json:"data_ordine"`
-	CostoTotale       float64   `json:"costo_totale"`
-	NumCoperti        int       `json:"num_coperti"`
-	CostoCoperto      float64   `json:"costo_coperto"`
-	ImportoCoperto    float64   `json:"importo_coperto"`
-	TotaleComplessivo float64   `json:"totale_complessivo"`
+	IDOrdine          int             `json:"id_ordine"`
+	IDTavolo          int             `json:"id_tavolo"`
+	DataOrdine        time.Time       `json:"data_ordine"`
+	CostoTotale       Importo         `json:"costo_totale"`
+	Sconti            []VoceScontrino `json:"sconti,omitempty"`
+	ImportoSconti     Importo         `json:"importo_sconti"`
+	ImportoServizio   Importo         `json:"importo_servizio"`
+	NumCoperti        int             `json:"num_coperti"`
+	CostoCoperto      Importo         `json:"costo_coperto"`
+	ImportoCoperto    Importo         `json:"importo_coperto"`
+	TotaleComplessivo Importo         `json:"totale_complessivo"`
+	IVA               []RiepilogoIVA  `json:"iva"`
+	TotaleImponibile  Importo         `json:"totale_imponibile"`
+	TotaleImposta     Importo         `json:"totale_imposta"`
+}
+
+// TotaleVoci restituisce il costo delle pietanze e dei menu al netto degli sconti e con il servizio
+func (s Scontrino) TotaleVoci() Importo {
+	return s.CostoTotale - s.ImportoSconti + s.ImportoServizio
 }
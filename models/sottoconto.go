@@ -0,0 +1,40 @@
+package models
+
+// Modalità di divisione del conto
+const (
+	DivisioneEqua    = "equal"
+	DivisionePerVoce = "per_voce"
+)
+
+// Sottoconto rappresenta una parte di un conto diviso, pagabile indipendentemente
+// Righe contiene gli ID dei dettagli ordine assegnati alla parte (vuoto nella divisione equa)
+// Subtotale è la quota del costo dell'ordine al netto degli sconti e comprensiva del servizio
+type Sottoconto struct {
+	ID             int     `json:"id,omitempty"`
+	IDOrdine       int     `json:"id_ordine"`
+	Nome           string  `json:"nome"`
+	NumPersone     int     `json:"num_persone"`
+	Righe          []int   `json:"righe,omitempty"`
+	MenuFissi      []int   `json:"menu_fissi,omitempty"`
+	Subtotale      Importo `json:"subtotale"`
+	ImportoCoperto Importo `json:"importo_coperto"`
+	Totale         Importo `json:"totale"`
+	Pagato         bool    `json:"pagato"`
+}
+
+// ScontrinoDiviso rappresenta uno scontrino suddiviso in più parti
+// La somma dei totali delle parti coincide sempre con il totale complessivo dello scontrino
+type ScontrinoDiviso struct {
+	Scontrino Scontrino    `json:"scontrino"`
+	Modalita  string       `json:"modalita"`
+	Parti     []Sottoconto `json:"parti"`
+}
+
+// RichiestaParte descrive come assegnare le voci di un ordine a una parte del conto:
+// le righe (ID dettaglio) delle pietanze alla carta e gli ID dei menu fissi ordinati
+type RichiestaParte struct {
+	Nome       string `json:"nome"`
+	NumPersone int    `json:"num_persone"`
+	Righe      []int  `json:"righe"`
+	MenuFissi  []int  `json:"menu_fissi"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Causali di spreco
+const (
+	CausaleScaduto     = "scaduto"
+	CausaleBruciato    = "bruciato"
+	CausaleCaduto      = "caduto"
+	CausaleResoCliente = "reso_cliente"
+)
+
+// CausaleSprecoValida verifica che la stringa sia una causale di spreco conosciuta
+func CausaleSprecoValida(causale string) bool {
+	switch causale {
+	case CausaleScaduto, CausaleBruciato, CausaleCaduto, CausaleResoCliente:
+		return true
+	}
+	return false
+}
+
+// Spreco rappresenta una quantità di ingrediente buttata, valorizzata al costo unitario del momento
+type Spreco struct {
+	ID            int           `json:"id"`
+	IDMovimento   int           `json:"id_movimento"`
+	IDIngrediente int           `json:"id_ingrediente"`
+	Causale       string        `json:"causale"`
+	Quantita      float64       `json:"quantita"`
+	CostoUnitario CostoUnitario `json:"costo_unitario"`
+	Valore        Importo       `json:"valore"`
+	Note          string        `json:"note,omitempty"`
+	DataSpreco    time.Time     `json:"data_spreco"`
+}
+
+// SprecoIngrediente riassume gli sprechi di un ingrediente nel periodo
+type SprecoIngrediente struct {
+	IDIngrediente int     `json:"id_ingrediente"`
+	Nome          string  `json:"nome"`
+	UnitaMisura   string  `json:"unita_misura"`
+	NumSprechi    int     `json:"num_sprechi"`
+	Quantita      float64 `json:"quantita"`
+	Valore        Importo `json:"valore"`
+}
+
+// SprecoCausale riassume gli sprechi per causale nel periodo
+type SprecoCausale struct {
+	Causale    string  `json:"causale"`
+	NumSprechi int     `json:"num_sprechi"`
+	Valore     Importo `json:"valore"`
+}
+
+// ReportSprechi riassume il valore degli sprechi nel periodo per ingrediente e per causale, dal più costoso
+type ReportSprechi struct {
+	Dal            string              `json:"dal"`
+	Al             string              `json:"al"`
+	NumSprechi     int                 `json:"num_sprechi"`
+	ValoreTotale   Importo             `json:"valore_totale"`
+	PerIngrediente []SprecoIngrediente `json:"per_ingrediente"`
+	PerCausale     []SprecoCausale     `json:"per_causale"`
+}
@@ -0,0 +1,70 @@
+package models
+
+import "fmt"
+
+// Stati possibili di un ordine
+const (
+	StatoInAttesa       = "in_attesa"
+	StatoConfermato     = "confermato"
+	StatoInPreparazione = "in_preparazione"
+	StatoPronto         = "pronto"
+	StatoConsegnato     = "consegnato"
+	StatoPagato         = "pagato"
+	StatoAnnullato      = "annullato"
+)
+
+// transizioniOrdine definisce la macchina a stati dell'ordine:
+// per ogni stato elenca gli stati successivi consentiti.
+// Un ordine può essere annullato solo finché non è pronto.
+var transizioniOrdine = map[string][]string{
+	StatoInAttesa:       {StatoConfermato, StatoAnnullato},
+	StatoConfermato:     {StatoInPreparazione, StatoAnnullato},
+	StatoInPreparazione: {StatoPronto, StatoAnnullato},
+	StatoPronto:         {StatoConsegnato},
+	StatoConsegnato:     {StatoPagato},
+	StatoPagato:         {},
+	StatoAnnullato:      {},
+}
+
+// StatoOrdineValido verifica che la stringa sia uno stato dell'ordine conosciuto
+func StatoOrdineValido(stato string) bool {
+	_, ok := transizioniOrdine[stato]
+	return ok
+}
+
+// TransizioniConsentite restituisce gli stati raggiungibili a partire dallo stato indicato
+func TransizioniConsentite(stato string) []string {
+	successivi := transizioniOrdine[stato]
+	risultato := make([]string, len(successivi))
+	copy(risultato, successivi)
+	return risultato
+}
+
+// TransizioneConsentita verifica se è possibile passare dallo stato "da" allo stato "a"
+func TransizioneConsentita(da, a string) bool {
+	for _, s := range transizioniOrdine[da] {
+		if s == a {
+			return true
+		}
+	}
+	return false
+}
+
+// PrimaDellaPreparazione indica se l'ordine non è ancora entrato in cucina: le sue righe
+// possono essere modificate e, se annullato, gli ingredienti tornano in magazzino
+func PrimaDellaPreparazione(stato string) bool {
+	return stato == StatoInAttesa || stato == StatoConfermato
+}
+
+// ErrTransizioneStato è l'errore restituito quando si tenta una transizione
+// di stato non prevista dalla macchina a stati dell'ordine
+type ErrTransizioneStato struct {
+	IDOrdine       int
+	StatoAttuale   string
+	StatoRichiesto string
+}
+
+func (e *ErrTransizioneStato) Error() string {
+	return fmt.Sprintf("transizione non consentita per l'ordine %d: da '%s' a '%s'",
+		e.IDOrdine, e.StatoAttuale, e.StatoRichiesto)
+}
@@ -0,0 +1,121 @@
+package models
+
+import (
+	"slices"
+	"testing"
+)
+
+var statiOrdine = []string{
+	StatoInAttesa,
+	StatoConfermato,
+	StatoInPreparazione,
+	StatoPronto,
+	StatoConsegnato,
+	StatoPagato,
+	StatoAnnullato,
+}
+
+func TestTransizioneConsentita(t *testing.T) {
+	// Archi consentiti della macchina a stati; tutte le altre coppie di stati sono vietate
+	consentite := map[[2]string]bool{
+		{StatoInAttesa, StatoConfermato}:       true,
+		{StatoInAttesa, StatoAnnullato}:        true,
+		{StatoConfermato, StatoInPreparazione}: true,
+		{StatoConfermato, StatoAnnullato}:      true,
+		{StatoInPreparazione, StatoPronto}:     true,
+		{StatoInPreparazione, StatoAnnullato}:  true,
+		{StatoPronto, StatoConsegnato}:         true,
+		{StatoConsegnato, StatoPagato}:         true,
+	}
+
+	for _, da := range statiOrdine {
+		for _, a := range statiOrdine {
+			atteso := consentite[[2]string{da, a}]
+			if got := TransizioneConsentita(da, a); got != atteso {
+				t.Errorf("TransizioneConsentita(%q, %q) = %v, atteso %v", da, a, got, atteso)
+			}
+		}
+	}
+
+	tests := []struct {
+		name  string
+		da, a string
+	}{
+		{"da stato sconosciuto", "sconosciuto", StatoConfermato},
+		{"verso stato sconosciuto", StatoInAttesa, "sconosciuto"},
+		{"da stato vuoto", "", StatoInAttesa},
+		{"maiuscole", "IN_ATTESA", StatoConfermato},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if TransizioneConsentita(tt.da, tt.a) {
+				t.Errorf("TransizioneConsentita(%q, %q) = true, atteso false", tt.da, tt.a)
+			}
+		})
+	}
+}
+
+func TestTransizioniConsentite(t *testing.T) {
+	tests := []struct {
+		stato  string
+		attese []string
+	}{
+		{StatoInAttesa, []string{StatoConfermato, StatoAnnullato}},
+		{StatoConfermato, []string{StatoInPreparazione, StatoAnnullato}},
+		{StatoInPreparazione, []string{StatoPronto, StatoAnnullato}},
+		{StatoPronto, []string{StatoConsegnato}},
+		{StatoConsegnato, []string{StatoPagato}},
+		{StatoPagato, []string{}},
+		{StatoAnnullato, []string{}},
+		{"sconosciuto", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.stato, func(t *testing.T) {
+			got := TransizioniConsentite(tt.stato)
+			if !slices.Equal(got, tt.attese) {
+				t.Errorf("TransizioniConsentite(%q) = %v, attese %v", tt.stato, got, tt.attese)
+			}
+		})
+	}
+
+	// Il risultato è una copia: modificarlo non cambia la macchina a stati
+	successivi := TransizioniConsentite(StatoInAttesa)
+	successivi[0] = StatoPagato
+	if TransizioneConsentita(StatoInAttesa, StatoPagato) {
+		t.Error("la modifica del risultato di TransizioniConsentite ha alterato la macchina a stati")
+	}
+}
+
+func TestStatoOrdineValido(t *testing.T) {
+	for _, stato := range statiOrdine {
+		if !StatoOrdineValido(stato) {
+			t.Errorf("StatoOrdineValido(%q) = false, atteso true", stato)
+		}
+	}
+	for _, stato := range []string{"", "sconosciuto", "Pagato", " pagato", "chiuso"} {
+		if StatoOrdineValido(stato) {
+			t.Errorf("StatoOrdineValido(%q) = true, atteso false", stato)
+		}
+	}
+}
+
+func TestPrimaDellaPreparazione(t *testing.T) {
+	tests := []struct {
+		stato  string
+		atteso bool
+	}{
+		{StatoInAttesa, true},
+		{StatoConfermato, true},
+		{StatoInPreparazione, false},
+		{StatoPronto, false},
+		{StatoConsegnato, false},
+		{StatoPagato, false},
+		{StatoAnnullato, false},
+		{"sconosciuto", false},
+	}
+	for _, tt := range tests {
+		if got := PrimaDellaPreparazione(tt.stato); got != tt.atteso {
+			t.Errorf("PrimaDellaPreparazione(%q) = %v, atteso %v", tt.stato, got, tt.atteso)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// CambioStatoOrdine rappresenta una transizione di stato registrata per un ordine
+type CambioStatoOrdine struct {
+	ID              int       `json:"id"`
+	IDOrdine        int       `json:"id_ordine"`
+	StatoPrecedente *string   `json:"stato_precedente"`
+	StatoNuovo      string    `json:"stato_nuovo"`
+	DataCambio      time.Time `json:"data_cambio"`
+	Attore          string    `json:"attore,omitempty"`
+}
+
+// DurateOrdine contiene le durate (in secondi) delle fasi principali di un ordine
+// Una durata è nulla se l'ordine non ha ancora attraversato la fase corrispondente
+type DurateOrdine struct {
+	TempoConferma *int64 `json:"tempo_conferma_secondi"`
+	TempoInCucina *int64 `json:"tempo_in_cucina_secondi"`
+	TempoServizio *int64 `json:"tempo_servizio_secondi"`
+	TempoTotale   *int64 `json:"tempo_totale_secondi"`
+}
+
+// StoricoOrdine rappresenta la cronologia completa degli stati di un ordine
+type StoricoOrdine struct {
+	IDOrdine     int                 `json:"id_ordine"`
+	DataOrdine   time.Time           `json:"data_ordine"`
+	StatoAttuale string              `json:"stato_attuale"`
+	Eventi       []CambioStatoOrdine `json:"eventi"`
+	Durate       DurateOrdine        `json:"durate"`
+}
+
+// CalcolaDurate calcola le durate delle fasi dell'ordine a partire dagli eventi registrati:
+// - tempo di conferma: dalla creazione alla conferma
+// - tempo in cucina: dall'inizio della preparazione a quando l'ordine è pronto
+// - tempo di servizio: da quando l'ordine è pronto alla consegna
+// - tempo totale: dalla creazione al pagamento
+func CalcolaDurate(dataOrdine time.Time, eventi []CambioStatoOrdine) DurateOrdine {
+	primoEvento := make(map[string]time.Time)
+	for _, e := range eventi {
+		if _, ok := primoEvento[e.StatoNuovo]; !ok {
+			primoEvento[e.StatoNuovo] = e.DataCambio
+		}
+	}
+
+	durata := func(inizio time.Time, statoFine string) *int64 {
+		fine, ok := primoEvento[statoFine]
+		if !ok || inizio.IsZero() {
+			return nil
+		}
+		secondi := int64(fine.Sub(inizio).Seconds())
+		return &secondi
+	}
+
+	return DurateOrdine{
+		TempoConferma: durata(dataOrdine, StatoConfermato),
+		TempoInCucina: durata(primoEvento[StatoInPreparazione], StatoPronto),
+		TempoServizio: durata(primoEvento[StatoPronto], StatoConsegnato),
+		TempoTotale:   durata(dataOrdine, StatoPagato),
+	}
+}
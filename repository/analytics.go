@@ -0,0 +1,331 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"ristorante-api/models"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// filtroOrdiniAnalisi seleziona gli ordini pagati nel periodo ($1, $2) e, se $3 è diverso da 0, del ristorante indicato
+const filtroOrdiniAnalisi = `o.stato = 'pagato'
+	AND o.data_ordine >= $1::date AND o.data_ordine < $2::date + 1
+	AND ($3::int = 0 OR o.id_ristorante = $3::int)`
+
+type AnalyticsRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewAnalyticsRepository(db *pgxpool.Pool) *AnalyticsRepository {
+	return &AnalyticsRepository{DB: db}
+}
+
+// TopPietanze restituisce le pietanze più vendute nel periodo, ordinate per quantità e per ricavo
+// Il ricavo è calcolato sulle vendite alla carta al prezzo registrato sulla riga dell'ordine al momento della vendita
+func (r *AnalyticsRepository) TopPietanze(ctx context.Context, filtro models.FiltroAnalisi, limite int) (*models.TopPietanze, error) {
+	if err := r.verificaRistorante(ctx, filtro.IDRistorante); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT p.id_pietanza, p.nome, COALESCE(c.nome, 'Senza categoria'),
+			SUM(d.quantita),
+			SUM(CASE WHEN d.parte_di_menu THEN d.quantita ELSE 0 END),
+			SUM(CASE WHEN d.parte_di_menu THEN 0 ELSE d.prezzo_unitario * d.quantita END)
+		FROM dettaglio_ordine_pietanza d
+		JOIN ordine o ON d.id_ordine = o.id_ordine
+		JOIN pietanza p ON d.id_pietanza = p.id_pietanza
+		LEFT JOIN categoria_pietanza c ON p.id_categoria = c.id_categoria
+		WHERE `+filtroOrdiniAnalisi+`
+		GROUP BY p.id_pietanza, p.nome, c.nome
+	`, filtro.Dal, filtro.Al, filtro.IDRistorante)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var vendite []models.VenditaPietanza
+	for rows.Next() {
+		var v models.VenditaPietanza
+		if err := rows.Scan(&v.IDPietanza, &v.Nome, &v.Categoria, &v.Quantita, &v.QuantitaInMenu, &v.Ricavo); err != nil {
+			return nil, err
+		}
+		vendite = append(vendite, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	top := &models.TopPietanze{Filtro: filtro}
+
+	sort.Slice(vendite, func(i, j int) bool {
+		if vendite[i].Quantita != vendite[j].Quantita {
+			return vendite[i].Quantita > vendite[j].Quantita
+		}
+		return vendite[i].Nome < vendite[j].Nome
+	})
+	top.PerQuantita = append([]models.VenditaPietanza{}, vendite[:min(limite, len(vendite))]...)
+
+	sort.Slice(vendite, func(i, j int) bool {
+		if vendite[i].Ricavo != vendite[j].Ricavo {
+			return vendite[i].Ricavo > vendite[j].Ricavo
+		}
+		return vendite[i].Nome < vendite[j].Nome
+	})
+	top.PerRicavo = append([]models.VenditaPietanza{}, vendite[:min(limite, len(vendite))]...)
+
+	return top, nil
+}
+
+// MappaVendite raggruppa gli ordini del periodo per giorno della settimana e ora del giorno
+// Il ricavo è il costo totale degli ordini, escluso coperto, sconti e servizio
+func (r *AnalyticsRepository) MappaVendite(ctx context.Context, filtro models.FiltroAnalisi) (*models.MappaVendite, error) {
+	if err := r.verificaRistorante(ctx, filtro.IDRistorante); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT EXTRACT(ISODOW FROM o.data_ordine)::int AS giorno, EXTRACT(HOUR FROM o.data_ordine)::int AS ora,
+			COUNT(*), SUM(o.num_persone), SUM(o.costo_totale)
+		FROM ordine o
+		WHERE `+filtroOrdiniAnalisi+`
+		GROUP BY giorno, ora
+		ORDER BY giorno, ora
+	`, filtro.Dal, filtro.Al, filtro.IDRistorante)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	mappa := &models.MappaVendite{
+		Filtro:    filtro,
+		PerOra:    []models.CellaVendite{},
+		PerGiorno: []models.CellaVendite{},
+		Celle:     []models.CellaVendite{},
+	}
+	perOra := make(map[int]*models.CellaVendite)
+	perGiorno := make(map[int]*models.CellaVendite)
+	for rows.Next() {
+		var cella models.CellaVendite
+		var ora int
+		if err := rows.Scan(&cella.GiornoSettimana, &ora, &cella.NumOrdini, &cella.NumCoperti, &cella.Ricavo); err != nil {
+			return nil, err
+		}
+		cella.Ora = &ora
+		mappa.Celle = append(mappa.Celle, cella)
+
+		totaleOra, ok := perOra[ora]
+		if !ok {
+			totaleOra = &models.CellaVendite{Ora: cella.Ora}
+			perOra[ora] = totaleOra
+		}
+		totaleGiorno, ok := perGiorno[cella.GiornoSettimana]
+		if !ok {
+			totaleGiorno = &models.CellaVendite{GiornoSettimana: cella.GiornoSettimana}
+			perGiorno[cella.GiornoSettimana] = totaleGiorno
+		}
+		for _, totale := range []*models.CellaVendite{totaleOra, totaleGiorno} {
+			totale.NumOrdini += cella.NumOrdini
+			totale.NumCoperti += cella.NumCoperti
+			totale.Ricavo += cella.Ricavo
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, totale := range perOra {
+		mappa.PerOra = append(mappa.PerOra, *totale)
+	}
+	sort.Slice(mappa.PerOra, func(i, j int) bool { return *mappa.PerOra[i].Ora < *mappa.PerOra[j].Ora })
+	for _, totale := range perGiorno {
+		mappa.PerGiorno = append(mappa.PerGiorno, *totale)
+	}
+	sort.Slice(mappa.PerGiorno, func(i, j int) bool {
+		return mappa.PerGiorno[i].GiornoSettimana < mappa.PerGiorno[j].GiornoSettimana
+	})
+
+	return mappa, nil
+}
+
+// AdesioneMenuFissi calcola quanti ordini del periodo includono menu fissi e quante volte è stato ordinato ciascun menu
+func (r *AnalyticsRepository) AdesioneMenuFissi(ctx context.Context, filtro models.FiltroAnalisi) (*models.AdesioneMenuFissi, error) {
+	if err := r.verificaRistorante(ctx, filtro.IDRistorante); err != nil {
+		return nil, err
+	}
+
+	adesione := &models.AdesioneMenuFissi{Filtro: filtro, Menu: []models.UtilizzoMenuFisso{}}
+
+	// 1. Ordini del periodo, con e senza menu fissi
+	err := r.DB.QueryRow(ctx, `
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE EXISTS (
+				SELECT 1 FROM dettaglio_ordine_pietanza d
+				WHERE d.id_ordine = o.id_ordine AND d.parte_di_menu = true AND d.id_menu IS NOT NULL
+			))
+		FROM ordine o
+		WHERE `+filtroOrdiniAnalisi,
+		filtro.Dal, filtro.Al, filtro.IDRistorante).Scan(&adesione.OrdiniTotali, &adesione.OrdiniConMenu)
+	if err != nil {
+		return nil, err
+	}
+	if adesione.OrdiniTotali > 0 {
+		adesione.Percentuale = arrotondaDecimo(float64(adesione.OrdiniConMenu) * 100 / float64(adesione.OrdiniTotali))
+	}
+
+	// 2. Menu ordinati (prezzo per numero di menu)
+	rows, err := r.DB.Query(ctx, `
+		SELECT m.id_menu, m.nome, SUM(menu_ordinati.quantita), COUNT(*), SUM(m.prezzo * menu_ordinati.quantita)
+		FROM (
+			SELECT id_ordine, id_menu, MAX(quantita) AS quantita
+			FROM (
+				SELECT d.id_ordine, d.id_menu, d.id_pietanza, SUM(d.quantita) AS quantita
+				FROM dettaglio_ordine_pietanza d
+				JOIN ordine o ON d.id_ordine = o.id_ordine
+				WHERE d.parte_di_menu = true AND d.id_menu IS NOT NULL AND `+filtroOrdiniAnalisi+`
+				GROUP BY d.id_ordine, d.id_menu, d.id_pietanza
+			) AS pietanze_menu
+			GROUP BY id_ordine, id_menu
+		) AS menu_ordinati
+		JOIN menu_fisso m ON menu_ordinati.id_menu = m.id_menu
+		GROUP BY m.id_menu, m.nome
+		ORDER BY SUM(menu_ordinati.quantita) DESC, m.nome
+	`, filtro.Dal, filtro.Al, filtro.IDRistorante)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u models.UtilizzoMenuFisso
+		if err := rows.Scan(&u.IDMenu, &u.Nome, &u.NumMenu, &u.NumOrdini, &u.Ricavo); err != nil {
+			return nil, err
+		}
+		adesione.Menu = append(adesione.Menu, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return adesione, nil
+}
+
+// CopertiPerTavolo calcola il numero medio di coperti degli ordini del periodo per capienza del tavolo
+func (r *AnalyticsRepository) CopertiPerTavolo(ctx context.Context, filtro models.FiltroAnalisi) (*models.AnalisiCoperti, error) {
+	if err := r.verificaRistorante(ctx, filtro.IDRistorante); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT t.max_posti, COUNT(*),
+			ROUND(AVG(o.num_persone), 2)::float8,
+			COALESCE(ROUND(AVG(o.num_persone) * 100 / NULLIF(t.max_posti, 0), 1), 0)::float8
+		FROM ordine o
+		JOIN tavolo t ON o.id_tavolo = t.id_tavolo
+		WHERE `+filtroOrdiniAnalisi+`
+		GROUP BY t.max_posti
+		ORDER BY t.max_posti
+	`, filtro.Dal, filtro.Al, filtro.IDRistorante)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	analisi := &models.AnalisiCoperti{Filtro: filtro, Tavoli: []models.CopertiPerTavolo{}}
+	for rows.Next() {
+		var c models.CopertiPerTavolo
+		if err := rows.Scan(&c.PostiTavolo, &c.NumOrdini, &c.MediaCoperti, &c.Occupazione); err != nil {
+			return nil, err
+		}
+		analisi.Tavoli = append(analisi.Tavoli, c)
+	}
+	return analisi, rows.Err()
+}
+
+// Andamento confronta gli indicatori del periodo con quelli del periodo immediatamente precedente di pari durata
+func (r *AnalyticsRepository) Andamento(ctx context.Context, filtro models.FiltroAnalisi) (*models.Andamento, error) {
+	if err := r.verificaRistorante(ctx, filtro.IDRistorante); err != nil {
+		return nil, err
+	}
+
+	dal, err := time.Parse("2006-01-02", filtro.Dal)
+	if err != nil {
+		return nil, err
+	}
+	al, err := time.Parse("2006-01-02", filtro.Al)
+	if err != nil {
+		return nil, err
+	}
+	giorni := int(al.Sub(dal).Hours()/24) + 1
+
+	andamento := &models.Andamento{IDRistorante: filtro.IDRistorante}
+	andamento.Corrente, err = r.indicatori(ctx, filtro)
+	if err != nil {
+		return nil, err
+	}
+	andamento.Precedente, err = r.indicatori(ctx, models.FiltroAnalisi{
+		Dal:          dal.AddDate(0, 0, -giorni).Format("2006-01-02"),
+		Al:           dal.AddDate(0, 0, -1).Format("2006-01-02"),
+		IDRistorante: filtro.IDRistorante,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	corrente, precedente := andamento.Corrente, andamento.Precedente
+	andamento.Variazioni = models.VariazioniPercentuali{
+		NumOrdini:      variazione(float64(corrente.NumOrdini), float64(precedente.NumOrdini)),
+		NumCoperti:     variazione(float64(corrente.NumCoperti), float64(precedente.NumCoperti)),
+		Ricavo:         variazione(float64(corrente.Ricavo), float64(precedente.Ricavo)),
+		ScontrinoMedio: variazione(float64(corrente.ScontrinoMedio), float64(precedente.ScontrinoMedio)),
+	}
+	return andamento, nil
+}
+
+// indicatori calcola numero di ordini, coperti, ricavo e scontrino medio degli ordini del periodo
+func (r *AnalyticsRepository) indicatori(ctx context.Context, filtro models.FiltroAnalisi) (models.IndicatoriPeriodo, error) {
+	indicatori := models.IndicatoriPeriodo{Dal: filtro.Dal, Al: filtro.Al}
+	err := r.DB.QueryRow(ctx, `
+		SELECT COUNT(*), COALESCE(SUM(o.num_persone), 0), COALESCE(SUM(o.costo_totale), 0)
+		FROM ordine o
+		WHERE `+filtroOrdiniAnalisi,
+		filtro.Dal, filtro.Al, filtro.IDRistorante).Scan(&indicatori.NumOrdini, &indicatori.NumCoperti, &indicatori.Ricavo)
+	if err != nil {
+		return indicatori, err
+	}
+	indicatori.ScontrinoMedio = indicatori.Ricavo.Diviso(indicatori.NumOrdini)
+	return indicatori, nil
+}
+
+// verificaRistorante controlla che il ristorante indicato esista (0 indica tutti i ristoranti)
+func (r *AnalyticsRepository) verificaRistorante(ctx context.Context, idRistorante int) error {
+	if idRistorante == 0 {
+		return nil
+	}
+	var esiste bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ristorante WHERE id_ristorante = $1)`, idRistorante).Scan(&esiste)
+	if err != nil {
+		return err
+	}
+	if !esiste {
+		return ErrRistoranteInesistente
+	}
+	return nil
+}
+
+// variazione restituisce la variazione percentuale (a un decimale) tra due valori, nil se il precedente è zero
+func variazione(corrente, precedente float64) *float64 {
+	if precedente == 0 {
+		return nil
+	}
+	v := arrotondaDecimo((corrente - precedente) * 100 / precedente)
+	return &v
+}
+
+// arrotondaDecimo arrotonda un valore al primo decimale
+func arrotondaDecimo(v float64) float64 {
+	return math.Round(v*10) / 10
+}
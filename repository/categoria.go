@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ristorante-api/models"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errori personalizzati
+var (
+	ErrCategoriaInesistente  = errors.New("categoria non trovata")
+	ErrCategoriaDuplicata    = errors.New("esiste già una categoria con questo nome")
+	ErrNomeCategoria         = errors.New("il nome della categoria è obbligatorio")
+	ErrCategoriaConPietanze  = errors.New("la categoria ha pietanze o sconti associati e non può essere eliminata")
+	ErrOrdineCategorieErrato = errors.New("il nuovo ordine deve elencare una sola volta tutte le categorie")
+)
+
+type CategoriaRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewCategoriaRepository(db *pgxpool.Pool) *CategoriaRepository {
+	return &CategoriaRepository{DB: db}
+}
+
+// GetAll restituisce tutte le categorie nell'ordine del menu
+func (r *CategoriaRepository) GetAll(ctx context.Context) ([]models.CategoriaPietanza, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id_categoria, nome, aliquota_iva, posizione
+		FROM categoria_pietanza
+		ORDER BY posizione, nome
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categorie := []models.CategoriaPietanza{}
+	for rows.Next() {
+		var c models.CategoriaPietanza
+		if err := rows.Scan(&c.ID, &c.Nome, &c.AliquotaIVA, &c.Posizione); err != nil {
+			return nil, err
+		}
+		categorie = append(categorie, c)
+	}
+	return categorie, rows.Err()
+}
+
+// GetByID restituisce una categoria
+func (r *CategoriaRepository) GetByID(ctx context.Context, id int) (*models.CategoriaPietanza, error) {
+	var c models.CategoriaPietanza
+	err := r.DB.QueryRow(ctx, `
+		SELECT id_categoria, nome, aliquota_iva, posizione
+		FROM categoria_pietanza
+		WHERE id_categoria = $1
+	`, id).Scan(&c.ID, &c.Nome, &c.AliquotaIVA, &c.Posizione)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrCategoriaInesistente
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Create aggiunge una categoria
+func (r *CategoriaRepository) Create(ctx context.Context, c *models.CategoriaPietanza) error {
+	if err := r.verificaNome(ctx, c.Nome, 0); err != nil {
+		return err
+	}
+	c.Nome = strings.TrimSpace(c.Nome)
+	return r.DB.QueryRow(ctx, `
+		INSERT INTO categoria_pietanza (nome, aliquota_iva, posizione)
+		VALUES ($1, $2, $3)
+		RETURNING id_categoria
+	`, c.Nome, c.AliquotaIVA, c.Posizione).Scan(&c.ID)
+}
+
+// Update aggiorna nome, aliquota IVA e posizione di una categoria
+func (r *CategoriaRepository) Update(ctx context.Context, c *models.CategoriaPietanza) error {
+	if err := r.verificaNome(ctx, c.Nome, c.ID); err != nil {
+		return err
+	}
+	c.Nome = strings.TrimSpace(c.Nome)
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE categoria_pietanza
+		SET nome = $1, aliquota_iva = $2, posizione = $3
+		WHERE id_categoria = $4
+	`, c.Nome, c.AliquotaIVA, c.Posizione, c.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCategoriaInesistente
+	}
+	return nil
+}
+
+// Delete elimina una categoria; non è possibile se ha pietanze o sconti, che verrebbero eliminati con lei
+func (r *CategoriaRepository) Delete(ctx context.Context, id int) error {
+	var inUso bool
+	err := r.DB.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM pietanza WHERE id_categoria = $1)
+		    OR EXISTS(SELECT 1 FROM sconto WHERE id_categoria = $1)
+	`, id).Scan(&inUso)
+	if err != nil {
+		return err
+	}
+	if inUso {
+		return ErrCategoriaConPietanze
+	}
+
+	tag, err := r.DB.Exec(ctx, `DELETE FROM categoria_pietanza WHERE id_categoria = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCategoriaInesistente
+	}
+	return nil
+}
+
+// Riordina assegna le posizioni nel menu secondo l'ordine degli ID, che devono comprendere tutte le categorie
+func (r *CategoriaRepository) Riordina(ctx context.Context, ids []int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Gli ID devono corrispondere, senza ripetizioni, alle categorie esistenti
+	var totale, indicate int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*), COUNT(*) FILTER (WHERE id_categoria = ANY($1))
+		FROM categoria_pietanza
+	`, ids).Scan(&totale, &indicate)
+	if err != nil {
+		return err
+	}
+	visti := make(map[int]bool)
+	for _, id := range ids {
+		visti[id] = true
+	}
+	if len(visti) != len(ids) || indicate != len(ids) || totale != len(ids) {
+		return ErrOrdineCategorieErrato
+	}
+
+	// 2. Posizioni a partire da 1
+	_, err = tx.Exec(ctx, `
+		UPDATE categoria_pietanza c
+		SET posizione = o.posizione
+		FROM unnest($1::int[]) WITH ORDINALITY AS o(id_categoria, posizione)
+		WHERE c.id_categoria = o.id_categoria
+	`, ids)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Menu restituisce le pietanze disponibili raggruppate per categoria, nell'ordine del menu
+// Le categorie senza pietanze disponibili non compaiono; quelle senza categoria sono in fondo.
+// Con idRistorante diverso da 0 include solo le pietanze del menu del ristorante, al suo prezzo
+func (r *CategoriaRepository) Menu(ctx context.Context, idRistorante int) ([]models.CategoriaMenu, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT c.id_categoria, COALESCE(c.nome, 'Senza categoria'), COALESCE(c.posizione, 0),
+		       p.id_pietanza, p.nome, COALESCE(m.prezzo, p.prezzo), p.id_categoria, p.aliquota_iva, p.disponibile, p.esaurita
+		FROM pietanza p
+		LEFT JOIN categoria_pietanza c ON p.id_categoria = c.id_categoria
+		LEFT JOIN menu m ON m.id_pietanza = p.id_pietanza AND m.id_ristorante = $1
+		WHERE p.disponibile AND ($1::int = 0 OR m.id_ristorante IS NOT NULL)
+		ORDER BY c.id_categoria IS NULL, c.posizione, c.nome, p.nome
+	`, idRistorante)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	menu := []models.CategoriaMenu{}
+	for rows.Next() {
+		var sezione models.CategoriaMenu
+		var p models.Pietanza
+		if err := rows.Scan(&sezione.IDCategoria, &sezione.Nome, &sezione.Posizione,
+			&p.ID, &p.Nome, &p.Prezzo, &p.IDCategoria, &p.AliquotaIVA, &p.Disponibile, &p.Esaurita); err != nil {
+			return nil, err
+		}
+		// Le righe arrivano ordinate per categoria: una nuova sezione a ogni cambio
+		if n := len(menu); n == 0 || !stessaCategoria(menu[n-1].IDCategoria, sezione.IDCategoria) {
+			sezione.Pietanze = []models.Pietanza{}
+			menu = append(menu, sezione)
+		}
+		menu[len(menu)-1].Pietanze = append(menu[len(menu)-1].Pietanze, p)
+	}
+	return menu, rows.Err()
+}
+
+// stessaCategoria confronta due categorie facoltative
+func stessaCategoria(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// verificaNome controlla che il nome sia presente e non usato da un'altra categoria
+func (r *CategoriaRepository) verificaNome(ctx context.Context, nome string, id int) error {
+	nome = strings.TrimSpace(nome)
+	if nome == "" {
+		return ErrNomeCategoria
+	}
+	var duplicato bool
+	err := r.DB.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM categoria_pietanza WHERE LOWER(nome) = LOWER($1) AND id_categoria <> $2)
+	`, nome, id).Scan(&duplicato)
+	if err != nil {
+		return err
+	}
+	if duplicato {
+		return ErrCategoriaDuplicata
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"context"
+	"ristorante-api/models"
+	"ristorante-api/unita"
+	"sort"
+)
+
+// Costo calcola il food cost di una porzione della pietanza a partire dalla sua ricetta
+// e il margine lordo rispetto al prezzo di vendita al netto dell'IVA
+func (r *PietanzaRepository) Costo(ctx context.Context, idPietanza int) (*models.CostoPietanza, error) {
+	costi, err := costiPietanze(ctx, r.DB, idPietanza)
+	if err != nil {
+		return nil, err
+	}
+	if len(costi) == 0 {
+		return nil, ErrPietanzaInesistente
+	}
+	return &costi[0], nil
+}
+
+// ReportMargini calcola il margine di tutte le pietanze, dal più basso, e segnala quelle
+// con margine percentuale inferiore a margineMinimo, con un costo incompleto o non calcolabili
+func (r *PietanzaRepository) ReportMargini(ctx context.Context, margineMinimo float64) (*models.ReportMargini, error) {
+	costi, err := costiPietanze(ctx, r.DB, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.ReportMargini{MargineMinimo: margineMinimo, Pietanze: []models.CostoPietanza{}}
+	for _, costo := range costi {
+		// Il dettaglio degli ingredienti si consulta con Costo
+		costo.Ingredienti = nil
+		costo.SottoSoglia = !costo.NonCalcolabile && costo.MarginePercentuale < margineMinimo
+		if costo.SottoSoglia {
+			report.NumSottoSoglia++
+		}
+		report.Pietanze = append(report.Pietanze, costo)
+	}
+	// Le pietanze non calcolabili, senza margine, vanno in fondo
+	sort.SliceStable(report.Pietanze, func(i, j int) bool {
+		a, b := report.Pietanze[i], report.Pietanze[j]
+		if a.NonCalcolabile != b.NonCalcolabile {
+			return b.NonCalcolabile
+		}
+		return a.MarginePercentuale < b.MarginePercentuale
+	})
+	return report, nil
+}
+
+// costiPietanze calcola il costo della pietanza indicata o, con idPietanza 0, di tutte le pietanze
+// Usa la versione attiva della ricetta; le quantità, riferite a una porzione, sono convertite nell'unità dell'ingrediente
+func costiPietanze(ctx context.Context, db dbtx, idPietanza int) ([]models.CostoPietanza, error) {
+	// 1. Pietanze con prezzo e aliquota IVA effettiva
+	rows, err := db.Query(ctx, `
+		SELECT p.id_pietanza, p.nome, p.prezzo, COALESCE(p.aliquota_iva, c.aliquota_iva, $2)
+		FROM pietanza p
+		LEFT JOIN categoria_pietanza c ON p.id_categoria = c.id_categoria
+		WHERE $1::int = 0 OR p.id_pietanza = $1::int
+		ORDER BY p.id_pietanza
+	`, idPietanza, models.AliquotaIVAPredefinita)
+	if err != nil {
+		return nil, err
+	}
+
+	var costi []models.CostoPietanza
+	indice := make(map[int]int)
+	for rows.Next() {
+		var c models.CostoPietanza
+		if err := rows.Scan(&c.IDPietanza, &c.Nome, &c.Prezzo, &c.AliquotaIVA); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		c.Ingredienti = []models.CostoIngrediente{}
+		indice[c.IDPietanza] = len(costi)
+		costi = append(costi, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 2. Ingredienti delle ricette attive con il costo unitario corrente
+	rows, err = db.Query(ctx, `
+		SELECT r.id_pietanza, i.id_ingrediente, i.nome, i.unita_misura, ri.quantita, i.costo_unitario,
+		       COALESCE(ri.unita_misura, i.unita_misura), i.peso_pezzo
+		FROM ricetta r
+		JOIN ricetta_ingrediente ri ON r.id_ricetta = ri.id_ricetta
+		JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
+		WHERE r.attiva AND ($1::int = 0 OR r.id_pietanza = $1::int)
+		ORDER BY r.id_pietanza, i.nome
+	`, idPietanza)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		var ci models.CostoIngrediente
+		var unitaRicetta string
+		var pesoPezzo float64
+		if err := rows.Scan(&id, &ci.IDIngrediente, &ci.Nome, &ci.UnitaMisura, &ci.Quantita, &ci.CostoUnitario,
+			&unitaRicetta, &pesoPezzo); err != nil {
+			return nil, err
+		}
+		i, ok := indice[id]
+		if !ok {
+			continue
+		}
+		// Il costo unitario è per unità di magazzino: la quantità della ricetta va convertita;
+		// se non si può convertire la pietanza non è calcolabile, ma il calcolo prosegue con le altre
+		quantita, err := unita.Converti(ci.Quantita, unitaRicetta, ci.UnitaMisura, pesoPezzo)
+		if err != nil {
+			costi[i].NonCalcolabile = true
+			continue
+		}
+		ci.Quantita = quantita
+		ci.Costo = models.CostoPerQuantita(ci.CostoUnitario, ci.Quantita)
+		costi[i].Ingredienti = append(costi[i].Ingredienti, ci)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 3. Food cost e margine
+	for i := range costi {
+		costi[i].CalcolaMargine()
+	}
+	return costi, nil
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+	"ristorante-api/unita"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// porzioniPreparabili calcola quante porzioni di ciascuna pietanza si possono preparare con le scorte attuali,
+// convertendo le quantità della ricetta attiva nell'unità del magazzino. Considera solo le pietanze indicate
+// (tutte se nil); quelle senza ricetta o senza ingredienti non compaiono perché le scorte non le limitano
+func porzioniPreparabili(ctx context.Context, db dbtx, idPietanze []int) (map[int]int, error) {
+	rows, err := db.Query(ctx, `
+		SELECT r.id_pietanza, ri.quantita, COALESCE(ri.unita_misura, i.unita_misura), i.unita_misura, i.peso_pezzo,
+		       i.quantita_disponibile
+		FROM ricetta r
+		JOIN ricetta_ingrediente ri ON r.id_ricetta = ri.id_ricetta
+		JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
+		WHERE r.attiva
+		  AND ($1::int[] IS NULL OR r.id_pietanza = ANY($1::int[]))
+	`, idPietanze)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	porzioni := make(map[int]int)
+	for rows.Next() {
+		var idPietanza int
+		var quantita, pesoPezzo, disponibile float64
+		var unitaRicetta, unitaScorta string
+		if err := rows.Scan(&idPietanza, &quantita, &unitaRicetta, &unitaScorta, &pesoPezzo, &disponibile); err != nil {
+			return nil, err
+		}
+		quantita, err := unita.Converti(quantita, unitaRicetta, unitaScorta, pesoPezzo)
+		if err != nil {
+			return nil, err
+		}
+		if quantita <= 0 {
+			continue
+		}
+		// La tolleranza evita che 0.3 / 0.1 = 2.999... diventi 2 porzioni
+		n := max(int(math.Floor(disponibile/quantita+1e-9)), 0)
+		if attuali, ok := porzioni[idPietanza]; !ok || n < attuali {
+			porzioni[idPietanza] = n
+		}
+	}
+	return porzioni, rows.Err()
+}
+
+// chiavePietanzeCambiate è la chiave del contesto in cui si raccolgono le pietanze di cui cambia la disponibilità
+type chiavePietanzeCambiate struct{}
+
+// RaccogliPietanzeCambiate restituisce un contesto in cui vengono annotate le pietanze di cui le operazioni
+// del repository cambiano la disponibilità, da passare dopo il commit a InvalidaCachePietanze
+func RaccogliPietanzeCambiate(ctx context.Context) (context.Context, *[]int) {
+	cambiate := &[]int{}
+	return context.WithValue(ctx, chiavePietanzeCambiate{}, cambiate), cambiate
+}
+
+// InvalidaCachePietanze rimuove dalla cache le pietanze indicate, l'elenco completo e i menu per categoria
+// dei ristoranti; va chiamata dopo il commit della transazione che ne ha cambiato la disponibilità
+func InvalidaCachePietanze(ctx context.Context, pietanzaCache *cache.PietanzaCache, idPietanze []int) {
+	if pietanzaCache == nil || len(idPietanze) == 0 {
+		return
+	}
+	for _, id := range idPietanze {
+		if err := pietanzaCache.InvalidateByID(ctx, id); err != nil {
+			// Log error but continue
+		}
+	}
+	if err := pietanzaCache.InvalidateAll(ctx); err != nil {
+		// Log error but continue
+	}
+}
+
+// aggiornaDisponibilitaIngrediente esaurisce o ripristina le pietanze che usano l'ingrediente,
+// dopo il movimento di magazzino indicato, e restituisce quelle di cui è cambiata la disponibilità
+func aggiornaDisponibilitaIngrediente(ctx context.Context, tx pgx.Tx, idIngrediente int, idMovimento int) ([]int, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT r.id_pietanza
+		FROM ricetta_ingrediente ri
+		JOIN ricetta r ON ri.id_ricetta = r.id_ricetta
+		WHERE ri.id_ingrediente = $1 AND r.attiva
+	`, idIngrediente)
+	if err != nil {
+		return nil, err
+	}
+	var pietanze []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pietanze = append(pietanze, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(pietanze) == 0 {
+		return nil, nil
+	}
+	return aggiornaDisponibilita(ctx, tx, pietanze, &idMovimento)
+}
+
+// aggiornaDisponibilita rende non disponibili (esaurite) le pietanze disponibili che non si possono più preparare
+// e di nuovo disponibili quelle esaurite automaticamente per cui le scorte bastano ancora, registrando l'evento.
+// Le pietanze rese non disponibili a mano non vengono toccate
+// Restituisce le pietanze di cui è cambiata la disponibilità e le annota nel contesto di RaccogliPietanzeCambiate
+func aggiornaDisponibilita(ctx context.Context, db dbtx, idPietanze []int, idMovimento *int) ([]int, error) {
+	porzioni, err := porzioniPreparabili(ctx, db, idPietanze)
+	if err != nil {
+		return nil, err
+	}
+
+	var esaurite, preparabili []int
+	for _, id := range idPietanze {
+		n, limitata := porzioni[id]
+		if limitata && n == 0 {
+			esaurite = append(esaurite, id)
+		} else {
+			preparabili = append(preparabili, id)
+		}
+	}
+
+	// 1. Pietanze disponibili rimaste senza porzioni
+	var cambiate []int
+	if len(esaurite) > 0 {
+		rows, err := db.Query(ctx, `
+			WITH cambiate AS (
+			  UPDATE pietanza SET disponibile = false, esaurita = true
+			  WHERE id_pietanza = ANY($1) AND disponibile
+			  RETURNING id_pietanza
+			), eventi AS (
+			  INSERT INTO evento_disponibilita (id_pietanza, tipo, porzioni, id_movimento)
+			  SELECT id_pietanza, $2, 0, $3 FROM cambiate
+			)
+			SELECT id_pietanza FROM cambiate
+		`, esaurite, models.EventoEsaurita, idMovimento)
+		if err != nil {
+			return nil, err
+		}
+		ids, err := pgx.CollectRows(rows, pgx.RowTo[int])
+		if err != nil {
+			return nil, err
+		}
+		cambiate = append(cambiate, ids...)
+	}
+
+	// 2. Pietanze esaurite che si possono di nuovo preparare
+	for _, id := range preparabili {
+		var ripristinata bool
+		err := db.QueryRow(ctx, `
+			WITH cambiate AS (
+			  UPDATE pietanza SET disponibile = true, esaurita = false
+			  WHERE id_pietanza = $1 AND esaurita
+			  RETURNING id_pietanza
+			), eventi AS (
+			  INSERT INTO evento_disponibilita (id_pietanza, tipo, porzioni, id_movimento)
+			  SELECT id_pietanza, $2, $3, $4 FROM cambiate
+			)
+			SELECT EXISTS(SELECT 1 FROM cambiate)
+		`, id, models.EventoRipristinata, porzioni[id], idMovimento).Scan(&ripristinata)
+		if err != nil {
+			return nil, err
+		}
+		if ripristinata {
+			cambiate = append(cambiate, id)
+		}
+	}
+
+	if raccolte, ok := ctx.Value(chiavePietanzeCambiate{}).(*[]int); ok {
+		*raccolte = append(*raccolte, cambiate...)
+	}
+	return cambiate, nil
+}
+
+// GetAllConPorzioni restituisce tutte le pietanze con il numero di porzioni preparabili con le scorte attuali
+func (r *PietanzaRepository) GetAllConPorzioni(ctx context.Context) ([]models.Pietanza, error) {
+	pietanze, err := r.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	porzioni, err := porzioniPreparabili(ctx, r.DB, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pietanze {
+		if n, ok := porzioni[pietanze[i].ID]; ok {
+			pietanze[i].Porzioni = &n
+		}
+	}
+	return pietanze, nil
+}
+
+// EventiDisponibilita restituisce i cambi automatici di disponibilità delle pietanze, dal più recente,
+// nel periodo indicato (date AAAA-MM-GG, estremi inclusi; vuote per non filtrare)
+func (r *PietanzaRepository) EventiDisponibilita(ctx context.Context, dal, al string) ([]models.EventoDisponibilita, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT e.id_evento, e.id_pietanza, p.nome, e.tipo, e.porzioni, e.id_movimento, e.data_evento
+		FROM evento_disponibilita e
+		JOIN pietanza p ON e.id_pietanza = p.id_pietanza
+		WHERE ($1::text = '' OR e.data_evento >= NULLIF($1::text, '')::date)
+		  AND ($2::text = '' OR e.data_evento < NULLIF($2::text, '')::date + 1)
+		ORDER BY e.data_evento DESC, e.id_evento DESC
+	`, dal, al)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventi := []models.EventoDisponibilita{}
+	for rows.Next() {
+		var e models.EventoDisponibilita
+		if err := rows.Scan(&e.ID, &e.IDPietanza, &e.Nome, &e.Tipo, &e.Porzioni, &e.IDMovimento, &e.DataEvento); err != nil {
+			return nil, err
+		}
+		eventi = append(eventi, e)
+	}
+	return eventi, rows.Err()
+}
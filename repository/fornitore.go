@@ -0,0 +1,206 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ristorante-api/models"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errori personalizzati
+var (
+	ErrFornitoreInesistente  = errors.New("fornitore non trovato")
+	ErrFornitoreDuplicato    = errors.New("esiste già un fornitore con questo nome")
+	ErrNomeFornitore         = errors.New("il nome del fornitore è obbligatorio")
+	ErrFornitoreConOrdini    = errors.New("il fornitore ha ordini di acquisto e non può essere eliminato")
+	ErrCondizioniNonValide   = errors.New("prezzo, giorni di consegna e ordine minimo non possono essere negativi")
+	ErrIngredienteNonFornito = errors.New("l'ingrediente non è nel listino del fornitore")
+)
+
+type FornitoreRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewFornitoreRepository(db *pgxpool.Pool) *FornitoreRepository {
+	return &FornitoreRepository{DB: db}
+}
+
+// GetAll restituisce tutti i fornitori, senza listino
+func (r *FornitoreRepository) GetAll(ctx context.Context) ([]models.Fornitore, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id_fornitore, nome, COALESCE(email, ''), COALESCE(telefono, ''), COALESCE(note, '')
+		FROM fornitore
+		ORDER BY nome
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	fornitori := []models.Fornitore{}
+	for rows.Next() {
+		var f models.Fornitore
+		if err := rows.Scan(&f.ID, &f.Nome, &f.Email, &f.Telefono, &f.Note); err != nil {
+			return nil, err
+		}
+		fornitori = append(fornitori, f)
+	}
+	return fornitori, rows.Err()
+}
+
+// GetByID restituisce un fornitore con il listino degli ingredienti
+func (r *FornitoreRepository) GetByID(ctx context.Context, id int) (*models.Fornitore, error) {
+	var f models.Fornitore
+	err := r.DB.QueryRow(ctx, `
+		SELECT id_fornitore, nome, COALESCE(email, ''), COALESCE(telefono, ''), COALESCE(note, '')
+		FROM fornitore
+		WHERE id_fornitore = $1
+	`, id).Scan(&f.ID, &f.Nome, &f.Email, &f.Telefono, &f.Note)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrFornitoreInesistente
+		}
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT fi.id_fornitore, fi.id_ingrediente, i.nome, i.unita_misura, fi.prezzo, fi.giorni_consegna, fi.ordine_minimo
+		FROM fornitore_ingrediente fi
+		JOIN ingrediente i ON fi.id_ingrediente = i.id_ingrediente
+		WHERE fi.id_fornitore = $1
+		ORDER BY i.nome
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	f.Ingredienti = []models.FornitoreIngrediente{}
+	for rows.Next() {
+		var fi models.FornitoreIngrediente
+		if err := rows.Scan(&fi.IDFornitore, &fi.IDIngrediente, &fi.Nome, &fi.UnitaMisura,
+			&fi.Prezzo, &fi.GiorniConsegna, &fi.OrdineMinimo); err != nil {
+			return nil, err
+		}
+		f.Ingredienti = append(f.Ingredienti, fi)
+	}
+	return &f, rows.Err()
+}
+
+// Create aggiunge un nuovo fornitore
+func (r *FornitoreRepository) Create(ctx context.Context, f *models.Fornitore) error {
+	if err := r.verificaNome(ctx, f.Nome, 0); err != nil {
+		return err
+	}
+	return r.DB.QueryRow(ctx, `
+		INSERT INTO fornitore (nome, email, telefono, note)
+		VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NULLIF($4, ''))
+		RETURNING id_fornitore
+	`, strings.TrimSpace(f.Nome), f.Email, f.Telefono, f.Note).Scan(&f.ID)
+}
+
+// Update aggiorna i dati anagrafici di un fornitore
+func (r *FornitoreRepository) Update(ctx context.Context, f *models.Fornitore) error {
+	if err := r.verificaNome(ctx, f.Nome, f.ID); err != nil {
+		return err
+	}
+	tag, err := r.DB.Exec(ctx, `
+		UPDATE fornitore
+		SET nome = $1, email = NULLIF($2, ''), telefono = NULLIF($3, ''), note = NULLIF($4, '')
+		WHERE id_fornitore = $5
+	`, strings.TrimSpace(f.Nome), f.Email, f.Telefono, f.Note, f.ID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFornitoreInesistente
+	}
+	return nil
+}
+
+// Delete elimina un fornitore e il suo listino; non è possibile se ha ordini di acquisto
+func (r *FornitoreRepository) Delete(ctx context.Context, id int) error {
+	var conOrdini bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ordine_acquisto WHERE id_fornitore = $1)`, id).Scan(&conOrdini)
+	if err != nil {
+		return err
+	}
+	if conOrdini {
+		return ErrFornitoreConOrdini
+	}
+
+	tag, err := r.DB.Exec(ctx, `DELETE FROM fornitore WHERE id_fornitore = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrFornitoreInesistente
+	}
+	return nil
+}
+
+// ImpostaIngrediente aggiunge un ingrediente al listino del fornitore o ne aggiorna le condizioni
+func (r *FornitoreRepository) ImpostaIngrediente(ctx context.Context, fi *models.FornitoreIngrediente) error {
+	if fi.Prezzo < 0 || fi.GiorniConsegna < 0 || fi.OrdineMinimo < 0 {
+		return ErrCondizioniNonValide
+	}
+
+	var fornitoreEsiste, ingredienteEsiste bool
+	err := r.DB.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM fornitore WHERE id_fornitore = $1),
+		       EXISTS(SELECT 1 FROM ingrediente WHERE id_ingrediente = $2)
+	`, fi.IDFornitore, fi.IDIngrediente).Scan(&fornitoreEsiste, &ingredienteEsiste)
+	if err != nil {
+		return err
+	}
+	if !fornitoreEsiste {
+		return ErrFornitoreInesistente
+	}
+	if !ingredienteEsiste {
+		return ErrIngredienteInesistente
+	}
+
+	_, err = r.DB.Exec(ctx, `
+		INSERT INTO fornitore_ingrediente (id_fornitore, id_ingrediente, prezzo, giorni_consegna, ordine_minimo)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id_fornitore, id_ingrediente)
+		DO UPDATE SET prezzo = EXCLUDED.prezzo, giorni_consegna = EXCLUDED.giorni_consegna, ordine_minimo = EXCLUDED.ordine_minimo
+	`, fi.IDFornitore, fi.IDIngrediente, fi.Prezzo, fi.GiorniConsegna, fi.OrdineMinimo)
+	return err
+}
+
+// RimuoviIngrediente toglie un ingrediente dal listino del fornitore
+func (r *FornitoreRepository) RimuoviIngrediente(ctx context.Context, idFornitore int, idIngrediente int) error {
+	tag, err := r.DB.Exec(ctx, `
+		DELETE FROM fornitore_ingrediente WHERE id_fornitore = $1 AND id_ingrediente = $2
+	`, idFornitore, idIngrediente)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrIngredienteNonFornito
+	}
+	return nil
+}
+
+// verificaNome controlla che il nome sia presente e non usato da un altro fornitore
+func (r *FornitoreRepository) verificaNome(ctx context.Context, nome string, id int) error {
+	nome = strings.TrimSpace(nome)
+	if nome == "" {
+		return ErrNomeFornitore
+	}
+	var duplicato bool
+	err := r.DB.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM fornitore WHERE LOWER(nome) = LOWER($1) AND id_fornitore <> $2)
+	`, nome, id).Scan(&duplicato)
+	if err != nil {
+		return err
+	}
+	if duplicato {
+		return ErrFornitoreDuplicato
+	}
+	return nil
+}
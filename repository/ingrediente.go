@@ -10,11 +10,28 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"ristorante-api/models"
+	"ristorante-api/unita"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Errori personalizzati
+var (
+	ErrIngredienteInesistente = errors.New("ingrediente non trovato")
+	ErrCostoNonValido         = errors.New("il costo unitario non può essere negativo")
+	ErrDataScadenzaNonValida  = errors.New("data di scadenza del lotto non valida (formato AAAA-MM-GG)")
+	ErrPesoPezzoNonValido     = errors.New("il peso per pezzo non può essere negativo e si indica solo per gli ingredienti a pezzi")
+	ErrAllergeneNonValido     = errors.New("allergene non valido")
+	ErrUnitaInUso             = errors.New("l'unità di misura non può cambiare: l'ingrediente ha scorte, lotti, un costo, listini o ordini d'acquisto aperti oppure è usato nelle ricette")
+)
+
 type IngredienteRepository struct {
 	DB *pgxpool.Pool
 }
@@ -26,7 +43,8 @@ func NewIngredienteRepository(db *pgxpool.Pool) *IngredienteRepository {
 // GetAll restituisce tutti gli ingredienti disponibili
 func (r *IngredienteRepository) GetAll(ctx context.Context) ([]models.Ingrediente, error) {
 	rows, err := r.DB.Query(ctx, `
-		SELECT id_ingrediente, nome, quantita_disponibile, unita_misura, soglia_riordino
+		SELECT id_ingrediente, nome, quantita_disponibile, unita_misura, soglia_riordino, costo_unitario, peso_pezzo,
+		       allergeni, vegetariano, vegano
 		FROM ingrediente
 	`)
 	if err != nil {
@@ -37,7 +55,8 @@ func (r *IngredienteRepository) GetAll(ctx context.Context) ([]models.Ingredient
 	var ingredienti []models.Ingrediente
 	for rows.Next() {
 		var i models.Ingrediente
-		err := rows.Scan(&i.ID, &i.Nome, &i.QuantitaDisponibile, &i.UnitaMisura, &i.SogliaRiordino)
+		err := rows.Scan(&i.ID, &i.Nome, &i.QuantitaDisponibile, &i.UnitaMisura, &i.SogliaRiordino, &i.CostoUnitario, &i.PesoPezzo,
+			&i.Allergeni, &i.Vegetariano, &i.Vegano)
 		if err != nil {
 			return nil, err
 		}
@@ -55,10 +74,12 @@ func (r *IngredienteRepository) GetAll(ctx context.Context) ([]models.Ingredient
 func (r *IngredienteRepository) GetByID(ctx context.Context, id int) (*models.Ingrediente, error) {
 	var i models.Ingrediente
 	err := r.DB.QueryRow(ctx, `
-		SELECT id_ingrediente, nome, quantita_disponibile, unita_misura, soglia_riordino
+		SELECT id_ingrediente, nome, quantita_disponibile, unita_misura, soglia_riordino, costo_unitario, peso_pezzo,
+		       allergeni, vegetariano, vegano
 		FROM ingrediente
 		WHERE id_ingrediente = $1
-	`, id).Scan(&i.ID, &i.Nome, &i.QuantitaDisponibile, &i.UnitaMisura, &i.SogliaRiordino)
+	`, id).Scan(&i.ID, &i.Nome, &i.QuantitaDisponibile, &i.UnitaMisura, &i.SogliaRiordino, &i.CostoUnitario, &i.PesoPezzo,
+		&i.Allergeni, &i.Vegetariano, &i.Vegano)
 
 	if err != nil {
 		return nil, err
@@ -67,23 +88,231 @@ func (r *IngredienteRepository) GetByID(ctx context.Context, id int) (*models.In
 	return &i, nil
 }
 
-// Create aggiunge un nuovo ingrediente al magazzino
+// Create aggiunge un nuovo ingrediente al magazzino e ne registra il costo iniziale nello storico
+// La quantità iniziale è registrata come carico di magazzino
 func (r *IngredienteRepository) Create(ctx context.Context, i *models.Ingrediente) error {
-	return r.DB.QueryRow(ctx, `
-		INSERT INTO ingrediente (nome, quantita_disponibile, unita_misura, soglia_riordino)
-		VALUES ($1, $2, $3, $4)
+	if i.CostoUnitario < 0 {
+		return ErrCostoNonValido
+	}
+	if err := validaUnita(i); err != nil {
+		return err
+	}
+	if err := validaAllergeni(i); err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO ingrediente (nome, quantita_disponibile, unita_misura, soglia_riordino, costo_unitario, peso_pezzo,
+		                         allergeni, vegetariano, vegano)
+		VALUES ($1, 0, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id_ingrediente
-	`, i.Nome, i.QuantitaDisponibile, i.UnitaMisura, i.SogliaRiordino).Scan(&i.ID)
+	`, i.Nome, i.UnitaMisura, i.SogliaRiordino, i.CostoUnitario, i.PesoPezzo, i.Allergeni, i.Vegetariano, i.Vegano).Scan(&i.ID)
+	if err != nil {
+		return err
+	}
+
+	if i.QuantitaDisponibile > 0 {
+		if _, err := rifornisci(ctx, tx, i.ID, i.QuantitaDisponibile, "giacenza iniziale", models.DatiLotto{}); err != nil {
+			return err
+		}
+	}
+
+	if _, err := registraCosto(ctx, tx, i.ID, i.CostoUnitario); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 // Update aggiorna un ingrediente esistente
+// Una quantità disponibile diversa da quella in magazzino è registrata come rettifica;
+// il costo unitario non viene modificato: si aggiorna con AggiornaCosto, che ne conserva lo storico.
+// L'unità di misura deve restare convertibile con quelle usate per l'ingrediente nelle ricette
 func (r *IngredienteRepository) Update(ctx context.Context, i *models.Ingrediente) error {
-	_, err := r.DB.Exec(ctx, `
+	if err := validaUnita(i); err != nil {
+		return err
+	}
+	if err := validaAllergeni(i); err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := verificaCambioUnita(ctx, tx, i); err != nil {
+		return err
+	}
+
+	var quantitaAttuale float64
+	err = tx.QueryRow(ctx, `
 		UPDATE ingrediente
-		SET nome = $1, quantita_disponibile = $2, unita_misura = $3, soglia_riordino = $4
-		WHERE id_ingrediente = $5
-	`, i.Nome, i.QuantitaDisponibile, i.UnitaMisura, i.SogliaRiordino, i.ID)
-	return err
+		SET nome = $1, unita_misura = $2, soglia_riordino = $3, peso_pezzo = $4,
+		    allergeni = $5, vegetariano = $6, vegano = $7
+		WHERE id_ingrediente = $8
+		RETURNING quantita_disponibile
+	`, i.Nome, i.UnitaMisura, i.SogliaRiordino, i.PesoPezzo, i.Allergeni, i.Vegetariano, i.Vegano, i.ID).Scan(&quantitaAttuale)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrIngredienteInesistente
+		}
+		return err
+	}
+
+	if err := verificaUnitaRicette(ctx, tx, i); err != nil {
+		return err
+	}
+
+	// Prima di rettificare al ribasso registra come spreco i lotti scaduti, che non sono più in magazzino
+	if i.QuantitaDisponibile < quantitaAttuale {
+		if err := smaltisciLottiScaduti(ctx, tx, i.ID, nil); err != nil {
+			return err
+		}
+		err := tx.QueryRow(ctx, `
+			SELECT quantita_disponibile FROM ingrediente WHERE id_ingrediente = $1
+		`, i.ID).Scan(&quantitaAttuale)
+		if err != nil {
+			return err
+		}
+	}
+	if i.QuantitaDisponibile != quantitaAttuale {
+		err := movimentaScorta(ctx, tx, &models.MovimentoMagazzino{
+			IDIngrediente: i.ID,
+			Tipo:          models.MovimentoRettifica,
+			Quantita:      i.QuantitaDisponibile - quantitaAttuale,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// verificaCambioUnita blocca l'ingrediente e, se l'unità di misura cambia, verifica che non ci sia
+// nulla espresso nell'unità attuale: scorte, lotti, costo unitario, listini dei fornitori,
+// ordini d'acquisto aperti e ricette. Altrimenti restituisce ErrUnitaInUso
+func verificaCambioUnita(ctx context.Context, tx pgx.Tx, i *models.Ingrediente) error {
+	var attuale string
+	err := tx.QueryRow(ctx, `
+		SELECT unita_misura FROM ingrediente WHERE id_ingrediente = $1 FOR UPDATE
+	`, i.ID).Scan(&attuale)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrIngredienteInesistente
+		}
+		return err
+	}
+
+	// Nomi diversi della stessa unità (es. "g" e "grammi") non sono un cambio
+	prima, errPrima := unita.Cerca(attuale)
+	dopo, errDopo := unita.Cerca(i.UnitaMisura)
+	if errPrima == nil && errDopo == nil && prima == dopo {
+		return nil
+	}
+
+	var inUso bool
+	err = tx.QueryRow(ctx, `
+		SELECT i.quantita_disponibile <> 0 OR i.costo_unitario <> 0
+		    OR EXISTS(SELECT 1 FROM lotto WHERE id_ingrediente = i.id_ingrediente AND quantita_residua > 0)
+		    OR EXISTS(SELECT 1 FROM ricetta_ingrediente WHERE id_ingrediente = i.id_ingrediente)
+		    OR EXISTS(SELECT 1 FROM fornitore_ingrediente WHERE id_ingrediente = i.id_ingrediente)
+		    OR EXISTS(
+				SELECT 1 FROM ordine_acquisto_riga r
+				JOIN ordine_acquisto o ON r.id_ordine_acquisto = o.id_ordine_acquisto
+				WHERE r.id_ingrediente = i.id_ingrediente AND o.stato <> 'ricevuto'
+			)
+		FROM ingrediente i
+		WHERE i.id_ingrediente = $1
+	`, i.ID).Scan(&inUso)
+	if err != nil {
+		return err
+	}
+	if inUso {
+		return ErrUnitaInUso
+	}
+	return nil
+}
+
+// validaUnita verifica che l'unità di misura dell'ingrediente sia conosciuta e che il peso per pezzo
+// sia indicato solo per le unità a conteggio
+func validaUnita(i *models.Ingrediente) error {
+	u, err := unita.Cerca(i.UnitaMisura)
+	if err != nil {
+		return err
+	}
+	if i.PesoPezzo < 0 || (i.PesoPezzo > 0 && !u.AConteggio()) {
+		return ErrPesoPezzoNonValido
+	}
+	return nil
+}
+
+// validaAllergeni controlla che gli allergeni dell'ingrediente siano tra i 14 da dichiarare
+// e li riporta nell'ordine del regolamento, senza ripetizioni; nil (non dichiarati) resta nil.
+// Un ingrediente vegano è anche vegetariano
+func validaAllergeni(i *models.Ingrediente) error {
+	if i.Vegano {
+		i.Vegetariano = true
+	}
+	if i.Allergeni == nil {
+		return nil
+	}
+	for k, a := range i.Allergeni {
+		a = strings.ToLower(strings.TrimSpace(a))
+		if !models.AllergeneValido(a) {
+			return fmt.Errorf("%w: %q", ErrAllergeneNonValido, a)
+		}
+		i.Allergeni[k] = a
+	}
+	allergeni := []string{}
+	for _, a := range models.Allergeni {
+		if slices.Contains(i.Allergeni, a) {
+			allergeni = append(allergeni, a)
+		}
+	}
+	i.Allergeni = allergeni
+	return nil
+}
+
+// verificaUnitaRicette controlla che le quantità delle ricette espresse in un'altra unità
+// si possano ancora convertire nell'unità di misura dell'ingrediente
+func verificaUnitaRicette(ctx context.Context, tx pgx.Tx, i *models.Ingrediente) error {
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT unita_misura
+		FROM ricetta_ingrediente
+		WHERE id_ingrediente = $1 AND unita_misura IS NOT NULL
+	`, i.ID)
+	if err != nil {
+		return err
+	}
+	var usate []string
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			rows.Close()
+			return err
+		}
+		usate = append(usate, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, u := range usate {
+		if err := unita.Convertibili(u, i.UnitaMisura, i.PesoPezzo); err != nil {
+			return fmt.Errorf("%w (usata nelle ricette per %s)", err, i.Nome)
+		}
+	}
+	return nil
 }
 
 // Delete elimina un ingrediente per ID
@@ -101,7 +330,8 @@ func (r *IngredienteRepository) Delete(ctx context.Context, id int) error {
 // IngredientiDaRiordinare restituisce gli ingredienti sotto la soglia di riordino
 func (r *IngredienteRepository) IngredientiDaRiordinare(ctx context.Context) ([]models.Ingrediente, error) {
 	rows, err := r.DB.Query(ctx, `
-		SELECT id_ingrediente, nome, quantita_disponibile, unita_misura, soglia_riordino
+		SELECT id_ingrediente, nome, quantita_disponibile, unita_misura, soglia_riordino, costo_unitario, peso_pezzo,
+		       allergeni, vegetariano, vegano
 		FROM ingrediente
 		WHERE quantita_disponibile < soglia_riordino
 	`)
@@ -113,7 +343,8 @@ func (r *IngredienteRepository) IngredientiDaRiordinare(ctx context.Context) ([]
 	var ingredienti []models.Ingrediente
 	for rows.Next() {
 		var i models.Ingrediente
-		err := rows.Scan(&i.ID, &i.Nome, &i.QuantitaDisponibile, &i.UnitaMisura, &i.SogliaRiordino)
+		err := rows.Scan(&i.ID, &i.Nome, &i.QuantitaDisponibile, &i.UnitaMisura, &i.SogliaRiordino, &i.CostoUnitario, &i.PesoPezzo,
+			&i.Allergeni, &i.Vegetariano, &i.Vegano)
 		if err != nil {
 			return nil, err
 		}
@@ -127,28 +358,148 @@ func (r *IngredienteRepository) IngredientiDaRiordinare(ctx context.Context) ([]
 	return ingredienti, nil
 }
 
-// Prenota un ingrediente di una certa quantità
+// Prenota un ingrediente di una certa quantità, registrandone lo scarico
+// Se la quantità disponibile non basta restituisce un *ErrIngredientiMancanti
 func (r *IngredienteRepository) Prenota(ctx context.Context, id int, quantita float64) error {
-	_, err := r.DB.Exec(ctx, `
-		UPDATE ingrediente
-		SET quantita_disponibile = quantita_disponibile - $1
-		WHERE id_ingrediente = $2 AND quantita_disponibile >= $1
-	`, quantita, id)
+	if quantita <= 0 {
+		return ErrQuantitaMovimentoNonValida
+	}
+
+	tx, err := r.DB.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer tx.Rollback(ctx)
+
+	if err := scalaIngredienti(ctx, tx, 0, map[int]float64{id: quantita}); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// Rifornisci un ingrediente con una certa quantità
-func (r *IngredienteRepository) Rifornisci(ctx context.Context, id int, quantita float64) error {
-	_, err := r.DB.Exec(ctx, `
-		UPDATE ingrediente
-		SET quantita_disponibile = quantita_disponibile + $1
-		WHERE id_ingrediente = $2
-	`, quantita, id)
+// Rifornisci un ingrediente con una certa quantità, registrandone il carico in un nuovo lotto
+func (r *IngredienteRepository) Rifornisci(ctx context.Context, id int, quantita float64, lotto models.DatiLotto) (*models.MovimentoMagazzino, error) {
+	if quantita <= 0 {
+		return nil, ErrQuantitaMovimentoNonValida
+	}
+
+	tx, err := r.DB.Begin(ctx)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	return nil
+	defer tx.Rollback(ctx)
+
+	movimento, err := rifornisci(ctx, tx, id, quantita, "", lotto)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return movimento, nil
+}
+
+// rifornisci carica in magazzino una quantità di ingrediente come nuovo lotto, all'interno della transazione fornita
+func rifornisci(ctx context.Context, tx pgx.Tx, id int, quantita float64, note string, lotto models.DatiLotto) (*models.MovimentoMagazzino, error) {
+	if quantita <= 0 {
+		return nil, ErrQuantitaMovimentoNonValida
+	}
+	if lotto.DataScadenza != "" {
+		if _, err := time.Parse("2006-01-02", lotto.DataScadenza); err != nil {
+			return nil, ErrDataScadenzaNonValida
+		}
+	}
+	movimento := &models.MovimentoMagazzino{
+		IDIngrediente: id,
+		Tipo:          models.MovimentoCarico,
+		Quantita:      quantita,
+		Note:          note,
+	}
+	if err := movimentaScorta(ctx, tx, movimento); err != nil {
+		return nil, err
+	}
+	if err := creaLotto(ctx, tx, movimento, lotto); err != nil {
+		return nil, err
+	}
+	return movimento, nil
+}
+
+// AggiornaCosto imposta il nuovo costo unitario di un ingrediente e lo registra nello storico dei costi
+func (r *IngredienteRepository) AggiornaCosto(ctx context.Context, id int, costo models.CostoUnitario) (*models.StoricoCostoIngrediente, error) {
+	if costo < 0 {
+		return nil, ErrCostoNonValido
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE ingrediente SET costo_unitario = $1 WHERE id_ingrediente = $2
+	`, costo, id)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrIngredienteInesistente
+	}
+
+	storico, err := registraCosto(ctx, tx, id, costo)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return storico, nil
+}
+
+// StoricoCosti restituisce i costi unitari di un ingrediente, dal più recente
+func (r *IngredienteRepository) StoricoCosti(ctx context.Context, id int) ([]models.StoricoCostoIngrediente, error) {
+	var esiste bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ingrediente WHERE id_ingrediente = $1)`, id).Scan(&esiste)
+	if err != nil {
+		return nil, err
+	}
+	if !esiste {
+		return nil, ErrIngredienteInesistente
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT id_storico, id_ingrediente, costo_unitario, data_inizio
+		FROM storico_costo_ingrediente
+		WHERE id_ingrediente = $1
+		ORDER BY data_inizio DESC, id_storico DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	storico := []models.StoricoCostoIngrediente{}
+	for rows.Next() {
+		var s models.StoricoCostoIngrediente
+		if err := rows.Scan(&s.ID, &s.IDIngrediente, &s.CostoUnitario, &s.DataInizio); err != nil {
+			return nil, err
+		}
+		storico = append(storico, s)
+	}
+	return storico, rows.Err()
+}
+
+// registraCosto aggiunge allo storico il costo unitario in vigore da ora per l'ingrediente
+func registraCosto(ctx context.Context, tx pgx.Tx, idIngrediente int, costo models.CostoUnitario) (*models.StoricoCostoIngrediente, error) {
+	s := &models.StoricoCostoIngrediente{IDIngrediente: idIngrediente, CostoUnitario: costo}
+	err := tx.QueryRow(ctx, `
+		INSERT INTO storico_costo_ingrediente (id_ingrediente, costo_unitario)
+		VALUES ($1, $2)
+		RETURNING id_storico, data_inizio
+	`, idIngrediente, costo).Scan(&s.ID, &s.DataInizio)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
 }
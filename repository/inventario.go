@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errori personalizzati
+var (
+	ErrInventarioInesistente = errors.New("inventario non trovato")
+	ErrInventarioConfermato  = errors.New("l'inventario è già stato confermato e non può essere modificato")
+	ErrInventarioVuoto       = errors.New("l'inventario deve contenere almeno un ingrediente contato")
+	ErrQuantitaContata       = errors.New("la quantità contata non può essere negativa")
+)
+
+type InventarioRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewInventarioRepository(db *pgxpool.Pool) *InventarioRepository {
+	return &InventarioRepository{DB: db}
+}
+
+// GetAll restituisce gli inventari, dal più recente, con i totali delle differenze ma senza righe
+func (r *InventarioRepository) GetAll(ctx context.Context) ([]models.Inventario, error) {
+	rows, err := r.DB.Query(ctx, `SELECT id_inventario FROM inventario ORDER BY data_creazione DESC, id_inventario DESC`)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	inventari := []models.Inventario{}
+	for _, id := range ids {
+		inv, err := leggiInventario(ctx, r.DB, id)
+		if err != nil {
+			return nil, err
+		}
+		inv.Righe = nil
+		inventari = append(inventari, *inv)
+	}
+	return inventari, nil
+}
+
+// GetByID restituisce l'inventario con il report delle differenze
+func (r *InventarioRepository) GetByID(ctx context.Context, id int) (*models.Inventario, error) {
+	return leggiInventario(ctx, r.DB, id)
+}
+
+// Create registra un nuovo conteggio come bozza; con conferma rettifica subito le scorte
+func (r *InventarioRepository) Create(ctx context.Context, note string, conteggi []models.ConteggioIngrediente, conferma bool, ingredienteCache *cache.IngredienteCache) (*models.Inventario, error) {
+	if len(conteggi) == 0 {
+		return nil, ErrInventarioVuoto
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Crea l'inventario in bozza
+	var id int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO inventario (note) VALUES (NULLIF($1, '')) RETURNING id_inventario
+	`, note).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Registra le quantità contate
+	if err := salvaConteggi(ctx, tx, id, conteggi); err != nil {
+		return nil, err
+	}
+
+	// 3. Conferma, se richiesto
+	var rettificati map[int]float64
+	if conferma {
+		rettificati, err = confermaInventario(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	inv, err := leggiInventario(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	InvalidaCacheIngredienti(ctx, ingredienteCache, rettificati)
+	return inv, nil
+}
+
+// AggiornaConteggi aggiunge o sostituisce quantità contate in una bozza di inventario
+func (r *InventarioRepository) AggiornaConteggi(ctx context.Context, id int, note *string, conteggi []models.ConteggioIngrediente) (*models.Inventario, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := bloccaBozza(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	if note != nil {
+		if _, err := tx.Exec(ctx, `UPDATE inventario SET note = NULLIF($1, '') WHERE id_inventario = $2`, *note, id); err != nil {
+			return nil, err
+		}
+	}
+	if err := salvaConteggi(ctx, tx, id, conteggi); err != nil {
+		return nil, err
+	}
+
+	inv, err := leggiInventario(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Conferma rettifica le scorte in base a una bozza di inventario e ne fissa il report
+func (r *InventarioRepository) Conferma(ctx context.Context, id int, ingredienteCache *cache.IngredienteCache) (*models.Inventario, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := bloccaBozza(ctx, tx, id); err != nil {
+		return nil, err
+	}
+	rettificati, err := confermaInventario(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	inv, err := leggiInventario(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	InvalidaCacheIngredienti(ctx, ingredienteCache, rettificati)
+	return inv, nil
+}
+
+// Delete elimina una bozza di inventario; un inventario confermato non si elimina
+func (r *InventarioRepository) Delete(ctx context.Context, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := bloccaBozza(ctx, tx, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM inventario WHERE id_inventario = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// bloccaBozza blocca l'inventario e verifica che sia ancora una bozza
+func bloccaBozza(ctx context.Context, tx pgx.Tx, id int) error {
+	var stato string
+	err := tx.QueryRow(ctx, `SELECT stato FROM inventario WHERE id_inventario = $1 FOR UPDATE`, id).Scan(&stato)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrInventarioInesistente
+		}
+		return err
+	}
+	if stato != models.InventarioBozza {
+		return ErrInventarioConfermato
+	}
+	return nil
+}
+
+// salvaConteggi registra le quantità contate, sostituendo quelle già presenti per gli stessi ingredienti,
+// insieme alla quantità registrata (teorica) nel momento del conteggio, al netto dei lotti già scaduti
+func salvaConteggi(ctx context.Context, tx pgx.Tx, id int, conteggi []models.ConteggioIngrediente) error {
+	for _, c := range conteggi {
+		if c.QuantitaContata < 0 {
+			return ErrQuantitaContata
+		}
+		var esiste bool
+		err := tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ingrediente WHERE id_ingrediente = $1)`, c.IDIngrediente).Scan(&esiste)
+		if err != nil {
+			return err
+		}
+		if !esiste {
+			return fmt.Errorf("%w: %d", ErrIngredienteInesistente, c.IDIngrediente)
+		}
+		if err := smaltisciLottiScaduti(ctx, tx, c.IDIngrediente, nil); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO inventario_riga (id_inventario, id_ingrediente, quantita_contata, quantita_teorica)
+			SELECT $1, $2, $3, quantita_disponibile FROM ingrediente WHERE id_ingrediente = $2
+			ON CONFLICT (id_inventario, id_ingrediente)
+			DO UPDATE SET quantita_contata = EXCLUDED.quantita_contata, quantita_teorica = EXCLUDED.quantita_teorica
+		`, id, c.IDIngrediente, c.QuantitaContata)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// confermaInventario rettifica le scorte di ogni ingrediente contato della differenza tra quantità contata
+// e quantità teorica al momento del conteggio, così i movimenti registrati nel frattempo (ordini, carichi)
+// restano validi; i lotti scaduti dopo il conteggio sono prima registrati come spreco e la rettifica
+// non porta mai le scorte sotto zero. Fissa sulle righe il costo unitario
+// e segna l'inventario come confermato
+// Restituisce le rettifiche applicate per ingrediente
+func confermaInventario(ctx context.Context, tx pgx.Tx, id int) (map[int]float64, error) {
+	// 1. Quantità contate e teoriche, in ordine di ingrediente per bloccare le scorte sempre nello stesso ordine
+	// (le righe salvate prima che la quantità teorica fosse registrata al conteggio non ne hanno una)
+	type conteggio struct {
+		models.ConteggioIngrediente
+		teorica *float64
+	}
+	rows, err := tx.Query(ctx, `
+		SELECT id_ingrediente, quantita_contata, quantita_teorica
+		FROM inventario_riga
+		WHERE id_inventario = $1
+		ORDER BY id_ingrediente
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	var conteggi []conteggio
+	for rows.Next() {
+		var c conteggio
+		if err := rows.Scan(&c.IDIngrediente, &c.QuantitaContata, &c.teorica); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		conteggi = append(conteggi, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(conteggi) == 0 {
+		return nil, ErrInventarioVuoto
+	}
+
+	// 2. Rettifica le scorte della differenza rilevata e fissa la quantità teorica e il costo
+	rettificati := make(map[int]float64)
+	for _, c := range conteggi {
+		if err := smaltisciLottiScaduti(ctx, tx, c.IDIngrediente, nil); err != nil {
+			return nil, err
+		}
+		var attuale float64
+		err := tx.QueryRow(ctx, `
+			SELECT quantita_disponibile FROM ingrediente WHERE id_ingrediente = $1 FOR UPDATE
+		`, c.IDIngrediente).Scan(&attuale)
+		if err != nil {
+			return nil, err
+		}
+		teorica := attuale
+		if c.teorica != nil {
+			teorica = *c.teorica
+		}
+
+		differenza := max(c.QuantitaContata-teorica, -attuale)
+		if differenza != 0 {
+			err := movimentaScorta(ctx, tx, &models.MovimentoMagazzino{
+				IDIngrediente: c.IDIngrediente,
+				Tipo:          models.MovimentoRettifica,
+				Quantita:      differenza,
+				Note:          fmt.Sprintf("inventario %d", id),
+			})
+			if err != nil {
+				return nil, err
+			}
+			rettificati[c.IDIngrediente] = differenza
+		}
+
+		_, err = tx.Exec(ctx, `
+			UPDATE inventario_riga r
+			SET quantita_teorica = $1, costo_unitario = i.costo_unitario
+			FROM ingrediente i
+			WHERE r.id_inventario = $2 AND r.id_ingrediente = $3 AND i.id_ingrediente = r.id_ingrediente
+		`, teorica, id, c.IDIngrediente)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// 3. Segna l'inventario come confermato
+	_, err = tx.Exec(ctx, `
+		UPDATE inventario SET stato = $1, data_conferma = CURRENT_TIMESTAMP WHERE id_inventario = $2
+	`, models.InventarioConfermato, id)
+	if err != nil {
+		return nil, err
+	}
+	return rettificati, nil
+}
+
+// leggiInventario legge l'inventario con le righe e calcola il report delle differenze
+// Le righe sono confrontate con la quantità teorica al momento del conteggio; i costi di una bozza sono quelli attuali
+func leggiInventario(ctx context.Context, db dbtx, id int) (*models.Inventario, error) {
+	inv := &models.Inventario{ID: id}
+	err := db.QueryRow(ctx, `
+		SELECT stato, COALESCE(note, ''), data_creazione, data_conferma
+		FROM inventario
+		WHERE id_inventario = $1
+	`, id).Scan(&inv.Stato, &inv.Note, &inv.DataCreazione, &inv.DataConferma)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrInventarioInesistente
+		}
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT r.id_ingrediente, i.nome, i.unita_misura,
+		       COALESCE(r.quantita_teorica, i.quantita_disponibile), r.quantita_contata,
+		       COALESCE(r.costo_unitario, i.costo_unitario)
+		FROM inventario_riga r
+		JOIN ingrediente i ON r.id_ingrediente = i.id_ingrediente
+		WHERE r.id_inventario = $1
+		ORDER BY i.nome
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	inv.Righe = []models.RigaInventario{}
+	for rows.Next() {
+		var riga models.RigaInventario
+		if err := rows.Scan(&riga.IDIngrediente, &riga.Nome, &riga.UnitaMisura,
+			&riga.QuantitaTeorica, &riga.QuantitaContata, &riga.CostoUnitario); err != nil {
+			return nil, err
+		}
+		inv.Righe = append(inv.Righe, riga)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	inv.CalcolaDifferenze()
+	return inv, nil
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"context"
+	"ristorante-api/models"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// calcolaIVA completa lo scontrino con il riepilogo IVA per aliquota
+// I prezzi sono IVA inclusa: ogni pietanza alla carta usa la propria aliquota o quella della categoria,
+// il prezzo di un menu fisso è ripartito tra le sue pietanze in proporzione al loro prezzo.
+// Gli sconti per categoria riducono solo le aliquote delle pietanze della propria categoria;
+// gli sconti sull'intero ordine sono poi ripartiti tra le aliquote in proporzione agli importi rimasti,
+// mentre coperto e servizio usano l'aliquota predefinita
+func calcolaIVA(ctx context.Context, tx pgx.Tx, scontrino *models.Scontrino) error {
+	lordoPerAliquota := make(map[models.Percentuale]int64)
+
+	// 1. Pietanze alla carta raggruppate per categoria e aliquota
+	type categoriaAliquota struct {
+		idCategoria int
+		aliquota    models.Percentuale
+	}
+	lordoCarta := make(map[categoriaAliquota]int64)
+	rows, err := tx.Query(ctx, `
+		SELECT COALESCE(p.id_categoria, 0), COALESCE(p.aliquota_iva, c.aliquota_iva, $2), SUM(d.prezzo_unitario * d.quantita)
+		FROM dettaglio_ordine_pietanza d
+		JOIN pietanza p ON d.id_pietanza = p.id_pietanza
+		LEFT JOIN categoria_pietanza c ON p.id_categoria = c.id_categoria
+		WHERE d.id_ordine = $1 AND d.parte_di_menu = false
+		GROUP BY 1, 2
+	`, scontrino.IDOrdine, models.AliquotaIVAPredefinita)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var chiave categoriaAliquota
+		var importo models.Importo
+		if err := rows.Scan(&chiave.idCategoria, &chiave.aliquota, &importo); err != nil {
+			rows.Close()
+			return err
+		}
+		lordoCarta[chiave] = importo.Centesimi()
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// 2. Menu fissi: il prezzo del menu è ripartito tra le pietanze che lo compongono
+	type pietanzaMenu struct {
+		prezzo   int64
+		aliquota models.Percentuale
+	}
+	rows, err = tx.Query(ctx, `
+		SELECT d.id_menu, m.prezzo, d.id_pietanza, d.quantita, d.prezzo_unitario, COALESCE(p.aliquota_iva, c.aliquota_iva, $2)
+		FROM dettaglio_ordine_pietanza d
+		JOIN pietanza p ON d.id_pietanza = p.id_pietanza
+		JOIN menu_fisso m ON d.id_menu = m.id_menu
+		LEFT JOIN categoria_pietanza c ON p.id_categoria = c.id_categoria
+		WHERE d.id_ordine = $1 AND d.parte_di_menu = true
+		ORDER BY d.id_menu, d.id_dettaglio
+	`, scontrino.IDOrdine, models.AliquotaIVAPredefinita)
+	if err != nil {
+		return err
+	}
+	var idMenuOrdinati []int
+	prezzoMenu := make(map[int]models.Importo)
+	// Una pietanza può essere su più righe dello stesso menu, una per versione della ricetta:
+	// il numero di menu è la massima quantità complessiva di una pietanza
+	quantitaPietanza := make(map[[2]int]int)
+	quantitaMenu := make(map[int]int)
+	pietanzeMenu := make(map[int][]pietanzaMenu)
+	for rows.Next() {
+		var idMenu, idPietanza, quantita int
+		var prezzo, prezzoPietanza models.Importo
+		var aliquota models.Percentuale
+		if err := rows.Scan(&idMenu, &prezzo, &idPietanza, &quantita, &prezzoPietanza, &aliquota); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := prezzoMenu[idMenu]; !ok {
+			idMenuOrdinati = append(idMenuOrdinati, idMenu)
+		}
+		prezzoMenu[idMenu] = prezzo
+		quantitaPietanza[[2]int{idMenu, idPietanza}] += quantita
+		quantitaMenu[idMenu] = max(quantitaMenu[idMenu], quantitaPietanza[[2]int{idMenu, idPietanza}])
+		pietanzeMenu[idMenu] = append(pietanzeMenu[idMenu], pietanzaMenu{prezzo: prezzoPietanza.Per(quantita).Centesimi(), aliquota: aliquota})
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, idMenu := range idMenuOrdinati {
+		pietanze := pietanzeMenu[idMenu]
+		pesi := make([]int64, len(pietanze))
+		for i, p := range pietanze {
+			pesi[i] = p.prezzo
+		}
+		quote := ripartisci(prezzoMenu[idMenu].Per(quantitaMenu[idMenu]).Centesimi(), pesi)
+		for i, p := range pietanze {
+			lordoPerAliquota[p.aliquota] += quote[i]
+		}
+	}
+
+	// 3. Ogni sconto per categoria è tolto dalle aliquote delle pietanze alla carta di quella categoria,
+	// in proporzione al loro importo
+	for _, voce := range scontrino.Sconti {
+		if voce.IDCategoria == nil || voce.Tipo == models.ScontoServizio {
+			continue
+		}
+		var chiavi []categoriaAliquota
+		for chiave := range lordoCarta {
+			if chiave.idCategoria == *voce.IDCategoria {
+				chiavi = append(chiavi, chiave)
+			}
+		}
+		sort.Slice(chiavi, func(i, j int) bool { return chiavi[i].aliquota < chiavi[j].aliquota })
+		pesi := make([]int64, len(chiavi))
+		for i, chiave := range chiavi {
+			pesi[i] = lordoCarta[chiave]
+		}
+		for i, quota := range ripartisci(-voce.Importo.Centesimi(), pesi) {
+			lordoCarta[chiavi[i]] -= quota
+		}
+	}
+	for chiave, lordo := range lordoCarta {
+		lordoPerAliquota[chiave.aliquota] += lordo
+	}
+
+	// 4. Ripartisce il costo delle voci al netto degli altri sconti tra le aliquote,
+	// così il riepilogo coincide sempre con il totale dello scontrino
+	aliquote := make([]models.Percentuale, 0, len(lordoPerAliquota)+1)
+	for aliquota := range lordoPerAliquota {
+		aliquote = append(aliquote, aliquota)
+	}
+	if _, ok := lordoPerAliquota[models.AliquotaIVAPredefinita]; !ok {
+		aliquote = append(aliquote, models.AliquotaIVAPredefinita)
+	}
+	sort.Slice(aliquote, func(i, j int) bool { return aliquote[i] < aliquote[j] })
+
+	pesi := make([]int64, len(aliquote))
+	for i, aliquota := range aliquote {
+		pesi[i] = lordoPerAliquota[aliquota]
+	}
+	netto := scontrino.CostoTotale - scontrino.ImportoSconti
+	quote := ripartisci(netto.Centesimi(), pesi)
+
+	// 5. Scorpora l'IVA per ogni aliquota; coperto e servizio vanno sull'aliquota predefinita
+	scontrino.IVA = []models.RiepilogoIVA{}
+	scontrino.TotaleImponibile = 0
+	scontrino.TotaleImposta = 0
+	for i, aliquota := range aliquote {
+		lordo := models.ImportoDaCentesimi(quote[i])
+		if aliquota == models.AliquotaIVAPredefinita {
+			lordo += scontrino.ImportoCoperto + scontrino.ImportoServizio
+		}
+		if lordo == 0 {
+			continue
+		}
+
+		imponibile, imposta := models.ScorporaIVA(lordo, aliquota)
+		scontrino.IVA = append(scontrino.IVA, models.RiepilogoIVA{
+			Aliquota:   aliquota,
+			Imponibile: imponibile,
+			Imposta:    imposta,
+			Totale:     lordo,
+		})
+		scontrino.TotaleImponibile += imponibile
+		scontrino.TotaleImposta += imposta
+	}
+
+	return nil
+}
@@ -0,0 +1,387 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// aggiornaLotti riflette sui lotti un movimento di magazzino appena registrato:
+// un'uscita preleva dai lotti non scaduti in ordine di scadenza (FEFO, poi di arrivo), uno storno di un ordine
+// restituisce le quantità ai lotti da cui l'ordine le aveva prelevate. Ciò che i lotti non coprono
+// riguarda le scorte senza lotto. I carichi creano il proprio lotto in rifornisci
+func aggiornaLotti(ctx context.Context, tx pgx.Tx, m *models.MovimentoMagazzino) error {
+	switch {
+	case m.Quantita < 0:
+		return consumaLotti(ctx, tx, m.ID, m.IDIngrediente, -m.Quantita)
+	case m.Tipo == models.MovimentoStorno && m.IDOrdine != nil:
+		return restituisciLotti(ctx, tx, m.ID, m.IDIngrediente, *m.IDOrdine, m.Quantita)
+	}
+	return nil
+}
+
+// consumaLotti preleva la quantità dai lotti dell'ingrediente con residuo non scaduti, dal primo in scadenza
+func consumaLotti(ctx context.Context, tx pgx.Tx, idMovimento int, idIngrediente int, quantita float64) error {
+	rows, err := tx.Query(ctx, `
+		SELECT id_lotto, quantita_residua
+		FROM lotto
+		WHERE id_ingrediente = $1 AND quantita_residua > 0
+		  AND (data_scadenza IS NULL OR data_scadenza >= CURRENT_DATE)
+		ORDER BY data_scadenza NULLS LAST, data_ricevimento, id_lotto
+		FOR UPDATE
+	`, idIngrediente)
+	if err != nil {
+		return err
+	}
+	prelievi := make(map[int]float64)
+	var lotti []int
+	for rows.Next() && quantita > 0 {
+		var idLotto int
+		var residua float64
+		if err := rows.Scan(&idLotto, &residua); err != nil {
+			rows.Close()
+			return err
+		}
+		preso := min(residua, quantita)
+		prelievi[idLotto] = preso
+		lotti = append(lotti, idLotto)
+		quantita -= preso
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, idLotto := range lotti {
+		if err := registraConsumo(ctx, tx, idMovimento, idLotto, prelievi[idLotto]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restituisciLotti rende ai lotti la quantità stornata da un ordine, partendo dagli ultimi prelievi
+// e senza superare quanto l'ordine aveva prelevato da ciascun lotto
+func restituisciLotti(ctx context.Context, tx pgx.Tx, idMovimento int, idIngrediente int, idOrdine int, quantita float64) error {
+	rows, err := tx.Query(ctx, `
+		SELECT c.id_lotto, SUM(c.quantita)
+		FROM consumo_lotto c
+		JOIN movimento_magazzino m ON c.id_movimento = m.id_movimento
+		WHERE m.id_ordine = $1 AND m.id_ingrediente = $2
+		GROUP BY c.id_lotto
+		HAVING SUM(c.quantita) > 0
+		ORDER BY MAX(c.id_consumo) DESC
+	`, idOrdine, idIngrediente)
+	if err != nil {
+		return err
+	}
+	restituzioni := make(map[int]float64)
+	var lotti []int
+	for rows.Next() && quantita > 0 {
+		var idLotto int
+		var prelevato float64
+		if err := rows.Scan(&idLotto, &prelevato); err != nil {
+			rows.Close()
+			return err
+		}
+		reso := min(prelevato, quantita)
+		restituzioni[idLotto] = reso
+		lotti = append(lotti, idLotto)
+		quantita -= reso
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, idLotto := range lotti {
+		if err := registraConsumo(ctx, tx, idMovimento, idLotto, -restituzioni[idLotto]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// consumaLottiScaduti preleva la quantità dai lotti scaduti dell'ingrediente, dal primo scaduto,
+// e restituisce la parte che i lotti scaduti non coprono
+func consumaLottiScaduti(ctx context.Context, tx pgx.Tx, idMovimento int, idIngrediente int, quantita float64) (float64, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT id_lotto, quantita_residua
+		FROM lotto
+		WHERE id_ingrediente = $1 AND quantita_residua > 0 AND data_scadenza < CURRENT_DATE
+		ORDER BY data_scadenza, id_lotto
+		FOR UPDATE
+	`, idIngrediente)
+	if err != nil {
+		return 0, err
+	}
+	prelievi := make(map[int]float64)
+	var lotti []int
+	for rows.Next() && quantita > 0 {
+		var idLotto int
+		var residua float64
+		if err := rows.Scan(&idLotto, &residua); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		preso := min(residua, quantita)
+		prelievi[idLotto] = preso
+		lotti = append(lotti, idLotto)
+		quantita -= preso
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, idLotto := range lotti {
+		if err := registraConsumo(ctx, tx, idMovimento, idLotto, prelievi[idLotto]); err != nil {
+			return 0, err
+		}
+	}
+	return quantita, nil
+}
+
+// smaltisciLottiScaduti registra come spreco con causale "scaduto" il residuo dei lotti scaduti
+// dell'ingrediente, che non possono più essere usati e non devono contare nelle scorte disponibili.
+// Ogni lotto ha il proprio movimento di spreco, prelevato da quel lotto; se smaltiti non è nil
+// vi aggiunge gli sprechi registrati
+func smaltisciLottiScaduti(ctx context.Context, tx pgx.Tx, idIngrediente int, smaltiti *[]models.Spreco) error {
+	// Blocca l'ingrediente prima dei lotti, nello stesso ordine delle altre uscite
+	_, err := tx.Exec(ctx, `SELECT 1 FROM ingrediente WHERE id_ingrediente = $1 FOR UPDATE`, idIngrediente)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id_lotto, COALESCE(codice_lotto, ''), quantita_residua
+		FROM lotto
+		WHERE id_ingrediente = $1 AND quantita_residua > 0 AND data_scadenza < CURRENT_DATE
+		ORDER BY data_scadenza, id_lotto
+		FOR UPDATE
+	`, idIngrediente)
+	if err != nil {
+		return err
+	}
+	type lottoScaduto struct {
+		id      int
+		codice  string
+		residuo float64
+	}
+	var scaduti []lottoScaduto
+	for rows.Next() {
+		var l lottoScaduto
+		if err := rows.Scan(&l.id, &l.codice, &l.residuo); err != nil {
+			rows.Close()
+			return err
+		}
+		scaduti = append(scaduti, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range scaduti {
+		note := fmt.Sprintf("lotto %d scaduto", l.id)
+		if l.codice != "" {
+			note = fmt.Sprintf("lotto %s scaduto", l.codice)
+		}
+		movimento := &models.MovimentoMagazzino{
+			IDIngrediente: idIngrediente,
+			Tipo:          models.MovimentoSpreco,
+			Quantita:      -l.residuo,
+			Note:          note,
+		}
+		if err := registraMovimento(ctx, tx, movimento); err != nil {
+			return err
+		}
+		if err := registraConsumo(ctx, tx, movimento.ID, l.id, l.residuo); err != nil {
+			return err
+		}
+
+		spreco := models.Spreco{
+			IDMovimento:   movimento.ID,
+			IDIngrediente: idIngrediente,
+			Causale:       models.CausaleScaduto,
+			Quantita:      l.residuo,
+			Note:          note,
+			DataSpreco:    movimento.DataMovimento,
+		}
+		err := tx.QueryRow(ctx, `
+			INSERT INTO spreco (id_movimento, causale, costo_unitario)
+			SELECT $1, $2, costo_unitario FROM ingrediente WHERE id_ingrediente = $3
+			RETURNING id_spreco, costo_unitario
+		`, movimento.ID, models.CausaleScaduto, idIngrediente).Scan(&spreco.ID, &spreco.CostoUnitario)
+		if err != nil {
+			return err
+		}
+		spreco.Valore = models.CostoPerQuantita(spreco.CostoUnitario, spreco.Quantita)
+		if smaltiti != nil {
+			*smaltiti = append(*smaltiti, spreco)
+		}
+
+		if _, err := aggiornaDisponibilitaIngrediente(ctx, tx, idIngrediente, movimento.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SmaltisciLottiScaduti registra come spreco il residuo di tutti i lotti scaduti, così le scorte
+// disponibili ne sono al netto anche prima della successiva uscita di ciascun ingrediente
+// Restituisce gli sprechi registrati
+func (r *IngredienteRepository) SmaltisciLottiScaduti(ctx context.Context) ([]models.Spreco, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// Ingredienti in ordine di ID per bloccarli sempre nello stesso ordine
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT id_ingrediente
+		FROM lotto
+		WHERE quantita_residua > 0 AND data_scadenza < CURRENT_DATE
+		ORDER BY id_ingrediente
+	`)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	smaltiti := []models.Spreco{}
+	for _, id := range ids {
+		if err := smaltisciLottiScaduti(ctx, tx, id, &smaltiti); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return smaltiti, nil
+}
+
+// registraConsumo aggiorna il residuo del lotto e registra il prelievo (negativo se restituzione)
+func registraConsumo(ctx context.Context, tx pgx.Tx, idMovimento int, idLotto int, quantita float64) error {
+	_, err := tx.Exec(ctx, `
+		UPDATE lotto SET quantita_residua = GREATEST(quantita_residua - $1, 0) WHERE id_lotto = $2
+	`, quantita, idLotto)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO consumo_lotto (id_movimento, id_lotto, quantita) VALUES ($1, $2, $3)
+	`, idMovimento, idLotto, quantita)
+	return err
+}
+
+// creaLotto registra il lotto entrato in magazzino con il movimento di carico
+func creaLotto(ctx context.Context, tx pgx.Tx, m *models.MovimentoMagazzino, dati models.DatiLotto) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO lotto (id_ingrediente, codice_lotto, quantita_iniziale, quantita_residua, data_ricevimento, data_scadenza, id_movimento)
+		VALUES ($1, NULLIF($2, ''), $3, $3, $4, NULLIF($5::text, '')::date, $6)
+	`, m.IDIngrediente, dati.CodiceLotto, m.Quantita, m.DataMovimento, dati.DataScadenza, m.ID)
+	return err
+}
+
+// Lotti restituisce i lotti con residuo di un ingrediente, nell'ordine in cui vengono consumati
+func (r *IngredienteRepository) Lotti(ctx context.Context, id int) ([]models.Lotto, error) {
+	var esiste bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ingrediente WHERE id_ingrediente = $1)`, id).Scan(&esiste)
+	if err != nil {
+		return nil, err
+	}
+	if !esiste {
+		return nil, ErrIngredienteInesistente
+	}
+	return leggiLotti(ctx, r.DB, `l.id_ingrediente = $1`, id)
+}
+
+// LottiInScadenza restituisce i lotti con residuo che scadono entro il numero di giorni indicato
+// (compresi quelli già scaduti), dal primo in scadenza
+func (r *IngredienteRepository) LottiInScadenza(ctx context.Context, giorni int) ([]models.Lotto, error) {
+	return leggiLotti(ctx, r.DB, `l.data_scadenza <= CURRENT_DATE + $1::int`, giorni)
+}
+
+// leggiLotti legge i lotti con residuo che soddisfano la condizione indicata
+func leggiLotti(ctx context.Context, db dbtx, condizione string, arg any) ([]models.Lotto, error) {
+	rows, err := db.Query(ctx, `
+		SELECT l.id_lotto, l.id_ingrediente, i.nome, i.unita_misura, COALESCE(l.codice_lotto, ''),
+		       l.quantita_iniziale, l.quantita_residua, l.data_ricevimento, l.data_scadenza
+		FROM lotto l
+		JOIN ingrediente i ON l.id_ingrediente = i.id_ingrediente
+		WHERE l.quantita_residua > 0 AND `+condizione+`
+		ORDER BY l.data_scadenza NULLS LAST, l.data_ricevimento, l.id_lotto
+	`, arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lotti := []models.Lotto{}
+	for rows.Next() {
+		var l models.Lotto
+		if err := rows.Scan(&l.ID, &l.IDIngrediente, &l.Nome, &l.UnitaMisura, &l.CodiceLotto,
+			&l.QuantitaIniziale, &l.QuantitaResidua, &l.DataRicevimento, &l.DataScadenza); err != nil {
+			return nil, err
+		}
+		lotti = append(lotti, l)
+	}
+	return lotti, rows.Err()
+}
+
+// LottiUtilizzati restituisce i lotti da cui sono stati prelevati gli ingredienti dell'ordine, al netto degli storni
+func (r *OrdineRepository) LottiUtilizzati(ctx context.Context, idOrdine int) ([]models.LottoUtilizzato, error) {
+	var esiste bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ordine WHERE id_ordine = $1)`, idOrdine).Scan(&esiste)
+	if err != nil {
+		return nil, err
+	}
+	if !esiste {
+		return nil, ErrOrdineInesistente
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT i.id_ingrediente, i.nome, i.unita_misura, l.id_lotto, COALESCE(l.codice_lotto, ''), l.data_scadenza,
+		       SUM(c.quantita)
+		FROM consumo_lotto c
+		JOIN movimento_magazzino m ON c.id_movimento = m.id_movimento
+		JOIN lotto l ON c.id_lotto = l.id_lotto
+		JOIN ingrediente i ON l.id_ingrediente = i.id_ingrediente
+		WHERE m.id_ordine = $1
+		GROUP BY i.id_ingrediente, i.nome, i.unita_misura, l.id_lotto, l.codice_lotto, l.data_scadenza
+		HAVING SUM(c.quantita) > 0
+		ORDER BY i.nome, l.id_lotto
+	`, idOrdine)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lotti := []models.LottoUtilizzato{}
+	for rows.Next() {
+		var l models.LottoUtilizzato
+		if err := rows.Scan(&l.IDIngrediente, &l.Nome, &l.UnitaMisura, &l.IDLotto, &l.CodiceLotto, &l.DataScadenza,
+			&l.Quantita); err != nil {
+			return nil, err
+		}
+		lotti = append(lotti, l)
+	}
+	return lotti, rows.Err()
+}
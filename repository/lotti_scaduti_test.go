@@ -0,0 +1,229 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"ristorante-api/database"
+	"ristorante-api/models"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	quantitaScaduta = 2.0
+	quantitaFresca  = 3.0
+)
+
+// databaseTest apre il database dei test di integrazione con lo schema aggiornato, o salta il test
+func databaseTest(t *testing.T) (context.Context, *pgxpool.Pool) {
+	t.Helper()
+	url := os.Getenv(variabileDatabaseTest)
+	if url == "" {
+		t.Skipf("%s non impostata: test di integrazione saltato", variabileDatabaseTest)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+
+	pool, err := pgxpool.New(ctx, url)
+	if err != nil {
+		t.Fatalf("connessione al database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+	if err := (&database.DB{Pool: pool}).InitSchema(); err != nil {
+		t.Fatalf("inizializzazione dello schema: %v", err)
+	}
+	return ctx, pool
+}
+
+// ingredienteConLottoScaduto crea un ingrediente con un lotto scaduto ieri e uno fresco
+func ingredienteConLottoScaduto(t *testing.T, ctx context.Context, pool *pgxpool.Pool) int {
+	t.Helper()
+	var id int
+	err := pool.QueryRow(ctx, `
+		INSERT INTO ingrediente (nome, quantita_disponibile, unita_misura, soglia_riordino)
+		VALUES ($1, 0, 'kg', 0) RETURNING id_ingrediente
+	`, fmt.Sprintf("test lotti scaduti %d", time.Now().UnixNano())).Scan(&id)
+	if err != nil {
+		t.Fatalf("creazione dell'ingrediente: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), `DELETE FROM ingrediente WHERE id_ingrediente = $1`, id)
+	})
+
+	repo := NewIngredienteRepository(pool)
+	oggi := time.Now()
+	lotti := []struct {
+		quantita float64
+		scadenza time.Time
+	}{
+		{quantitaScaduta, oggi.AddDate(0, 0, -1)},
+		{quantitaFresca, oggi.AddDate(0, 0, 7)},
+	}
+	for _, l := range lotti {
+		if _, err := repo.Rifornisci(ctx, id, l.quantita, models.DatiLotto{DataScadenza: l.scadenza.Format("2006-01-02")}); err != nil {
+			t.Fatalf("carico del lotto: %v", err)
+		}
+	}
+	return id
+}
+
+// verificaScorte controlla la quantità disponibile, il residuo dei lotti e gli sprechi registrati per causale
+func verificaScorte(t *testing.T, ctx context.Context, pool *pgxpool.Pool, id int, disponibile, residuoScaduto, residuoFresco float64, sprechi map[string]float64) {
+	t.Helper()
+	var quantita float64
+	err := pool.QueryRow(ctx, `SELECT quantita_disponibile FROM ingrediente WHERE id_ingrediente = $1`, id).Scan(&quantita)
+	if err != nil {
+		t.Fatalf("lettura della scorta: %v", err)
+	}
+	if quantita != disponibile {
+		t.Errorf("scorta = %g, attesa %g", quantita, disponibile)
+	}
+
+	var scaduto, fresco float64
+	err = pool.QueryRow(ctx, `
+		SELECT COALESCE(SUM(quantita_residua) FILTER (WHERE data_scadenza < CURRENT_DATE), 0),
+		       COALESCE(SUM(quantita_residua) FILTER (WHERE data_scadenza >= CURRENT_DATE), 0)
+		FROM lotto WHERE id_ingrediente = $1
+	`, id).Scan(&scaduto, &fresco)
+	if err != nil {
+		t.Fatalf("lettura dei lotti: %v", err)
+	}
+	if scaduto != residuoScaduto || fresco != residuoFresco {
+		t.Errorf("residuo lotti scaduti/freschi = %g/%g, atteso %g/%g", scaduto, fresco, residuoScaduto, residuoFresco)
+	}
+
+	rows, err := pool.Query(ctx, `
+		SELECT s.causale, SUM(-m.quantita)
+		FROM spreco s
+		JOIN movimento_magazzino m ON s.id_movimento = m.id_movimento
+		WHERE m.id_ingrediente = $1
+		GROUP BY s.causale
+	`, id)
+	if err != nil {
+		t.Fatalf("lettura degli sprechi: %v", err)
+	}
+	defer rows.Close()
+	registrati := make(map[string]float64)
+	for rows.Next() {
+		var causale string
+		var q float64
+		if err := rows.Scan(&causale, &q); err != nil {
+			t.Fatalf("lettura degli sprechi: %v", err)
+		}
+		registrati[causale] = q
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("lettura degli sprechi: %v", err)
+	}
+	if fmt.Sprint(registrati) != fmt.Sprint(sprechi) {
+		t.Errorf("sprechi = %v, attesi %v", registrati, sprechi)
+	}
+}
+
+// TestRegistraSprecoScaduto butta il lotto scaduto: la quantità esce una sola volta, dal lotto scaduto
+func TestRegistraSprecoScaduto(t *testing.T) {
+	ctx, pool := databaseTest(t)
+	id := ingredienteConLottoScaduto(t, ctx, pool)
+
+	spreco, err := NewIngredienteRepository(pool).RegistraSpreco(ctx, id, quantitaScaduta, models.CausaleScaduto, "")
+	if err != nil {
+		t.Fatalf("registrazione dello spreco: %v", err)
+	}
+	if spreco.Quantita != quantitaScaduta {
+		t.Errorf("quantità sprecata = %g, attesa %g", spreco.Quantita, quantitaScaduta)
+	}
+	verificaScorte(t, ctx, pool, id, quantitaFresca, 0, quantitaFresca, map[string]float64{models.CausaleScaduto: quantitaScaduta})
+}
+
+// TestRegistraSprecoAltraCausale butta tutta la scorta utilizzabile: il lotto scaduto è smaltito prima
+// e non conta come disponibile
+func TestRegistraSprecoAltraCausale(t *testing.T) {
+	ctx, pool := databaseTest(t)
+	id := ingredienteConLottoScaduto(t, ctx, pool)
+
+	if _, err := NewIngredienteRepository(pool).RegistraSpreco(ctx, id, quantitaFresca, models.CausaleCaduto, ""); err != nil {
+		t.Fatalf("registrazione dello spreco: %v", err)
+	}
+	verificaScorte(t, ctx, pool, id, 0, 0, 0, map[string]float64{
+		models.CausaleScaduto: quantitaScaduta,
+		models.CausaleCaduto:  quantitaFresca,
+	})
+}
+
+// TestConfermaInventarioLottoScaduto conta la sola scorta utilizzabile: il lotto scaduto diventa spreco
+// e la rettifica non lo toglie una seconda volta
+func TestConfermaInventarioLottoScaduto(t *testing.T) {
+	ctx, pool := databaseTest(t)
+	id := ingredienteConLottoScaduto(t, ctx, pool)
+
+	inv, err := NewInventarioRepository(pool).Create(ctx, "test lotti scaduti",
+		[]models.ConteggioIngrediente{{IDIngrediente: id, QuantitaContata: quantitaFresca}}, true, nil)
+	if err != nil {
+		t.Fatalf("conferma dell'inventario: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), `DELETE FROM inventario WHERE id_inventario = $1`, inv.ID)
+	})
+	verificaScorte(t, ctx, pool, id, quantitaFresca, 0, quantitaFresca, map[string]float64{models.CausaleScaduto: quantitaScaduta})
+}
+
+// TestOrdineLottoScaduto ordina una pietanza che usa tutta la scorta utilizzabile: il lotto scaduto
+// è smaltito una sola volta e non copre l'ordine
+func TestOrdineLottoScaduto(t *testing.T) {
+	ctx, pool := databaseTest(t)
+	id := ingredienteConLottoScaduto(t, ctx, pool)
+
+	nome := fmt.Sprintf("test lotti scaduti %d", time.Now().UnixNano())
+	var idRistorante, idTavolo, idPietanza, idRicetta, idOrdine int
+	err := pool.QueryRow(ctx, `
+		INSERT INTO ristorante (nome, numero_tavoli, costo_coperto) VALUES ($1, 1, 0) RETURNING id_ristorante
+	`, nome).Scan(&idRistorante)
+	if err != nil {
+		t.Fatalf("creazione del ristorante: %v", err)
+	}
+	t.Cleanup(func() {
+		pool.Exec(context.Background(), `DELETE FROM ristorante WHERE id_ristorante = $1`, idRistorante)
+		pool.Exec(context.Background(), `DELETE FROM pietanza WHERE id_pietanza = $1`, idPietanza)
+	})
+	err = pool.QueryRow(ctx, `
+		INSERT INTO tavolo (max_posti, id_ristorante) VALUES (4, $1) RETURNING id_tavolo
+	`, idRistorante).Scan(&idTavolo)
+	if err != nil {
+		t.Fatalf("creazione del tavolo: %v", err)
+	}
+	err = pool.QueryRow(ctx, `INSERT INTO pietanza (nome, prezzo) VALUES ($1, 10) RETURNING id_pietanza`, nome).Scan(&idPietanza)
+	if err != nil {
+		t.Fatalf("creazione della pietanza: %v", err)
+	}
+	if _, err := pool.Exec(ctx, `INSERT INTO menu (id_ristorante, id_pietanza) VALUES ($1, $2)`, idRistorante, idPietanza); err != nil {
+		t.Fatalf("inserimento nel menu: %v", err)
+	}
+	err = pool.QueryRow(ctx, `
+		INSERT INTO ricetta (nome, descrizione, id_pietanza, attiva) VALUES ($1, '', $2, true) RETURNING id_ricetta
+	`, nome, idPietanza).Scan(&idRicetta)
+	if err != nil {
+		t.Fatalf("creazione della ricetta: %v", err)
+	}
+	_, err = pool.Exec(ctx, `
+		INSERT INTO ricetta_ingrediente (id_ricetta, id_ingrediente, quantita) VALUES ($1, $2, $3)
+	`, idRicetta, id, quantitaFresca)
+	if err != nil {
+		t.Fatalf("creazione della riga di ricetta: %v", err)
+	}
+	err = pool.QueryRow(ctx, `
+		INSERT INTO ordine (id_tavolo, num_persone, id_ristorante) VALUES ($1, 2, $2) RETURNING id_ordine
+	`, idTavolo, idRistorante).Scan(&idOrdine)
+	if err != nil {
+		t.Fatalf("creazione dell'ordine: %v", err)
+	}
+
+	err = NewPietanzaRepository(pool).AddPietanzaToOrdine(ctx, idOrdine, idPietanza, 1, NewRicettaRepository(pool, nil), nil)
+	if err != nil {
+		t.Fatalf("aggiunta della pietanza: %v", err)
+	}
+	verificaScorte(t, ctx, pool, id, 0, 0, 0, map[string]float64{models.CausaleScaduto: quantitaScaduta})
+}
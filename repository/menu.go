@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errori personalizzati
+var (
+	ErrPietanzaNonInMenu = errors.New("la pietanza non è nel menu del ristorante")
+	ErrPrezzoNonValido   = errors.New("il prezzo deve essere positivo")
+)
+
+// MenuRepository gestisce le pietanze proposte da ciascun ristorante e i loro prezzi
+type MenuRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewMenuRepository(db *pgxpool.Pool) *MenuRepository {
+	return &MenuRepository{DB: db}
+}
+
+// GetByRistorante restituisce le pietanze del menu del ristorante con il prezzo applicato, per nome
+func (r *MenuRepository) GetByRistorante(ctx context.Context, idRistorante int) ([]models.VoceMenu, error) {
+	if err := r.verificaRistorante(ctx, idRistorante); err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT p.id_pietanza, p.nome, COALESCE(m.prezzo, p.prezzo), p.id_categoria, p.aliquota_iva,
+		       p.disponibile, p.esaurita, p.prezzo, m.prezzo IS NOT NULL
+		FROM menu m
+		JOIN pietanza p ON m.id_pietanza = p.id_pietanza
+		WHERE m.id_ristorante = $1
+		ORDER BY p.nome
+	`, idRistorante)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	voci := []models.VoceMenu{}
+	for rows.Next() {
+		v := models.VoceMenu{IDRistorante: idRistorante}
+		if err := rows.Scan(&v.ID, &v.Nome, &v.Prezzo, &v.IDCategoria, &v.AliquotaIVA,
+			&v.Disponibile, &v.Esaurita, &v.PrezzoListino, &v.Personalizzato); err != nil {
+			return nil, err
+		}
+		voci = append(voci, v)
+	}
+	return voci, rows.Err()
+}
+
+// Imposta aggiunge una pietanza al menu del ristorante o ne aggiorna il prezzo;
+// senza prezzo la pietanza è venduta al prezzo di listino
+func (r *MenuRepository) Imposta(ctx context.Context, m *models.Menu) error {
+	if m.Prezzo != nil && *m.Prezzo <= 0 {
+		return ErrPrezzoNonValido
+	}
+
+	var ristoranteEsiste, pietanzaEsiste bool
+	err := r.DB.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM ristorante WHERE id_ristorante = $1),
+		       EXISTS(SELECT 1 FROM pietanza WHERE id_pietanza = $2)
+	`, m.ID_Ristorante, m.ID_Pietanza).Scan(&ristoranteEsiste, &pietanzaEsiste)
+	if err != nil {
+		return err
+	}
+	if !ristoranteEsiste {
+		return ErrRistoranteInesistente
+	}
+	if !pietanzaEsiste {
+		return ErrPietanzaInesistente
+	}
+
+	_, err = r.DB.Exec(ctx, `
+		INSERT INTO menu (id_ristorante, id_pietanza, prezzo)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (id_ristorante, id_pietanza)
+		DO UPDATE SET prezzo = EXCLUDED.prezzo
+	`, m.ID_Ristorante, m.ID_Pietanza, m.Prezzo)
+	return err
+}
+
+// Rimuovi toglie una pietanza dal menu del ristorante
+func (r *MenuRepository) Rimuovi(ctx context.Context, idRistorante int, idPietanza int) error {
+	tag, err := r.DB.Exec(ctx, `
+		DELETE FROM menu WHERE id_ristorante = $1 AND id_pietanza = $2
+	`, idRistorante, idPietanza)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		if err := r.verificaRistorante(ctx, idRistorante); err != nil {
+			return err
+		}
+		return ErrPietanzaNonInMenu
+	}
+	return nil
+}
+
+// verificaRistorante controlla che il ristorante esista
+func (r *MenuRepository) verificaRistorante(ctx context.Context, idRistorante int) error {
+	var esiste bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ristorante WHERE id_ristorante = $1)`, idRistorante).Scan(&esiste)
+	if err != nil {
+		return err
+	}
+	if !esiste {
+		return ErrRistoranteInesistente
+	}
+	return nil
+}
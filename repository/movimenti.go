@@ -0,0 +1,105 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Errori personalizzati
+var (
+	ErrQuantitaMovimentoNonValida = errors.New("la quantità del movimento deve essere maggiore di zero")
+)
+
+// movimentaScorta è l'unico punto in cui cambia la quantità disponibile di un ingrediente:
+// blocca la riga dell'ingrediente, applica la variazione m.Quantita e registra il movimento
+// con le quantità prima e dopo, aggiornando i lotti e la disponibilità delle pietanze. Completa m con ID, quantità e data del movimento
+// Le uscite prelevano solo dai lotti non scaduti: chi scala le scorte registra prima come spreco il residuo
+// dei lotti scaduti con smaltisciLottiScaduti, prima di leggere le scorte e calcolare la quantità
+func movimentaScorta(ctx context.Context, tx pgx.Tx, m *models.MovimentoMagazzino) error {
+	// 1. Applica la variazione e registra il movimento
+	if err := registraMovimento(ctx, tx, m); err != nil {
+		return err
+	}
+
+	// 2. Preleva dai lotti o restituisce ai lotti
+	if err := aggiornaLotti(ctx, tx, m); err != nil {
+		return err
+	}
+
+	// 3. Esaurisce o ripristina le pietanze che usano l'ingrediente
+	_, err := aggiornaDisponibilitaIngrediente(ctx, tx, m.IDIngrediente, m.ID)
+	return err
+}
+
+// registraMovimento blocca l'ingrediente, applica la variazione m.Quantita e registra il movimento,
+// senza toccare lotti e disponibilità delle pietanze
+func registraMovimento(ctx context.Context, tx pgx.Tx, m *models.MovimentoMagazzino) error {
+	// 1. Blocca l'ingrediente e legge la quantità attuale
+	err := tx.QueryRow(ctx, `
+		SELECT quantita_disponibile FROM ingrediente WHERE id_ingrediente = $1 FOR UPDATE
+	`, m.IDIngrediente).Scan(&m.QuantitaPrima)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrIngredienteInesistente
+		}
+		return err
+	}
+	m.QuantitaDopo = m.QuantitaPrima + m.Quantita
+
+	// 2. Aggiorna la quantità
+	_, err = tx.Exec(ctx, `
+		UPDATE ingrediente SET quantita_disponibile = $1 WHERE id_ingrediente = $2
+	`, m.QuantitaDopo, m.IDIngrediente)
+	if err != nil {
+		return err
+	}
+
+	// 3. Registra il movimento
+	err = tx.QueryRow(ctx, `
+		INSERT INTO movimento_magazzino (id_ingrediente, tipo, quantita, quantita_prima, quantita_dopo, id_ordine, note)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		RETURNING id_movimento, data_movimento
+	`, m.IDIngrediente, m.Tipo, m.Quantita, m.QuantitaPrima, m.QuantitaDopo, m.IDOrdine, m.Note).Scan(&m.ID, &m.DataMovimento)
+	return err
+}
+
+// Movimenti restituisce i movimenti di magazzino di un ingrediente, dal più recente
+func (r *IngredienteRepository) Movimenti(ctx context.Context, id int, filtro models.FiltroMovimenti) ([]models.MovimentoMagazzino, error) {
+	var esiste bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ingrediente WHERE id_ingrediente = $1)`, id).Scan(&esiste)
+	if err != nil {
+		return nil, err
+	}
+	if !esiste {
+		return nil, ErrIngredienteInesistente
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT id_movimento, id_ingrediente, tipo, quantita, quantita_prima, quantita_dopo,
+		       id_ordine, COALESCE(note, ''), data_movimento
+		FROM movimento_magazzino
+		WHERE id_ingrediente = $1
+		  AND ($2::text = '' OR data_movimento >= NULLIF($2::text, '')::date)
+		  AND ($3::text = '' OR data_movimento < NULLIF($3::text, '')::date + 1)
+		  AND ($4::text = '' OR tipo = $4::text)
+		ORDER BY data_movimento DESC, id_movimento DESC
+	`, id, filtro.Dal, filtro.Al, filtro.Tipo)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movimenti := []models.MovimentoMagazzino{}
+	for rows.Next() {
+		var m models.MovimentoMagazzino
+		if err := rows.Scan(&m.ID, &m.IDIngrediente, &m.Tipo, &m.Quantita, &m.QuantitaPrima, &m.QuantitaDopo,
+			&m.IDOrdine, &m.Note, &m.DataMovimento); err != nil {
+			return nil, err
+		}
+		movimenti = append(movimenti, m)
+	}
+	return movimenti, rows.Err()
+}
@@ -2,12 +2,25 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"ristorante-api/cache"
 	"ristorante-api/models"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Errori personalizzati
+var (
+	ErrOrdineInesistente    = errors.New("ordine non trovato")
+	ErrStatoOrdineNonValido = errors.New("stato dell'ordine non valido")
+	ErrPagamentoRichiesto   = errors.New("un ordine passa a pagato solo registrando il pagamento con POST /ordini/{id}/pagamento")
+
+	ErrMetodoPagamentoNonValido = errors.New("metodo di pagamento non valido")
+	ErrImportoNonValido         = errors.New("importo del pagamento non valido")
+	ErrImportoInsufficiente     = errors.New("importo insufficiente a coprire il totale dello scontrino")
+)
+
 type OrdineRepository struct {
 	DB *pgxpool.Pool
 }
@@ -18,17 +31,48 @@ func NewOrdineRepository(db *pgxpool.Pool) *OrdineRepository {
 
 // Create crea un nuovo ordine e restituisce l'ID e la data dell'ordine
 // Il Cameriere può creare un ordine per un tavolo specifico
-func (r *OrdineRepository) Create(ctx context.Context, o *models.Ordine) error {
-	return r.DB.QueryRow(ctx, `
+// La creazione viene registrata come primo evento nello storico dell'ordine
+func (r *OrdineRepository) Create(ctx context.Context, o *models.Ordine, attore string) error {
+	// Inizia una transazione
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Il tavolo deve essere del ristorante dell'ordine; il blocco impedisce che passi
+	// a un altro ristorante prima che l'ordine sia registrato
+	if _, err = tx.Exec(ctx, "SELECT 1 FROM tavolo WHERE id_tavolo = $1 FOR SHARE", o.IDTavolo); err != nil {
+		return err
+	}
+	idRistorante, err := ristoranteTavolo(ctx, tx, o.IDTavolo)
+	if err != nil {
+		return err
+	}
+	if idRistorante != o.IDRistorante {
+		return ErrTavoloAltroRistorante
+	}
+
+	err = tx.QueryRow(ctx, `
 		INSERT INTO ordine (id_tavolo, num_persone, stato, id_ristorante)
 		VALUES ($1, $2, 'in_attesa', $3)
 		RETURNING id_ordine, data_ordine, stato
 	`, o.IDTavolo, o.NumPersone, o.IDRistorante).Scan(&o.ID, &o.DataOrdine, &o.Stato)
+	if err != nil {
+		return err
+	}
+
+	if err = registraCambioStato(ctx, tx, o.ID, nil, o.Stato, attore); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
-// GetAll restituisce tutti gli ordini - utile per il Cuoco
-func (r *OrdineRepository) GetAll(ctx context.Context) ([]models.Ordine, error) {
-	rows, err := r.DB.Query(ctx, `SELECT id_ordine, id_tavolo, num_persone, data_ordine, stato, id_ristorante, costo_totale FROM ordine WHERE stato != 'pagato' AND stato !='consegnato' ORDER BY data_ordine ASC`)
+// GetAll restituisce tutti gli ordini aperti - utile per il Cuoco
+// del ristorante indicato o, con idRistorante 0, di tutti i ristoranti
+func (r *OrdineRepository) GetAll(ctx context.Context, idRistorante int) ([]models.Ordine, error) {
+	rows, err := r.DB.Query(ctx, `SELECT id_ordine, id_tavolo, num_persone, data_ordine, stato, id_ristorante, costo_totale FROM ordine WHERE stato NOT IN ('pagato', 'consegnato', 'annullato') AND ($1::int = 0 OR id_ristorante = $1::int) ORDER BY data_ordine ASC`, idRistorante)
 	if err != nil {
 		return nil, err
 	}
@@ -46,6 +90,19 @@ func (r *OrdineRepository) GetAll(ctx context.Context) ([]models.Ordine, error)
 	return ordini, nil
 }
 
+// IDRistorante restituisce il ristorante dell'ordine
+func (r *OrdineRepository) IDRistorante(ctx context.Context, id int) (int, error) {
+	var idRistorante int
+	err := r.DB.QueryRow(ctx, `SELECT id_ristorante FROM ordine WHERE id_ordine = $1`, id).Scan(&idRistorante)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrOrdineInesistente
+		}
+		return 0, err
+	}
+	return idRistorante, nil
+}
+
 func (r *OrdineRepository) GetByID(ctx context.Context, id int) (models.Ordine, error) {
 	var o models.Ordine
 	err := r.DB.QueryRow(ctx, `SELECT id_ordine, id_tavolo, num_persone, data_ordine, stato, id_ristorante, costo_totale FROM ordine WHERE id_ordine = $1`, id).
@@ -56,10 +113,75 @@ func (r *OrdineRepository) GetByID(ctx context.Context, id int) (models.Ordine,
 	return o, nil
 }
 
-// il Cuoco e il Cameriere possono aggiornare lo stato di un ordine (ad esempio da "in attesa" a "in preparazione" o "completato")
-func (r *OrdineRepository) UpdateStato(ctx context.Context, id int, nuovoStato string) (models.Ordine, error) {
+// UpdateStato aggiorna lo stato di un ordine rispettando la macchina a stati
+// Il Cuoco e il Cameriere possono far avanzare un ordine (ad esempio da "confermato" a "in_preparazione")
+// Restituisce ErrStatoOrdineNonValido se lo stato non esiste e *models.ErrTransizioneStato
+// se la transizione non è consentita a partire dallo stato attuale
+// Il cambio di stato viene registrato nello storico nella stessa transazione
+// Un ordine annullato prima della preparazione restituisce al magazzino gli ingredienti di tutte le righe
+// Lo stato "pagato" si raggiunge solo registrando il pagamento: altrimenti restituisce ErrPagamentoRichiesto
+func (r *OrdineRepository) UpdateStato(ctx context.Context, id int, nuovoStato string, attore string, ingredienteCache *cache.IngredienteCache) (models.Ordine, error) {
+	if !models.StatoOrdineValido(nuovoStato) {
+		return models.Ordine{}, ErrStatoOrdineNonValido
+	}
+	if nuovoStato == models.StatoPagato {
+		return models.Ordine{}, ErrPagamentoRichiesto
+	}
+
+	// Inizia una transazione
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return models.Ordine{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var ripristinati map[int]float64
+	if nuovoStato == models.StatoAnnullato {
+		ripristinati, err = ripristinaIngredientiOrdine(ctx, tx, id)
+		if err != nil {
+			return models.Ordine{}, err
+		}
+	}
+
+	o, err := r.cambiaStato(ctx, tx, id, nuovoStato, attore)
+	if err != nil {
+		return models.Ordine{}, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return models.Ordine{}, err
+	}
+
+	InvalidaCacheIngredienti(ctx, ingredienteCache, ripristinati)
+	return o, nil
+}
+
+// cambiaStato esegue la transizione di stato di un ordine all'interno di una transazione fornita
+// La riga dell'ordine viene bloccata per evitare transizioni concorrenti
+func (r *OrdineRepository) cambiaStato(ctx context.Context, tx pgx.Tx, id int, nuovoStato string, attore string) (models.Ordine, error) {
+	var statoAttuale string
+	err := tx.QueryRow(ctx, `
+		SELECT stato FROM ordine
+		WHERE id_ordine = $1
+		FOR UPDATE
+	`, id).Scan(&statoAttuale)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return models.Ordine{}, ErrOrdineInesistente
+		}
+		return models.Ordine{}, err
+	}
+
+	if !models.TransizioneConsentita(statoAttuale, nuovoStato) {
+		return models.Ordine{}, &models.ErrTransizioneStato{
+			IDOrdine:       id,
+			StatoAttuale:   statoAttuale,
+			StatoRichiesto: nuovoStato,
+		}
+	}
+
 	var o models.Ordine
-	err := r.DB.QueryRow(ctx, `
+	err = tx.QueryRow(ctx, `
 		UPDATE ordine SET stato = $1
 		WHERE id_ordine = $2
 		RETURNING id_ordine, id_tavolo, num_persone, data_ordine, stato, id_ristorante, costo_totale
@@ -67,48 +189,117 @@ func (r *OrdineRepository) UpdateStato(ctx context.Context, id int, nuovoStato s
 	if err != nil {
 		return models.Ordine{}, err
 	}
+
+	if err = registraCambioStato(ctx, tx, id, &statoAttuale, nuovoStato, attore); err != nil {
+		return models.Ordine{}, err
+	}
 	return o, nil
 }
 
+// registraCambioStato inserisce un evento nello storico degli stati dell'ordine
+func registraCambioStato(ctx context.Context, tx pgx.Tx, idOrdine int, statoPrecedente *string, statoNuovo string, attore string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO storico_stato_ordine (id_ordine, stato_precedente, stato_nuovo, attore)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+	`, idOrdine, statoPrecedente, statoNuovo, attore)
+	return err
+}
+
+// GetStorico restituisce la cronologia degli stati di un ordine con le durate delle fasi
+// Utile al Manager per misurare i tempi della cucina e del servizio
+func (r *OrdineRepository) GetStorico(ctx context.Context, id int) (*models.StoricoOrdine, error) {
+	ordine, err := r.GetByID(ctx, id)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrOrdineInesistente
+		}
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(ctx, `
+		SELECT id_storico, id_ordine, stato_precedente, stato_nuovo, data_cambio, COALESCE(attore, '')
+		FROM storico_stato_ordine
+		WHERE id_ordine = $1
+		ORDER BY data_cambio, id_storico
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventi := []models.CambioStatoOrdine{}
+	for rows.Next() {
+		var e models.CambioStatoOrdine
+		err := rows.Scan(&e.ID, &e.IDOrdine, &e.StatoPrecedente, &e.StatoNuovo, &e.DataCambio, &e.Attore)
+		if err != nil {
+			return nil, err
+		}
+		eventi = append(eventi, e)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &models.StoricoOrdine{
+		IDOrdine:     ordine.ID,
+		DataOrdine:   ordine.DataOrdine,
+		StatoAttuale: ordine.Stato,
+		Eventi:       eventi,
+		Durate:       models.CalcolaDurate(ordine.DataOrdine, eventi),
+	}, nil
+}
+
 // Delete elimina un ordine per ID
-func (r *OrdineRepository) Delete(ctx context.Context, id int) error {
-	_, err := r.DB.Exec(ctx, `DELETE FROM ordine WHERE id_ordine = $1`, id)
+// Se l'ordine non è ancora in preparazione gli ingredienti delle sue righe tornano in magazzino
+func (r *OrdineRepository) Delete(ctx context.Context, id int, ingredienteCache *cache.IngredienteCache) error {
+	tx, err := r.DB.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	return nil
-}
+	defer tx.Rollback(ctx)
 
-// AggiornaCostoTotale aggiorna il costo totale di un ordine
-// Se specificato un importo fisso (es. per un menu fisso), viene utilizzato quello,
-// altrimenti viene calcolato dalla somma delle pietanze
-func (r *OrdineRepository) AggiornaCostoTotale(ctx context.Context, tx pgx.Tx, idOrdine int, importoFisso *float64) error {
-	if importoFisso != nil {
-		// Aggiorna con l'importo fisso specificato (es. prezzo del menu fisso)
-		_, err := tx.Exec(ctx, `
-			UPDATE ordine
-			SET costo_totale = costo_totale + $1
-			WHERE id_ordine = $2
-		`, *importoFisso, idOrdine)
+	ripristinati, err := ripristinaIngredientiOrdine(ctx, tx, id)
+	if err != nil {
 		return err
 	}
 
-	// Altrimenti ricalcola il totale dalle pietanze dell'ordine
+	_, err = tx.Exec(ctx, `DELETE FROM ordine WHERE id_ordine = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	InvalidaCacheIngredienti(ctx, ingredienteCache, ripristinati)
+	return nil
+}
+
+// AggiornaCostoTotale ricalcola il costo totale di un ordine dalle sue righe:
+// pietanze alla carta al prezzo della riga e menu fissi al prezzo del menu per il numero di menu
+func (r *OrdineRepository) AggiornaCostoTotale(ctx context.Context, tx pgx.Tx, idOrdine int) error {
 	_, err := tx.Exec(ctx, `
 		UPDATE ordine o
 		SET costo_totale = (
 			-- Pietanze normali (non parte di menu fisso)
-			SELECT COALESCE(SUM(p.prezzo * d.quantita), 0)
+			SELECT COALESCE(SUM(d.prezzo_unitario * d.quantita), 0)
 			FROM dettaglio_ordine_pietanza d
-			JOIN pietanza p ON d.id_pietanza = p.id_pietanza
 			WHERE d.id_ordine = o.id_ordine AND (d.parte_di_menu = false OR d.parte_di_menu IS NULL)
 		) + (
-			-- Menu fissi (calcolati dai loro ID distinti)
-			SELECT COALESCE(SUM(m.prezzo), 0)
+			-- Menu fissi (prezzo per numero di volte in cui il menu è stato ordinato)
+			SELECT COALESCE(SUM(m.prezzo * menu_ids.quantita), 0)
 			FROM (
-				SELECT DISTINCT id_menu 
-				FROM dettaglio_ordine_pietanza 
-				WHERE id_ordine = o.id_ordine AND parte_di_menu = true AND id_menu IS NOT NULL
+				SELECT id_menu, MAX(quantita) AS quantita
+				FROM (
+					-- Una pietanza può essere su più righe, una per versione della ricetta
+					SELECT id_menu, id_pietanza, SUM(quantita) AS quantita
+					FROM dettaglio_ordine_pietanza
+					WHERE id_ordine = o.id_ordine AND parte_di_menu = true AND id_menu IS NOT NULL
+					GROUP BY id_menu, id_pietanza
+				) AS pietanze_menu
+				GROUP BY id_menu
 			) AS menu_ids
 			JOIN menu_fisso m ON menu_ids.id_menu = m.id_menu
 		)
@@ -121,7 +312,7 @@ func (r *OrdineRepository) AggiornaCostoTotale(ctx context.Context, tx pgx.Tx, i
 // CalcolaScontrino calcola lo scontrino per l'ordine di un tavolo
 // Prende l'ordine in stato "consegnato" associato al tavolo
 // Aggiunge il costo del coperto per ogni persona al costo totale
-// Non modifica lo stato dell'ordine (il pagamento verrà gestito separatamente)
+// Non modifica lo stato dell'ordine (il pagamento è gestito da RegistraPagamento)
 func (r *OrdineRepository) CalcolaScontrino(ctx context.Context, idTavolo int) (*models.Scontrino, error) {
 	// Inizia una transazione
 	tx, err := r.DB.Begin(ctx)
@@ -131,62 +322,234 @@ func (r *OrdineRepository) CalcolaScontrino(ctx context.Context, idTavolo int) (
 	defer tx.Rollback(ctx)
 
 	// 1. Recupera l'ordine in stato "consegnato" per il tavolo specificato
+	ordine, err := ordineConsegnatoPerTavolo(ctx, tx, idTavolo, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Calcola lo scontrino dell'ordine
+	scontrino, err := calcolaScontrinoOrdine(ctx, tx, ordine)
+	if err != nil {
+		return nil, err
+	}
+
+	// Commit della transazione
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return scontrino, nil
+}
+
+// calcolaScontrinoOrdine calcola lo scontrino di un ordine già recuperato
+// applicando sconti e servizio al costo totale, aggiungendo il coperto per ogni persona
+// e scorporando l'IVA per aliquota
+func calcolaScontrinoOrdine(ctx context.Context, tx pgx.Tx, ordine models.Ordine) (*models.Scontrino, error) {
+	// 1. Recupera il costo del coperto dal ristorante
+	var costoCoperto models.Importo
+	err := tx.QueryRow(ctx, `
+		SELECT costo_coperto
+		FROM ristorante
+		WHERE id_ristorante = $1
+	`, ordine.IDRistorante).Scan(&costoCoperto)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Calcola l'importo totale del coperto
+	importoCoperto := costoCoperto.Per(ordine.NumPersone)
+
+	// 3. Calcola sconti e servizio applicati all'ordine
+	sconti, importoSconti, importoServizio, err := calcolaSconti(ctx, tx, ordine)
+	if err != nil {
+		return nil, err
+	}
+
+	// 4. Crea lo scontrino
+	scontrino := &models.Scontrino{
+		IDOrdine:        ordine.ID,
+		IDTavolo:        ordine.IDTavolo,
+		DataOrdine:      ordine.DataOrdine,
+		CostoTotale:     ordine.CostoTotale,
+		Sconti:          sconti,
+		ImportoSconti:   importoSconti,
+		ImportoServizio: importoServizio,
+		NumCoperti:      ordine.NumPersone,
+		CostoCoperto:    costoCoperto,
+		ImportoCoperto:  importoCoperto,
+	}
+	scontrino.TotaleComplessivo = scontrino.TotaleVoci() + importoCoperto
+
+	// 5. Calcola il riepilogo IVA per aliquota
+	if err = calcolaIVA(ctx, tx, scontrino); err != nil {
+		return nil, err
+	}
+	return scontrino, nil
+}
+
+// RegistraPagamento registra il pagamento del conto di un ordine in stato "consegnato"
+// In un'unica transazione:
+// - valida l'importo rispetto al totale dello scontrino (o della parte, se il conto è diviso)
+// - registra il pagamento (importo, metodo, mancia e resto); l'importo versato comprende la mancia
+// - quando il conto è saldato, porta l'ordine nello stato "pagato" e registra lo scontrino
+// - libera il tavolo se non ci sono altri ordini aperti
+func (r *OrdineRepository) RegistraPagamento(ctx context.Context, idOrdine int, p *models.Pagamento, attore string, tavoloRepo *TavoloRepository) (*models.EsitoPagamento, error) {
+	if !models.MetodoPagamentoValido(p.Metodo) {
+		return nil, ErrMetodoPagamentoNonValido
+	}
+	if p.Importo <= 0 || p.Mancia < 0 {
+		return nil, ErrImportoNonValido
+	}
+
+	// Inizia una transazione
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Recupera e blocca l'ordine
 	var ordine models.Ordine
 	err = tx.QueryRow(ctx, `
 		SELECT id_ordine, id_tavolo, num_persone, data_ordine, stato, id_ristorante, costo_totale
-		FROM ordine 
-		WHERE id_tavolo = $1 AND stato = 'consegnato'
-		ORDER BY data_ordine DESC
-		LIMIT 1
-	`, idTavolo).Scan(
+		FROM ordine
+		WHERE id_ordine = $1
+		FOR UPDATE
+	`, idOrdine).Scan(
 		&ordine.ID, &ordine.IDTavolo, &ordine.NumPersone, &ordine.DataOrdine,
 		&ordine.Stato, &ordine.IDRistorante, &ordine.CostoTotale,
 	)
 	if err != nil {
-		// Verifica se l'errore è dovuto all'assenza di righe
 		if err == pgx.ErrNoRows {
-			return nil, &models.ErrOrdineNonTrovato{
-				IDTavolo:        idTavolo,
-				StatoRichiesto:  "consegnato",
-				MessaggioErrore: "Nessun ordine in stato 'consegnato' trovato per il tavolo specificato",
-			}
+			return nil, ErrOrdineInesistente
+		}
+		return nil, err
+	}
+
+	if !models.TransizioneConsentita(ordine.Stato, models.StatoPagato) {
+		return nil, &models.ErrTransizioneStato{
+			IDOrdine:       ordine.ID,
+			StatoAttuale:   ordine.Stato,
+			StatoRichiesto: models.StatoPagato,
 		}
+	}
+
+	// 2. Calcola lo scontrino e valida l'importo
+	scontrino, err := calcolaScontrinoOrdine(ctx, tx, ordine)
+	if err != nil {
 		return nil, err
 	}
 
-	// 2. Recupera il costo del coperto dal ristorante
-	var costoCoperto float64
+	// Se il conto è diviso si paga una parte alla volta
+	var sottoconto *models.Sottoconto
+	totale := scontrino.TotaleComplessivo
+	if p.IDSottoconto != nil {
+		sottoconto, err = sottocontoPerPagamento(ctx, tx, ordine.ID, *p.IDSottoconto)
+		if err != nil {
+			return nil, err
+		}
+		totale = sottoconto.Totale
+	} else {
+		var contoDiviso bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM sottoconto WHERE id_ordine = $1)
+		`, ordine.ID).Scan(&contoDiviso)
+		if err != nil {
+			return nil, err
+		}
+		if contoDiviso {
+			return nil, ErrContoDiviso
+		}
+	}
+
+	// L'importo comprende la mancia: deve coprire il totale più la mancia
+	switch {
+	case p.Importo-totale-p.Mancia < 0:
+		return nil, ErrImportoInsufficiente
+	case p.Metodo == models.MetodoCarta && p.Importo != totale+p.Mancia:
+		// Con la carta viene addebitato esattamente il totale più la mancia
+		return nil, ErrImportoNonValido
+	case p.Metodo == models.MetodoContanti:
+		p.Resto = p.Importo - totale - p.Mancia
+	default:
+		// Un buono di valore superiore al conto non dà diritto a resto
+		p.Resto = 0
+	}
+
+	// 3. Registra il pagamento
 	err = tx.QueryRow(ctx, `
-		SELECT costo_coperto
-		FROM ristorante
-		WHERE id_ristorante = $1
-	`, ordine.IDRistorante).Scan(&costoCoperto)
+		INSERT INTO pagamento (id_ordine, id_sottoconto, importo, metodo, mancia, resto)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id_pagamento, id_ordine, data_pagamento
+	`, ordine.ID, p.IDSottoconto, p.Importo, p.Metodo, p.Mancia, p.Resto).Scan(&p.ID, &p.IDOrdine, &p.DataPagamento)
 	if err != nil {
 		return nil, err
 	}
 
-	// 3. Calcola l'importo totale del coperto
-	importoCoperto := costoCoperto * float64(ordine.NumPersone)
-	totaleComplessivo := ordine.CostoTotale + importoCoperto
+	if sottoconto != nil {
+		_, err = tx.Exec(ctx, `UPDATE sottoconto SET pagato = true WHERE id_sottoconto = $1`, sottoconto.ID)
+		if err != nil {
+			return nil, err
+		}
+		sottoconto.Pagato = true
 
-	// 4. Crea lo scontrino
-	scontrino := &models.Scontrino{
-		IDOrdine:          ordine.ID,
-		IDTavolo:          ordine.IDTavolo,
-		DataOrdine:        ordine.DataOrdine,
-		CostoTotale:       ordine.CostoTotale,
-		NumCoperti:        ordine.NumPersone,
-		CostoCoperto:      costoCoperto,
-		ImportoCoperto:    importoCoperto,
-		TotaleComplessivo: totaleComplessivo,
+		// L'ordine resta aperto finché tutte le parti non sono pagate
+		var partiDaPagare bool
+		err = tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM sottoconto WHERE id_ordine = $1 AND pagato = false)
+		`, ordine.ID).Scan(&partiDaPagare)
+		if err != nil {
+			return nil, err
+		}
+		if partiDaPagare {
+			if err = tx.Commit(ctx); err != nil {
+				return nil, err
+			}
+			return &models.EsitoPagamento{
+				Pagamento:  *p,
+				Scontrino:  *scontrino,
+				Sottoconto: sottoconto,
+				Ordine:     ordine,
+			}, nil
+		}
+	}
+
+	// 4. Chiude l'ordine e registra lo scontrino su cui è stato pagato
+	ordine, err = r.cambiaStato(ctx, tx, ordine.ID, models.StatoPagato, attore)
+	if err != nil {
+		return nil, err
+	}
+	if err = registraScontrino(ctx, tx, scontrino); err != nil {
+		return nil, err
+	}
+
+	// 5. Libera il tavolo se non ci sono altri ordini ancora aperti
+	var altriOrdiniAperti bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM ordine
+			WHERE id_tavolo = $1 AND id_ordine != $2 AND stato NOT IN ('pagato', 'annullato')
+		)
+	`, ordine.IDTavolo, ordine.ID).Scan(&altriOrdiniAperti)
+	if err != nil {
+		return nil, err
+	}
+	if !altriOrdiniAperti {
+		if _, err = tavoloRepo.CambiaStatoTx(ctx, tx, ordine.IDTavolo, "libero"); err != nil {
+			return nil, err
+		}
 	}
 
-	// Commit della transazione
 	if err = tx.Commit(ctx); err != nil {
 		return nil, err
 	}
 
-	return scontrino, nil
+	return &models.EsitoPagamento{
+		Pagamento:  *p,
+		Scontrino:  *scontrino,
+		Sottoconto: sottoconto,
+		Ordine:     ordine,
+	}, nil
 }
 
 // GetOrdineCompleto recupera un ordine per ID inclusi tutti i dettagli
@@ -202,8 +565,8 @@ func (r *OrdineRepository) GetOrdineCompleto(ctx context.Context, id int) (*mode
 	rows, err := r.DB.Query(ctx, `
 		SELECT 
 			d.id_dettaglio, d.id_ordine, d.id_pietanza, d.quantita, 
-			d.parte_di_menu, d.id_menu,
-			p.id_pietanza, p.nome, p.prezzo, p.id_categoria, p.disponibile
+			d.parte_di_menu, d.id_menu, d.id_ricetta,
+			p.id_pietanza, p.nome, d.prezzo_unitario, p.id_categoria, p.disponibile
 		FROM dettaglio_ordine_pietanza d
 		JOIN pietanza p ON d.id_pietanza = p.id_pietanza
 		WHERE d.id_ordine = $1
@@ -222,7 +585,7 @@ func (r *OrdineRepository) GetOrdineCompleto(ctx context.Context, id int) (*mode
 		var idMenu *int
 		err := rows.Scan(
 			&dettaglio.ID, &dettaglio.IDOrdine, &dettaglio.Pietanza.ID, &dettaglio.Quantita,
-			&dettaglio.ParteDiMenu, &idMenu,
+			&dettaglio.ParteDiMenu, &idMenu, &dettaglio.IDRicetta,
 			&dettaglio.Pietanza.ID, &dettaglio.Pietanza.Nome, &dettaglio.Pietanza.Prezzo,
 			&dettaglio.Pietanza.IDCategoria, &dettaglio.Pietanza.Disponibile,
 		)
@@ -276,10 +639,11 @@ func (r *OrdineRepository) GetOrdineCompleto(ctx context.Context, id int) (*mode
 	return ordineCompleto, nil
 }
 
-// GetAllOrdiniCompleti recupera tutti gli ordini con i dettagli completi
-func (r *OrdineRepository) GetAllOrdiniCompleti(ctx context.Context) ([]*models.OrdineCompleto, error) {
+// GetAllOrdiniCompleti recupera gli ordini aperti con i dettagli completi
+// del ristorante indicato o, con idRistorante 0, di tutti i ristoranti
+func (r *OrdineRepository) GetAllOrdiniCompleti(ctx context.Context, idRistorante int) ([]*models.OrdineCompleto, error) {
 	// 1. Recupera tutti gli ordini base
-	ordini, err := r.GetAll(ctx)
+	ordini, err := r.GetAll(ctx, idRistorante)
 	if err != nil {
 		return nil, err
 	}
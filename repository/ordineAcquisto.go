@@ -0,0 +1,440 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errori personalizzati
+var (
+	ErrOrdineAcquistoInesistente = errors.New("ordine di acquisto non trovato")
+	ErrStatoOrdineAcquisto       = errors.New("operazione non consentita nello stato dell'ordine di acquisto")
+	ErrRigaAcquistoInesistente   = errors.New("riga non trovata nell'ordine di acquisto")
+	ErrOrdineAcquistoVuoto       = errors.New("l'ordine di acquisto non contiene righe")
+)
+
+type OrdineAcquistoRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewOrdineAcquistoRepository(db *pgxpool.Pool) *OrdineAcquistoRepository {
+	return &OrdineAcquistoRepository{DB: db}
+}
+
+// GetAll restituisce gli ordini di acquisto, dal più recente, filtrati per stato e fornitore se indicati
+func (r *OrdineAcquistoRepository) GetAll(ctx context.Context, stato string, idFornitore int) ([]models.OrdineAcquisto, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id_ordine_acquisto
+		FROM ordine_acquisto
+		WHERE ($1::text = '' OR stato = $1::text) AND ($2::int = 0 OR id_fornitore = $2::int)
+		ORDER BY data_creazione DESC, id_ordine_acquisto DESC
+	`, stato, idFornitore)
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ordini := []models.OrdineAcquisto{}
+	for _, id := range ids {
+		o, err := leggiOrdineAcquisto(ctx, r.DB, id)
+		if err != nil {
+			return nil, err
+		}
+		ordini = append(ordini, *o)
+	}
+	return ordini, nil
+}
+
+// GetByID restituisce un ordine di acquisto con le righe
+func (r *OrdineAcquistoRepository) GetByID(ctx context.Context, id int) (*models.OrdineAcquisto, error) {
+	return leggiOrdineAcquisto(ctx, r.DB, id)
+}
+
+// GeneraDaRiordino crea le bozze degli ordini di acquisto, una per fornitore, per gli ingredienti sotto soglia
+// Ogni ingrediente è ordinato al fornitore più economico (a parità di prezzo, il più rapido) nella quantità
+// che riporta le scorte al doppio della soglia di riordino, tenendo conto di quanto già ordinato e non ricevuto.
+// Se il fornitore ha già una bozza le quantità vengono aggiunte alle sue righe; l'ordine minimo vale per la riga
+// risultante, così una riga che già lo rispetta non viene gonfiata rigenerando il riordino
+func (r *OrdineAcquistoRepository) GeneraDaRiordino(ctx context.Context) (*models.RiordinoGenerato, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Ingredienti sotto soglia con il fornitore scelto e le quantità già in arrivo
+	rows, err := tx.Query(ctx, `
+		SELECT i.id_ingrediente, i.nome, i.quantita_disponibile, i.unita_misura, i.soglia_riordino, i.costo_unitario,
+		       COALESCE((
+		         SELECT SUM(GREATEST(r.quantita_ordinata - r.quantita_ricevuta, 0))
+		         FROM ordine_acquisto_riga r
+		         JOIN ordine_acquisto o ON r.id_ordine_acquisto = o.id_ordine_acquisto
+		         WHERE r.id_ingrediente = i.id_ingrediente AND o.stato <> $1
+		       ), 0),
+		       f.id_fornitore, f.prezzo, f.ordine_minimo
+		FROM ingrediente i
+		LEFT JOIN LATERAL (
+		  SELECT fi.id_fornitore, fi.prezzo, fi.ordine_minimo
+		  FROM fornitore_ingrediente fi
+		  WHERE fi.id_ingrediente = i.id_ingrediente
+		  ORDER BY fi.prezzo, fi.giorni_consegna, fi.id_fornitore
+		  LIMIT 1
+		) f ON true
+		WHERE i.quantita_disponibile < i.soglia_riordino
+		ORDER BY i.id_ingrediente
+	`, models.AcquistoRicevuto)
+	if err != nil {
+		return nil, err
+	}
+
+	type daOrdinare struct {
+		idIngrediente int
+		quantita      float64
+		ordineMinimo  float64
+		prezzo        models.Importo
+	}
+	perFornitore := make(map[int][]daOrdinare)
+	var fornitori []int
+	risultato := &models.RiordinoGenerato{Ordini: []models.OrdineAcquisto{}, SenzaFornitore: []models.Ingrediente{}}
+	for rows.Next() {
+		var i models.Ingrediente
+		var inArrivo float64
+		var idFornitore *int
+		var prezzo *models.Importo
+		var ordineMinimo *float64
+		if err := rows.Scan(&i.ID, &i.Nome, &i.QuantitaDisponibile, &i.UnitaMisura, &i.SogliaRiordino, &i.CostoUnitario,
+			&inArrivo, &idFornitore, &prezzo, &ordineMinimo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if idFornitore == nil {
+			risultato.SenzaFornitore = append(risultato.SenzaFornitore, i)
+			continue
+		}
+
+		quantita := 2*i.SogliaRiordino - i.QuantitaDisponibile - inArrivo
+		if quantita <= 0 {
+			continue
+		}
+		if _, ok := perFornitore[*idFornitore]; !ok {
+			fornitori = append(fornitori, *idFornitore)
+		}
+		perFornitore[*idFornitore] = append(perFornitore[*idFornitore], daOrdinare{i.ID, quantita, *ordineMinimo, *prezzo})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 2. Una bozza per fornitore
+	for _, idFornitore := range fornitori {
+		var idOrdine int
+		err := tx.QueryRow(ctx, `
+			SELECT id_ordine_acquisto FROM ordine_acquisto
+			WHERE id_fornitore = $1 AND stato = $2
+			ORDER BY id_ordine_acquisto
+			LIMIT 1
+			FOR UPDATE
+		`, idFornitore, models.AcquistoBozza).Scan(&idOrdine)
+		if err == pgx.ErrNoRows {
+			err = tx.QueryRow(ctx, `
+				INSERT INTO ordine_acquisto (id_fornitore) VALUES ($1) RETURNING id_ordine_acquisto
+			`, idFornitore).Scan(&idOrdine)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range perFornitore[idFornitore] {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO ordine_acquisto_riga (id_ordine_acquisto, id_ingrediente, quantita_ordinata, prezzo_unitario)
+				VALUES ($1, $2, GREATEST($3::float, $5::float), $4)
+				ON CONFLICT (id_ordine_acquisto, id_ingrediente)
+				DO UPDATE SET quantita_ordinata = GREATEST(ordine_acquisto_riga.quantita_ordinata + $3::float, $5::float),
+				              prezzo_unitario = EXCLUDED.prezzo_unitario
+			`, idOrdine, d.idIngrediente, d.quantita, d.prezzo, d.ordineMinimo)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		ordine, err := leggiOrdineAcquisto(ctx, tx, idOrdine)
+		if err != nil {
+			return nil, err
+		}
+		risultato.Ordini = append(risultato.Ordini, *ordine)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return risultato, nil
+}
+
+// ModificaRiga imposta la quantità ordinata di una riga in bozza; con quantità zero la riga viene eliminata
+func (r *OrdineAcquistoRepository) ModificaRiga(ctx context.Context, id int, idRiga int, quantita float64) (*models.OrdineAcquisto, error) {
+	if quantita < 0 {
+		return nil, ErrQuantitaMovimentoNonValida
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := bloccaOrdineAcquisto(ctx, tx, id, models.AcquistoBozza); err != nil {
+		return nil, err
+	}
+
+	var tag pgconn.CommandTag
+	if quantita == 0 {
+		tag, err = tx.Exec(ctx, `
+			DELETE FROM ordine_acquisto_riga WHERE id_riga = $1 AND id_ordine_acquisto = $2
+		`, idRiga, id)
+	} else {
+		tag, err = tx.Exec(ctx, `
+			UPDATE ordine_acquisto_riga SET quantita_ordinata = $1 WHERE id_riga = $2 AND id_ordine_acquisto = $3
+		`, quantita, idRiga, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrRigaAcquistoInesistente
+	}
+
+	ordine, err := leggiOrdineAcquisto(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ordine, nil
+}
+
+// Invia segna la bozza come inviata al fornitore e calcola la consegna prevista
+// in base ai giorni di consegna più lunghi tra gli ingredienti ordinati
+func (r *OrdineAcquistoRepository) Invia(ctx context.Context, id int) (*models.OrdineAcquisto, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := bloccaOrdineAcquisto(ctx, tx, id, models.AcquistoBozza); err != nil {
+		return nil, err
+	}
+
+	tag, err := tx.Exec(ctx, `
+		UPDATE ordine_acquisto o
+		SET stato = $1, data_invio = CURRENT_TIMESTAMP,
+		    consegna_prevista = CURRENT_DATE + COALESCE((
+		      SELECT MAX(fi.giorni_consegna)
+		      FROM ordine_acquisto_riga r
+		      JOIN fornitore_ingrediente fi ON fi.id_fornitore = o.id_fornitore AND fi.id_ingrediente = r.id_ingrediente
+		      WHERE r.id_ordine_acquisto = o.id_ordine_acquisto
+		    ), 0)
+		WHERE o.id_ordine_acquisto = $2
+		  AND EXISTS (SELECT 1 FROM ordine_acquisto_riga WHERE id_ordine_acquisto = $2)
+	`, models.AcquistoInviato, id)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrOrdineAcquistoVuoto
+	}
+
+	ordine, err := leggiOrdineAcquisto(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return ordine, nil
+}
+
+// Ricevi registra la merce arrivata per un ordine inviato: ogni quantità ricevuta viene caricata in magazzino
+// Senza righe viene ricevuto tutto il residuo; l'ordine diventa ricevuto quando ogni riga è completa
+func (r *OrdineAcquistoRepository) Ricevi(ctx context.Context, id int, ricezioni []models.RicezioneRiga, ingredienteCache *cache.IngredienteCache) (*models.OrdineAcquisto, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Blocca l'ordine, che deve essere inviato o ricevuto in parte
+	if _, err := bloccaOrdineAcquisto(ctx, tx, id, models.AcquistoInviato, models.AcquistoRicevutoParzialmente); err != nil {
+		return nil, err
+	}
+	ordine, err := leggiOrdineAcquisto(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	righe := make(map[int]models.RigaOrdineAcquisto)
+	for _, riga := range ordine.Righe {
+		righe[riga.ID] = riga
+	}
+
+	// 2. Senza indicazioni si riceve il residuo di ogni riga
+	if len(ricezioni) == 0 {
+		for _, riga := range ordine.Righe {
+			if residuo := riga.QuantitaOrdinata - riga.QuantitaRicevuta; residuo > 0 {
+				ricezioni = append(ricezioni, models.RicezioneRiga{IDRiga: riga.ID, Quantita: residuo})
+			}
+		}
+	}
+
+	// 3. Carica in magazzino ogni quantità ricevuta
+	caricati := make(map[int]float64)
+	for _, ricezione := range ricezioni {
+		riga, ok := righe[ricezione.IDRiga]
+		if !ok {
+			return nil, fmt.Errorf("%w: %d", ErrRigaAcquistoInesistente, ricezione.IDRiga)
+		}
+		lotto := models.DatiLotto{CodiceLotto: ricezione.CodiceLotto, DataScadenza: ricezione.DataScadenza}
+		if _, err := rifornisci(ctx, tx, riga.IDIngrediente, ricezione.Quantita, fmt.Sprintf("ordine di acquisto %d", id), lotto); err != nil {
+			return nil, err
+		}
+		_, err := tx.Exec(ctx, `
+			UPDATE ordine_acquisto_riga SET quantita_ricevuta = quantita_ricevuta + $1 WHERE id_riga = $2
+		`, ricezione.Quantita, riga.ID)
+		if err != nil {
+			return nil, err
+		}
+		caricati[riga.IDIngrediente] += ricezione.Quantita
+	}
+
+	// 4. Aggiorna lo stato in base alle quantità ricevute
+	_, err = tx.Exec(ctx, `
+		UPDATE ordine_acquisto o
+		SET stato = CASE WHEN completo THEN $1 ELSE $2 END,
+		    data_ricezione = CASE WHEN completo THEN CURRENT_TIMESTAMP END
+		FROM (
+		  SELECT bool_and(quantita_ricevuta >= quantita_ordinata) AS completo
+		  FROM ordine_acquisto_riga
+		  WHERE id_ordine_acquisto = $3
+		) r
+		WHERE o.id_ordine_acquisto = $3
+	`, models.AcquistoRicevuto, models.AcquistoRicevutoParzialmente, id)
+	if err != nil {
+		return nil, err
+	}
+
+	ordine, err = leggiOrdineAcquisto(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	InvalidaCacheIngredienti(ctx, ingredienteCache, caricati)
+	return ordine, nil
+}
+
+// Delete elimina un ordine di acquisto ancora in bozza
+func (r *OrdineAcquistoRepository) Delete(ctx context.Context, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := bloccaOrdineAcquisto(ctx, tx, id, models.AcquistoBozza); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM ordine_acquisto WHERE id_ordine_acquisto = $1`, id); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// bloccaOrdineAcquisto blocca l'ordine di acquisto e verifica che sia in uno degli stati indicati
+func bloccaOrdineAcquisto(ctx context.Context, tx pgx.Tx, id int, stati ...string) (string, error) {
+	var stato string
+	err := tx.QueryRow(ctx, `
+		SELECT stato FROM ordine_acquisto WHERE id_ordine_acquisto = $1 FOR UPDATE
+	`, id).Scan(&stato)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return "", ErrOrdineAcquistoInesistente
+		}
+		return "", err
+	}
+	for _, s := range stati {
+		if stato == s {
+			return stato, nil
+		}
+	}
+	return stato, fmt.Errorf("%w (%s)", ErrStatoOrdineAcquisto, stato)
+}
+
+// leggiOrdineAcquisto legge un ordine di acquisto con fornitore, righe e totale
+func leggiOrdineAcquisto(ctx context.Context, db dbtx, id int) (*models.OrdineAcquisto, error) {
+	o := &models.OrdineAcquisto{ID: id}
+	err := db.QueryRow(ctx, `
+		SELECT o.id_fornitore, f.nome, o.stato, COALESCE(o.note, ''), o.data_creazione,
+		       o.data_invio, o.consegna_prevista, o.data_ricezione
+		FROM ordine_acquisto o
+		JOIN fornitore f ON o.id_fornitore = f.id_fornitore
+		WHERE o.id_ordine_acquisto = $1
+	`, id).Scan(&o.IDFornitore, &o.Fornitore, &o.Stato, &o.Note, &o.DataCreazione,
+		&o.DataInvio, &o.ConsegnaPrevista, &o.DataRicezione)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrOrdineAcquistoInesistente
+		}
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT r.id_riga, r.id_ingrediente, i.nome, i.unita_misura,
+		       r.quantita_ordinata, r.quantita_ricevuta, r.prezzo_unitario
+		FROM ordine_acquisto_riga r
+		JOIN ingrediente i ON r.id_ingrediente = i.id_ingrediente
+		WHERE r.id_ordine_acquisto = $1
+		ORDER BY i.nome
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	o.Righe = []models.RigaOrdineAcquisto{}
+	for rows.Next() {
+		var riga models.RigaOrdineAcquisto
+		if err := rows.Scan(&riga.ID, &riga.IDIngrediente, &riga.Nome, &riga.UnitaMisura,
+			&riga.QuantitaOrdinata, &riga.QuantitaRicevuta, &riga.PrezzoUnitario); err != nil {
+			return nil, err
+		}
+		o.Righe = append(o.Righe, riga)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	o.CalcolaTotale()
+	return o, nil
+}
@@ -6,11 +6,13 @@ import (
 	"ristorante-api/cache"
 	"ristorante-api/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // Errori personalizzati
 var (
+	ErrPietanzaInesistente      = errors.New("pietanza non trovata")
 	ErrPietanzaNonDisponibile   = errors.New("la pietanza non è disponibile")
 	ErrIngredientiInsufficienti = errors.New("ingredienti insufficienti per preparare la pietanza")
 	ErrMenuNonDisponibile       = errors.New("il menu non è disponibile: una o più pietanze non sono disponibili o mancano ingredienti")
@@ -27,7 +29,7 @@ func NewPietanzaRepository(db *pgxpool.Pool) *PietanzaRepository {
 // GetAll restituisce tutte le pietanze disponibili
 func (r *PietanzaRepository) GetAll(ctx context.Context) ([]models.Pietanza, error) {
 	rows, err := r.DB.Query(ctx, `
-		SELECT p.id_pietanza, p.nome, p.prezzo, p.id_categoria, p.disponibile
+		SELECT p.id_pietanza, p.nome, p.prezzo, p.id_categoria, p.aliquota_iva, p.disponibile, p.esaurita
 		FROM pietanza p
 	`)
 	if err != nil {
@@ -38,7 +40,7 @@ func (r *PietanzaRepository) GetAll(ctx context.Context) ([]models.Pietanza, err
 	var pietanze []models.Pietanza
 	for rows.Next() {
 		var p models.Pietanza
-		err := rows.Scan(&p.ID, &p.Nome, &p.Prezzo, &p.IDCategoria, &p.Disponibile)
+		err := rows.Scan(&p.ID, &p.Nome, &p.Prezzo, &p.IDCategoria, &p.AliquotaIVA, &p.Disponibile, &p.Esaurita)
 		if err != nil {
 			return nil, err
 		}
@@ -56,10 +58,10 @@ func (r *PietanzaRepository) GetAll(ctx context.Context) ([]models.Pietanza, err
 func (r *PietanzaRepository) GetByID(ctx context.Context, id int) (*models.Pietanza, error) {
 	var p models.Pietanza
 	err := r.DB.QueryRow(ctx, `
-		SELECT p.id_pietanza, p.nome, p.prezzo, p.id_categoria, p.disponibile
+		SELECT p.id_pietanza, p.nome, p.prezzo, p.id_categoria, p.aliquota_iva, p.disponibile, p.esaurita
 		FROM pietanza p
 		WHERE p.id_pietanza = $1
-	`, id).Scan(&p.ID, &p.Nome, &p.Prezzo, &p.IDCategoria, &p.Disponibile)
+	`, id).Scan(&p.ID, &p.Nome, &p.Prezzo, &p.IDCategoria, &p.AliquotaIVA, &p.Disponibile, &p.Esaurita)
 
 	if err != nil {
 		return nil, err
@@ -71,19 +73,20 @@ func (r *PietanzaRepository) GetByID(ctx context.Context, id int) (*models.Pieta
 // Create crea una nuova pietanza e restituisce l'ID generato
 func (r *PietanzaRepository) Create(ctx context.Context, p *models.Pietanza) error {
 	return r.DB.QueryRow(ctx, `
-		INSERT INTO pietanza (nome, prezzo, id_categoria, disponibile)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO pietanza (nome, prezzo, id_categoria, aliquota_iva, disponibile)
+		VALUES ($1, $2, $3, $4, $5)
 		RETURNING id_pietanza
-	`, p.Nome, p.Prezzo, p.IDCategoria, p.Disponibile).Scan(&p.ID)
+	`, p.Nome, p.Prezzo, p.IDCategoria, p.AliquotaIVA, p.Disponibile).Scan(&p.ID)
 }
 
 // Update aggiorna una pietanza esistente
+// La disponibilità impostata a mano prevale su quella automatica fino al successivo movimento di magazzino
 func (r *PietanzaRepository) Update(ctx context.Context, p *models.Pietanza) error {
 	_, err := r.DB.Exec(ctx, `
 		UPDATE pietanza
-		SET nome = $1, prezzo = $2, id_categoria = $3, disponibile = $4
-		WHERE id_pietanza = $5
-	`, p.Nome, p.Prezzo, p.IDCategoria, p.Disponibile, p.ID)
+		SET nome = $1, prezzo = $2, id_categoria = $3, aliquota_iva = $4, disponibile = $5, esaurita = false
+		WHERE id_pietanza = $6
+	`, p.Nome, p.Prezzo, p.IDCategoria, p.AliquotaIVA, p.Disponibile, p.ID)
 
 	return err
 }
@@ -102,8 +105,9 @@ func (r *PietanzaRepository) Exists(ctx context.Context, id int) (bool, error) {
 }
 
 // AddPietanzaToOrdine aggiunge una pietanza a un ordine esistente
-// Verifica che la pietanza sia disponibile e che ci siano ingredienti sufficienti
-// Restituisce un errore se la pietanza non è disponibile o se mancano ingredienti
+// Verifica che la pietanza sia nel menu del ristorante dell'ordine, che sia disponibile e che ci siano ingredienti sufficienti
+// Restituisce ErrPietanzaNonInMenu se il ristorante non la propone, ErrPietanzaNonDisponibile se la pietanza
+// non è disponibile o un *ErrIngredientiMancanti se mancano ingredienti
 func (r *PietanzaRepository) AddPietanzaToOrdine(ctx context.Context, idOrdine int, idPietanza int, quantita int, ricettaRepo *RicettaRepository, ingredienteCache *cache.IngredienteCache) error {
 	// Inizia una transazione
 	tx, err := r.DB.Begin(ctx)
@@ -113,70 +117,70 @@ func (r *PietanzaRepository) AddPietanzaToOrdine(ctx context.Context, idOrdine i
 	// Rollback in caso di errore
 	defer tx.Rollback(ctx)
 
-	// 1. Verifica che la pietanza sia disponibile
-	var disponibile bool
-	err = tx.QueryRow(ctx, `
-		SELECT disponibile
-		FROM pietanza
-		WHERE id_pietanza = $1
-	`, idPietanza).Scan(&disponibile)
-
+	// 1. Verifica che la pietanza sia nel menu del ristorante e disponibile e ne legge il prezzo
+	disponibile, inMenu, prezzo, err := pietanzaNelMenu(ctx, tx, idOrdine, idPietanza)
 	if err != nil {
 		return err
 	}
 
+	if !inMenu {
+		return ErrPietanzaNonInMenu
+	}
 	if !disponibile {
 		return ErrPietanzaNonDisponibile
 	}
 
-	// 2. Recupera la ricetta associata alla pietanza
-	ricetta, err := ricettaRepo.GetByPietanzaID(ctx, idPietanza)
+	// 2. Legge e blocca la versione attiva della ricetta associata alla pietanza
+	idRicetta, err := ricettaAttivaPerOrdine(ctx, tx, idPietanza)
 	if err != nil {
 		return err
 	}
 
-	// 3. Verifica la disponibilità degli ingredienti utilizzando la cache
-	disponibilitaIngredienti, ingredientiNecessari, err := ricettaRepo.VerificaDisponibilitaIngredienti(ctx, ricetta.ID, quantita, ingredienteCache)
+	// 3. Calcola gli ingredienti necessari
+	ingredientiNecessari, err := ricettaRepo.IngredientiNecessari(ctx, tx, idRicetta, quantita)
 	if err != nil {
 		return err
 	}
 
-	if !disponibilitaIngredienti {
-		return ErrIngredientiInsufficienti
-	}
-
-	// 4. Aggiunge la pietanza all'ordine
+	// 4. Aggiunge la pietanza all'ordine con il prezzo attuale e la versione della ricetta usata
 	_, err = tx.Exec(ctx, `
-		INSERT INTO dettaglio_ordine_pietanza (id_ordine, id_pietanza, quantita, parte_di_menu, id_menu)
-		VALUES ($1, $2, $3, false, 0)
-		ON CONFLICT (id_ordine, id_pietanza, parte_di_menu, id_menu)
+		INSERT INTO dettaglio_ordine_pietanza (id_ordine, id_pietanza, quantita, parte_di_menu, id_menu, id_ricetta, prezzo_unitario)
+		VALUES ($1, $2, $3, false, 0, $4, $5)
+		ON CONFLICT (id_ordine, id_pietanza, id_menu, prezzo_unitario, id_ricetta) WHERE NOT parte_di_menu
 		DO UPDATE SET quantita = dettaglio_ordine_pietanza.quantita + EXCLUDED.quantita
-	`, idOrdine, idPietanza, quantita)
+	`, idOrdine, idPietanza, quantita, idRicetta, prezzo)
 
 	if err != nil {
 		return err
 	}
 
-	// 5. Aggiorna gli ingredienti e invalida la cache
-	err = ricettaRepo.AggiornaIngredienti(ctx, tx, ingredientiNecessari, ingredienteCache)
+	// 5. Verifica e scala gli ingredienti sotto lock di riga
+	err = ricettaRepo.AggiornaIngredienti(ctx, tx, idOrdine, ingredientiNecessari)
 	if err != nil {
 		return err
 	}
 
 	// 6. Aggiorna il costo totale dell'ordine
 	ordineRepo := OrdineRepository{DB: r.DB}
-	err = ordineRepo.AggiornaCostoTotale(ctx, tx, idOrdine, nil)
+	err = ordineRepo.AggiornaCostoTotale(ctx, tx, idOrdine)
 	if err != nil {
 		return err
 	}
 
 	// Commit della transazione
-	return tx.Commit(ctx)
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	// 7. Invalida la cache degli ingredienti aggiornati
+	InvalidaCacheIngredienti(ctx, ingredienteCache, ingredientiNecessari)
+	return nil
 }
 
 // AddMenuFissoToOrdine aggiunge un menu fisso completo a un ordine
-// Verifica che tutte le pietanze del menu siano disponibili e che ci siano ingredienti sufficienti
-// Se una pietanza non è disponibile o mancano ingredienti, nessuna pietanza viene aggiunta
+// Verifica che tutte le pietanze del menu siano nel menu del ristorante dell'ordine, disponibili e che ci siano
+// ingredienti sufficienti. Se una pietanza non è nel menu del ristorante (ErrPietanzaNonInMenu), non è disponibile
+// (ErrMenuNonDisponibile) o mancano ingredienti (*ErrIngredientiMancanti), nessuna pietanza viene aggiunta
 func (r *PietanzaRepository) AddMenuFissoToOrdine(ctx context.Context, idOrdine int, idMenu int, ricettaRepo *RicettaRepository, menuRepo *MenuFissoRepository, ingredienteCache *cache.IngredienteCache) error {
 	// Inizia una transazione
 	tx, err := r.DB.Begin(ctx)
@@ -186,9 +190,8 @@ func (r *PietanzaRepository) AddMenuFissoToOrdine(ctx context.Context, idOrdine
 	// Rollback in caso di errore
 	defer tx.Rollback(ctx)
 
-	// 1. Recupera il menu fisso
-	menuFisso, err := menuRepo.GetByID(ctx, idMenu)
-	if err != nil {
+	// 1. Verifica che il menu fisso esista
+	if _, err := menuRepo.GetByID(ctx, idMenu); err != nil {
 		return err
 	}
 
@@ -203,84 +206,91 @@ func (r *PietanzaRepository) AddMenuFissoToOrdine(ctx context.Context, idOrdine
 		return errors.New("il menu fisso non contiene pietanze")
 	}
 
-	// 3. Verifica la disponibilità di tutte le pietanze e degli ingredienti
-	// Accumuliamo tutte le risorse necessarie prima di effettuare qualsiasi modifica
-	type pietanzaRisorse struct {
-		ricetta              *models.Ricetta
-		ingredientiNecessari map[int]float64
-	}
-
-	risorsePietanze := make(map[int]pietanzaRisorse)
+	// 3. Verifica la disponibilità di tutte le pietanze e somma gli ingredienti necessari
+	// (più pietanze del menu possono usare lo stesso ingrediente)
+	ingredientiNecessari := make(map[int]float64)
+	ricette := make(map[int]int)
+	prezzi := make(map[int]models.Importo)
 
 	for _, p := range pietanze {
-		// Verifica che la pietanza sia disponibile
-		var disponibile bool
-		err = tx.QueryRow(ctx, `
-			SELECT disponibile
-			FROM pietanza
-			WHERE id_pietanza = $1
-		`, p.ID).Scan(&disponibile)
-
+		// Verifica che la pietanza sia nel menu del ristorante e disponibile e ne legge il prezzo
+		disponibile, inMenu, prezzo, err := pietanzaNelMenu(ctx, tx, idOrdine, p.ID)
 		if err != nil {
 			return err
 		}
 
+		if !inMenu {
+			return ErrPietanzaNonInMenu
+		}
 		if !disponibile {
 			return ErrMenuNonDisponibile
 		}
+		prezzi[p.ID] = prezzo
 
-		// Recupera la ricetta associata alla pietanza
-		ricetta, err := ricettaRepo.GetByPietanzaID(ctx, p.ID)
+		// Legge e blocca la versione attiva della ricetta associata alla pietanza
+		idRicetta, err := ricettaAttivaPerOrdine(ctx, tx, p.ID)
 		if err != nil {
 			return err
 		}
+		ricette[p.ID] = idRicetta
 
-		// Verifica la disponibilità degli ingredienti (quantità = 1 per ogni pietanza nel menu)
-		// Utilizziamo la cache degli ingredienti per migliorare le performance
-		disponibilitaIngredienti, ingredientiNecessari, err := ricettaRepo.VerificaDisponibilitaIngredienti(ctx, ricetta.ID, 1, ingredienteCache)
+		// Ingredienti necessari (quantità = 1 per ogni pietanza nel menu)
+		necessari, err := ricettaRepo.IngredientiNecessari(ctx, tx, idRicetta, 1)
 		if err != nil {
 			return err
 		}
-
-		if !disponibilitaIngredienti {
-			return ErrMenuNonDisponibile
+		for idIngrediente, quantita := range necessari {
+			ingredientiNecessari[idIngrediente] += quantita
 		}
+	}
 
-		// Salva le risorse necessarie per questa pietanza
-		risorsePietanze[p.ID] = pietanzaRisorse{
-			ricetta:              ricetta,
-			ingredientiNecessari: ingredientiNecessari,
-		}
+	// 4. Verifica e scala gli ingredienti di tutto il menu sotto lock di riga
+	err = ricettaRepo.AggiornaIngredienti(ctx, tx, idOrdine, ingredientiNecessari)
+	if err != nil {
+		return err
 	}
 
-	// 5. Aggiungi tutte le pietanze che compongono il menu all'ordine
+	// 5. Aggiungi tutte le pietanze che compongono il menu all'ordine, con il prezzo attuale (che pesa
+	// nella ripartizione del prezzo del menu) e la versione della ricetta usata
 	for _, p := range pietanze {
 		_, err = tx.Exec(ctx, `
-			INSERT INTO dettaglio_ordine_pietanza (id_ordine, id_pietanza, quantita, parte_di_menu, id_menu)
-			VALUES ($1, $2, 1, true, $3)
-			ON CONFLICT (id_ordine, id_pietanza, parte_di_menu, id_menu) 
+			INSERT INTO dettaglio_ordine_pietanza (id_ordine, id_pietanza, quantita, parte_di_menu, id_menu, id_ricetta, prezzo_unitario)
+			VALUES ($1, $2, 1, true, $3, $4, $5)
+			ON CONFLICT (id_ordine, id_pietanza, id_menu, id_ricetta) WHERE parte_di_menu
 			DO UPDATE SET quantita = dettaglio_ordine_pietanza.quantita + 1
-		`, idOrdine, p.ID, idMenu)
-
-		if err != nil {
-			return err
-		}
+		`, idOrdine, p.ID, idMenu, ricette[p.ID], prezzi[p.ID])
 
-		// Aggiorna gli ingredienti per questa pietanza e invalida la cache
-		risorsa := risorsePietanze[p.ID]
-		err = ricettaRepo.AggiornaIngredienti(ctx, tx, risorsa.ingredientiNecessari, ingredienteCache)
 		if err != nil {
 			return err
 		}
 	}
 
-	// 6. Aggiorna il costo totale dell'ordine con il prezzo del menu fisso
+	// 6. Ricalcola il costo totale dell'ordine, compreso il prezzo del menu fisso
 	ordineRepo := OrdineRepository{DB: r.DB}
-	err = ordineRepo.AggiornaCostoTotale(ctx, tx, idOrdine, &menuFisso.Prezzo)
+	err = ordineRepo.AggiornaCostoTotale(ctx, tx, idOrdine)
 	if err != nil {
 		return err
 	}
 
 	// Commit della transazione
-	return tx.Commit(ctx)
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	// 7. Invalida la cache degli ingredienti aggiornati
+	InvalidaCacheIngredienti(ctx, ingredienteCache, ingredientiNecessari)
+	return nil
+}
+
+// pietanzaNelMenu indica se la pietanza è disponibile e nel menu del ristorante dell'ordine e ne restituisce
+// il prezzo applicato: quello del menu del ristorante, se personalizzato, altrimenti il prezzo di listino
+func pietanzaNelMenu(ctx context.Context, tx pgx.Tx, idOrdine int, idPietanza int) (disponibile bool, inMenu bool, prezzo models.Importo, err error) {
+	err = tx.QueryRow(ctx, `
+		SELECT p.disponibile, m.id_pietanza IS NOT NULL, COALESCE(m.prezzo, p.prezzo)
+		FROM pietanza p
+		LEFT JOIN ordine o ON o.id_ordine = $2
+		LEFT JOIN menu m ON m.id_ristorante = o.id_ristorante AND m.id_pietanza = p.id_pietanza
+		WHERE p.id_pietanza = $1
+	`, idPietanza, idOrdine).Scan(&disponibile, &inMenu, &prezzo)
+	return disponibile, inMenu, prezzo, err
 }
@@ -0,0 +1,228 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ristorante-api/models"
+	"sort"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errori personalizzati
+var (
+	ErrRistoranteInesistente = errors.New("ristorante non trovato")
+)
+
+type ReportRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewReportRepository(db *pgxpool.Pool) *ReportRepository {
+	return &ReportRepository{DB: db}
+}
+
+// Chiusura calcola la chiusura giornaliera di un ristorante per la data indicata (AAAA-MM-GG)
+// Considera gli ordini pagati in quella giornata, cioè passati allo stato "pagato" quel giorno
+// (per gli ordini senza storico si usa la data dell'ordine), e ne somma gli scontrini registrati
+// al pagamento, così che sconti, servizio, coperto e IVA coincidano con quanto riportato al cliente
+// anche se nel frattempo sono cambiati. Gli scontrini degli ordini pagati prima della loro
+// registrazione vengono ricalcolati
+func (r *ReportRepository) Chiusura(ctx context.Context, data string, idRistorante int) (*models.ReportChiusura, error) {
+	tx, err := r.DB.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var esiste bool
+	err = tx.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ristorante WHERE id_ristorante = $1)`, idRistorante).Scan(&esiste)
+	if err != nil {
+		return nil, err
+	}
+	if !esiste {
+		return nil, ErrRistoranteInesistente
+	}
+
+	report := &models.ReportChiusura{
+		Data:         data,
+		IDRistorante: idRistorante,
+		PerCategoria: []models.IncassoCategoria{},
+		PerMetodo:    []models.IncassoMetodo{},
+		IVA:          []models.RiepilogoIVA{},
+	}
+
+	// 1. Ordini pagati nella giornata
+	ordini, err := ordiniPagatiNelGiorno(ctx, tx, data, idRistorante)
+	if err != nil {
+		return nil, err
+	}
+	if len(ordini) == 0 {
+		return report, nil
+	}
+
+	// 2. Somma gli importi degli scontrini registrati, ricalcolando quelli mancanti
+	idOrdini := make([]int, len(ordini))
+	for i, ordine := range ordini {
+		idOrdini[i] = ordine.ID
+	}
+	scontrini, err := scontriniEmessi(ctx, tx, idOrdini)
+	if err != nil {
+		return nil, err
+	}
+
+	totalePerOrdine := make(map[int]models.Importo, len(ordini))
+	ivaPerAliquota := make(map[models.Percentuale]*models.RiepilogoIVA)
+	for _, ordine := range ordini {
+		scontrino, ok := scontrini[ordine.ID]
+		if !ok {
+			ricalcolato, err := calcolaScontrinoOrdine(ctx, tx, ordine)
+			if err != nil {
+				return nil, err
+			}
+			scontrino = &scontrinoEmesso{Scontrino: *ricalcolato}
+			if err := vociScontrino(ctx, tx, scontrino); err != nil {
+				return nil, err
+			}
+		}
+		totalePerOrdine[ordine.ID] = scontrino.TotaleComplessivo
+
+		report.NumCoperti += scontrino.NumCoperti
+		report.IncassoCoperto += scontrino.ImportoCoperto
+		report.ImportoAllaCarta += scontrino.ImportoAllaCarta
+		report.NumMenuFissi += scontrino.NumMenuFissi
+		report.ImportoMenuFissi += scontrino.ImportoMenuFissi
+		report.ImportoSconti += scontrino.ImportoSconti
+		report.ImportoServizio += scontrino.ImportoServizio
+		report.IncassoTotale += scontrino.TotaleComplessivo
+
+		for _, iva := range scontrino.IVA {
+			riepilogo, ok := ivaPerAliquota[iva.Aliquota]
+			if !ok {
+				riepilogo = &models.RiepilogoIVA{Aliquota: iva.Aliquota}
+				ivaPerAliquota[iva.Aliquota] = riepilogo
+			}
+			riepilogo.Imponibile += iva.Imponibile
+			riepilogo.Imposta += iva.Imposta
+			riepilogo.Totale += iva.Totale
+		}
+	}
+	report.NumOrdini = len(ordini)
+	report.ScontrinoMedio = report.IncassoTotale.Diviso(report.NumOrdini)
+
+	for _, riepilogo := range ivaPerAliquota {
+		report.IVA = append(report.IVA, *riepilogo)
+	}
+	sort.Slice(report.IVA, func(i, j int) bool { return report.IVA[i].Aliquota < report.IVA[j].Aliquota })
+
+	// 3. Pietanze alla carta per categoria
+	rows, err := tx.Query(ctx, `
+		SELECT c.id_categoria, COALESCE(c.nome, 'Senza categoria'), SUM(d.quantita), SUM(d.prezzo_unitario * d.quantita) AS importo
+		FROM dettaglio_ordine_pietanza d
+		JOIN pietanza p ON d.id_pietanza = p.id_pietanza
+		LEFT JOIN categoria_pietanza c ON p.id_categoria = c.id_categoria
+		WHERE d.id_ordine = ANY($1) AND d.parte_di_menu = false
+		GROUP BY c.id_categoria, c.nome
+		ORDER BY importo DESC, c.nome
+	`, idOrdini)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var c models.IncassoCategoria
+		if err := rows.Scan(&c.IDCategoria, &c.Categoria, &c.Quantita, &c.Importo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.PerCategoria = append(report.PerCategoria, c)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 4. Incassi per metodo di pagamento (al netto di resto e mance)
+	rows, err = tx.Query(ctx, `
+		SELECT metodo, COUNT(*), SUM(importo - resto - mancia), SUM(mancia)
+		FROM pagamento
+		WHERE id_ordine = ANY($1)
+		GROUP BY metodo
+		ORDER BY metodo
+	`, idOrdini)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var m models.IncassoMetodo
+		if err := rows.Scan(&m.Metodo, &m.NumPagamenti, &m.Importo, &m.Mance); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		report.PerMetodo = append(report.PerMetodo, m)
+		report.Mance += m.Mance
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Gli ordini chiusi senza un pagamento registrato sono riportati a parte
+	rows, err = tx.Query(ctx, `
+		SELECT u.id_ordine
+		FROM UNNEST($1::int[]) AS u(id_ordine)
+		WHERE NOT EXISTS (SELECT 1 FROM pagamento p WHERE p.id_ordine = u.id_ordine)
+	`, idOrdini)
+	if err != nil {
+		return nil, err
+	}
+	nonRegistrati := models.IncassoMetodo{Metodo: models.MetodoNonRegistrato}
+	for rows.Next() {
+		var idOrdine int
+		if err := rows.Scan(&idOrdine); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		nonRegistrati.NumPagamenti++
+		nonRegistrati.Importo += totalePerOrdine[idOrdine]
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if nonRegistrati.NumPagamenti > 0 {
+		report.PerMetodo = append(report.PerMetodo, nonRegistrati)
+	}
+
+	return report, nil
+}
+
+// ordiniPagatiNelGiorno restituisce gli ordini di un ristorante passati allo stato "pagato" nella data indicata
+func ordiniPagatiNelGiorno(ctx context.Context, tx pgx.Tx, data string, idRistorante int) ([]models.Ordine, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT o.id_ordine, o.id_tavolo, o.num_persone, o.data_ordine, o.stato, o.id_ristorante, o.costo_totale
+		FROM ordine o
+		WHERE o.id_ristorante = $1 AND o.stato = 'pagato'
+		  AND COALESCE(
+				(SELECT MAX(s.data_cambio) FROM storico_stato_ordine s
+				 WHERE s.id_ordine = o.id_ordine AND s.stato_nuovo = 'pagato'),
+				o.data_ordine
+			)::date = $2::date
+		ORDER BY o.id_ordine
+	`, idRistorante, data)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ordini []models.Ordine
+	for rows.Next() {
+		var o models.Ordine
+		err := rows.Scan(&o.ID, &o.IDTavolo, &o.NumPersone, &o.DataOrdine, &o.Stato, &o.IDRistorante, &o.CostoTotale)
+		if err != nil {
+			return nil, err
+		}
+		ordini = append(ordini, o)
+	}
+	return ordini, rows.Err()
+}
@@ -2,13 +2,38 @@ package repository
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"ristorante-api/cache"
 	"ristorante-api/models"
+	"ristorante-api/unita"
+	"strings"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Errori personalizzati
+var (
+	ErrRicettaInesistente       = errors.New("ricetta non trovata")
+	ErrRicettaEsistente         = errors.New("la pietanza ha già una ricetta: va modificata la versione attiva")
+	ErrRicettaNonAttiva         = errors.New("si può modificare o eliminare solo la versione attiva della ricetta")
+	ErrNomeRicetta              = errors.New("il nome della ricetta è obbligatorio")
+	ErrQuantitaRicettaNonValida = errors.New("la quantità dell'ingrediente nella ricetta deve essere positiva")
+	ErrIngredienteNonInRicetta  = errors.New("l'ingrediente non fa parte della ricetta")
+	ErrIngredienteRipetuto      = errors.New("un ingrediente compare più volte nella ricetta")
+)
+
+// colonneRicetta sono le colonne lette in una models.Ricetta da scansionaRicetta
+const colonneRicetta = `id_ricetta, nome, descrizione, id_pietanza, COALESCE(tempo_preparazione, 0), COALESCE(istruzioni, ''),
+	versione, attiva, data_creazione`
+
+// scansionaRicetta legge una riga con le colonne di colonneRicetta
+func scansionaRicetta(row pgx.Row, ricetta *models.Ricetta) error {
+	return row.Scan(&ricetta.ID, &ricetta.Nome, &ricetta.Descrizione, &ricetta.IDPietanza, &ricetta.TempoPreparazione,
+		&ricetta.Istruzioni, &ricetta.Versione, &ricetta.Attiva, &ricetta.DataCreazione)
+}
+
 type RicettaRepository struct {
 	DB    *pgxpool.Pool
 	Cache *cache.RicettaCache
@@ -21,7 +46,7 @@ func NewRicettaRepository(db *pgxpool.Pool, cache *cache.RicettaCache) *RicettaR
 	}
 }
 
-// GetByPietanzaID restituisce la ricetta associata a una pietanza
+// GetByPietanzaID restituisce la versione attiva della ricetta di una pietanza
 func (r *RicettaRepository) GetByPietanzaID(ctx context.Context, idPietanza int) (*models.Ricetta, error) {
 	// Controlla prima nella cache
 	if r.Cache != nil {
@@ -35,13 +60,16 @@ func (r *RicettaRepository) GetByPietanzaID(ctx context.Context, idPietanza int)
 
 	// Se non trovato in cache, recupera dal database
 	var ricetta models.Ricetta
-	err := r.DB.QueryRow(ctx, `
-		SELECT id_ricetta, nome, descrizione, id_pietanza, tempo_preparazione, istruzioni
+	err := scansionaRicetta(r.DB.QueryRow(ctx, `
+		SELECT `+colonneRicetta+`
 		FROM ricetta
-		WHERE id_pietanza = $1
-	`, idPietanza).Scan(&ricetta.ID, &ricetta.Nome, &ricetta.Descrizione, &ricetta.IDPietanza, &ricetta.TempoPreparazione, &ricetta.Istruzioni)
+		WHERE id_pietanza = $1 AND attiva
+	`, idPietanza), &ricetta)
 
 	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrRicettaInesistente
+		}
 		return nil, err
 	}
 
@@ -69,8 +97,9 @@ func (r *RicettaRepository) GetIngredientiByRicettaID(ctx context.Context, idRic
 
 	// Se non trovato in cache, recupera dal database
 	rows, err := r.DB.Query(ctx, `
-		SELECT ri.id_ricetta, ri.id_ingrediente, ri.quantita
+		SELECT ri.id_ricetta, ri.id_ingrediente, ri.quantita, COALESCE(ri.unita_misura, i.unita_misura)
 		FROM ricetta_ingrediente ri
+		JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
 		WHERE ri.id_ricetta = $1
 	`, idRicetta)
 	if err != nil {
@@ -81,7 +110,7 @@ func (r *RicettaRepository) GetIngredientiByRicettaID(ctx context.Context, idRic
 	var ingredienti []models.RicettaIngrediente
 	for rows.Next() {
 		var ri models.RicettaIngrediente
-		err := rows.Scan(&ri.IDRicetta, &ri.IDIngrediente, &ri.Quantita)
+		err := rows.Scan(&ri.IDRicetta, &ri.IDIngrediente, &ri.Quantita, &ri.UnitaMisura)
 		if err != nil {
 			return nil, err
 		}
@@ -102,95 +131,70 @@ func (r *RicettaRepository) GetIngredientiByRicettaID(ctx context.Context, idRic
 	return ingredienti, nil
 }
 
-// VerificaDisponibilitaIngredienti controlla se ci sono ingredienti sufficienti per preparare una pietanza
-func (r *RicettaRepository) VerificaDisponibilitaIngredienti(ctx context.Context, idRicetta int, quantitaPietanze int, ingredienteCache *cache.IngredienteCache) (bool, map[int]float64, error) {
-	// Recupera gli ingredienti necessari per la ricetta
-	ingredienti, err := r.GetIngredientiByRicettaID(ctx, idRicetta)
+// IngredientiNecessari restituisce le quantità di ingredienti necessarie per preparare
+// quantitaPietanze porzioni della ricetta, lette all'interno della transazione fornita
+// e convertite nell'unità di misura del magazzino
+func (r *RicettaRepository) IngredientiNecessari(ctx context.Context, tx pgx.Tx, idRicetta int, quantitaPietanze int) (map[int]float64, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT ri.id_ingrediente, ri.quantita, COALESCE(ri.unita_misura, i.unita_misura), i.unita_misura, i.peso_pezzo
+		FROM ricetta_ingrediente ri
+		JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
+		WHERE ri.id_ricetta = $1
+	`, idRicetta)
 	if err != nil {
-		return false, nil, err
+		return nil, err
 	}
+	return sommaIngredientiRicetta(rows, quantitaPietanze)
+}
 
-	// Verifica la disponibilità di ciascun ingrediente
-	disponibile := true
-	ingredientiNecessari := make(map[int]float64)
+// sommaIngredientiRicetta somma per ingrediente le quantità delle righe di ricetta lette
+// (id ingrediente, quantità, unità della ricetta, unità del magazzino, peso per pezzo),
+// convertite nell'unità del magazzino e moltiplicate per il numero di porzioni
+func sommaIngredientiRicetta(rows pgx.Rows, porzioni int) (map[int]float64, error) {
+	defer rows.Close()
 
-	for _, ingrediente := range ingredienti {
-		// Moltiplica per il numero di pietanze da preparare
-		quantitaNecessaria := ingrediente.Quantita * float64(quantitaPietanze)
-		ingredientiNecessari[ingrediente.IDIngrediente] = quantitaNecessaria
-
-		// Controlla se l'ingrediente è disponibile in quantità sufficiente - prima dalla cache
-		var quantitaDisponibile float64
-		var err error
-
-		if ingredienteCache != nil {
-			// Tenta di recuperare l'ingrediente dalla cache
-			cachedIngr, found, cacheErr := ingredienteCache.GetByID(ctx, ingrediente.IDIngrediente)
-			if cacheErr == nil && found {
-				quantitaDisponibile = cachedIngr.QuantitaDisponibile
-			} else {
-				// Se non trovato nella cache, recupera dal database
-				err = r.DB.QueryRow(ctx, `
-					SELECT quantita_disponibile 
-					FROM ingrediente 
-					WHERE id_ingrediente = $1
-				`, ingrediente.IDIngrediente).Scan(&quantitaDisponibile)
-			}
-		} else {
-			// Se non c'è cache, recupera direttamente dal database
-			err = r.DB.QueryRow(ctx, `
-				SELECT quantita_disponibile 
-				FROM ingrediente 
-				WHERE id_ingrediente = $1
-			`, ingrediente.IDIngrediente).Scan(&quantitaDisponibile)
+	ingredienti := make(map[int]float64)
+	for rows.Next() {
+		var idIngrediente int
+		var quantita, pesoPezzo float64
+		var unitaRicetta, unitaScorta string
+		if err := rows.Scan(&idIngrediente, &quantita, &unitaRicetta, &unitaScorta, &pesoPezzo); err != nil {
+			return nil, err
 		}
-
+		quantita, err := unita.Converti(quantita, unitaRicetta, unitaScorta, pesoPezzo)
 		if err != nil {
-			return false, nil, err
-		}
-
-		if quantitaDisponibile < quantitaNecessaria {
-			disponibile = false
-			break
+			return nil, err
 		}
+		// Moltiplica per il numero di pietanze da preparare
+		ingredienti[idIngrediente] += quantita * float64(porzioni)
 	}
-
-	return disponibile, ingredientiNecessari, nil
+	return ingredienti, rows.Err()
 }
 
-// AggiornaIngredienti aggiorna la quantità degli ingredienti disponibili dopo la preparazione di una pietanza
-// Viene eseguito all'interno di una transazione fornita
-// Invalida anche la cache degli ingredienti aggiornati
-func (r *RicettaRepository) AggiornaIngredienti(ctx context.Context, tx pgx.Tx, ingredientiNecessari map[int]float64, ingredienteCache *cache.IngredienteCache) error {
-	for idIngrediente, quantita := range ingredientiNecessari {
-		_, err := tx.Exec(ctx, `
-			UPDATE ingrediente
-			SET quantita_disponibile = quantita_disponibile - $1
-			WHERE id_ingrediente = $2
-		`, quantita, idIngrediente)
-		if err != nil {
-			return err
-		}
+// AggiornaIngredienti scala dal magazzino gli ingredienti necessari all'ordine, all'interno della transazione fornita
+// Le scorte sono verificate sotto lock di riga (vedi scalaIngredienti), quindi non possono scendere sotto zero;
+// se qualche ingrediente non basta restituisce un *ErrIngredientiMancanti con l'elenco completo
+func (r *RicettaRepository) AggiornaIngredienti(ctx context.Context, tx pgx.Tx, idOrdine int, ingredientiNecessari map[int]float64) error {
+	return scalaIngredienti(ctx, tx, idOrdine, ingredientiNecessari)
+}
 
-		// Invalida la cache per questo ingrediente
-		if ingredienteCache != nil {
-			if err := ingredienteCache.InvalidateByID(ctx, idIngrediente); err != nil {
-				// Log error but continue
-			}
-		}
+// InvalidaCacheIngredienti rimuove dalla cache gli ingredienti modificati, l'elenco completo
+// e quello degli ingredienti da riordinare; va chiamata dopo il commit della transazione
+func InvalidaCacheIngredienti(ctx context.Context, ingredienteCache *cache.IngredienteCache, ingredientiNecessari map[int]float64) {
+	if ingredienteCache == nil {
+		return
 	}
-
-	// Invalida anche la cache degli ingredienti da riordinare, poiché potrebbe essere cambiata
-	if ingredienteCache != nil {
-		if err := ingredienteCache.InvalidateDaRiordinare(ctx); err != nil {
-			// Log error but continue
-		}
-		if err := ingredienteCache.InvalidateAll(ctx); err != nil {
+	for idIngrediente := range ingredientiNecessari {
+		if err := ingredienteCache.InvalidateByID(ctx, idIngrediente); err != nil {
 			// Log error but continue
 		}
 	}
-
-	return nil
+	if err := ingredienteCache.InvalidateDaRiordinare(ctx); err != nil {
+		// Log error but continue
+	}
+	if err := ingredienteCache.InvalidateAll(ctx); err != nil {
+		// Log error but continue
+	}
 }
 
 // GetRicettaCompletaByPietanzaID restituisce la ricetta completa con ingredienti per una pietanza
@@ -203,8 +207,9 @@ func (r *RicettaRepository) GetRicettaCompletaByPietanzaID(ctx context.Context,
 
 	// 2. Recupera gli ingredienti associati alla ricetta
 	rows, err := r.DB.Query(ctx, `
-		SELECT ri.id_ricetta, ri.id_ingrediente, ri.quantita, 
-			i.id_ingrediente, i.nome, i.quantita_disponibile, i.unita_misura, i.soglia_riordino
+		SELECT ri.id_ricetta, ri.id_ingrediente, ri.quantita, COALESCE(ri.unita_misura, i.unita_misura),
+			i.id_ingrediente, i.nome, i.quantita_disponibile, i.unita_misura, i.soglia_riordino, i.costo_unitario, i.peso_pezzo,
+			i.allergeni, i.vegetariano, i.vegano
 		FROM ricetta_ingrediente ri
 		JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
 		WHERE ri.id_ricetta = $1
@@ -219,9 +224,10 @@ func (r *RicettaRepository) GetRicettaCompletaByPietanzaID(ctx context.Context,
 		var ing models.IngredienteConQuantita
 		var idRicetta, idIngrediente int
 		err := rows.Scan(
-			&idRicetta, &idIngrediente, &ing.Quantita,
+			&idRicetta, &idIngrediente, &ing.Quantita, &ing.UnitaMisura,
 			&ing.Ingrediente.ID, &ing.Ingrediente.Nome, &ing.Ingrediente.QuantitaDisponibile,
-			&ing.Ingrediente.UnitaMisura, &ing.Ingrediente.SogliaRiordino,
+			&ing.Ingrediente.UnitaMisura, &ing.Ingrediente.SogliaRiordino, &ing.Ingrediente.CostoUnitario,
+			&ing.Ingrediente.PesoPezzo, &ing.Ingrediente.Allergeni, &ing.Ingrediente.Vegetariano, &ing.Ingrediente.Vegano,
 		)
 		if err != nil {
 			return nil, err
@@ -240,3 +246,578 @@ func (r *RicettaRepository) GetRicettaCompletaByPietanzaID(ctx context.Context,
 
 	return ricettaCompleta, nil
 }
+
+// ProfiliAllergeni restituisce allergeni e diete compatibili delle pietanze con una ricetta attiva,
+// ricavati dagli ingredienti della ricetta completa; mancano le pietanze con allergeni non dichiarati
+func (r *RicettaRepository) ProfiliAllergeni(ctx context.Context) (map[int]*models.ProfiloAllergeni, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT r.id_ricetta, r.id_pietanza, i.id_ingrediente, COALESCE(i.nome, ''),
+		       i.allergeni, COALESCE(i.vegetariano, false), COALESCE(i.vegano, false)
+		FROM ricetta r
+		LEFT JOIN ricetta_ingrediente ri ON ri.id_ricetta = r.id_ricetta
+		LEFT JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
+		WHERE r.attiva
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ricette := make(map[int]*models.RicettaCompleta)
+	for rows.Next() {
+		var ricetta models.Ricetta
+		var idIngrediente *int
+		var ing models.Ingrediente
+		if err := rows.Scan(&ricetta.ID, &ricetta.IDPietanza, &idIngrediente, &ing.Nome,
+			&ing.Allergeni, &ing.Vegetariano, &ing.Vegano); err != nil {
+			return nil, err
+		}
+		rc, ok := ricette[ricetta.IDPietanza]
+		if !ok {
+			rc = &models.RicettaCompleta{Ricetta: ricetta}
+			ricette[ricetta.IDPietanza] = rc
+		}
+		// Una ricetta senza ingredienti ha una sola riga, senza ingrediente
+		if idIngrediente != nil {
+			ing.ID = *idIngrediente
+			rc.Ingredienti = append(rc.Ingredienti, models.IngredienteConQuantita{Ingrediente: ing})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Le pietanze con allergeni non noti restano senza profilo
+	profili := make(map[int]*models.ProfiloAllergeni, len(ricette))
+	for idPietanza, rc := range ricette {
+		if profilo := rc.Profilo(); profilo != nil {
+			profili[idPietanza] = profilo
+		}
+	}
+	return profili, nil
+}
+
+// GetAll restituisce le versioni attive delle ricette, una per pietanza
+func (r *RicettaRepository) GetAll(ctx context.Context) ([]models.Ricetta, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+colonneRicetta+`
+		FROM ricetta
+		WHERE attiva
+		ORDER BY nome, id_ricetta
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ricette := []models.Ricetta{}
+	for rows.Next() {
+		var ricetta models.Ricetta
+		if err := scansionaRicetta(rows, &ricetta); err != nil {
+			return nil, err
+		}
+		ricette = append(ricette, ricetta)
+	}
+	return ricette, rows.Err()
+}
+
+// GetByID restituisce una versione della ricetta, anche non più attiva, con i suoi ingredienti
+func (r *RicettaRepository) GetByID(ctx context.Context, id int) (*models.RicettaConIngredienti, error) {
+	return leggiRicetta(ctx, r.DB, id)
+}
+
+// Versioni restituisce tutte le versioni della ricetta della stessa pietanza, dalla più recente
+func (r *RicettaRepository) Versioni(ctx context.Context, id int) ([]models.Ricetta, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT `+colonneRicetta+`
+		FROM ricetta
+		WHERE id_pietanza = (SELECT id_pietanza FROM ricetta WHERE id_ricetta = $1)
+		ORDER BY versione DESC, id_ricetta DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versioni := []models.Ricetta{}
+	for rows.Next() {
+		var ricetta models.Ricetta
+		if err := scansionaRicetta(rows, &ricetta); err != nil {
+			return nil, err
+		}
+		versioni = append(versioni, ricetta)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(versioni) == 0 {
+		return nil, ErrRicettaInesistente
+	}
+	return versioni, nil
+}
+
+// Create crea la ricetta di una pietanza che non ne ha una attiva, con tutti i suoi ingredienti
+// Le quantità possono essere espresse in un'unità diversa da quella del magazzino purché convertibile
+func (r *RicettaRepository) Create(ctx context.Context, rc *models.RicettaConIngredienti) error {
+	if err := validaRicetta(rc); err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Blocca la pietanza, che non deve avere una ricetta attiva
+	var haRicetta bool
+	var versione int
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM ricetta WHERE id_pietanza = p.id_pietanza AND attiva),
+		       COALESCE((SELECT MAX(versione) FROM ricetta WHERE id_pietanza = p.id_pietanza), 0)
+		FROM pietanza p
+		WHERE p.id_pietanza = $1
+		FOR UPDATE
+	`, rc.IDPietanza).Scan(&haRicetta, &versione)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrPietanzaInesistente
+		}
+		return err
+	}
+	if haRicetta {
+		return ErrRicettaEsistente
+	}
+
+	// 2. Inserisce la ricetta, dopo le eventuali versioni eliminate ma ancora usate dagli ordini
+	err = tx.QueryRow(ctx, `
+		INSERT INTO ricetta (nome, descrizione, id_pietanza, tempo_preparazione, istruzioni, versione)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id_ricetta
+	`, rc.Nome, rc.Descrizione, rc.IDPietanza, rc.TempoPreparazione, rc.Istruzioni, versione+1).Scan(&rc.ID)
+	if err != nil {
+		return err
+	}
+
+	// 3. Ingredienti e disponibilità della pietanza
+	if err := salvaRigheRicetta(ctx, tx, rc.ID, rc.Ingredienti); err != nil {
+		return err
+	}
+	if _, err := aggiornaDisponibilita(ctx, tx, []int{rc.IDPietanza}, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	r.invalidaCacheRicetta(ctx, rc.IDPietanza, rc.ID)
+	return r.rileggi(ctx, rc)
+}
+
+// Update modifica la versione attiva della ricetta e ne sostituisce gli ingredienti
+// Se la versione è già stata usata da qualche ordine le modifiche vanno in una nuova versione,
+// che diventa quella attiva: rc riporta l'ID della versione risultante
+func (r *RicettaRepository) Update(ctx context.Context, id int, rc *models.RicettaConIngredienti) error {
+	if err := validaRicetta(rc); err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Blocca la versione attiva, creandone una nuova se già usata
+	idPietanza, err := bloccaRicettaAttiva(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	idVersione, err := versioneModificabile(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	// 2. Dati della ricetta e ingredienti
+	_, err = tx.Exec(ctx, `
+		UPDATE ricetta
+		SET nome = $1, descrizione = $2, tempo_preparazione = $3, istruzioni = $4
+		WHERE id_ricetta = $5
+	`, rc.Nome, rc.Descrizione, rc.TempoPreparazione, rc.Istruzioni, idVersione)
+	if err != nil {
+		return err
+	}
+	if err := salvaRigheRicetta(ctx, tx, idVersione, rc.Ingredienti); err != nil {
+		return err
+	}
+
+	// 3. Disponibilità della pietanza con la nuova ricetta
+	if _, err := aggiornaDisponibilita(ctx, tx, []int{idPietanza}, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	r.invalidaCacheRicetta(ctx, idPietanza, id)
+	rc.ID = idVersione
+	return r.rileggi(ctx, rc)
+}
+
+// Delete elimina la ricetta di una pietanza, indicata dalla versione attiva
+// Le versioni usate da qualche ordine restano, non più attive, per la tracciabilità; le altre sono eliminate
+func (r *RicettaRepository) Delete(ctx context.Context, id int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	idPietanza, err := bloccaRicettaAttiva(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE ricetta SET attiva = false WHERE id_ricetta = $1`, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM ricetta r
+		WHERE r.id_pietanza = $1
+		  AND NOT EXISTS (SELECT 1 FROM dettaglio_ordine_pietanza d WHERE d.id_ricetta = r.id_ricetta)
+	`, idPietanza)
+	if err != nil {
+		return err
+	}
+
+	// Senza ricetta le scorte non limitano più la pietanza
+	if _, err := aggiornaDisponibilita(ctx, tx, []int{idPietanza}, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	r.invalidaCacheRicetta(ctx, idPietanza, id)
+	return nil
+}
+
+// ImpostaIngrediente aggiunge un ingrediente alla ricetta attiva della pietanza o ne aggiorna la quantità
+// Senza unità di misura la quantità è nell'unità dell'ingrediente in magazzino; un'unità diversa
+// deve essere convertibile in quella del magazzino (es. g per kg, pz per kg con il peso per pezzo).
+// Come in Update, una versione già usata dagli ordini non viene toccata: la modifica crea una nuova versione
+func (r *RicettaRepository) ImpostaIngrediente(ctx context.Context, idPietanza int, ri *models.RicettaIngrediente) error {
+	if ri.Quantita <= 0 {
+		return ErrQuantitaRicettaNonValida
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Versione della ricetta da modificare
+	idRicetta, err := ricettaAttivaPietanza(ctx, tx, idPietanza)
+	if err != nil {
+		return err
+	}
+	idVersione, err := versioneModificabile(ctx, tx, idRicetta)
+	if err != nil {
+		return err
+	}
+
+	// 2. Inserimento o aggiornamento della riga, con la verifica dell'unità
+	if err := salvaRigaRicetta(ctx, tx, idVersione, ri); err != nil {
+		return err
+	}
+	if _, err := aggiornaDisponibilita(ctx, tx, []int{idPietanza}, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	r.invalidaCacheRicetta(ctx, idPietanza, idRicetta)
+	return nil
+}
+
+// RimuoviIngrediente toglie un ingrediente dalla ricetta attiva della pietanza
+// (in una nuova versione se quella attiva è già stata usata dagli ordini)
+func (r *RicettaRepository) RimuoviIngrediente(ctx context.Context, idPietanza int, idIngrediente int) error {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	idRicetta, err := ricettaAttivaPietanza(ctx, tx, idPietanza)
+	if err != nil {
+		return err
+	}
+	var presente bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM ricetta_ingrediente WHERE id_ricetta = $1 AND id_ingrediente = $2)
+	`, idRicetta, idIngrediente).Scan(&presente)
+	if err != nil {
+		return err
+	}
+	if !presente {
+		return ErrIngredienteNonInRicetta
+	}
+
+	idVersione, err := versioneModificabile(ctx, tx, idRicetta)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		DELETE FROM ricetta_ingrediente WHERE id_ricetta = $1 AND id_ingrediente = $2
+	`, idVersione, idIngrediente)
+	if err != nil {
+		return err
+	}
+	if _, err := aggiornaDisponibilita(ctx, tx, []int{idPietanza}, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	r.invalidaCacheRicetta(ctx, idPietanza, idRicetta)
+	return nil
+}
+
+// validaRicetta controlla nome e righe della ricetta prima di salvarla
+func validaRicetta(rc *models.RicettaConIngredienti) error {
+	if strings.TrimSpace(rc.Nome) == "" {
+		return ErrNomeRicetta
+	}
+	visti := make(map[int]bool)
+	for _, ri := range rc.Ingredienti {
+		if ri.Quantita <= 0 {
+			return ErrQuantitaRicettaNonValida
+		}
+		if visti[ri.IDIngrediente] {
+			return ErrIngredienteRipetuto
+		}
+		visti[ri.IDIngrediente] = true
+	}
+	return nil
+}
+
+// bloccaRicettaAttiva blocca la versione della ricetta, che deve essere quella attiva, e ne restituisce la pietanza
+func bloccaRicettaAttiva(ctx context.Context, tx pgx.Tx, id int) (int, error) {
+	var idPietanza int
+	var attiva bool
+	err := tx.QueryRow(ctx, `
+		SELECT id_pietanza, attiva FROM ricetta WHERE id_ricetta = $1 FOR UPDATE
+	`, id).Scan(&idPietanza, &attiva)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrRicettaInesistente
+		}
+		return 0, err
+	}
+	if !attiva {
+		return 0, ErrRicettaNonAttiva
+	}
+	return idPietanza, nil
+}
+
+// ricettaAttivaPietanza blocca la versione attiva della ricetta della pietanza e ne restituisce l'ID
+func ricettaAttivaPietanza(ctx context.Context, tx pgx.Tx, idPietanza int) (int, error) {
+	var idRicetta int
+	err := tx.QueryRow(ctx, `
+		SELECT id_ricetta FROM ricetta WHERE id_pietanza = $1 AND attiva FOR UPDATE
+	`, idPietanza).Scan(&idRicetta)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrRicettaInesistente
+		}
+		return 0, err
+	}
+	return idRicetta, nil
+}
+
+// ricettaAttivaPerOrdine legge nella transazione dell'ordine la versione attiva della ricetta della pietanza
+// e la blocca in condivisione, così non può essere modificata o sostituita finché l'ordine non la registra
+func ricettaAttivaPerOrdine(ctx context.Context, tx pgx.Tx, idPietanza int) (int, error) {
+	var idRicetta int
+	var err error
+	// Se la versione attiva viene sostituita mentre si attende il lock, la nuova non è visibile
+	// alla stessa query: la lettura si ripete una volta
+	for tentativo := 0; tentativo < 2; tentativo++ {
+		err = tx.QueryRow(ctx, `
+			SELECT id_ricetta FROM ricetta WHERE id_pietanza = $1 AND attiva FOR SHARE
+		`, idPietanza).Scan(&idRicetta)
+		if err != pgx.ErrNoRows {
+			break
+		}
+	}
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrRicettaInesistente
+		}
+		return 0, err
+	}
+	return idRicetta, nil
+}
+
+// versioneModificabile restituisce la versione da modificare al posto di quella attiva indicata:
+// la stessa se nessun ordine l'ha ancora usata, altrimenti una copia con gli stessi ingredienti
+// che diventa la nuova versione attiva
+func versioneModificabile(ctx context.Context, tx pgx.Tx, id int) (int, error) {
+	var usata bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM dettaglio_ordine_pietanza WHERE id_ricetta = $1)
+	`, id).Scan(&usata)
+	if err != nil {
+		return 0, err
+	}
+	if !usata {
+		return id, nil
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE ricetta SET attiva = false WHERE id_ricetta = $1`, id)
+	if err != nil {
+		return 0, err
+	}
+	var idVersione int
+	err = tx.QueryRow(ctx, `
+		INSERT INTO ricetta (nome, descrizione, id_pietanza, tempo_preparazione, istruzioni, versione)
+		SELECT nome, descrizione, id_pietanza, tempo_preparazione, istruzioni,
+		       (SELECT MAX(versione) FROM ricetta v WHERE v.id_pietanza = r.id_pietanza) + 1
+		FROM ricetta r
+		WHERE id_ricetta = $1
+		RETURNING id_ricetta
+	`, id).Scan(&idVersione)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO ricetta_ingrediente (id_ricetta, id_ingrediente, quantita, unita_misura)
+		SELECT $2, id_ingrediente, quantita, unita_misura
+		FROM ricetta_ingrediente
+		WHERE id_ricetta = $1
+	`, id, idVersione)
+	if err != nil {
+		return 0, err
+	}
+	return idVersione, nil
+}
+
+// salvaRigheRicetta sostituisce gli ingredienti della versione della ricetta
+func salvaRigheRicetta(ctx context.Context, tx pgx.Tx, idRicetta int, righe []models.RicettaIngrediente) error {
+	_, err := tx.Exec(ctx, `DELETE FROM ricetta_ingrediente WHERE id_ricetta = $1`, idRicetta)
+	if err != nil {
+		return err
+	}
+	for i := range righe {
+		if err := salvaRigaRicetta(ctx, tx, idRicetta, &righe[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// salvaRigaRicetta inserisce o aggiorna un ingrediente della versione della ricetta,
+// verificando che la sua unità sia convertibile in quella del magazzino
+func salvaRigaRicetta(ctx context.Context, tx pgx.Tx, idRicetta int, ri *models.RicettaIngrediente) error {
+	var unitaScorta string
+	var pesoPezzo float64
+	err := tx.QueryRow(ctx, `
+		SELECT nome, unita_misura, peso_pezzo FROM ingrediente WHERE id_ingrediente = $1
+	`, ri.IDIngrediente).Scan(&ri.Nome, &unitaScorta, &pesoPezzo)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return fmt.Errorf("%w: %d", ErrIngredienteInesistente, ri.IDIngrediente)
+		}
+		return err
+	}
+	if ri.UnitaMisura != "" {
+		if err := unita.Convertibili(ri.UnitaMisura, unitaScorta, pesoPezzo); err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO ricetta_ingrediente (id_ricetta, id_ingrediente, quantita, unita_misura)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (id_ricetta, id_ingrediente)
+		DO UPDATE SET quantita = EXCLUDED.quantita, unita_misura = EXCLUDED.unita_misura
+	`, idRicetta, ri.IDIngrediente, ri.Quantita, ri.UnitaMisura)
+	if err != nil {
+		return err
+	}
+
+	ri.IDRicetta = idRicetta
+	if ri.UnitaMisura == "" {
+		ri.UnitaMisura = unitaScorta
+	}
+	return nil
+}
+
+// leggiRicetta legge una versione della ricetta con i suoi ingredienti
+func leggiRicetta(ctx context.Context, db dbtx, id int) (*models.RicettaConIngredienti, error) {
+	rc := &models.RicettaConIngredienti{Ingredienti: []models.RicettaIngrediente{}}
+	err := scansionaRicetta(db.QueryRow(ctx, `
+		SELECT `+colonneRicetta+` FROM ricetta WHERE id_ricetta = $1
+	`, id), &rc.Ricetta)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrRicettaInesistente
+		}
+		return nil, err
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT ri.id_ricetta, ri.id_ingrediente, i.nome, ri.quantita, COALESCE(ri.unita_misura, i.unita_misura)
+		FROM ricetta_ingrediente ri
+		JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
+		WHERE ri.id_ricetta = $1
+		ORDER BY i.nome
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ri models.RicettaIngrediente
+		if err := rows.Scan(&ri.IDRicetta, &ri.IDIngrediente, &ri.Nome, &ri.Quantita, &ri.UnitaMisura); err != nil {
+			return nil, err
+		}
+		rc.Ingredienti = append(rc.Ingredienti, ri)
+	}
+	return rc, rows.Err()
+}
+
+// rileggi sostituisce rc con la versione salvata della ricetta
+func (r *RicettaRepository) rileggi(ctx context.Context, rc *models.RicettaConIngredienti) error {
+	salvata, err := leggiRicetta(ctx, r.DB, rc.ID)
+	if err != nil {
+		return err
+	}
+	*rc = *salvata
+	return nil
+}
+
+// invalidaCacheRicetta rimuove dalla cache la ricetta della pietanza e gli ingredienti della versione modificata
+func (r *RicettaRepository) invalidaCacheRicetta(ctx context.Context, idPietanza int, idRicetta int) {
+	if r.Cache == nil {
+		return
+	}
+	if err := r.Cache.InvalidateByPietanzaID(ctx, idPietanza); err != nil {
+		// Log error but continue
+	}
+	if err := r.Cache.InvalidateIngredientiByRicettaID(ctx, idRicetta); err != nil {
+		// Log error but continue
+	}
+	if err := r.Cache.InvalidateRicettaCompletaByPietanzaID(ctx, idPietanza); err != nil {
+		// Log error but continue
+	}
+	if err := r.Cache.InvalidateProfiliAllergeni(ctx); err != nil {
+		// Log error but continue
+	}
+}
@@ -0,0 +1,238 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ristorante-api/cache"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Errori personalizzati
+var (
+	ErrRigaInesistente     = errors.New("riga non trovata nell'ordine")
+	ErrRigaNonModificabile = errors.New("l'ordine è già in preparazione: le righe non possono essere modificate")
+	ErrQuantitaNonValida   = errors.New("la quantità deve essere maggiore di zero")
+)
+
+// RimuoviRiga elimina una riga dell'ordine e restituisce al magazzino gli ingredienti della ricetta
+// Se la riga fa parte di un menu fisso viene eliminato l'intero menu
+func (r *OrdineRepository) RimuoviRiga(ctx context.Context, idOrdine int, idDettaglio int, ingredienteCache *cache.IngredienteCache) (models.Ordine, error) {
+	return r.modificaRiga(ctx, idOrdine, idDettaglio, 0, ingredienteCache)
+}
+
+// ModificaQuantitaRiga imposta la quantità di una riga dell'ordine: se diminuisce gli ingredienti
+// tornano in magazzino, se aumenta vengono scalati verificandone la disponibilità
+// Se la riga fa parte di un menu fisso la quantità indica il numero di menu e vale per tutte le sue pietanze
+func (r *OrdineRepository) ModificaQuantitaRiga(ctx context.Context, idOrdine int, idDettaglio int, quantita int, ingredienteCache *cache.IngredienteCache) (models.Ordine, error) {
+	if quantita <= 0 {
+		return models.Ordine{}, ErrQuantitaNonValida
+	}
+	return r.modificaRiga(ctx, idOrdine, idDettaglio, quantita, ingredienteCache)
+}
+
+// modificaRiga porta la riga (o il menu fisso di cui fa parte) alla quantità indicata, eliminandola se zero
+// Aggiorna le scorte, ricalcola il costo totale e annulla l'eventuale divisione del conto
+func (r *OrdineRepository) modificaRiga(ctx context.Context, idOrdine int, idDettaglio int, quantita int, ingredienteCache *cache.IngredienteCache) (models.Ordine, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return models.Ordine{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Blocca l'ordine, che deve essere ancora prima della preparazione
+	ordine, err := ordineModificabile(ctx, tx, idOrdine)
+	if err != nil {
+		return models.Ordine{}, err
+	}
+	if !models.PrimaDellaPreparazione(ordine.Stato) {
+		return models.Ordine{}, ErrRigaNonModificabile
+	}
+
+	// 2. Righe interessate: la riga indicata o tutte le pietanze del suo menu fisso
+	rows, err := tx.Query(ctx, `
+		SELECT d.id_dettaglio, d.id_pietanza, d.quantita, d.id_ricetta
+		FROM dettaglio_ordine_pietanza d
+		JOIN dettaglio_ordine_pietanza rif ON rif.id_ordine = d.id_ordine
+		WHERE rif.id_dettaglio = $1 AND rif.id_ordine = $2
+		  AND (d.id_dettaglio = rif.id_dettaglio
+		       OR (rif.parte_di_menu = true AND d.parte_di_menu = true AND d.id_menu = rif.id_menu))
+		ORDER BY d.id_dettaglio
+		FOR UPDATE OF d
+	`, idDettaglio, idOrdine)
+	if err != nil {
+		return models.Ordine{}, err
+	}
+	var righe []models.DettaglioOrdine
+	for rows.Next() {
+		var d models.DettaglioOrdine
+		if err := rows.Scan(&d.ID, &d.IDPietanza, &d.Quantita, &d.IDRicetta); err != nil {
+			rows.Close()
+			return models.Ordine{}, err
+		}
+		righe = append(righe, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return models.Ordine{}, err
+	}
+	if len(righe) == 0 {
+		return models.Ordine{}, ErrRigaInesistente
+	}
+
+	// 3. Ingredienti da restituire e da scalare in base alla variazione delle porzioni
+	nuove := nuoveQuantitaRighe(righe, quantita)
+	daRipristinare := make(map[int]float64)
+	daScalare := make(map[int]float64)
+	for i, riga := range righe {
+		variazione := nuove[i] - riga.Quantita
+		if variazione == 0 {
+			continue
+		}
+		ingredienti, err := ingredientiPietanza(ctx, tx, riga.IDPietanza, riga.IDRicetta, variazione)
+		if err != nil {
+			return models.Ordine{}, err
+		}
+		for idIngrediente, q := range ingredienti {
+			if q < 0 {
+				daRipristinare[idIngrediente] -= q
+			} else {
+				daScalare[idIngrediente] += q
+			}
+		}
+	}
+	if err := ripristinaIngredienti(ctx, tx, idOrdine, daRipristinare); err != nil {
+		return models.Ordine{}, err
+	}
+	if err := scalaIngredienti(ctx, tx, idOrdine, daScalare); err != nil {
+		return models.Ordine{}, err
+	}
+
+	// 4. Aggiorna o elimina le righe
+	for i, riga := range righe {
+		switch {
+		case nuove[i] == riga.Quantita:
+			continue
+		case nuove[i] == 0:
+			_, err = tx.Exec(ctx, `DELETE FROM dettaglio_ordine_pietanza WHERE id_dettaglio = $1`, riga.ID)
+		default:
+			_, err = tx.Exec(ctx, `UPDATE dettaglio_ordine_pietanza SET quantita = $1 WHERE id_dettaglio = $2`, nuove[i], riga.ID)
+		}
+		if err != nil {
+			return models.Ordine{}, err
+		}
+	}
+
+	// 5. Ricalcola il costo totale e annulla la divisione del conto, che va ripetuta
+	if err := r.AggiornaCostoTotale(ctx, tx, idOrdine); err != nil {
+		return models.Ordine{}, err
+	}
+	if err := annullaDivisione(ctx, tx, idOrdine); err != nil {
+		return models.Ordine{}, err
+	}
+
+	err = tx.QueryRow(ctx, `SELECT costo_totale FROM ordine WHERE id_ordine = $1`, idOrdine).Scan(&ordine.CostoTotale)
+	if err != nil {
+		return models.Ordine{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return models.Ordine{}, err
+	}
+
+	// 6. Invalida la cache degli ingredienti aggiornati
+	for idIngrediente, q := range daScalare {
+		daRipristinare[idIngrediente] += q
+	}
+	InvalidaCacheIngredienti(ctx, ingredienteCache, daRipristinare)
+	return ordine, nil
+}
+
+// nuoveQuantitaRighe distribuisce la nuova quantità tra le righe (in ordine di inserimento) di ogni pietanza
+// In un menu fisso una pietanza può stare su più righe, una per versione della ricetta: la quantità
+// in più va sull'ultima riga, quella in meno si toglie a partire dalle righe più recenti
+func nuoveQuantitaRighe(righe []models.DettaglioOrdine, quantita int) []int {
+	nuove := make([]int, len(righe))
+	perPietanza := make(map[int][]int)
+	var pietanze []int
+	for i, riga := range righe {
+		nuove[i] = riga.Quantita
+		if _, ok := perPietanza[riga.IDPietanza]; !ok {
+			pietanze = append(pietanze, riga.IDPietanza)
+		}
+		perPietanza[riga.IDPietanza] = append(perPietanza[riga.IDPietanza], i)
+	}
+
+	for _, idPietanza := range pietanze {
+		indici := perPietanza[idPietanza]
+		totale := 0
+		for _, i := range indici {
+			totale += righe[i].Quantita
+		}
+		if quantita >= totale {
+			nuove[indici[len(indici)-1]] += quantita - totale
+			continue
+		}
+		daTogliere := totale - quantita
+		for j := len(indici) - 1; j >= 0 && daTogliere > 0; j-- {
+			tolti := min(nuove[indici[j]], daTogliere)
+			nuove[indici[j]] -= tolti
+			daTogliere -= tolti
+		}
+	}
+	return nuove
+}
+
+// ripristinaIngredientiOrdine restituisce al magazzino gli ingredienti di tutte le righe dell'ordine
+// se l'ordine non è ancora in preparazione; restituisce le quantità ripristinate
+func ripristinaIngredientiOrdine(ctx context.Context, tx pgx.Tx, idOrdine int) (map[int]float64, error) {
+	var stato string
+	err := tx.QueryRow(ctx, `SELECT stato FROM ordine WHERE id_ordine = $1 FOR UPDATE`, idOrdine).Scan(&stato)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrOrdineInesistente
+		}
+		return nil, err
+	}
+	if !models.PrimaDellaPreparazione(stato) {
+		return nil, nil
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT id_pietanza, quantita, id_ricetta
+		FROM dettaglio_ordine_pietanza
+		WHERE id_ordine = $1
+	`, idOrdine)
+	if err != nil {
+		return nil, err
+	}
+	var righe []models.DettaglioOrdine
+	for rows.Next() {
+		var d models.DettaglioOrdine
+		if err := rows.Scan(&d.IDPietanza, &d.Quantita, &d.IDRicetta); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		righe = append(righe, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ripristinati := make(map[int]float64)
+	for _, riga := range righe {
+		ingredienti, err := ingredientiPietanza(ctx, tx, riga.IDPietanza, riga.IDRicetta, riga.Quantita)
+		if err != nil {
+			return nil, err
+		}
+		for idIngrediente, q := range ingredienti {
+			ripristinati[idIngrediente] += q
+		}
+	}
+	if err := ripristinaIngredienti(ctx, tx, idOrdine, ripristinati); err != nil {
+		return nil, err
+	}
+	return ripristinati, nil
+}
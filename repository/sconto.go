@@ -0,0 +1,478 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ristorante-api/models"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Errori personalizzati
+var (
+	ErrScontoInesistente     = errors.New("sconto non trovato")
+	ErrScontoNonValido       = errors.New("sconto non valido")
+	ErrCodiceScontoDuplicato = errors.New("esiste già uno sconto con questo codice")
+	ErrScontoInUso           = errors.New("lo sconto è già stato applicato a degli ordini: disattivarlo invece di eliminarlo")
+	ErrScontoUsatoImmutabile = errors.New("lo sconto è già stato utilizzato: tipo, valore e categoria non si possono modificare, crearne uno nuovo")
+	ErrScontoNonApplicabile  = errors.New("lo sconto non è attivo o è fuori dal periodo di validità")
+	ErrScontoEsaurito        = errors.New("lo sconto ha raggiunto il numero massimo di utilizzi")
+	ErrScontoGiaApplicato    = errors.New("lo sconto è già applicato all'ordine")
+	ErrScontoNonApplicato    = errors.New("lo sconto non è applicato all'ordine")
+	ErrOrdineChiuso          = errors.New("l'ordine è pagato o annullato e non può essere modificato")
+)
+
+type ScontoRepository struct {
+	DB *pgxpool.Pool
+}
+
+func NewScontoRepository(db *pgxpool.Pool) *ScontoRepository {
+	return &ScontoRepository{DB: db}
+}
+
+const selectSconto = `
+	SELECT id_sconto, nome, codice, tipo, valore, id_categoria, valido_dal, valido_al,
+		utilizzi_massimi, utilizzi, attivo
+	FROM sconto`
+
+func scanSconto(row pgx.Row, s *models.Sconto) error {
+	return row.Scan(&s.ID, &s.Nome, &s.Codice, &s.Tipo, &s.Valore, &s.IDCategoria, &s.ValidoDal,
+		&s.ValidoAl, &s.UtilizziMassimi, &s.Utilizzi, &s.Attivo)
+}
+
+// GetAll restituisce tutti gli sconti, compresi quelli non attivi
+func (r *ScontoRepository) GetAll(ctx context.Context) ([]models.Sconto, error) {
+	rows, err := r.DB.Query(ctx, selectSconto+` ORDER BY id_sconto`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sconti := []models.Sconto{}
+	for rows.Next() {
+		var s models.Sconto
+		if err := scanSconto(rows, &s); err != nil {
+			return nil, err
+		}
+		sconti = append(sconti, s)
+	}
+	return sconti, rows.Err()
+}
+
+func (r *ScontoRepository) GetByID(ctx context.Context, id int) (*models.Sconto, error) {
+	var s models.Sconto
+	err := scanSconto(r.DB.QueryRow(ctx, selectSconto+` WHERE id_sconto = $1`, id), &s)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrScontoInesistente
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+func (r *ScontoRepository) Create(ctx context.Context, s *models.Sconto) error {
+	if err := validaSconto(s); err != nil {
+		return err
+	}
+	if err := r.verificaRiferimenti(ctx, s); err != nil {
+		return err
+	}
+
+	return r.DB.QueryRow(ctx, `
+		INSERT INTO sconto (nome, codice, tipo, valore, id_categoria, valido_dal, valido_al, utilizzi_massimi, attivo)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id_sconto, utilizzi
+	`, s.Nome, s.Codice, s.Tipo, s.Valore, s.IDCategoria, s.ValidoDal, s.ValidoAl, s.UtilizziMassimi, s.Attivo).
+		Scan(&s.ID, &s.Utilizzi)
+}
+
+// Update modifica la definizione di uno sconto; il contatore degli utilizzi non viene modificato
+// Uno sconto già utilizzato mantiene tipo, valore e categoria (ErrScontoUsatoImmutabile), così gli
+// ordini a cui è stato applicato non cambiano importo; restano modificabili nome, codice, validità e stato
+func (r *ScontoRepository) Update(ctx context.Context, s *models.Sconto) error {
+	if err := validaSconto(s); err != nil {
+		return err
+	}
+	if err := r.verificaRiferimenti(ctx, s); err != nil {
+		return err
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Blocca lo sconto e verifica che non cambi l'importo di uno sconto già utilizzato
+	var attuale models.Sconto
+	err = tx.QueryRow(ctx, `
+		SELECT tipo, valore, id_categoria, utilizzi FROM sconto WHERE id_sconto = $1 FOR UPDATE
+	`, s.ID).Scan(&attuale.Tipo, &attuale.Valore, &attuale.IDCategoria, &attuale.Utilizzi)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrScontoInesistente
+		}
+		return err
+	}
+	stessaCategoria := (attuale.IDCategoria == nil) == (s.IDCategoria == nil) &&
+		(attuale.IDCategoria == nil || *attuale.IDCategoria == *s.IDCategoria)
+	if attuale.Utilizzi > 0 && (attuale.Tipo != s.Tipo || attuale.Valore != s.Valore || !stessaCategoria) {
+		return ErrScontoUsatoImmutabile
+	}
+
+	// 2. Aggiorna la definizione
+	err = tx.QueryRow(ctx, `
+		UPDATE sconto
+		SET nome = $1, codice = $2, tipo = $3, valore = $4, id_categoria = $5,
+			valido_dal = $6, valido_al = $7, utilizzi_massimi = $8, attivo = $9
+		WHERE id_sconto = $10
+		RETURNING utilizzi
+	`, s.Nome, s.Codice, s.Tipo, s.Valore, s.IDCategoria, s.ValidoDal, s.ValidoAl, s.UtilizziMassimi, s.Attivo, s.ID).
+		Scan(&s.Utilizzi)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+// Delete elimina uno sconto mai applicato; gli sconti già usati vanno disattivati
+// per non alterare gli scontrini degli ordini a cui sono stati applicati
+func (r *ScontoRepository) Delete(ctx context.Context, id int) error {
+	var inUso bool
+	err := r.DB.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM ordine_sconto WHERE id_sconto = $1)`, id).Scan(&inUso)
+	if err != nil {
+		return err
+	}
+	if inUso {
+		return ErrScontoInUso
+	}
+
+	tag, err := r.DB.Exec(ctx, `DELETE FROM sconto WHERE id_sconto = $1`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrScontoInesistente
+	}
+	return nil
+}
+
+// verificaRiferimenti controlla che la categoria indicata esista e che il codice
+// promozionale non sia già usato da un altro sconto
+func (r *ScontoRepository) verificaRiferimenti(ctx context.Context, s *models.Sconto) error {
+	if s.IDCategoria != nil {
+		var esiste bool
+		err := r.DB.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM categoria_pietanza WHERE id_categoria = $1)
+		`, *s.IDCategoria).Scan(&esiste)
+		if err != nil {
+			return err
+		}
+		if !esiste {
+			return fmt.Errorf("%w: la categoria %d non esiste", ErrScontoNonValido, *s.IDCategoria)
+		}
+	}
+
+	if s.Codice != nil {
+		var esiste bool
+		err := r.DB.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM sconto WHERE codice = $1 AND id_sconto != $2)
+		`, *s.Codice, s.ID).Scan(&esiste)
+		if err != nil {
+			return err
+		}
+		if esiste {
+			return ErrCodiceScontoDuplicato
+		}
+	}
+	return nil
+}
+
+// validaSconto verifica la definizione di uno sconto e normalizza il codice (maiuscolo, senza spazi)
+func validaSconto(s *models.Sconto) error {
+	s.Nome = strings.TrimSpace(s.Nome)
+	if s.Nome == "" {
+		return fmt.Errorf("%w: il nome è obbligatorio", ErrScontoNonValido)
+	}
+	if s.Codice != nil {
+		codice := strings.ToUpper(strings.TrimSpace(*s.Codice))
+		if codice == "" {
+			s.Codice = nil
+		} else {
+			s.Codice = &codice
+		}
+	}
+	if !models.TipoScontoValido(s.Tipo) {
+		return fmt.Errorf("%w: tipo non valido (percentuale, fisso, servizio)", ErrScontoNonValido)
+	}
+	if s.Valore <= 0 {
+		return fmt.Errorf("%w: il valore deve essere positivo", ErrScontoNonValido)
+	}
+	if s.Tipo != models.ScontoFisso && s.Valore.Percentuale() > models.PercentualeMassima {
+		return fmt.Errorf("%w: la percentuale non può superare 100", ErrScontoNonValido)
+	}
+	if s.Tipo == models.ScontoServizio && s.IDCategoria != nil {
+		return fmt.Errorf("%w: il servizio non può essere limitato a una categoria", ErrScontoNonValido)
+	}
+	if s.ValidoDal != nil && s.ValidoAl != nil && s.ValidoAl.Before(*s.ValidoDal) {
+		return fmt.Errorf("%w: la fine della validità precede l'inizio", ErrScontoNonValido)
+	}
+	if s.UtilizziMassimi != nil && *s.UtilizziMassimi <= 0 {
+		return fmt.Errorf("%w: il numero massimo di utilizzi deve essere positivo", ErrScontoNonValido)
+	}
+	return nil
+}
+
+// ApplicaSconto applica all'ordine uno sconto indicato per ID o per codice promozionale
+// In un'unica transazione verifica validità e utilizzi residui, incrementa il contatore
+// degli utilizzi e annulla l'eventuale divisione del conto, che va ripetuta
+// Restituisce lo scontrino dell'ordine ricalcolato
+func (r *OrdineRepository) ApplicaSconto(ctx context.Context, idOrdine int, idSconto int, codice string) (*models.Scontrino, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Recupera e blocca l'ordine
+	ordine, err := ordineModificabile(ctx, tx, idOrdine)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2. Recupera e blocca lo sconto, verificandone la validità in questo momento
+	var s models.Sconto
+	var valido bool
+	err = tx.QueryRow(ctx, `
+		SELECT id_sconto, utilizzi_massimi, utilizzi,
+			attivo AND (valido_dal IS NULL OR valido_dal <= NOW()) AND (valido_al IS NULL OR valido_al >= NOW())
+		FROM sconto
+		WHERE ($1 > 0 AND id_sconto = $1) OR ($1 = 0 AND codice = UPPER(TRIM($2)))
+		FOR UPDATE
+	`, idSconto, codice).Scan(&s.ID, &s.UtilizziMassimi, &s.Utilizzi, &valido)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrScontoInesistente
+		}
+		return nil, err
+	}
+	if !valido {
+		return nil, ErrScontoNonApplicabile
+	}
+	if s.UtilizziMassimi != nil && s.Utilizzi >= *s.UtilizziMassimi {
+		return nil, ErrScontoEsaurito
+	}
+
+	// 3. Collega lo sconto all'ordine e conta l'utilizzo
+	tag, err := tx.Exec(ctx, `
+		INSERT INTO ordine_sconto (id_ordine, id_sconto)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, ordine.ID, s.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrScontoGiaApplicato
+	}
+
+	if _, err = tx.Exec(ctx, `UPDATE sconto SET utilizzi = utilizzi + 1 WHERE id_sconto = $1`, s.ID); err != nil {
+		return nil, err
+	}
+
+	// 4. Il totale è cambiato: la divisione del conto non è più valida
+	if err = annullaDivisione(ctx, tx, ordine.ID); err != nil {
+		return nil, err
+	}
+
+	scontrino, err := calcolaScontrinoOrdine(ctx, tx, ordine)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return scontrino, nil
+}
+
+// RimuoviSconto toglie uno sconto dall'ordine e ne restituisce l'utilizzo
+// Restituisce lo scontrino dell'ordine ricalcolato
+func (r *OrdineRepository) RimuoviSconto(ctx context.Context, idOrdine int, idSconto int) (*models.Scontrino, error) {
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ordine, err := ordineModificabile(ctx, tx, idOrdine)
+	if err != nil {
+		return nil, err
+	}
+
+	tag, err := tx.Exec(ctx, `DELETE FROM ordine_sconto WHERE id_ordine = $1 AND id_sconto = $2`, ordine.ID, idSconto)
+	if err != nil {
+		return nil, err
+	}
+	if tag.RowsAffected() == 0 {
+		return nil, ErrScontoNonApplicato
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE sconto SET utilizzi = GREATEST(utilizzi - 1, 0) WHERE id_sconto = $1`, idSconto)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = annullaDivisione(ctx, tx, ordine.ID); err != nil {
+		return nil, err
+	}
+
+	scontrino, err := calcolaScontrinoOrdine(ctx, tx, ordine)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return scontrino, nil
+}
+
+// ordineModificabile recupera e blocca un ordine non ancora pagato né annullato
+func ordineModificabile(ctx context.Context, tx pgx.Tx, idOrdine int) (models.Ordine, error) {
+	var ordine models.Ordine
+	err := tx.QueryRow(ctx, `
+		SELECT id_ordine, id_tavolo, num_persone, data_ordine, stato, id_ristorante, costo_totale
+		FROM ordine
+		WHERE id_ordine = $1
+		FOR UPDATE
+	`, idOrdine).Scan(
+		&ordine.ID, &ordine.IDTavolo, &ordine.NumPersone, &ordine.DataOrdine,
+		&ordine.Stato, &ordine.IDRistorante, &ordine.CostoTotale,
+	)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return models.Ordine{}, ErrOrdineInesistente
+		}
+		return models.Ordine{}, err
+	}
+	if ordine.Stato == models.StatoPagato || ordine.Stato == models.StatoAnnullato {
+		return models.Ordine{}, ErrOrdineChiuso
+	}
+	return ordine, nil
+}
+
+// calcolaSconti calcola le voci di sconto e di servizio dello scontrino di un ordine
+// Gli sconti sono applicati in quest'ordine: prima quelli per categoria (sulle pietanze
+// alla carta della categoria), poi quelli percentuali e infine quelli fissi sull'intero ordine;
+// ogni sconto è limitato all'importo che resta da scontare, così il totale non diventa negativo
+// Il servizio è calcolato sul costo già scontato. Il coperto è escluso da sconti e servizio
+func calcolaSconti(ctx context.Context, tx pgx.Tx, ordine models.Ordine) ([]models.VoceScontrino, models.Importo, models.Importo, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT s.id_sconto, s.nome, s.codice, s.tipo, s.valore, s.id_categoria
+		FROM ordine_sconto os
+		JOIN sconto s ON os.id_sconto = s.id_sconto
+		WHERE os.id_ordine = $1
+		ORDER BY
+			CASE
+				WHEN s.tipo = 'servizio' THEN 3
+				WHEN s.id_categoria IS NOT NULL THEN 0
+				WHEN s.tipo = 'percentuale' THEN 1
+				ELSE 2
+			END,
+			os.data_applicazione, s.id_sconto
+	`, ordine.ID)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	var sconti []models.Sconto
+	perCategoria := false
+	for rows.Next() {
+		var s models.Sconto
+		if err := rows.Scan(&s.ID, &s.Nome, &s.Codice, &s.Tipo, &s.Valore, &s.IDCategoria); err != nil {
+			rows.Close()
+			return nil, 0, 0, err
+		}
+		if s.IDCategoria != nil {
+			perCategoria = true
+		}
+		sconti = append(sconti, s)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+	if len(sconti) == 0 {
+		return nil, 0, 0, nil
+	}
+
+	// Importo delle pietanze alla carta per categoria (i menu fissi hanno un prezzo proprio)
+	residuoCategoria := make(map[int]models.Importo)
+	if perCategoria {
+		rows, err = tx.Query(ctx, `
+			SELECT p.id_categoria, SUM(d.prezzo_unitario * d.quantita)
+			FROM dettaglio_ordine_pietanza d
+			JOIN pietanza p ON d.id_pietanza = p.id_pietanza
+			WHERE d.id_ordine = $1 AND d.parte_di_menu = false AND p.id_categoria IS NOT NULL
+			GROUP BY p.id_categoria
+		`, ordine.ID)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		for rows.Next() {
+			var idCategoria int
+			var importo models.Importo
+			if err := rows.Scan(&idCategoria, &importo); err != nil {
+				rows.Close()
+				return nil, 0, 0, err
+			}
+			residuoCategoria[idCategoria] = importo
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	voci := make([]models.VoceScontrino, 0, len(sconti))
+	residuo := ordine.CostoTotale
+	var importoSconti, importoServizio models.Importo
+	for _, s := range sconti {
+		descrizione := s.Nome
+		if s.Tipo != models.ScontoFisso {
+			descrizione = fmt.Sprintf("%s (%s%%)", s.Nome, s.Valore.Percentuale())
+		}
+		voce := models.VoceScontrino{IDSconto: s.ID, Descrizione: descrizione, Tipo: s.Tipo, Codice: s.Codice, IDCategoria: s.IDCategoria}
+
+		if s.Tipo == models.ScontoServizio {
+			voce.Importo = residuo.Percentuale(s.Valore.Percentuale())
+			importoServizio += voce.Importo
+			voci = append(voci, voce)
+			continue
+		}
+
+		base := residuo
+		if s.IDCategoria != nil {
+			base = min(residuoCategoria[*s.IDCategoria], residuo)
+		}
+		importo := s.Valore.Importo()
+		if s.Tipo == models.ScontoPercentuale {
+			importo = base.Percentuale(s.Valore.Percentuale())
+		}
+		importo = min(importo, base)
+
+		if s.IDCategoria != nil {
+			residuoCategoria[*s.IDCategoria] -= importo
+		}
+		residuo -= importo
+		importoSconti += importo
+		voce.Importo = -importo
+		voci = append(voci, voce)
+	}
+
+	return voci, importoSconti, importoServizio, nil
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// scontrinoEmesso è lo scontrino di un ordine pagato con gli importi delle voci,
+// così come è stato registrato alla chiusura dell'ordine
+type scontrinoEmesso struct {
+	models.Scontrino
+	ImportoAllaCarta models.Importo
+	NumMenuFissi     int
+	ImportoMenuFissi models.Importo
+}
+
+// vociScontrino calcola dalle righe dell'ordine l'importo delle pietanze alla carta
+// e il numero e l'importo dei menu fissi (prezzo per numero di menu ordinati)
+func vociScontrino(ctx context.Context, tx pgx.Tx, s *scontrinoEmesso) error {
+	return tx.QueryRow(ctx, `
+		SELECT (
+			SELECT COALESCE(SUM(prezzo_unitario * quantita), 0)
+			FROM dettaglio_ordine_pietanza
+			WHERE id_ordine = $1 AND parte_di_menu = false
+		), COALESCE(SUM(menu_ordinati.quantita), 0), COALESCE(SUM(m.prezzo * menu_ordinati.quantita), 0)
+		FROM (
+			SELECT id_menu, MAX(quantita) AS quantita
+			FROM (
+				SELECT id_menu, id_pietanza, SUM(quantita) AS quantita
+				FROM dettaglio_ordine_pietanza
+				WHERE id_ordine = $1 AND parte_di_menu = true AND id_menu IS NOT NULL
+				GROUP BY id_menu, id_pietanza
+			) AS pietanze_menu
+			GROUP BY id_menu
+		) AS menu_ordinati
+		JOIN menu_fisso m ON menu_ordinati.id_menu = m.id_menu
+	`, s.IDOrdine).Scan(&s.ImportoAllaCarta, &s.NumMenuFissi, &s.ImportoMenuFissi)
+}
+
+// registraScontrino salva gli importi dello scontrino di un ordine che viene pagato, con il
+// riepilogo IVA per aliquota: la chiusura giornaliera li somma senza ricalcolarli, così
+// le modifiche successive a sconti, coperto, aliquote o prezzi non cambiano gli incassi passati
+func registraScontrino(ctx context.Context, tx pgx.Tx, scontrino *models.Scontrino) error {
+	s := scontrinoEmesso{Scontrino: *scontrino}
+	if err := vociScontrino(ctx, tx, &s); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, `
+		INSERT INTO scontrino (
+			id_ordine, costo_totale, importo_alla_carta, num_menu_fissi, importo_menu_fissi,
+			importo_sconti, importo_servizio, num_coperti, costo_coperto, importo_coperto,
+			totale_complessivo, totale_imponibile, totale_imposta
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+	`, s.IDOrdine, s.CostoTotale, s.ImportoAllaCarta, s.NumMenuFissi, s.ImportoMenuFissi,
+		s.ImportoSconti, s.ImportoServizio, s.NumCoperti, s.CostoCoperto, s.ImportoCoperto,
+		s.TotaleComplessivo, s.TotaleImponibile, s.TotaleImposta)
+	if err != nil {
+		return err
+	}
+
+	for _, iva := range s.IVA {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO scontrino_iva (id_ordine, aliquota, imponibile, imposta, totale)
+			VALUES ($1, $2, $3, $4, $5)
+		`, s.IDOrdine, iva.Aliquota, iva.Imponibile, iva.Imposta, iva.Totale)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scontriniEmessi restituisce gli scontrini registrati degli ordini indicati, per ID ordine
+// Gli ordini pagati prima della registrazione degli scontrini non compaiono
+func scontriniEmessi(ctx context.Context, tx pgx.Tx, idOrdini []int) (map[int]*scontrinoEmesso, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT s.id_ordine, o.id_tavolo, o.data_ordine, s.costo_totale, s.importo_alla_carta,
+		       s.num_menu_fissi, s.importo_menu_fissi, s.importo_sconti, s.importo_servizio,
+		       s.num_coperti, s.costo_coperto, s.importo_coperto, s.totale_complessivo,
+		       s.totale_imponibile, s.totale_imposta
+		FROM scontrino s
+		JOIN ordine o ON s.id_ordine = o.id_ordine
+		WHERE s.id_ordine = ANY($1)
+	`, idOrdini)
+	if err != nil {
+		return nil, err
+	}
+	scontrini := make(map[int]*scontrinoEmesso)
+	for rows.Next() {
+		s := &scontrinoEmesso{Scontrino: models.Scontrino{IVA: []models.RiepilogoIVA{}}}
+		err := rows.Scan(&s.IDOrdine, &s.IDTavolo, &s.DataOrdine, &s.CostoTotale, &s.ImportoAllaCarta,
+			&s.NumMenuFissi, &s.ImportoMenuFissi, &s.ImportoSconti, &s.ImportoServizio,
+			&s.NumCoperti, &s.CostoCoperto, &s.ImportoCoperto, &s.TotaleComplessivo,
+			&s.TotaleImponibile, &s.TotaleImposta)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		scontrini[s.IDOrdine] = s
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = tx.Query(ctx, `
+		SELECT id_ordine, aliquota, imponibile, imposta, totale
+		FROM scontrino_iva
+		WHERE id_ordine = ANY($1)
+		ORDER BY id_ordine, aliquota
+	`, idOrdini)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idOrdine int
+		var iva models.RiepilogoIVA
+		if err := rows.Scan(&idOrdine, &iva.Aliquota, &iva.Imponibile, &iva.Imposta, &iva.Totale); err != nil {
+			return nil, err
+		}
+		if s, ok := scontrini[idOrdine]; ok {
+			s.IVA = append(s.IVA, iva)
+		}
+	}
+	return scontrini, rows.Err()
+}
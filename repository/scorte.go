@@ -0,0 +1,155 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"ristorante-api/models"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// IngredienteMancante indica un ingrediente con scorte insufficienti: quantità necessaria e disponibile
+type IngredienteMancante struct {
+	IDIngrediente int     `json:"id_ingrediente"`
+	Nome          string  `json:"nome"`
+	UnitaMisura   string  `json:"unita_misura"`
+	Necessario    float64 `json:"necessario"`
+	Disponibile   float64 `json:"disponibile"`
+}
+
+// ErrIngredientiMancanti è l'errore restituito quando le scorte non bastano a preparare quanto ordinato
+// Elenca tutti gli ingredienti insufficienti; errors.Is(err, ErrIngredientiInsufficienti) è vero
+type ErrIngredientiMancanti struct {
+	Mancanti []IngredienteMancante
+}
+
+func (e *ErrIngredientiMancanti) Error() string {
+	voci := make([]string, len(e.Mancanti))
+	for i, m := range e.Mancanti {
+		voci[i] = fmt.Sprintf("%s (necessari %g %s, disponibili %g %s)", m.Nome, m.Necessario, m.UnitaMisura, m.Disponibile, m.UnitaMisura)
+	}
+	return fmt.Sprintf("%s: %s", ErrIngredientiInsufficienti, strings.Join(voci, ", "))
+}
+
+func (e *ErrIngredientiMancanti) Unwrap() error {
+	return ErrIngredientiInsufficienti
+}
+
+// scalaIngredienti scala dal magazzino le quantità indicate, all'interno della transazione fornita,
+// registrando uno scarico per ogni ingrediente (riferito all'ordine, se idOrdine non è zero)
+// Le righe degli ingredienti vengono bloccate (SELECT ... FOR UPDATE, in ordine di ID per evitare deadlock)
+// prima di verificarne la disponibilità: una transazione concorrente sugli stessi ingredienti attende
+// il commit e rilegge le scorte aggiornate, quindi le quantità non possono scendere sotto zero
+func scalaIngredienti(ctx context.Context, tx pgx.Tx, idOrdine int, ingredientiNecessari map[int]float64) error {
+	if len(ingredientiNecessari) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(ingredientiNecessari))
+	for id := range ingredientiNecessari {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	// I lotti scaduti non si possono usare: il loro residuo diventa spreco prima della verifica
+	for _, id := range ids {
+		if err := smaltisciLottiScaduti(ctx, tx, id, nil); err != nil {
+			return err
+		}
+	}
+
+	// 1. Blocca le righe degli ingredienti e verifica le scorte
+	rows, err := tx.Query(ctx, `
+		SELECT id_ingrediente, nome, unita_misura, quantita_disponibile
+		FROM ingrediente
+		WHERE id_ingrediente = ANY($1)
+		ORDER BY id_ingrediente
+		FOR UPDATE
+	`, ids)
+	if err != nil {
+		return err
+	}
+	var mancanti []IngredienteMancante
+	for rows.Next() {
+		var m IngredienteMancante
+		if err := rows.Scan(&m.IDIngrediente, &m.Nome, &m.UnitaMisura, &m.Disponibile); err != nil {
+			rows.Close()
+			return err
+		}
+		m.Necessario = ingredientiNecessari[m.IDIngrediente]
+		if m.Disponibile < m.Necessario {
+			mancanti = append(mancanti, m)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(mancanti) > 0 {
+		return &ErrIngredientiMancanti{Mancanti: mancanti}
+	}
+
+	// 2. Scala le quantità dalle righe bloccate
+	for _, id := range ids {
+		err := movimentaScorta(ctx, tx, &models.MovimentoMagazzino{
+			IDIngrediente: id,
+			Tipo:          models.MovimentoScarico,
+			Quantita:      -ingredientiNecessari[id],
+			IDOrdine:      riferimentoOrdine(idOrdine),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ripristinaIngredienti restituisce al magazzino le quantità indicate, all'interno della transazione fornita
+// Il ripristino è registrato come storno dello scarico dell'ordine
+func ripristinaIngredienti(ctx context.Context, tx pgx.Tx, idOrdine int, quantita map[int]float64) error {
+	ids := make([]int, 0, len(quantita))
+	for id := range quantita {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	for _, id := range ids {
+		err := movimentaScorta(ctx, tx, &models.MovimentoMagazzino{
+			IDIngrediente: id,
+			Tipo:          models.MovimentoStorno,
+			Quantita:      quantita[id],
+			IDOrdine:      riferimentoOrdine(idOrdine),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// riferimentoOrdine restituisce il riferimento all'ordine da registrare nel movimento (nessuno se zero)
+func riferimentoOrdine(idOrdine int) *int {
+	if idOrdine == 0 {
+		return nil
+	}
+	return &idOrdine
+}
+
+// ingredientiPietanza restituisce le quantità di ingredienti della ricetta di una pietanza per il numero di porzioni indicato,
+// nell'unità di misura del magazzino. Usa la versione della ricetta indicata (quella registrata sulla riga dell'ordine)
+// oppure, se nil, la versione attiva
+func ingredientiPietanza(ctx context.Context, tx pgx.Tx, idPietanza int, idRicetta *int, porzioni int) (map[int]float64, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT ri.id_ingrediente, ri.quantita, COALESCE(ri.unita_misura, i.unita_misura), i.unita_misura, i.peso_pezzo
+		FROM ricetta_ingrediente ri
+		JOIN ingrediente i ON ri.id_ingrediente = i.id_ingrediente
+		WHERE ri.id_ricetta = COALESCE($2::int, (SELECT id_ricetta FROM ricetta WHERE id_pietanza = $1 AND attiva))
+	`, idPietanza, idRicetta)
+	if err != nil {
+		return nil, err
+	}
+	return sommaIngredientiRicetta(rows, porzioni)
+}
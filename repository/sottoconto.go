@@ -0,0 +1,433 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ristorante-api/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Numero massimo di parti in cui è possibile dividere un conto
+const maxPartiScontrino = 50
+
+// Errori personalizzati
+var (
+	ErrDivisioneNonValida    = errors.New("divisione del conto non valida")
+	ErrSottocontoPagato      = errors.New("il conto diviso ha già parti pagate e non può essere modificato")
+	ErrSottocontoInesistente = errors.New("sottoconto non trovato per l'ordine")
+	ErrContoDiviso           = errors.New("il conto è diviso: indicare il sottoconto da pagare")
+)
+
+// DividiScontrinoEquo divide lo scontrino dell'ordine consegnato di un tavolo in parti uguali
+// Il resto dei centesimi viene assegnato alle prime parti, così la somma coincide con il totale
+// Se salva è true la divisione viene registrata e ogni parte può essere pagata separatamente
+func (r *OrdineRepository) DividiScontrinoEquo(ctx context.Context, idTavolo int, numParti int, salva bool) (*models.ScontrinoDiviso, error) {
+	if numParti < 1 || numParti > maxPartiScontrino {
+		return nil, fmt.Errorf("%w: il numero di parti deve essere compreso tra 1 e %d", ErrDivisioneNonValida, maxPartiScontrino)
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ordine, err := ordineConsegnatoPerTavolo(ctx, tx, idTavolo, salva)
+	if err != nil {
+		return nil, err
+	}
+
+	scontrino, err := calcolaScontrinoOrdine(ctx, tx, ordine)
+	if err != nil {
+		return nil, err
+	}
+
+	pesi := make([]int64, numParti)
+	for i := range pesi {
+		pesi[i] = 1
+	}
+	subtotali := ripartisci(scontrino.TotaleVoci().Centesimi(), pesi)
+	coperti := ripartisci(scontrino.ImportoCoperto.Centesimi(), pesi)
+	persone := ripartisci(int64(scontrino.NumCoperti), pesi)
+
+	parti := make([]models.Sottoconto, numParti)
+	for i := range parti {
+		parti[i] = models.Sottoconto{
+			IDOrdine:       ordine.ID,
+			Nome:           fmt.Sprintf("Parte %d", i+1),
+			NumPersone:     int(persone[i]),
+			Subtotale:      models.ImportoDaCentesimi(subtotali[i]),
+			ImportoCoperto: models.ImportoDaCentesimi(coperti[i]),
+			Totale:         models.ImportoDaCentesimi(subtotali[i] + coperti[i]),
+		}
+	}
+
+	if salva {
+		if err = salvaSottoconti(ctx, tx, ordine.ID, parti); err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.ScontrinoDiviso{
+		Scontrino: *scontrino,
+		Modalita:  models.DivisioneEqua,
+		Parti:     parti,
+	}, nil
+}
+
+// DividiScontrinoPerVoce divide lo scontrino dell'ordine consegnato di un tavolo assegnando
+// ogni riga alla carta e ogni menu fisso a una parte nominativa
+// Ogni voce deve essere assegnata a una sola parte e la somma delle persone deve coincidere
+// con i coperti dell'ordine: il coperto viene addebitato a ciascuna parte per persona
+// La divisione viene registrata e ogni parte può essere pagata separatamente
+func (r *OrdineRepository) DividiScontrinoPerVoce(ctx context.Context, idTavolo int, richieste []models.RichiestaParte) (*models.ScontrinoDiviso, error) {
+	if len(richieste) < 1 || len(richieste) > maxPartiScontrino {
+		return nil, fmt.Errorf("%w: il numero di parti deve essere compreso tra 1 e %d", ErrDivisioneNonValida, maxPartiScontrino)
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	ordine, err := ordineConsegnatoPerTavolo(ctx, tx, idTavolo, true)
+	if err != nil {
+		return nil, err
+	}
+
+	scontrino, err := calcolaScontrinoOrdine(ctx, tx, ordine)
+	if err != nil {
+		return nil, err
+	}
+
+	// 1. Recupera l'importo di ogni riga alla carta
+	importiRighe := make(map[int]int64)
+	rows, err := tx.Query(ctx, `
+		SELECT d.id_dettaglio, d.prezzo_unitario * d.quantita
+		FROM dettaglio_ordine_pietanza d
+		WHERE d.id_ordine = $1 AND d.parte_di_menu = false
+	`, ordine.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var idDettaglio int
+		var importo models.Importo
+		if err := rows.Scan(&idDettaglio, &importo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		importiRighe[idDettaglio] = importo.Centesimi()
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 2. Recupera l'importo di ogni menu fisso (prezzo per numero di menu ordinati)
+	importiMenu := make(map[int]int64)
+	rows, err = tx.Query(ctx, `
+		SELECT pm.id_menu, m.prezzo * MAX(pm.quantita)
+		FROM (
+			SELECT id_menu, id_pietanza, SUM(quantita) AS quantita
+			FROM dettaglio_ordine_pietanza
+			WHERE id_ordine = $1 AND parte_di_menu = true
+			GROUP BY id_menu, id_pietanza
+		) AS pm
+		JOIN menu_fisso m ON pm.id_menu = m.id_menu
+		GROUP BY pm.id_menu, m.prezzo
+	`, ordine.ID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var idMenu int
+		var importo models.Importo
+		if err := rows.Scan(&idMenu, &importo); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		importiMenu[idMenu] = importo.Centesimi()
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// 3. Verifica le assegnazioni e calcola il peso di ogni parte
+	righeAssegnate := make(map[int]bool)
+	menuAssegnati := make(map[int]bool)
+	pesi := make([]int64, len(richieste))
+	totalePersone := 0
+	for i, richiesta := range richieste {
+		if richiesta.Nome == "" {
+			return nil, fmt.Errorf("%w: ogni parte deve avere un nome", ErrDivisioneNonValida)
+		}
+		if richiesta.NumPersone < 0 {
+			return nil, fmt.Errorf("%w: il numero di persone non può essere negativo", ErrDivisioneNonValida)
+		}
+		totalePersone += richiesta.NumPersone
+
+		for _, idDettaglio := range richiesta.Righe {
+			importo, ok := importiRighe[idDettaglio]
+			if !ok {
+				return nil, fmt.Errorf("%w: la riga %d non è una pietanza alla carta dell'ordine", ErrDivisioneNonValida, idDettaglio)
+			}
+			if righeAssegnate[idDettaglio] {
+				return nil, fmt.Errorf("%w: la riga %d è assegnata a più parti", ErrDivisioneNonValida, idDettaglio)
+			}
+			righeAssegnate[idDettaglio] = true
+			pesi[i] += importo
+		}
+
+		for _, idMenu := range richiesta.MenuFissi {
+			importo, ok := importiMenu[idMenu]
+			if !ok {
+				return nil, fmt.Errorf("%w: il menu fisso %d non fa parte dell'ordine", ErrDivisioneNonValida, idMenu)
+			}
+			if menuAssegnati[idMenu] {
+				return nil, fmt.Errorf("%w: il menu fisso %d è assegnato a più parti", ErrDivisioneNonValida, idMenu)
+			}
+			menuAssegnati[idMenu] = true
+			pesi[i] += importo
+		}
+	}
+
+	if len(righeAssegnate) != len(importiRighe) || len(menuAssegnati) != len(importiMenu) {
+		return nil, fmt.Errorf("%w: tutte le voci dell'ordine devono essere assegnate", ErrDivisioneNonValida)
+	}
+	if totalePersone != scontrino.NumCoperti {
+		return nil, fmt.Errorf("%w: le persone indicate (%d) non corrispondono ai coperti dell'ordine (%d)",
+			ErrDivisioneNonValida, totalePersone, scontrino.NumCoperti)
+	}
+
+	// 4. Ripartisce il costo dell'ordine, al netto di sconti e con il servizio, in proporzione
+	// alle voci assegnate, così la somma delle parti coincide sempre con lo scontrino
+	subtotali := ripartisci(scontrino.TotaleVoci().Centesimi(), pesi)
+	costoCoperto := scontrino.CostoCoperto.Centesimi()
+
+	parti := make([]models.Sottoconto, len(richieste))
+	for i, richiesta := range richieste {
+		coperto := costoCoperto * int64(richiesta.NumPersone)
+		parti[i] = models.Sottoconto{
+			IDOrdine:       ordine.ID,
+			Nome:           richiesta.Nome,
+			NumPersone:     richiesta.NumPersone,
+			Righe:          richiesta.Righe,
+			MenuFissi:      richiesta.MenuFissi,
+			Subtotale:      models.ImportoDaCentesimi(subtotali[i]),
+			ImportoCoperto: models.ImportoDaCentesimi(coperto),
+			Totale:         models.ImportoDaCentesimi(subtotali[i] + coperto),
+		}
+	}
+
+	if err = salvaSottoconti(ctx, tx, ordine.ID, parti); err != nil {
+		return nil, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return &models.ScontrinoDiviso{
+		Scontrino: *scontrino,
+		Modalita:  models.DivisionePerVoce,
+		Parti:     parti,
+	}, nil
+}
+
+// GetSottoconti restituisce le parti del conto diviso di un ordine con lo stato di pagamento
+func (r *OrdineRepository) GetSottoconti(ctx context.Context, idOrdine int) ([]models.Sottoconto, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT s.id_sottoconto, s.id_ordine, s.nome, s.num_persone, s.subtotale, s.importo_coperto, s.totale, s.pagato,
+			COALESCE(ARRAY_AGG(d.id_dettaglio ORDER BY d.id_dettaglio) FILTER (WHERE d.parte_di_menu = false), '{}'),
+			COALESCE(ARRAY_AGG(DISTINCT d.id_menu) FILTER (WHERE d.parte_di_menu = true), '{}')
+		FROM sottoconto s
+		LEFT JOIN sottoconto_riga sr ON s.id_sottoconto = sr.id_sottoconto
+		LEFT JOIN dettaglio_ordine_pietanza d ON sr.id_dettaglio = d.id_dettaglio
+		WHERE s.id_ordine = $1
+		GROUP BY s.id_sottoconto
+		ORDER BY s.id_sottoconto
+	`, idOrdine)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sottoconti := []models.Sottoconto{}
+	for rows.Next() {
+		var s models.Sottoconto
+		err := rows.Scan(&s.ID, &s.IDOrdine, &s.Nome, &s.NumPersone, &s.Subtotale, &s.ImportoCoperto,
+			&s.Totale, &s.Pagato, &s.Righe, &s.MenuFissi)
+		if err != nil {
+			return nil, err
+		}
+		sottoconti = append(sottoconti, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sottoconti, nil
+}
+
+// ordineConsegnatoPerTavolo recupera l'ordine in stato "consegnato" più recente di un tavolo
+// Se perAggiornamento è true la riga dell'ordine viene bloccata fino al termine della transazione
+func ordineConsegnatoPerTavolo(ctx context.Context, tx pgx.Tx, idTavolo int, perAggiornamento bool) (models.Ordine, error) {
+	query := `
+		SELECT id_ordine, id_tavolo, num_persone, data_ordine, stato, id_ristorante, costo_totale
+		FROM ordine 
+		WHERE id_tavolo = $1 AND stato = 'consegnato'
+		ORDER BY data_ordine DESC
+		LIMIT 1
+	`
+	if perAggiornamento {
+		query += " FOR UPDATE"
+	}
+
+	var ordine models.Ordine
+	err := tx.QueryRow(ctx, query, idTavolo).Scan(
+		&ordine.ID, &ordine.IDTavolo, &ordine.NumPersone, &ordine.DataOrdine,
+		&ordine.Stato, &ordine.IDRistorante, &ordine.CostoTotale,
+	)
+	if err != nil {
+		// Verifica se l'errore è dovuto all'assenza di righe
+		if err == pgx.ErrNoRows {
+			return models.Ordine{}, &models.ErrOrdineNonTrovato{
+				IDTavolo:        idTavolo,
+				StatoRichiesto:  models.StatoConsegnato,
+				MessaggioErrore: "Nessun ordine in stato 'consegnato' trovato per il tavolo specificato",
+			}
+		}
+		return models.Ordine{}, err
+	}
+	return ordine, nil
+}
+
+// salvaSottoconti registra la divisione del conto di un ordine sostituendo quella precedente
+// Non è possibile modificare una divisione di cui almeno una parte è già stata pagata
+func salvaSottoconti(ctx context.Context, tx pgx.Tx, idOrdine int, parti []models.Sottoconto) error {
+	err := annullaDivisione(ctx, tx, idOrdine)
+	if err != nil {
+		return err
+	}
+
+	for i := range parti {
+		p := &parti[i]
+		err = tx.QueryRow(ctx, `
+			INSERT INTO sottoconto (id_ordine, nome, num_persone, subtotale, importo_coperto, totale)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id_sottoconto
+		`, idOrdine, p.Nome, p.NumPersone, p.Subtotale, p.ImportoCoperto, p.Totale).Scan(&p.ID)
+		if err != nil {
+			return err
+		}
+
+		// Registra le righe assegnate: per i menu fissi tutte le righe che li compongono
+		_, err = tx.Exec(ctx, `
+			INSERT INTO sottoconto_riga (id_sottoconto, id_dettaglio)
+			SELECT $1, d.id_dettaglio
+			FROM dettaglio_ordine_pietanza d
+			WHERE d.id_ordine = $2
+			  AND ((d.parte_di_menu = false AND d.id_dettaglio = ANY($3))
+			    OR (d.parte_di_menu = true AND d.id_menu = ANY($4)))
+		`, p.ID, idOrdine, p.Righe, p.MenuFissi)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// annullaDivisione elimina la divisione del conto di un ordine, se presente
+// Non è possibile annullare una divisione di cui almeno una parte è già stata pagata
+func annullaDivisione(ctx context.Context, tx pgx.Tx, idOrdine int) error {
+	var partiPagate bool
+	err := tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM sottoconto WHERE id_ordine = $1 AND pagato = true)
+	`, idOrdine).Scan(&partiPagate)
+	if err != nil {
+		return err
+	}
+	if partiPagate {
+		return ErrSottocontoPagato
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM sottoconto WHERE id_ordine = $1`, idOrdine)
+	return err
+}
+
+// sottocontoPerPagamento recupera e blocca una parte non ancora pagata del conto di un ordine
+func sottocontoPerPagamento(ctx context.Context, tx pgx.Tx, idOrdine int, idSottoconto int) (*models.Sottoconto, error) {
+	var s models.Sottoconto
+	err := tx.QueryRow(ctx, `
+		SELECT id_sottoconto, id_ordine, nome, num_persone, subtotale, importo_coperto, totale, pagato
+		FROM sottoconto
+		WHERE id_sottoconto = $1 AND id_ordine = $2
+		FOR UPDATE
+	`, idSottoconto, idOrdine).Scan(&s.ID, &s.IDOrdine, &s.Nome, &s.NumPersone, &s.Subtotale,
+		&s.ImportoCoperto, &s.Totale, &s.Pagato)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return nil, ErrSottocontoInesistente
+		}
+		return nil, err
+	}
+	if s.Pagato {
+		return nil, ErrSottocontoPagato
+	}
+	return &s, nil
+}
+
+// ripartisci divide un totale intero (es. centesimi) in parti proporzionali ai pesi
+// con il metodo dei resti maggiori: la somma delle parti coincide sempre con il totale
+// Se tutti i pesi sono nulli il totale viene diviso in parti uguali
+func ripartisci(totale int64, pesi []int64) []int64 {
+	parti := make([]int64, len(pesi))
+	if len(pesi) == 0 {
+		return parti
+	}
+
+	var sommaPesi int64
+	for _, p := range pesi {
+		sommaPesi += p
+	}
+	if sommaPesi == 0 {
+		pesi = make([]int64, len(parti))
+		for i := range pesi {
+			pesi[i] = 1
+		}
+		sommaPesi = int64(len(pesi))
+	}
+
+	// Quota intera di ogni parte e resto della divisione
+	resti := make([]int64, len(pesi))
+	var assegnato int64
+	for i, p := range pesi {
+		parti[i] = totale * p / sommaPesi
+		resti[i] = totale * p % sommaPesi
+		assegnato += parti[i]
+	}
+
+	// Distribuisce le unità rimanenti alle parti con il resto maggiore
+	// (a parità di resto, alla prima parte)
+	for rimanenti := totale - assegnato; rimanenti > 0; rimanenti-- {
+		migliore := 0
+		for i := range resti {
+			if resti[i] > resti[migliore] {
+				migliore = i
+			}
+		}
+		parti[migliore]++
+		resti[migliore] = -1
+	}
+
+	return parti
+}
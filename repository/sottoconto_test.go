@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestRipartisci(t *testing.T) {
+	tests := []struct {
+		name   string
+		totale int64
+		pesi   []int64
+		attese []int64
+	}{
+		{"parti uguali esatte", 900, []int64{1, 1, 1}, []int64{300, 300, 300}},
+		{"resto alle prime parti", 1000, []int64{1, 1, 1}, []int64{334, 333, 333}},
+		{"due centesimi su tre parti", 2, []int64{1, 1, 1}, []int64{1, 1, 0}},
+		{"proporzionale", 1000, []int64{1, 3}, []int64{250, 750}},
+		{"resti maggiori", 100, []int64{1, 2, 4}, []int64{14, 29, 57}},
+		{"pesi nulli in parti uguali", 100, []int64{0, 0, 0}, []int64{34, 33, 33}},
+		{"peso nullo", 100, []int64{0, 5, 5}, []int64{0, 50, 50}},
+		{"una parte", 1234, []int64{7}, []int64{1234}},
+		{"totale nullo", 0, []int64{1, 2}, []int64{0, 0}},
+		{"nessuna parte", 1000, []int64{}, []int64{}},
+		{"prezzi in centesimi", 2500, []int64{1200, 800, 600}, []int64{1154, 769, 577}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ripartisci(tt.totale, tt.pesi)
+			if !slices.Equal(got, tt.attese) {
+				t.Errorf("ripartisci(%d, %v) = %v, attese %v", tt.totale, tt.pesi, got, tt.attese)
+			}
+		})
+	}
+}
+
+func TestRipartisciSommaTotale(t *testing.T) {
+	pesi := [][]int64{
+		{1, 1, 1, 1, 1, 1, 1},
+		{3, 7, 11},
+		{1250, 800, 45, 999},
+		{0, 0, 1},
+		{1},
+	}
+	for _, p := range pesi {
+		for totale := int64(0); totale <= 1000; totale += 37 {
+			var somma int64
+			for _, parte := range ripartisci(totale, p) {
+				if parte < 0 {
+					t.Fatalf("ripartisci(%d, %v): parte negativa %d", totale, p, parte)
+				}
+				somma += parte
+			}
+			if somma != totale {
+				t.Errorf("ripartisci(%d, %v): somma %d, attesa %d", totale, p, somma, totale)
+			}
+		}
+	}
+}
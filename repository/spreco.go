@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"ristorante-api/models"
+	"sort"
+)
+
+// Errori personalizzati
+var (
+	ErrCausaleSprecoNonValida = errors.New("causale di spreco non valida (scaduto, bruciato, caduto, reso_cliente)")
+)
+
+// RegistraSpreco scala dal magazzino una quantità di ingrediente buttata con la relativa causale,
+// valorizzandola al costo unitario corrente; non si può sprecare più della quantità disponibile
+// Uno spreco "scaduto" preleva prima dai lotti scaduti; con le altre causali il residuo dei lotti scaduti
+// diventa prima spreco "scaduto" e la quantità si preleva dalle scorte utilizzabili
+func (r *IngredienteRepository) RegistraSpreco(ctx context.Context, id int, quantita float64, causale string, note string) (*models.Spreco, error) {
+	if quantita <= 0 {
+		return nil, ErrQuantitaMovimentoNonValida
+	}
+	if !models.CausaleSprecoValida(causale) {
+		return nil, ErrCausaleSprecoNonValida
+	}
+
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Smaltisce i lotti scaduti prima di leggere le scorte, salvo che lo spreco sia proprio quello
+	if causale != models.CausaleScaduto {
+		if err := smaltisciLottiScaduti(ctx, tx, id, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	// 2. Scala la quantità con un movimento di spreco
+	movimento := &models.MovimentoMagazzino{
+		IDIngrediente: id,
+		Tipo:          models.MovimentoSpreco,
+		Quantita:      -quantita,
+		Note:          note,
+	}
+	if err := registraMovimento(ctx, tx, movimento); err != nil {
+		return nil, err
+	}
+	if movimento.QuantitaDopo < 0 {
+		var m IngredienteMancante
+		err := tx.QueryRow(ctx, `
+			SELECT id_ingrediente, nome, unita_misura FROM ingrediente WHERE id_ingrediente = $1
+		`, id).Scan(&m.IDIngrediente, &m.Nome, &m.UnitaMisura)
+		if err != nil {
+			return nil, err
+		}
+		m.Necessario, m.Disponibile = quantita, movimento.QuantitaPrima
+		return nil, &ErrIngredientiMancanti{Mancanti: []IngredienteMancante{m}}
+	}
+
+	// 3. Preleva dai lotti (prima da quelli scaduti per uno spreco "scaduto") e aggiorna le pietanze
+	daPrelevare := quantita
+	if causale == models.CausaleScaduto {
+		daPrelevare, err = consumaLottiScaduti(ctx, tx, movimento.ID, id, quantita)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if daPrelevare > 0 {
+		if err := consumaLotti(ctx, tx, movimento.ID, id, daPrelevare); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := aggiornaDisponibilitaIngrediente(ctx, tx, id, movimento.ID); err != nil {
+		return nil, err
+	}
+
+	// 4. Registra causale e costo dello spreco
+	spreco := &models.Spreco{
+		IDMovimento:   movimento.ID,
+		IDIngrediente: id,
+		Causale:       causale,
+		Quantita:      quantita,
+		Note:          note,
+		DataSpreco:    movimento.DataMovimento,
+	}
+	err = tx.QueryRow(ctx, `
+		INSERT INTO spreco (id_movimento, causale, costo_unitario)
+		SELECT $1, $2, costo_unitario FROM ingrediente WHERE id_ingrediente = $3
+		RETURNING id_spreco, costo_unitario
+	`, movimento.ID, causale, id).Scan(&spreco.ID, &spreco.CostoUnitario)
+	if err != nil {
+		return nil, err
+	}
+	spreco.Valore = models.CostoPerQuantita(spreco.CostoUnitario, quantita)
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return spreco, nil
+}
+
+// Sprechi riassume gli sprechi nel periodo (date AAAA-MM-GG, estremi inclusi) per ingrediente e per causale,
+// dal valore più alto
+func (r *ReportRepository) Sprechi(ctx context.Context, dal string, al string) (*models.ReportSprechi, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT m.id_ingrediente, i.nome, i.unita_misura, s.causale, -m.quantita, s.costo_unitario
+		FROM spreco s
+		JOIN movimento_magazzino m ON s.id_movimento = m.id_movimento
+		JOIN ingrediente i ON m.id_ingrediente = i.id_ingrediente
+		WHERE m.data_movimento >= $1::date AND m.data_movimento < $2::date + 1
+		ORDER BY m.data_movimento
+	`, dal, al)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	report := &models.ReportSprechi{Dal: dal, Al: al}
+	perIngrediente := make(map[int]*models.SprecoIngrediente)
+	perCausale := make(map[string]*models.SprecoCausale)
+	for rows.Next() {
+		var ingrediente models.SprecoIngrediente
+		var causale string
+		var costoUnitario models.CostoUnitario
+		if err := rows.Scan(&ingrediente.IDIngrediente, &ingrediente.Nome, &ingrediente.UnitaMisura,
+			&causale, &ingrediente.Quantita, &costoUnitario); err != nil {
+			return nil, err
+		}
+		valore := models.CostoPerQuantita(costoUnitario, ingrediente.Quantita)
+
+		voce, ok := perIngrediente[ingrediente.IDIngrediente]
+		if !ok {
+			voce = &models.SprecoIngrediente{IDIngrediente: ingrediente.IDIngrediente, Nome: ingrediente.Nome, UnitaMisura: ingrediente.UnitaMisura}
+			perIngrediente[ingrediente.IDIngrediente] = voce
+		}
+		voce.NumSprechi++
+		voce.Quantita += ingrediente.Quantita
+		voce.Valore += valore
+
+		c, ok := perCausale[causale]
+		if !ok {
+			c = &models.SprecoCausale{Causale: causale}
+			perCausale[causale] = c
+		}
+		c.NumSprechi++
+		c.Valore += valore
+
+		report.NumSprechi++
+		report.ValoreTotale += valore
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report.PerIngrediente = make([]models.SprecoIngrediente, 0, len(perIngrediente))
+	for _, voce := range perIngrediente {
+		report.PerIngrediente = append(report.PerIngrediente, *voce)
+	}
+	sort.Slice(report.PerIngrediente, func(i, j int) bool {
+		if report.PerIngrediente[i].Valore != report.PerIngrediente[j].Valore {
+			return report.PerIngrediente[i].Valore > report.PerIngrediente[j].Valore
+		}
+		return report.PerIngrediente[i].Nome < report.PerIngrediente[j].Nome
+	})
+
+	report.PerCausale = make([]models.SprecoCausale, 0, len(perCausale))
+	for _, c := range perCausale {
+		report.PerCausale = append(report.PerCausale, *c)
+	}
+	sort.Slice(report.PerCausale, func(i, j int) bool {
+		if report.PerCausale[i].Valore != report.PerCausale[j].Valore {
+			return report.PerCausale[i].Valore > report.PerCausale[j].Valore
+		}
+		return report.PerCausale[i].Causale < report.PerCausale[j].Causale
+	})
+	return report, nil
+}
@@ -2,11 +2,20 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"ristorante-api/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Errori personalizzati
+var (
+	ErrTavoloInesistente     = errors.New("tavolo non trovato")
+	ErrTavoloAltroRistorante = errors.New("il tavolo non appartiene al ristorante indicato")
+	ErrTavoloConOrdiniAperti = errors.New("il tavolo ha ordini aperti: non può passare a un altro ristorante")
+)
+
 type TavoloRepository struct {
 	DB *pgxpool.Pool
 }
@@ -15,8 +24,13 @@ func NewTavoloRepository(db *pgxpool.Pool) *TavoloRepository {
 	return &TavoloRepository{DB: db}
 }
 
-func (r *TavoloRepository) GetAll(ctx context.Context) ([]models.Tavolo, error) {
-	rows, err := r.DB.Query(ctx, "SELECT id_tavolo, max_posti, stato, id_ristorante FROM tavolo ORDER BY id_tavolo")
+// GetAll recupera i tavoli del ristorante indicato o, con idRistorante 0, di tutti i ristoranti
+func (r *TavoloRepository) GetAll(ctx context.Context, idRistorante int) ([]models.Tavolo, error) {
+	rows, err := r.DB.Query(ctx, `
+		SELECT id_tavolo, max_posti, stato, id_ristorante
+		FROM tavolo
+		WHERE $1::int = 0 OR id_ristorante = $1::int
+		ORDER BY id_tavolo`, idRistorante)
 	if err != nil {
 		return nil, err
 	}
@@ -44,12 +58,12 @@ func (r *TavoloRepository) GetByID(ctx context.Context, id int) (models.Tavolo,
 	return t, nil
 }
 
-// Get tavoli liberi
+// GetTavoliLiberi recupera i tavoli liberi del ristorante indicato o, con idRistorante 0, di tutti i ristoranti
 func (r *TavoloRepository) GetTavoliLiberi(ctx context.Context, idRistorante int) ([]models.Tavolo, error) {
 	rows, err := r.DB.Query(ctx, `
 		SELECT id_tavolo, max_posti, stato, id_ristorante
 		FROM tavolo
-		WHERE id_ristorante = $1 AND stato = 'libero'
+		WHERE ($1::int = 0 OR id_ristorante = $1::int) AND stato = 'libero'
 		ORDER BY id_tavolo`, idRistorante)
 	if err != nil {
 		return nil, err
@@ -67,12 +81,12 @@ func (r *TavoloRepository) GetTavoliLiberi(ctx context.Context, idRistorante int
 	return tavoli, nil
 }
 
-// GetTavoliOccupati recupera tutti i tavoli occupati per un ristorante specifico
+// GetTavoliOccupati recupera i tavoli occupati del ristorante indicato o, con idRistorante 0, di tutti i ristoranti
 func (r *TavoloRepository) GetTavoliOccupati(ctx context.Context, idRistorante int) ([]models.Tavolo, error) {
 	rows, err := r.DB.Query(ctx, `
 		SELECT id_tavolo, max_posti, stato, id_ristorante
 		FROM tavolo
-		WHERE id_ristorante = $1 AND stato = 'occupato'
+		WHERE ($1::int = 0 OR id_ristorante = $1::int) AND stato = 'occupato'
 		ORDER BY id_tavolo`, idRistorante)
 	if err != nil {
 		return nil, err
@@ -90,10 +104,36 @@ func (r *TavoloRepository) GetTavoliOccupati(ctx context.Context, idRistorante i
 	return tavoli, nil
 }
 
+// IDRistorante restituisce il ristorante a cui appartiene il tavolo
+func (r *TavoloRepository) IDRistorante(ctx context.Context, id int) (int, error) {
+	return ristoranteTavolo(ctx, r.DB, id)
+}
+
+func ristoranteTavolo(ctx context.Context, db dbtx, id int) (int, error) {
+	var idRistorante int
+	err := db.QueryRow(ctx, "SELECT id_ristorante FROM tavolo WHERE id_tavolo = $1", id).Scan(&idRistorante)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return 0, ErrTavoloInesistente
+		}
+		return 0, err
+	}
+	return idRistorante, nil
+}
+
 // CambiaStato cambia lo stato di un tavolo
 func (r *TavoloRepository) CambiaStato(ctx context.Context, id int, nuovoStato string) (models.Tavolo, error) {
+	return cambiaStatoTavolo(ctx, r.DB, id, nuovoStato)
+}
+
+// CambiaStatoTx cambia lo stato di un tavolo all'interno di una transazione fornita
+func (r *TavoloRepository) CambiaStatoTx(ctx context.Context, tx pgx.Tx, id int, nuovoStato string) (models.Tavolo, error) {
+	return cambiaStatoTavolo(ctx, tx, id, nuovoStato)
+}
+
+func cambiaStatoTavolo(ctx context.Context, db dbtx, id int, nuovoStato string) (models.Tavolo, error) {
 	var t models.Tavolo
-	err := r.DB.QueryRow(ctx, `
+	err := db.QueryRow(ctx, `
 		UPDATE tavolo SET stato = $1
 		WHERE id_tavolo = $2
 		RETURNING id_tavolo, max_posti, stato, id_ristorante`, nuovoStato, id).
@@ -112,12 +152,59 @@ func (r *TavoloRepository) Create(ctx context.Context, t *models.Tavolo) error {
 		t.MaxPosti, t.Stato, t.IDRistorante).
 		Scan(&t.ID)
 }
+
+// Update aggiorna il tavolo; può passare a un altro ristorante esistente, ma non finché ha ordini aperti,
+// che altrimenti resterebbero nel ristorante precedente
 func (r *TavoloRepository) Update(ctx context.Context, id int, t models.Tavolo) error {
-	_, err := r.DB.Exec(ctx, `
+	tx, err := r.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// 1. Blocca il tavolo: un ordine aperto nel frattempo attende il cambio di ristorante
+	var idRistorante int
+	err = tx.QueryRow(ctx, `
+		SELECT id_ristorante FROM tavolo WHERE id_tavolo = $1 FOR UPDATE
+	`, id).Scan(&idRistorante)
+	if err != nil {
+		if err == pgx.ErrNoRows {
+			return ErrTavoloInesistente
+		}
+		return err
+	}
+
+	// 2. Il cambio di ristorante è consentito solo verso un ristorante esistente e senza ordini aperti
+	if t.IDRistorante != idRistorante {
+		var esiste, ordiniAperti bool
+		err = tx.QueryRow(ctx, `
+			SELECT
+				EXISTS(SELECT 1 FROM ristorante WHERE id_ristorante = $2),
+				EXISTS(
+					SELECT 1 FROM ordine
+					WHERE id_tavolo = $1 AND stato NOT IN ('pagato', 'annullato')
+				)
+		`, id, t.IDRistorante).Scan(&esiste, &ordiniAperti)
+		if err != nil {
+			return err
+		}
+		if !esiste {
+			return ErrRistoranteInesistente
+		}
+		if ordiniAperti {
+			return ErrTavoloConOrdiniAperti
+		}
+	}
+
+	// 3. Aggiorna il tavolo
+	_, err = tx.Exec(ctx, `
 		UPDATE tavolo SET max_posti = $1, stato = $2, id_ristorante = $3
 		WHERE id_tavolo = $4`,
 		t.MaxPosti, t.Stato, t.IDRistorante, id)
-	return err
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (r *TavoloRepository) Delete(ctx context.Context, id int) error {
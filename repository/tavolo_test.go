@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"ristorante-api/models"
+	"testing"
+	"time"
+)
+
+// TestUpdateTavoloCambioRistorante passa un tavolo a un altro ristorante: rifiutato finché ha ordini
+// aperti o se il ristorante non esiste, consentito quando gli ordini sono chiusi
+func TestUpdateTavoloCambioRistorante(t *testing.T) {
+	ctx, pool := databaseTest(t)
+
+	nome := fmt.Sprintf("test cambio ristorante %d", time.Now().UnixNano())
+	ristoranti := make([]int, 2)
+	for i := range ristoranti {
+		err := pool.QueryRow(ctx, `
+			INSERT INTO ristorante (nome, numero_tavoli, costo_coperto) VALUES ($1, 1, 0) RETURNING id_ristorante
+		`, fmt.Sprintf("%s %d", nome, i)).Scan(&ristoranti[i])
+		if err != nil {
+			t.Fatalf("creazione del ristorante: %v", err)
+		}
+		id := ristoranti[i]
+		t.Cleanup(func() {
+			pool.Exec(context.Background(), `DELETE FROM ristorante WHERE id_ristorante = $1`, id)
+		})
+	}
+	var idTavolo, idOrdine int
+	err := pool.QueryRow(ctx, `
+		INSERT INTO tavolo (max_posti, id_ristorante) VALUES (4, $1) RETURNING id_tavolo
+	`, ristoranti[0]).Scan(&idTavolo)
+	if err != nil {
+		t.Fatalf("creazione del tavolo: %v", err)
+	}
+	err = pool.QueryRow(ctx, `
+		INSERT INTO ordine (id_tavolo, num_persone, id_ristorante) VALUES ($1, 2, $2) RETURNING id_ordine
+	`, idTavolo, ristoranti[0]).Scan(&idOrdine)
+	if err != nil {
+		t.Fatalf("creazione dell'ordine: %v", err)
+	}
+
+	repo := NewTavoloRepository(pool)
+	tavolo := models.Tavolo{MaxPosti: 4, Stato: "libero", IDRistorante: ristoranti[1]}
+
+	// 1. Con un ordine aperto il tavolo resta nel ristorante
+	if err := repo.Update(ctx, idTavolo, tavolo); !errors.Is(err, ErrTavoloConOrdiniAperti) {
+		t.Fatalf("cambio con ordini aperti: errore %v, atteso ErrTavoloConOrdiniAperti", err)
+	}
+
+	// 2. Un ristorante inesistente è rifiutato
+	inesistente := tavolo
+	inesistente.IDRistorante = -1
+	if err := repo.Update(ctx, idTavolo, inesistente); !errors.Is(err, ErrRistoranteInesistente) {
+		t.Fatalf("cambio verso un ristorante inesistente: errore %v, atteso ErrRistoranteInesistente", err)
+	}
+
+	// 3. Chiuso l'ordine, il tavolo passa all'altro ristorante
+	if _, err := pool.Exec(ctx, `UPDATE ordine SET stato = 'annullato' WHERE id_ordine = $1`, idOrdine); err != nil {
+		t.Fatalf("chiusura dell'ordine: %v", err)
+	}
+	if err := repo.Update(ctx, idTavolo, tavolo); err != nil {
+		t.Fatalf("cambio senza ordini aperti: %v", err)
+	}
+	idRistorante, err := repo.IDRistorante(ctx, idTavolo)
+	if err != nil {
+		t.Fatalf("lettura del ristorante del tavolo: %v", err)
+	}
+	if idRistorante != ristoranti[1] {
+		t.Errorf("ristorante del tavolo = %d, atteso %d", idRistorante, ristoranti[1])
+	}
+}
@@ -0,0 +1,36 @@
+package stampa
+
+import "bytes"
+
+// Comandi ESC/POS
+var (
+	escposInizializza    = []byte{0x1B, 0x40}             // ESC @
+	escposCodePage1252   = []byte{0x1B, 0x74, 0x10}       // ESC t 16: Windows-1252
+	escposGrassettoOn    = []byte{0x1B, 0x45, 0x01}       // ESC E 1
+	escposGrassettoOff   = []byte{0x1B, 0x45, 0x00}       // ESC E 0
+	escposAvanzaRighe    = []byte{0x1B, 0x64, 0x04}       // ESC d 4: avanza di 4 righe
+	escposTaglioParziale = []byte{0x1D, 0x56, 0x42, 0x00} // GS V 66 0: taglio parziale
+)
+
+// ESCPOS restituisce lo scontrino come sequenza di comandi ESC/POS da inviare
+// direttamente a una stampante termica da 80 mm, terminata dal taglio della carta
+func ESCPOS(d DatiScontrino) []byte {
+	var b bytes.Buffer
+	b.Write(escposInizializza)
+	b.Write(escposCodePage1252)
+
+	for _, r := range componi(d) {
+		if r.grassetto {
+			b.Write(escposGrassettoOn)
+		}
+		b.Write(cp1252(r.testo))
+		b.WriteByte('\n')
+		if r.grassetto {
+			b.Write(escposGrassettoOff)
+		}
+	}
+
+	b.Write(escposAvanzaRighe)
+	b.Write(escposTaglioParziale)
+	return b.Bytes()
+}
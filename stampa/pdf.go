@@ -0,0 +1,85 @@
+package stampa
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Impaginazione del PDF: una sola pagina larga quanto uno scontrino da 80 mm,
+// alta quanto serve per contenere tutte le righe, con font a spaziatura fissa
+const (
+	pdfDimensioneFont = 9.0
+	pdfInterlinea     = 11.0
+	pdfMargine        = 14.0
+	// Larghezza di un carattere Courier: 0,6 volte la dimensione del font
+	pdfLarghezzaCarattere = pdfDimensioneFont * 0.6
+)
+
+// PDF restituisce lo scontrino come documento PDF di una pagina
+// Il documento usa i font standard Courier e Courier-Bold, quindi non richiede font incorporati
+func PDF(d DatiScontrino) []byte {
+	righe := componi(d)
+	larghezza := LarghezzaScontrino*pdfLarghezzaCarattere + 2*pdfMargine
+	altezza := float64(len(righe))*pdfInterlinea + 2*pdfMargine
+
+	// Contenuto della pagina
+	var contenuto bytes.Buffer
+	fmt.Fprintf(&contenuto, "BT\n%.2f TL\n%.2f %.2f Td\n", pdfInterlinea, pdfMargine, altezza-pdfMargine-pdfDimensioneFont)
+	for _, r := range righe {
+		font := "F1"
+		if r.grassetto {
+			font = "F2"
+		}
+		fmt.Fprintf(&contenuto, "/%s %.0f Tf\n", font, pdfDimensioneFont)
+		contenuto.WriteByte('(')
+		contenuto.Write(stringaPDF(r.testo))
+		contenuto.WriteString(") Tj T*\n")
+	}
+	contenuto.WriteString("ET\n")
+
+	oggetti := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] "+
+			"/Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> /Contents 4 0 R >>", larghezza, altezza),
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", contenuto.Len(), contenuto.String()),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+	}
+
+	// Scrive gli oggetti ricordando la posizione di ciascuno per la tabella xref
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	posizioni := make([]int, len(oggetti))
+	for i, oggetto := range oggetti {
+		posizioni[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, oggetto)
+	}
+
+	inizioXref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(oggetti)+1)
+	for _, posizione := range posizioni {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", posizione)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(oggetti)+1, inizioXref)
+
+	return pdf.Bytes()
+}
+
+// stringaPDF codifica il testo come stringa letterale PDF: converte in Windows-1252,
+// applica l'escape a parentesi e barre rovesciate e scrive in ottale i byte non ASCII
+func stringaPDF(testo string) []byte {
+	var b bytes.Buffer
+	for _, c := range cp1252(testo) {
+		switch {
+		case c == '(' || c == ')' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c >= 0x80:
+			fmt.Fprintf(&b, "\\%03o", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.Bytes()
+}
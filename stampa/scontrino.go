@@ -0,0 +1,233 @@
+// Package stampa genera le versioni stampabili dello scontrino:
+// testo a larghezza fissa, PDF e comandi ESC/POS per le stampanti termiche
+package stampa
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"ristorante-api/models"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Formati di stampa dello scontrino
+const (
+	FormatoJSON   = "json"
+	FormatoTesto  = "text"
+	FormatoPDF    = "pdf"
+	FormatoESCPOS = "escpos"
+)
+
+// LarghezzaScontrino è il numero di colonne dello scontrino (stampanti termiche da 80 mm)
+const LarghezzaScontrino = 42
+
+// ErrFormatoNonSupportato è restituito quando il formato richiesto non è tra quelli disponibili
+var ErrFormatoNonSupportato = errors.New("formato dello scontrino non supportato (json, text, pdf, escpos)")
+
+// DatiScontrino raccoglie quanto serve per stampare lo scontrino di un ordine
+type DatiScontrino struct {
+	NomeRistorante string
+	Scontrino      models.Scontrino
+	Ordine         models.OrdineCompleto
+}
+
+// riga è una riga dello scontrino già impaginata alla larghezza dello scontrino
+type riga struct {
+	testo     string
+	grassetto bool
+}
+
+// FormatoRichiesto determina il formato dello scontrino dal parametro ?format=
+// o, in sua assenza, dall'intestazione Accept. Il formato predefinito è JSON
+func FormatoRichiesto(formato string, accept string) (string, error) {
+	switch strings.ToLower(formato) {
+	case "":
+	case FormatoJSON, FormatoTesto, FormatoPDF, FormatoESCPOS:
+		return strings.ToLower(formato), nil
+	case "txt":
+		return FormatoTesto, nil
+	default:
+		return "", ErrFormatoNonSupportato
+	}
+
+	for _, parte := range strings.Split(accept, ",") {
+		tipo, _, err := mime.ParseMediaType(strings.TrimSpace(parte))
+		if err != nil {
+			continue
+		}
+		switch tipo {
+		case "application/json":
+			return FormatoJSON, nil
+		case "text/plain":
+			return FormatoTesto, nil
+		case "application/pdf":
+			return FormatoPDF, nil
+		case "application/vnd.escpos", "application/octet-stream":
+			return FormatoESCPOS, nil
+		}
+	}
+	return FormatoJSON, nil
+}
+
+// ContentType restituisce il tipo MIME del formato indicato
+func ContentType(formato string) string {
+	switch formato {
+	case FormatoTesto:
+		return "text/plain; charset=utf-8"
+	case FormatoPDF:
+		return "application/pdf"
+	case FormatoESCPOS:
+		return "application/vnd.escpos"
+	default:
+		return "application/json"
+	}
+}
+
+// Genera restituisce lo scontrino nel formato indicato (text, pdf o escpos)
+func Genera(formato string, d DatiScontrino) ([]byte, error) {
+	switch formato {
+	case FormatoTesto:
+		return Testo(d), nil
+	case FormatoPDF:
+		return PDF(d), nil
+	case FormatoESCPOS:
+		return ESCPOS(d), nil
+	default:
+		return nil, ErrFormatoNonSupportato
+	}
+}
+
+// Testo restituisce lo scontrino come testo a larghezza fissa
+func Testo(d DatiScontrino) []byte {
+	var b strings.Builder
+	for _, r := range componi(d) {
+		b.WriteString(r.testo)
+		b.WriteByte('\n')
+	}
+	return []byte(b.String())
+}
+
+// componi impagina lo scontrino: intestazione, voci dell'ordine (con i menu fissi raggruppati),
+// sconti, servizio, coperto, totale e riepilogo IVA
+func componi(d DatiScontrino) []riga {
+	s := d.Scontrino
+	separatore := riga{testo: strings.Repeat("-", LarghezzaScontrino)}
+
+	righe := []riga{
+		{testo: centra(d.NomeRistorante), grassetto: true},
+		separatore,
+		{testo: affianca(fmt.Sprintf("Ordine n. %d", s.IDOrdine), fmt.Sprintf("Tavolo %d", s.IDTavolo))},
+		{testo: s.DataOrdine.Format("02/01/2006 15:04")},
+		separatore,
+	}
+
+	// Pietanze alla carta
+	for _, p := range d.Ordine.Pietanze {
+		descrizione := fmt.Sprintf("%d x %s", p.Quantita, p.Pietanza.Nome)
+		righe = append(righe, riga{testo: affianca(descrizione, p.Pietanza.Prezzo.Per(p.Quantita).String())})
+	}
+
+	// Menu fissi, ciascuno seguito dalle pietanze che lo compongono
+	menuFissi := make([]models.DettaglioMenuFisso, len(d.Ordine.MenuFissi))
+	copy(menuFissi, d.Ordine.MenuFissi)
+	sort.Slice(menuFissi, func(i, j int) bool { return menuFissi[i].Menu.ID < menuFissi[j].Menu.ID })
+	for _, m := range menuFissi {
+		// Una pietanza può stare su più righe, una per versione della ricetta:
+		// il numero di menu è la massima quantità complessiva di una pietanza
+		quantita := 1
+		perPietanza := make(map[int]int)
+		var pietanze []models.Pietanza
+		for _, p := range m.Pietanze {
+			if _, ok := perPietanza[p.Pietanza.ID]; !ok {
+				pietanze = append(pietanze, p.Pietanza)
+			}
+			perPietanza[p.Pietanza.ID] += p.Quantita
+			quantita = max(quantita, perPietanza[p.Pietanza.ID])
+		}
+		descrizione := fmt.Sprintf("%d x %s", quantita, m.Menu.Nome)
+		righe = append(righe, riga{testo: affianca(descrizione, m.Menu.Prezzo.Per(quantita).String())})
+		for _, p := range pietanze {
+			righe = append(righe, riga{testo: tronca("    - " + p.Nome)})
+		}
+	}
+
+	righe = append(righe, separatore, riga{testo: affianca("Subtotale", s.CostoTotale.String())})
+	for _, v := range s.Sconti {
+		righe = append(righe, riga{testo: affianca(v.Descrizione, v.Importo.String())})
+	}
+	if s.NumCoperti > 0 {
+		coperto := fmt.Sprintf("Coperto %d x %s", s.NumCoperti, s.CostoCoperto)
+		righe = append(righe, riga{testo: affianca(coperto, s.ImportoCoperto.String())})
+	}
+	righe = append(righe,
+		riga{testo: strings.Repeat("=", LarghezzaScontrino)},
+		riga{testo: affianca("TOTALE EUR", s.TotaleComplessivo.String()), grassetto: true},
+		separatore,
+	)
+
+	// Riepilogo IVA per aliquota
+	if len(s.IVA) > 0 {
+		righe = append(righe, riga{testo: colonne("IVA", "Imponibile", "Imposta", "Totale")})
+		for _, iva := range s.IVA {
+			righe = append(righe, riga{testo: colonne(iva.Aliquota.String()+"%",
+				iva.Imponibile.String(), iva.Imposta.String(), iva.Totale.String())})
+		}
+		righe = append(righe,
+			riga{testo: affianca("Totale imponibile", s.TotaleImponibile.String())},
+			riga{testo: affianca("Totale IVA", s.TotaleImposta.String())},
+			separatore,
+		)
+	}
+
+	righe = append(righe, riga{testo: centra("Grazie e arrivederci")})
+	return righe
+}
+
+// affianca allinea la descrizione a sinistra e l'importo a destra, troncando la descrizione se necessario
+func affianca(sinistra string, destra string) string {
+	spazio := LarghezzaScontrino - utf8.RuneCountInString(destra) - 1
+	sinistra = troncaA(sinistra, spazio)
+	return sinistra + strings.Repeat(" ", LarghezzaScontrino-utf8.RuneCountInString(sinistra)-utf8.RuneCountInString(destra)) + destra
+}
+
+// colonne impagina le quattro colonne del riepilogo IVA
+func colonne(aliquota, imponibile, imposta, totale string) string {
+	return fmt.Sprintf("%-9s%12s%10s%11s", aliquota, imponibile, imposta, totale)
+}
+
+// centra centra il testo sulla larghezza dello scontrino
+func centra(testo string) string {
+	testo = tronca(testo)
+	return strings.Repeat(" ", (LarghezzaScontrino-utf8.RuneCountInString(testo))/2) + testo
+}
+
+// tronca limita il testo alla larghezza dello scontrino
+func tronca(testo string) string {
+	return troncaA(testo, LarghezzaScontrino)
+}
+
+func troncaA(testo string, larghezza int) string {
+	if utf8.RuneCountInString(testo) <= larghezza {
+		return testo
+	}
+	return string([]rune(testo)[:larghezza])
+}
+
+// cp1252 converte il testo nella codifica Windows-1252, usata sia dai font standard
+// dei PDF sia dalle stampanti ESC/POS; i caratteri non rappresentabili diventano "?"
+func cp1252(testo string) []byte {
+	b := make([]byte, 0, len(testo))
+	for _, r := range testo {
+		switch {
+		case r < 0x80, r >= 0xA0 && r <= 0xFF:
+			b = append(b, byte(r))
+		case r == '€':
+			b = append(b, 0x80)
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
@@ -0,0 +1,125 @@
+package stampa
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"ristorante-api/models"
+	"testing"
+	"time"
+)
+
+// Con -update i file di riferimento in testdata vengono riscritti con l'output attuale:
+// go test ./stampa/ -update
+var aggiorna = flag.Bool("update", false, "riscrive i file di riferimento in testdata")
+
+// scontrinoDiProva è uno scontrino fisso con pietanze alla carta, un menu fisso (con una pietanza
+// su due righe per due versioni della ricetta), uno sconto, il coperto e due aliquote IVA
+func scontrinoDiProva() DatiScontrino {
+	idMenu := 2
+	codice := "PRANZO10"
+	return DatiScontrino{
+		NomeRistorante: "Trattoria Da Mario (Centro)",
+		Scontrino: models.Scontrino{
+			IDOrdine:          42,
+			IDTavolo:          7,
+			DataOrdine:        time.Date(2024, time.June, 14, 20, 35, 0, 0, time.UTC),
+			CostoTotale:       6250,
+			Sconti:            []models.VoceScontrino{{IDSconto: 1, Descrizione: "Sconto pranzo (10.00%)", Tipo: "percentuale", Codice: &codice, Importo: -625}},
+			ImportoSconti:     625,
+			NumCoperti:        2,
+			CostoCoperto:      250,
+			ImportoCoperto:    500,
+			TotaleComplessivo: 6125,
+			IVA: []models.RiepilogoIVA{
+				{Aliquota: 1000, Imponibile: 5159, Imposta: 516, Totale: 5675},
+				{Aliquota: 2200, Imponibile: 369, Imposta: 81, Totale: 450},
+			},
+			TotaleImponibile: 5528,
+			TotaleImposta:    597,
+		},
+		Ordine: models.OrdineCompleto{
+			Pietanze: []models.DettaglioPietanza{
+				{ID: 1, Pietanza: models.Pietanza{ID: 10, Nome: "Spaghetti alla carbonara", Prezzo: 1200}, Quantita: 2},
+				{ID: 2, Pietanza: models.Pietanza{ID: 11, Nome: "Caffè", Prezzo: 150}, Quantita: 3},
+				{ID: 3, Pietanza: models.Pietanza{ID: 12, Nome: "Tagliata di manzo con rucola, grana e aceto balsamico", Prezzo: 1800}, Quantita: 1},
+			},
+			MenuFissi: []models.DettaglioMenuFisso{{
+				Menu: models.MenuFisso{ID: idMenu, Nome: "Menu del giorno", Prezzo: 800},
+				Pietanze: []models.DettaglioPietanza{
+					{ID: 4, Pietanza: models.Pietanza{ID: 13, Nome: "Lasagne"}, Quantita: 1, ParteDiMenu: true, IDMenu: &idMenu},
+					{ID: 5, Pietanza: models.Pietanza{ID: 14, Nome: "Tiramisù"}, Quantita: 2, ParteDiMenu: true, IDMenu: &idMenu},
+					{ID: 6, Pietanza: models.Pietanza{ID: 13, Nome: "Lasagne"}, Quantita: 1, ParteDiMenu: true, IDMenu: &idMenu},
+				},
+			}},
+		},
+	}
+}
+
+func TestGeneraGolden(t *testing.T) {
+	tests := []struct {
+		formato string
+		file    string
+	}{
+		{FormatoTesto, "scontrino.txt"},
+		{FormatoPDF, "scontrino.pdf"},
+		{FormatoESCPOS, "scontrino.escpos"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.formato, func(t *testing.T) {
+			got, err := Genera(tt.formato, scontrinoDiProva())
+			if err != nil {
+				t.Fatalf("Genera(%q) errore: %v", tt.formato, err)
+			}
+
+			percorso := filepath.Join("testdata", tt.file)
+			if *aggiorna {
+				if err := os.WriteFile(percorso, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			atteso, err := os.ReadFile(percorso)
+			if err != nil {
+				t.Fatalf("lettura di %s: %v (rigenerare con -update)", percorso, err)
+			}
+			if !bytes.Equal(got, atteso) {
+				t.Errorf("Genera(%q) differisce da %s (rigenerare con -update se la modifica è voluta)\n--- ottenuto ---\n%q\n--- atteso ---\n%q",
+					tt.formato, percorso, got, atteso)
+			}
+		})
+	}
+}
+
+func TestTestoLarghezza(t *testing.T) {
+	for _, r := range componi(scontrinoDiProva()) {
+		if n := len([]rune(r.testo)); n > LarghezzaScontrino {
+			t.Errorf("riga di %d colonne oltre la larghezza dello scontrino: %q", n, r.testo)
+		}
+	}
+}
+
+func TestFormatoRichiesto(t *testing.T) {
+	tests := []struct {
+		formato, accept string
+		atteso          string
+	}{
+		{"", "", FormatoJSON},
+		{"text", "", FormatoTesto},
+		{"TXT", "", FormatoTesto},
+		{"pdf", "text/plain", FormatoPDF},
+		{"", "application/pdf", FormatoPDF},
+		{"", "text/plain; charset=utf-8", FormatoTesto},
+		{"", "image/png, application/vnd.escpos", FormatoESCPOS},
+		{"", "*/*", FormatoJSON},
+	}
+	for _, tt := range tests {
+		got, err := FormatoRichiesto(tt.formato, tt.accept)
+		if err != nil || got != tt.atteso {
+			t.Errorf("FormatoRichiesto(%q, %q) = %q, %v; atteso %q", tt.formato, tt.accept, got, err, tt.atteso)
+		}
+	}
+	if _, err := FormatoRichiesto("xml", ""); err != ErrFormatoNonSupportato {
+		t.Errorf("FormatoRichiesto(\"xml\") errore = %v, atteso ErrFormatoNonSupportato", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Package unita gestisce le unità di misura degli ingredienti e delle ricette
+// e la conversione delle quantità tra unità della stessa dimensione
+package unita
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Dimensioni delle unità di misura; si convertono tra loro solo unità della stessa dimensione,
+// oppure unità a pezzi e a peso quando è noto il peso di un pezzo dell'ingrediente
+const (
+	Massa    = "massa"
+	Volume   = "volume"
+	Pezzi    = "pezzi"
+	Mazzetti = "mazzetti"
+)
+
+// Errori di validazione e conversione
+var (
+	ErrUnitaSconosciuta   = errors.New("unità di misura sconosciuta")
+	ErrUnitaIncompatibili = errors.New("unità di misura non convertibili")
+)
+
+// Unita è un'unità di misura con il fattore rispetto all'unità base della sua dimensione
+// (grammo per la massa, millilitro per il volume, singolo pezzo per i conteggi)
+type Unita struct {
+	Simbolo    string
+	Dimensione string
+	Fattore    float64
+}
+
+// AConteggio indica le unità che contano pezzi (pezzi, mazzetti), convertibili a peso con il peso per pezzo
+func (u Unita) AConteggio() bool {
+	return u.Dimensione == Pezzi || u.Dimensione == Mazzetti
+}
+
+var (
+	grammo      = Unita{Simbolo: "g", Dimensione: Massa, Fattore: 1}
+	chilogrammo = Unita{Simbolo: "kg", Dimensione: Massa, Fattore: 1000}
+	millilitro  = Unita{Simbolo: "ml", Dimensione: Volume, Fattore: 1}
+	centilitro  = Unita{Simbolo: "cl", Dimensione: Volume, Fattore: 10}
+	litro       = Unita{Simbolo: "l", Dimensione: Volume, Fattore: 1000}
+	pezzo       = Unita{Simbolo: "pz", Dimensione: Pezzi, Fattore: 1}
+	mazzetto    = Unita{Simbolo: "mazzetti", Dimensione: Mazzetti, Fattore: 1}
+)
+
+// conosciute associa simboli e nomi in uso (anche al plurale) all'unità corrispondente
+var conosciute = map[string]Unita{
+	"g":           grammo,
+	"gr":          grammo,
+	"grammi":      grammo,
+	"kg":          chilogrammo,
+	"chilogrammi": chilogrammo,
+	"ml":          millilitro,
+	"millilitri":  millilitro,
+	"cl":          centilitro,
+	"l":           litro,
+	"lt":          litro,
+	"litro":       litro,
+	"litri":       litro,
+	"pz":          pezzo,
+	"pezzo":       pezzo,
+	"pezzi":       pezzo,
+	"unita":       pezzo,
+	"unità":       pezzo,
+	"mazzetto":    mazzetto,
+	"mazzetti":    mazzetto,
+}
+
+// Cerca restituisce l'unità di misura indicata dal simbolo o dal nome, senza distinguere maiuscole e spazi
+func Cerca(simbolo string) (Unita, error) {
+	u, ok := conosciute[strings.ToLower(strings.TrimSpace(simbolo))]
+	if !ok {
+		return Unita{}, fmt.Errorf("%w: %q", ErrUnitaSconosciuta, simbolo)
+	}
+	return u, nil
+}
+
+// Converti esprime la quantità dall'unità da all'unità a
+// pesoPezzo è il peso in grammi di un pezzo dell'ingrediente (zero se non noto) e consente
+// di passare dalle unità a conteggio a quelle di massa e viceversa
+func Converti(quantita float64, da, a string, pesoPezzo float64) (float64, error) {
+	if da == a {
+		return quantita, nil
+	}
+	uDa, err := Cerca(da)
+	if err != nil {
+		return 0, err
+	}
+	uA, err := Cerca(a)
+	if err != nil {
+		return 0, err
+	}
+
+	switch {
+	case uDa.Dimensione == uA.Dimensione:
+		return quantita * uDa.Fattore / uA.Fattore, nil
+	case pesoPezzo > 0 && uDa.AConteggio() && uA.Dimensione == Massa:
+		return quantita * uDa.Fattore * pesoPezzo / uA.Fattore, nil
+	case pesoPezzo > 0 && uDa.Dimensione == Massa && uA.AConteggio():
+		return quantita * uDa.Fattore / pesoPezzo / uA.Fattore, nil
+	}
+	return 0, fmt.Errorf("%w: da %s a %s", ErrUnitaIncompatibili, da, a)
+}
+
+// Convertibili verifica che le quantità espresse nell'unità da si possano convertire nell'unità a
+func Convertibili(da, a string, pesoPezzo float64) error {
+	_, err := Converti(1, da, a, pesoPezzo)
+	return err
+}
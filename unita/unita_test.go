@@ -0,0 +1,87 @@
+package unita
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestConverti(t *testing.T) {
+	tests := []struct {
+		name      string
+		quantita  float64
+		da, a     string
+		pesoPezzo float64
+		atteso    float64
+	}{
+		{"stessa unità", 2.5, "kg", "kg", 0, 2.5},
+		{"sinonimi", 300, "gr", "g", 0, 300},
+		{"maiuscole e spazi", 1, " KG ", "g", 0, 1000},
+		{"chilogrammi in grammi", 1.5, "kg", "g", 0, 1500},
+		{"grammi in chilogrammi", 250, "g", "kg", 0, 0.25},
+		{"litri in millilitri", 0.75, "l", "ml", 0, 750},
+		{"centilitri in litri", 33, "cl", "l", 0, 0.33},
+		{"millilitri in centilitri", 200, "ml", "cl", 0, 20},
+		{"pezzi in grammi", 3, "pz", "g", 60, 180},
+		{"pezzi in chilogrammi", 10, "pezzi", "kg", 150, 1.5},
+		{"grammi in pezzi", 180, "g", "pz", 60, 3},
+		{"chilogrammi in pezzi", 1.2, "kg", "pz", 200, 6},
+		{"mazzetti in grammi", 2, "mazzetti", "g", 25, 50},
+		{"pezzi", 4, "unità", "pz", 0, 4},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Converti(tt.quantita, tt.da, tt.a, tt.pesoPezzo)
+			if err != nil {
+				t.Fatalf("Converti(%g, %q, %q, %g) errore: %v", tt.quantita, tt.da, tt.a, tt.pesoPezzo, err)
+			}
+			if math.Abs(got-tt.atteso) > 1e-9 {
+				t.Errorf("Converti(%g, %q, %q, %g) = %g, atteso %g", tt.quantita, tt.da, tt.a, tt.pesoPezzo, got, tt.atteso)
+			}
+		})
+	}
+}
+
+func TestConvertiErrori(t *testing.T) {
+	tests := []struct {
+		name      string
+		da, a     string
+		pesoPezzo float64
+		errore    error
+	}{
+		{"unità di partenza sconosciuta", "tazze", "g", 0, ErrUnitaSconosciuta},
+		{"unità di arrivo sconosciuta", "g", "once", 0, ErrUnitaSconosciuta},
+		{"massa e volume", "g", "ml", 0, ErrUnitaIncompatibili},
+		{"volume e pezzi", "l", "pz", 100, ErrUnitaIncompatibili},
+		{"pezzi senza peso per pezzo", "pz", "g", 0, ErrUnitaIncompatibili},
+		{"grammi in pezzi senza peso per pezzo", "g", "pz", 0, ErrUnitaIncompatibili},
+		{"pezzi e mazzetti", "pz", "mazzetti", 50, ErrUnitaIncompatibili},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Converti(1, tt.da, tt.a, tt.pesoPezzo)
+			if !errors.Is(err, tt.errore) {
+				t.Errorf("Converti(1, %q, %q, %g) errore = %v, atteso %v", tt.da, tt.a, tt.pesoPezzo, err, tt.errore)
+			}
+			if err := Convertibili(tt.da, tt.a, tt.pesoPezzo); !errors.Is(err, tt.errore) {
+				t.Errorf("Convertibili(%q, %q, %g) errore = %v, atteso %v", tt.da, tt.a, tt.pesoPezzo, err, tt.errore)
+			}
+		})
+	}
+}
+
+func TestCerca(t *testing.T) {
+	u, err := Cerca("Litri")
+	if err != nil {
+		t.Fatalf("Cerca(\"Litri\") errore: %v", err)
+	}
+	if u.Simbolo != "l" || u.Dimensione != Volume || u.Fattore != 1000 {
+		t.Errorf("Cerca(\"Litri\") = %+v, atteso litro", u)
+	}
+	if u.AConteggio() {
+		t.Errorf("il litro non è un'unità a conteggio")
+	}
+	if _, err := Cerca(""); !errors.Is(err, ErrUnitaSconosciuta) {
+		t.Errorf("Cerca(\"\") errore = %v, atteso ErrUnitaSconosciuta", err)
+	}
+}